@@ -0,0 +1,355 @@
+package influxdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdb/influxdb/influxql"
+	"github.com/influxdb/influxdb/messaging"
+)
+
+const (
+	// DefaultAuditMaxSize is the default size of the audit log before it is rotated.
+	DefaultAuditMaxSize = 100 * 1024 * 1024 // 100MB
+
+	// DefaultAuditMaxBackups is the default number of rotated audit logs kept.
+	DefaultAuditMaxBackups = 5
+)
+
+// Audit event types.
+const (
+	// AuditCommand is the event of a broadcast command being applied to the server.
+	AuditCommand = "command"
+
+	// AuditStatement is the event of a user executing an administrative statement.
+	AuditStatement = "statement"
+
+	// AuditAuthentication is the event of a user failing to authenticate.
+	AuditAuthentication = "authentication"
+
+	// AuditAuthorization is the event of a user not being authorized to execute a query.
+	AuditAuthorization = "authorization"
+)
+
+// redacted replaces passwords in the audit log.
+const redacted = "[REDACTED]"
+
+// auditCommandNames are the names of the broadcast commands written to the audit log.
+var auditCommandNames = map[messaging.MessageType]string{
+	deleteDataNodeMessageType:            "deleteDataNode",
+	createDatabaseMessageType:            "createDatabase",
+	dropDatabaseMessageType:              "dropDatabase",
+	createRetentionPolicyMessageType:     "createRetentionPolicy",
+	updateRetentionPolicyMessageType:     "updateRetentionPolicy",
+	deleteRetentionPolicyMessageType:     "deleteRetentionPolicy",
+	setDefaultRetentionPolicyMessageType: "setDefaultRetentionPolicy",
+	createUserMessageType:                "createUser",
+	updateUserMessageType:                "updateUser",
+	deleteUserMessageType:                "deleteUser",
+	unlockUserMessageType:                "unlockUser",
+	deleteShardGroupMessageType:          "deleteShardGroup",
+	dropSeriesMessageType:                "dropSeries",
+	dropMeasurementMessageType:           "dropMeasurement",
+	createContinuousQueryMessageType:     "createContinuousQuery",
+	dropContinuousQueryMessageType:       "dropContinuousQuery",
+	setPrivilegeMessageType:              "setPrivilege",
+	createRoleMessageType:                "createRole",
+	dropRoleMessageType:                  "dropRole",
+	setRolePrivilegeMessageType:          "setRolePrivilege",
+	grantRoleMessageType:                 "grantRole",
+	revokeRoleMessageType:                "revokeRole",
+	createTokenMessageType:               "createToken",
+	dropTokenMessageType:                 "dropToken",
+}
+
+// AuditEvent represents an entry in the audit log.
+type AuditEvent struct {
+	Time  time.Time `json:"time"`
+	Event string    `json:"event"`
+
+	// The applied broadcast command, for command events.
+	Index   uint64          `json:"index,omitempty"`
+	Command string          `json:"command,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+
+	// The statement executed and the user executing it.
+	Statement string `json:"statement,omitempty"`
+	Database  string `json:"database,omitempty"`
+	User      string `json:"user,omitempty"`
+	Addr      string `json:"addr,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// commandOrigin is the user and remote address of the statement that broadcast a command.
+// It's encoded along with the command so every server can write it to its audit log.
+type commandOrigin struct {
+	User string `json:"user,omitempty"`
+	Addr string `json:"addr,omitempty"`
+}
+
+// newCommandOrigin returns the origin of commands broadcast by a user's statements.
+func newCommandOrigin(user *User, addr string) *commandOrigin {
+	o := &commandOrigin{Addr: addr}
+	if user != nil {
+		o.User = user.Name
+	}
+	return o
+}
+
+// encode adds the origin to an encoded command. The command is returned unchanged if o is nil.
+func (o *commandOrigin) encode(data []byte) ([]byte, error) {
+	if o == nil || len(data) < 2 || data[0] != '{' {
+		return data, nil
+	}
+	b, err := json.Marshal(o)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 0, len(data)+len(b)+11)
+	buf = append(buf, `{"origin":`...)
+	buf = append(buf, b...)
+	if len(data) > 2 {
+		buf = append(buf, ',')
+	}
+	return append(buf, data[1:]...), nil
+}
+
+// AuditLog writes audit events as JSON lines to a file. The file is rotated
+// once it reaches a maximum size.
+type AuditLog struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+	size int64
+
+	// Size of the file before it is rotated. Zero disables rotation.
+	MaxSize int64
+
+	// Number of rotated files kept, named path.1 (most recent) to path.N.
+	MaxBackups int
+}
+
+// OpenAuditLog opens an audit log, appending to the file at path.
+func OpenAuditLog(path string) (*AuditLog, error) {
+	l := &AuditLog{
+		path:       path,
+		MaxSize:    DefaultAuditMaxSize,
+		MaxBackups: DefaultAuditMaxBackups,
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// open opens the log file and reads its current size.
+func (l *AuditLog) open() error {
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	l.f, l.size = f, fi.Size()
+	return nil
+}
+
+// Path returns the path of the current log file.
+func (l *AuditLog) Path() string { return l.path }
+
+// Close closes the log file.
+func (l *AuditLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
+
+// Write appends an event to the log, rotating the file first if needed.
+// The event's time is set if it is zero.
+func (l *AuditLog) Write(e *AuditEvent) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return fmt.Errorf("audit log closed")
+	}
+
+	if l.MaxSize > 0 && l.size > 0 && l.size+int64(len(b)) > l.MaxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := l.f.Write(b)
+	l.size += int64(n)
+	return err
+}
+
+// rotate shifts the rotated files, moves the current file to path.1 and starts a new one.
+// The oldest file is removed once there are more than MaxBackups.
+func (l *AuditLog) rotate() error {
+	if err := l.f.Close(); err != nil {
+		return err
+	}
+	l.f = nil
+
+	if l.MaxBackups > 0 {
+		_ = os.Remove(fmt.Sprintf("%s.%d", l.path, l.MaxBackups))
+		for i := l.MaxBackups - 1; i > 0; i-- {
+			_ = os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+		}
+		if err := os.Rename(l.path, l.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(l.path); err != nil {
+		return err
+	}
+
+	return l.open()
+}
+
+// Audit writes an event to the server's audit log, if it has one.
+func (s *Server) Audit(e *AuditEvent) {
+	if s.AuditLog == nil {
+		return
+	}
+	if err := s.AuditLog.Write(e); err != nil {
+		s.Logger.Printf("audit log: %s", err)
+	}
+}
+
+// commandAuditEvent returns the audit event of an applied broadcast command and its result.
+// Returns nil if the command isn't audited. The event is written by the caller, outside of
+// the server lock.
+func (s *Server) commandAuditEvent(m *messaging.Message, err error) *AuditEvent {
+	name, ok := auditCommandNames[m.Type]
+	if !ok || s.AuditLog == nil {
+		return nil
+	}
+
+	var c struct {
+		Origin *commandOrigin `json:"origin"`
+	}
+	_ = json.Unmarshal(m.Data, &c)
+
+	e := &AuditEvent{Time: time.Now().UTC(), Event: AuditCommand, Index: m.Index, Command: name, Data: redactCommand(m.Data)}
+	if c.Origin != nil {
+		e.User, e.Addr = c.Origin.User, c.Origin.Addr
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	return e
+}
+
+// auditStatement writes an executed administrative statement and its result to the audit log.
+// Statements only reading data or meta data aren't written.
+func (s *Server) auditStatement(stmt influxql.Statement, database string, user *User, addr string, err error) {
+	if s.AuditLog == nil {
+		return
+	}
+
+	switch stmt := stmt.(type) {
+	case *influxql.SelectStatement:
+		// Only select statements writing into a measurement are audited.
+		if stmt.Target == nil {
+			return
+		}
+	case *influxql.ExplainStatement, *influxql.ShowContinuousQueriesStatement, *influxql.ShowServersStatement,
+		*influxql.ShowDatabasesStatement, *influxql.ShowFieldKeysStatement, *influxql.ShowGrantsForUserStatement,
+		*influxql.ShowRetentionPoliciesStatement, *influxql.ShowRolesStatement, *influxql.ShowMeasurementsStatement,
+		*influxql.ShowSeriesStatement, *influxql.ShowStatsStatement, *influxql.ShowDiagnosticsStatement,
+		*influxql.ShowTagKeysStatement, *influxql.ShowTagValuesStatement, *influxql.ShowTokensStatement,
+		*influxql.ShowUsersStatement:
+		return
+	}
+
+	e := &AuditEvent{Event: AuditStatement, Statement: redactStatement(stmt).String(), Database: database, Addr: addr}
+	if user != nil {
+		e.User = user.Name
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	s.Audit(e)
+}
+
+// auditAuthorization writes a query a user wasn't authorized to execute to the audit log.
+func (s *Server) auditAuthorization(q *influxql.Query, database string, user *User, addr string, err error) {
+	if s.AuditLog == nil {
+		return
+	}
+
+	var a []string
+	for _, stmt := range q.Statements {
+		a = append(a, redactStatement(stmt).String())
+	}
+
+	e := &AuditEvent{Event: AuditAuthorization, Statement: strings.Join(a, "; "), Database: database, Addr: addr, Error: err.Error()}
+	if user != nil {
+		e.User = user.Name
+	}
+	s.Audit(e)
+}
+
+// redactCommand returns the encoded command with any password or hash replaced.
+// The origin of the command is removed as it's written to the event itself.
+func redactCommand(data []byte) json.RawMessage {
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return json.RawMessage(data)
+	}
+
+	var changed bool
+	for _, k := range []string{"password", "hash"} {
+		if _, ok := m[k]; ok {
+			m[k] = redacted
+			changed = true
+		}
+	}
+	if _, ok := m["origin"]; ok {
+		delete(m, "origin")
+		changed = true
+	}
+	if !changed {
+		return json.RawMessage(data)
+	}
+	return json.RawMessage(mustMarshalJSON(m))
+}
+
+// redactStatement returns a copy of statements containing passwords with the password replaced.
+func redactStatement(stmt influxql.Statement) influxql.Statement {
+	switch stmt := stmt.(type) {
+	case *influxql.CreateUserStatement:
+		other := *stmt
+		other.Password = redacted
+		return &other
+	case *influxql.SetPasswordUserStatement:
+		other := *stmt
+		other.Password = redacted
+		return &other
+	}
+	return stmt
+}
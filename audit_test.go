@@ -0,0 +1,126 @@
+package influxdb_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/influxdb/influxdb"
+	"github.com/influxdb/influxdb/test"
+)
+
+// Ensure the audit log records applied commands and administrative statements.
+func TestServer_AuditLog(t *testing.T) {
+	c := test.NewDefaultMessagingClient()
+	defer c.Close()
+	s := OpenServer(c)
+	defer s.Close()
+
+	path := filepath.Join(tempdir(t), "audit.log")
+	defer os.RemoveAll(filepath.Dir(path))
+	l, err := influxdb.OpenAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	s.AuditLog = l
+
+	s.CreateUser("admin", "admin", true)
+	s.SetAuthenticationEnabled(true)
+	defer s.SetAuthenticationEnabled(false)
+	admin := s.User("admin")
+
+	// Execute an administrative statement, a read only one and an unauthorized one.
+	results, err := s.ExecuteQuery(MustParseQuery(`CREATE USER jdoe WITH PASSWORD 'secret'; SHOW USERS`), "", nil, admin, "10.0.0.1:1234", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range results {
+	}
+	if _, err := s.ExecuteQuery(MustParseQuery(`DROP DATABASE foo`), "", nil, s.User("jdoe"), "10.0.0.2:1234", 0); err == nil {
+		t.Fatal("expected authorization error")
+	}
+
+	events := mustReadAuditLog(path)
+	if len(events) != 4 {
+		t.Fatalf("unexpected event count: %d", len(events))
+	}
+	if e := events[0]; e.Event != influxdb.AuditCommand || e.Command != "createUser" || e.Index == 0 || !strings.Contains(string(e.Data), `"username":"admin"`) || !strings.Contains(string(e.Data), `"password":"[REDACTED]"`) {
+		t.Fatalf("unexpected event: %#v", e)
+	}
+	if e := events[0]; e.User != "" || e.Addr != "" {
+		t.Fatalf("unexpected origin: %#v", e)
+	}
+	if e := events[1]; e.Event != influxdb.AuditCommand || e.Command != "createUser" || !strings.Contains(string(e.Data), `"username":"jdoe"`) || strings.Contains(string(e.Data), "secret") {
+		t.Fatalf("unexpected event: %#v", e)
+	} else if e.User != "admin" || e.Addr != "10.0.0.1:1234" || strings.Contains(string(e.Data), "origin") {
+		t.Fatalf("unexpected event: %#v", e)
+	}
+	if e := events[2]; e.Event != influxdb.AuditStatement || e.Statement != `CREATE USER jdoe WITH PASSWORD [REDACTED]` || e.User != "admin" || e.Addr != "10.0.0.1:1234" || e.Error != "" {
+		t.Fatalf("unexpected event: %#v", e)
+	}
+	if e := events[3]; e.Event != influxdb.AuditAuthorization || e.Statement != `DROP DATABASE foo` || e.User != "jdoe" || e.Addr != "10.0.0.2:1234" || e.Error == "" {
+		t.Fatalf("unexpected event: %#v", e)
+	}
+}
+
+// Ensure the audit log is rotated once it reaches its max size.
+func TestAuditLog_Rotate(t *testing.T) {
+	path := filepath.Join(tempdir(t), "audit.log")
+	defer os.RemoveAll(filepath.Dir(path))
+	l, err := influxdb.OpenAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	l.MaxSize = 100
+	l.MaxBackups = 2
+
+	// Each event is written to a new file, only the two last rotated files are kept.
+	for _, user := range []string{"a", "b", "c", "d"} {
+		if err := l.Write(&influxdb.AuditEvent{Event: influxdb.AuditAuthentication, User: user, Error: "invalid username or password"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for p, user := range map[string]string{path: "d", path + ".1": "c", path + ".2": "b"} {
+		if events := mustReadAuditLog(p); len(events) != 1 || events[0].User != user {
+			t.Fatalf("unexpected events in %s: %#v", p, events)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// tempdir returns a new temporary directory.
+func tempdir(t *testing.T) string {
+	path, err := ioutil.TempDir("", "influxdb-audit-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// mustReadAuditLog returns the events in an audit log file.
+func mustReadAuditLog(path string) (a []*influxdb.AuditEvent) {
+	f, err := os.Open(path)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		e := &influxdb.AuditEvent{}
+		if err := json.Unmarshal(scanner.Bytes(), e); err != nil {
+			panic(err)
+		}
+		a = append(a, e)
+	}
+	return a
+}
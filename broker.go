@@ -35,6 +35,10 @@ type Broker struct {
 	TriggerInterval     time.Duration
 	TriggerTimeout      time.Duration
 	TriggerFailurePause time.Duration
+
+	// HTTP transport used for requests to data nodes.
+	// Defaults to http.DefaultTransport if not set.
+	Transport http.RoundTripper
 }
 
 // NewBroker returns a new instance of a Broker with default values.
@@ -110,9 +114,12 @@ func (b *Broker) runContinuousQueries() {
 func (b *Broker) requestContinuousQueryProcessing(cqURL url.URL) error {
 	// Send request.
 	cqURL.Path = "/data/process_continuous_queries"
-	cqURL.Scheme = "http"
+	if cqURL.Scheme == "" {
+		cqURL.Scheme = "http"
+	}
 	client := &http.Client{
-		Timeout: DefaultDataNodeTimeout,
+		Transport: b.Transport,
+		Timeout:   DefaultDataNodeTimeout,
 	}
 	resp, err := client.Post(cqURL.String(), "application/octet-stream", nil)
 	if err != nil {
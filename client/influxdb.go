@@ -17,6 +17,10 @@ import (
 type Query struct {
 	Command  string
 	Database string
+
+	// Values of the bound parameters in the command, e.g. $host.
+	// Durations are passed as map[string]interface{}{"duration": "10m"}.
+	Params map[string]interface{}
 }
 
 // Config is used to specify what server to connect to.
@@ -68,6 +72,13 @@ func (c *Client) Query(q Query) (*Response, error) {
 	values := u.Query()
 	values.Set("q", q.Command)
 	values.Set("db", q.Database)
+	if len(q.Params) > 0 {
+		b, err := json.Marshal(q.Params)
+		if err != nil {
+			return nil, err
+		}
+		values.Set("params", string(b))
+	}
 	u.RawQuery = values.Encode()
 
 	req, err := http.NewRequest("GET", u.String(), nil)
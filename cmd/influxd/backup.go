@@ -24,6 +24,10 @@ type BackupCommand struct {
 
 	// Standard input/output, overridden for testing.
 	Stderr io.Writer
+
+	// HTTP transport used to download the snapshot.
+	// Set from the cluster TLS settings if a config file is passed.
+	transport http.RoundTripper
 }
 
 // NewBackupCommand returns a new instance of BackupCommand with default settings.
@@ -84,12 +88,28 @@ func (cmd *BackupCommand) Run(args ...string) error {
 func (cmd *BackupCommand) parseFlags(args []string) (url.URL, string, error) {
 	fs := flag.NewFlagSet("", flag.ContinueOnError)
 	host := fs.String("host", DefaultSnapshotURL.String(), "")
+	configPath := fs.String("config", "", "")
 	fs.SetOutput(cmd.Stderr)
 	fs.Usage = cmd.printUsage
 	if err := fs.Parse(args); err != nil {
 		return url.URL{}, "", err
 	}
 
+	// Use the node's cluster TLS settings, if enabled.
+	if *configPath != "" {
+		config, err := ParseConfigFile(*configPath)
+		if err != nil {
+			return url.URL{}, "", fmt.Errorf("parse config: %s", err)
+		}
+		if config.ClusterTLS.Enabled {
+			tlsConfig, err := config.ClusterTLS.TLSConfig()
+			if err != nil {
+				return url.URL{}, "", fmt.Errorf("cluster tls: %s", err)
+			}
+			cmd.transport = &http.Transport{TLSClientConfig: tlsConfig}
+		}
+	}
+
 	// Parse host.
 	u, err := url.Parse(*host)
 	if err != nil {
@@ -150,7 +170,7 @@ func (cmd *BackupCommand) download(u url.URL, ss *influxdb.Snapshot, path string
 	}
 
 	// Fetch the archive from the server.
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := (&http.Client{Transport: cmd.transport}).Do(req)
 	if err != nil {
 		return fmt.Errorf("get: %s", err)
 	}
@@ -178,5 +198,9 @@ backup downloads a snapshot of a data node and saves it to disk.
         -host <url>
                           The host to connect to snapshot.
                           Defaults to http://127.0.0.1:8087.
+
+        -config <path>
+                          The node's config file. If cluster TLS is enabled
+                          then its certificate is used to connect to the host.
 `)
 }
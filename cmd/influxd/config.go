@@ -1,8 +1,11 @@
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"net"
 	"net/url"
@@ -73,6 +76,31 @@ const (
 	// DefaultContinousQueryComputeNoMoreThan is ???
 	DefaultContinousQueryComputeNoMoreThan = 2 * time.Minute
 
+	// DefaultMaxGroupByBuckets is the default max number of GROUP BY time() intervals per series in a query
+	DefaultMaxGroupByBuckets = 100000
+
+	// DefaultAuditMaxSize is the default size of the audit log before it is rotated.
+	DefaultAuditMaxSize = 100 * 1024 * 1024 // 100MB
+
+	// DefaultAuditMaxBackups is the default number of rotated audit logs kept.
+	DefaultAuditMaxBackups = 5
+
+	// DefaultQueryCacheMaxSize is the default size of the cached query results.
+	DefaultQueryCacheMaxSize = 64 * 1024 * 1024 // 64MB
+
+	// DefaultMinPasswordLength is the default minimum length of user passwords.
+	DefaultMinPasswordLength = 1
+
+	// DefaultMaxFailedLogins is the default number of failed logins before a user is locked out.
+	// Users aren't locked out by default as anyone could otherwise lock out an admin.
+	DefaultMaxFailedLogins = 0
+
+	// DefaultMaxFailedLoginsPerHost is the default number of failed logins before a host is locked out.
+	DefaultMaxFailedLoginsPerHost = 20
+
+	// DefaultLoginLockout is the default duration failed logins are remembered and users and hosts locked out.
+	DefaultLoginLockout = 5 * time.Minute
+
 	// DefaultStatisticsEnabled is the default setting for whether internal statistics are collected
 	DefaultStatisticsEnabled = false
 
@@ -96,6 +124,49 @@ type Broker struct {
 	Dir     string   `toml:"dir"`
 	Enabled bool     `toml:"enabled"`
 	Timeout Duration `toml:"election-timeout"`
+
+	// Snapshot thresholds for the raft log. A snapshot of the broker is written
+	// once either threshold is reached since the last snapshot. Zero disables.
+	SnapshotEntryThreshold int  `toml:"snapshot-entry-threshold"`
+	SnapshotSizeThreshold  Size `toml:"snapshot-size-threshold"`
+}
+
+// ClusterTLS represents the TLS configuration for communication between nodes.
+// When enabled, the cluster port only serves HTTPS and requests to the broker,
+// raft and data node endpoints must present a client certificate signed by the CA.
+type ClusterTLS struct {
+	Enabled  bool   `toml:"enabled"`
+	CertPath string `toml:"cert"`
+	KeyPath  string `toml:"key"`
+	CAPath   string `toml:"ca"`
+}
+
+// TLSConfig returns the TLS configuration used by both the cluster listener
+// and the clients connecting to other nodes.
+func (c *ClusterTLS) TLSConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(c.CertPath, c.KeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("load key pair: %s", err)
+	}
+
+	buf, err := ioutil.ReadFile(c.CAPath)
+	if err != nil {
+		return nil, fmt.Errorf("read ca: %s", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(buf) {
+		return nil, fmt.Errorf("no certificates found in ca: %s", c.CAPath)
+	}
+
+	// Client certificates are verified if given so API requests can still be
+	// served when the API shares the cluster port. Cluster endpoints require one.
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		ClientCAs:    pool,
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
 }
 
 // Snapshot represents the configuration for a snapshot service. Snapshot configuration
@@ -104,6 +175,29 @@ type Snapshot struct {
 	Enabled bool `toml:"enabled"`
 }
 
+// Query represents the limits on the select statements run by a data node. Zero means no limit.
+type Query struct {
+	MaxSeries         int      `toml:"max-series"`
+	MaxPointsScanned  int      `toml:"max-points-scanned"`
+	MaxGroupByBuckets int      `toml:"max-group-by-buckets"`
+	Timeout           Duration `toml:"timeout"`
+
+	// Statements running for at least this long are logged. Zero disables the log.
+	SlowQueryThreshold Duration `toml:"slow-query-threshold"`
+
+	// Cache of aggregate results grouped by time.
+	CacheEnabled bool `toml:"cache-enabled"`
+	CacheMaxSize Size `toml:"cache-max-size"`
+}
+
+// Audit represents the configuration of the audit log of a data node.
+type Audit struct {
+	Enabled    bool   `toml:"enabled"`
+	Path       string `toml:"path"`
+	MaxSize    Size   `toml:"max-size"`
+	MaxBackups int    `toml:"max-backups"`
+}
+
 // Data represents the configuration for a data node
 type Data struct {
 	Dir                   string   `toml:"dir"`
@@ -135,6 +229,18 @@ type Config struct {
 
 	Authentication struct {
 		Enabled bool `toml:"enabled"`
+
+		// Password policy, it must be the same on all nodes.
+		MinPasswordLength      int  `toml:"min-password-length"`
+		PasswordRequireUpper   bool `toml:"password-require-upper"`
+		PasswordRequireLower   bool `toml:"password-require-lower"`
+		PasswordRequireDigit   bool `toml:"password-require-digit"`
+		PasswordRequireSpecial bool `toml:"password-require-special"`
+
+		// Lockout after repeated failed logins. Zero disables the limit.
+		MaxFailedLogins        int      `toml:"max-failed-logins"`
+		MaxFailedLoginsPerHost int      `toml:"max-failed-logins-per-host"`
+		LockoutDuration        Duration `toml:"lockout-duration"`
 	} `toml:"authentication"`
 
 	Admin struct {
@@ -148,6 +254,20 @@ type Config struct {
 		SSLPort     int      `toml:"ssl-port"`
 		SSLCertPath string   `toml:"ssl-cert"`
 		ReadTimeout Duration `toml:"read-timeout"`
+
+		// Max size of non-chunked JSON query responses. Zero means no limit.
+		MaxResponseSize Size `toml:"max-response-size"`
+
+		// Origins and request headers allowed in CORS requests. Any origin is allowed if not set.
+		AllowedOrigins []string `toml:"allowed-origins"`
+		AllowedHeaders []string `toml:"allowed-headers"`
+
+		// Request limits. Zero means no limit.
+		MaxWriteBodySize     Size    `toml:"max-write-body-size"`
+		MaxConcurrentQueries int     `toml:"max-concurrent-queries"`
+		MaxConcurrentWrites  int     `toml:"max-concurrent-writes"`
+		RateLimit            float64 `toml:"rate-limit"`
+		RateLimitBurst       int     `toml:"rate-limit-burst"`
 	} `toml:"api"`
 
 	Graphites []Graphite `toml:"graphite"`
@@ -164,6 +284,12 @@ type Config struct {
 
 	Data Data `toml:"data"`
 
+	Query Query `toml:"query"`
+
+	Audit Audit `toml:"audit"`
+
+	ClusterTLS ClusterTLS `toml:"cluster-tls"`
+
 	Snapshot Snapshot `toml:"snapshot"`
 
 	Logging struct {
@@ -226,6 +352,17 @@ func NewConfig() *Config {
 	c.Data.RetentionCheckPeriod = Duration(DefaultRetentionCheckPeriod)
 	c.Data.RetentionCreatePeriod = Duration(DefaultRetentionCreatePeriod)
 
+	c.Authentication.MinPasswordLength = DefaultMinPasswordLength
+	c.Authentication.MaxFailedLogins = DefaultMaxFailedLogins
+	c.Authentication.MaxFailedLoginsPerHost = DefaultMaxFailedLoginsPerHost
+	c.Authentication.LockoutDuration = Duration(DefaultLoginLockout)
+
+	c.Query.MaxGroupByBuckets = DefaultMaxGroupByBuckets
+	c.Query.CacheMaxSize = DefaultQueryCacheMaxSize
+
+	c.Audit.MaxSize = DefaultAuditMaxSize
+	c.Audit.MaxBackups = DefaultAuditMaxBackups
+
 	c.Monitoring.Enabled = false
 	c.Monitoring.WriteInterval = Duration(DefaultStatisticsWriteInterval)
 	c.ContinuousQuery.RecomputePreviousN = DefaultContinuousQueryRecomputePreviousN
@@ -302,8 +439,12 @@ func (c *Config) ClusterAddr() string {
 
 // ClusterURL returns the URL required to contact the server cluster endpoints.
 func (c *Config) ClusterURL() url.URL {
+	scheme := "http"
+	if c.ClusterTLS.Enabled {
+		scheme = "https"
+	}
 	return url.URL{
-		Scheme: "http",
+		Scheme: scheme,
 		Host:   net.JoinHostPort(c.Hostname, strconv.Itoa(c.Port)),
 	}
 }
@@ -25,6 +25,10 @@ port = 8086
 # Control authentication
 [authentication]
 enabled = true
+min-password-length = 8
+password-require-digit = true
+max-failed-logins = 3
+lockout-duration = "10m"
 
 [logging]
 write-tracing = true
@@ -54,6 +58,14 @@ ssl-cert = "../cert.pem"
 # and keep alive connections they don't use won't end up connection a million times.
 # However, if a request is taking longer than this to complete, could be a problem.
 read-timeout = "5s"
+max-response-size = "256m"
+allowed-origins = ["https://grafana.example.com"]
+allowed-headers = ["Authorization", "Content-Type"]
+max-write-body-size = "25m"
+max-concurrent-queries = 20
+max-concurrent-writes = 50
+rate-limit = 10.5
+rate-limit-burst = 30
 
 [input_plugins]
 
@@ -105,6 +117,9 @@ dir  = "/tmp/influxdb/development/broker"
 
 # election-timeout = "2s"
 
+snapshot-entry-threshold = 1000
+snapshot-size-threshold = "10m"
+
 [data]
 dir = "/tmp/influxdb/development/db"
 retention-auto-create = false
@@ -112,6 +127,27 @@ retention-check-enabled = true
 retention-check-period = "5m"
 enabled = false
 
+[query]
+max-series = 1000
+max-points-scanned = 5000000
+max-group-by-buckets = 10000
+timeout = "30s"
+slow-query-threshold = "5s"
+cache-enabled = true
+cache-max-size = "16m"
+
+[audit]
+enabled = true
+path = "/tmp/influxdb/audit.log"
+max-size = "10m"
+max-backups = 3
+
+[cluster-tls]
+enabled = true
+cert = "/etc/influxdb/node.pem"
+key = "/etc/influxdb/node.key"
+ca = "/etc/influxdb/ca.pem"
+
 [continuous_queries]
 disabled = true
 
@@ -162,10 +198,36 @@ func TestParseConfig(t *testing.T) {
 
 	if !c.Authentication.Enabled {
 		t.Fatalf("authentication enabled mismatch: %v", c.Authentication.Enabled)
+	} else if c.Authentication.MinPasswordLength != 8 {
+		t.Fatalf("min password length mismatch: %v", c.Authentication.MinPasswordLength)
+	} else if !c.Authentication.PasswordRequireDigit || c.Authentication.PasswordRequireUpper {
+		t.Fatalf("password policy mismatch: %v", c.Authentication)
+	} else if c.Authentication.MaxFailedLogins != 3 {
+		t.Fatalf("max failed logins mismatch: %v", c.Authentication.MaxFailedLogins)
+	} else if c.Authentication.MaxFailedLoginsPerHost != main.DefaultMaxFailedLoginsPerHost {
+		t.Fatalf("max failed logins per host mismatch: %v", c.Authentication.MaxFailedLoginsPerHost)
+	} else if time.Duration(c.Authentication.LockoutDuration) != 10*time.Minute {
+		t.Fatalf("lockout duration mismatch: %v", c.Authentication.LockoutDuration)
 	}
 
 	if exp := "10.1.2.3"; c.HTTPAPI.BindAddress != exp {
 		t.Fatalf("http api bind-address mismatch: got %v, exp %v", c.HTTPAPI.BindAddress, exp)
+	} else if c.HTTPAPI.MaxResponseSize != main.Size(256*1024*1024) {
+		t.Fatalf("http api max-response-size mismatch: %v", c.HTTPAPI.MaxResponseSize)
+	} else if !reflect.DeepEqual(c.HTTPAPI.AllowedOrigins, []string{"https://grafana.example.com"}) {
+		t.Fatalf("http api allowed-origins mismatch: %v", c.HTTPAPI.AllowedOrigins)
+	} else if !reflect.DeepEqual(c.HTTPAPI.AllowedHeaders, []string{"Authorization", "Content-Type"}) {
+		t.Fatalf("http api allowed-headers mismatch: %v", c.HTTPAPI.AllowedHeaders)
+	} else if c.HTTPAPI.MaxWriteBodySize != main.Size(25*1024*1024) {
+		t.Fatalf("http api max-write-body-size mismatch: %v", c.HTTPAPI.MaxWriteBodySize)
+	} else if c.HTTPAPI.MaxConcurrentQueries != 20 {
+		t.Fatalf("http api max-concurrent-queries mismatch: %v", c.HTTPAPI.MaxConcurrentQueries)
+	} else if c.HTTPAPI.MaxConcurrentWrites != 50 {
+		t.Fatalf("http api max-concurrent-writes mismatch: %v", c.HTTPAPI.MaxConcurrentWrites)
+	} else if c.HTTPAPI.RateLimit != 10.5 {
+		t.Fatalf("http api rate-limit mismatch: %v", c.HTTPAPI.RateLimit)
+	} else if c.HTTPAPI.RateLimitBurst != 30 {
+		t.Fatalf("http api rate-limit-burst mismatch: %v", c.HTTPAPI.RateLimitBurst)
 	}
 
 	if c.UDP.Enabled {
@@ -252,6 +314,24 @@ func TestParseConfig(t *testing.T) {
 		t.Fatalf("broker disabled mismatch: %v, got: %v", false, c.Broker.Enabled)
 	}
 
+	if c.Broker.SnapshotEntryThreshold != 1000 {
+		t.Fatalf("broker snapshot entry threshold mismatch: %v", c.Broker.SnapshotEntryThreshold)
+	} else if c.Broker.SnapshotSizeThreshold != 10*(1<<20) {
+		t.Fatalf("broker snapshot size threshold mismatch: %v", c.Broker.SnapshotSizeThreshold)
+	}
+
+	if !c.ClusterTLS.Enabled {
+		t.Fatalf("cluster tls enabled mismatch: %v", c.ClusterTLS.Enabled)
+	} else if c.ClusterTLS.CertPath != "/etc/influxdb/node.pem" {
+		t.Fatalf("cluster tls cert mismatch: %v", c.ClusterTLS.CertPath)
+	} else if c.ClusterTLS.KeyPath != "/etc/influxdb/node.key" {
+		t.Fatalf("cluster tls key mismatch: %v", c.ClusterTLS.KeyPath)
+	} else if c.ClusterTLS.CAPath != "/etc/influxdb/ca.pem" {
+		t.Fatalf("cluster tls ca mismatch: %v", c.ClusterTLS.CAPath)
+	} else if u := c.ClusterURL(); u.Scheme != "https" {
+		t.Fatalf("cluster url scheme mismatch: %v", u.Scheme)
+	}
+
 	if c.Data.Dir != "/tmp/influxdb/development/db" {
 		t.Fatalf("data dir mismatch: %v", c.Data.Dir)
 	}
@@ -266,6 +346,32 @@ func TestParseConfig(t *testing.T) {
 		t.Fatalf("data disabled mismatch: %v, got: %v", false, c.Data.Enabled)
 	}
 
+	if c.Query.MaxSeries != 1000 {
+		t.Fatalf("query max series mismatch: %v", c.Query.MaxSeries)
+	} else if c.Query.MaxPointsScanned != 5000000 {
+		t.Fatalf("query max points scanned mismatch: %v", c.Query.MaxPointsScanned)
+	} else if c.Query.MaxGroupByBuckets != 10000 {
+		t.Fatalf("query max group by buckets mismatch: %v", c.Query.MaxGroupByBuckets)
+	} else if c.Query.Timeout != main.Duration(30*time.Second) {
+		t.Fatalf("query timeout mismatch: %v", c.Query.Timeout)
+	} else if c.Query.SlowQueryThreshold != main.Duration(5*time.Second) {
+		t.Fatalf("query slow query threshold mismatch: %v", c.Query.SlowQueryThreshold)
+	} else if !c.Query.CacheEnabled {
+		t.Fatalf("query cache enabled mismatch: %v", c.Query.CacheEnabled)
+	} else if c.Query.CacheMaxSize != main.Size(16*1024*1024) {
+		t.Fatalf("query cache max size mismatch: %v", c.Query.CacheMaxSize)
+	}
+
+	if !c.Audit.Enabled {
+		t.Fatalf("audit enabled mismatch: %v", c.Audit.Enabled)
+	} else if c.Audit.Path != "/tmp/influxdb/audit.log" {
+		t.Fatalf("audit path mismatch: %v", c.Audit.Path)
+	} else if c.Audit.MaxSize != main.Size(10*1024*1024) {
+		t.Fatalf("audit max size mismatch: %v", c.Audit.MaxSize)
+	} else if c.Audit.MaxBackups != 3 {
+		t.Fatalf("audit max backups mismatch: %v", c.Audit.MaxBackups)
+	}
+
 	if c.Monitoring.WriteInterval.String() != "1m0s" {
 		t.Fatalf("Monitoring.WriteInterval mismatch: %v", c.Monitoring.WriteInterval)
 	}
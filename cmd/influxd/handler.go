@@ -7,6 +7,7 @@ import (
 	"net/http/pprof"
 	"net/url"
 	"strings"
+	"sync"
 
 	"github.com/influxdb/influxdb"
 	"github.com/influxdb/influxdb/httpd"
@@ -21,6 +22,10 @@ type Handler struct {
 	Broker *influxdb.Broker
 	Server *influxdb.Server
 	Config *Config
+
+	// The API handler is kept across requests for its limits and stats.
+	apiOnce    sync.Once
+	apiHandler *httpd.Handler
 }
 
 // NewHandler returns a new instance of Handler.
@@ -48,21 +53,27 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Broker raft communication endpoints.  These are called and handled by brokers
 	// to coordinate changes to the raft log.
 	if strings.HasPrefix(r.URL.Path, "/raft") {
-		h.serveRaft(w, r)
+		if h.authorizeNode(w, r) {
+			h.serveRaft(w, r)
+		}
 		return
 	}
 
 	// Broker messaging endpoints.  These are handled by brokers and called by data
 	// nodes to receive topic change and update replication status.
 	if strings.HasPrefix(r.URL.Path, "/messaging") {
-		h.serveMessaging(w, r)
+		if h.authorizeNode(w, r) {
+			h.serveMessaging(w, r)
+		}
 		return
 	}
 
 	// Data node endpoints.  These are handled by data nodes and allow brokers and data
 	// nodes to transfer state, process queries, etc..
 	if strings.HasPrefix(r.URL.Path, "/data") {
-		h.serveData(w, r)
+		if h.authorizeNode(w, r) {
+			h.serveData(w, r)
+		}
 		return
 	}
 
@@ -70,6 +81,21 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	h.serveAPI(w, r)
 }
 
+// authorizeNode checks that a request to a cluster endpoint was made by another
+// node. If cluster TLS is enabled then the request must have been made over TLS
+// with a client certificate verified against the cluster CA. Writes an error
+// and returns false if the request is not authorized.
+func (h *Handler) authorizeNode(w http.ResponseWriter, r *http.Request) bool {
+	if !h.Config.ClusterTLS.Enabled {
+		return true
+	}
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		http.Error(w, "client certificate required", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
 // serveMessaging responds to broker requests
 func (h *Handler) serveMessaging(w http.ResponseWriter, r *http.Request) {
 	if h.Broker == nil && h.Server == nil {
@@ -145,9 +171,22 @@ func (h *Handler) serveAPI(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if h.Server != nil {
-		sh := httpd.NewAPIHandler(h.Server, h.Config.Authentication.Enabled, version)
-		sh.WriteTrace = h.Config.Logging.WriteTracing
-		sh.ServeHTTP(w, r)
+		h.apiOnce.Do(func() {
+			c := h.Config.HTTPAPI
+			sh := httpd.NewAPIHandler(h.Server, h.Config.Authentication.Enabled, version)
+			sh.WriteTrace = h.Config.Logging.WriteTracing
+			sh.MaxResponseSize = int64(c.MaxResponseSize)
+			sh.AllowedOrigins = c.AllowedOrigins
+			sh.AllowedHeaders = c.AllowedHeaders
+			sh.MaxWriteBodySize = int64(c.MaxWriteBodySize)
+			sh.MaxConcurrentQueries = c.MaxConcurrentQueries
+			sh.MaxConcurrentWrites = c.MaxConcurrentWrites
+			sh.RateLimit = c.RateLimit
+			sh.RateLimitBurst = c.RateLimitBurst
+			h.Server.RegisterStats(sh.Stats())
+			h.apiHandler = sh
+		})
+		h.apiHandler.ServeHTTP(w, r)
 		return
 	}
 
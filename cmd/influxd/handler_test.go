@@ -0,0 +1,142 @@
+package main_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	main "github.com/influxdb/influxdb/cmd/influxd"
+)
+
+// Ensure cluster endpoints reject requests without a verified client certificate
+// when cluster TLS is enabled.
+func TestHandler_ClusterTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "influxd-tls-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := MustCreateClusterTLS(dir)
+	tlsConfig, err := c.TLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The handler has no broker or server so authorized requests are unavailable.
+	h := main.NewHandler()
+	h.Config = main.NewConfig()
+	h.Config.ClusterTLS = *c
+	s := httptest.NewUnstartedServer(h)
+	s.TLS = tlsConfig
+	s.StartTLS()
+	defer s.Close()
+
+	// A client trusting the cluster CA, without a certificate of its own.
+	anonymous := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: tlsConfig.RootCAs}}}
+
+	// A client using the same configuration as the transports between nodes.
+	node := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+
+	for _, path := range []string{"/raft/heartbeat", "/messaging/messages", "/data/run_mapper"} {
+		if status := MustGetStatus(anonymous, s.URL+path); status != http.StatusUnauthorized {
+			t.Errorf("%s: unexpected status without certificate: %d", path, status)
+		}
+		if status := MustGetStatus(node, s.URL+path); status != http.StatusServiceUnavailable {
+			t.Errorf("%s: unexpected status with certificate: %d", path, status)
+		}
+	}
+
+	// Cluster endpoints served without TLS are rejected too.
+	r, _ := http.NewRequest("GET", "/data/run_mapper", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("unexpected status without tls: %d", w.Code)
+	}
+}
+
+// MustCreateClusterTLS writes a self-signed CA and a node certificate signed by it to dir.
+// Returns the cluster TLS configuration using them.
+func MustCreateClusterTLS(dir string) *main.ClusterTLS {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "influxdb test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, ca, ca, &caKey.PublicKey, caKey)
+	if err != nil {
+		panic(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	cert := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, cert, ca, &key.PublicKey, caKey)
+	if err != nil {
+		panic(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		panic(err)
+	}
+
+	c := &main.ClusterTLS{
+		Enabled:  true,
+		CertPath: filepath.Join(dir, "node.pem"),
+		KeyPath:  filepath.Join(dir, "node.key"),
+		CAPath:   filepath.Join(dir, "ca.pem"),
+	}
+	MustWritePEM(c.CAPath, "CERTIFICATE", caDER)
+	MustWritePEM(c.CertPath, "CERTIFICATE", certDER)
+	MustWritePEM(c.KeyPath, "EC PRIVATE KEY", keyDER)
+	return c
+}
+
+// MustWritePEM writes a PEM encoded block to a file.
+func MustWritePEM(path, typ string, b []byte) {
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: b}), 0600); err != nil {
+		panic(err)
+	}
+}
+
+// MustGetStatus sends a GET request and returns the response status.
+func MustGetStatus(client *http.Client, url string) int {
+	resp, err := client.Get(url)
+	if err != nil {
+		panic(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -9,10 +10,12 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/influxdb/influxdb"
@@ -31,6 +34,10 @@ type RunCommand struct {
 	config    *Config
 	hostname  string
 	node      *Node
+
+	// TLS configuration and HTTP transport used between nodes.
+	clusterTLS       *tls.Config
+	clusterTransport *http.Transport
 }
 
 func NewRunCommand() *RunCommand {
@@ -96,12 +103,15 @@ func (s *Node) closeAdminServer() error {
 	return nil
 }
 
-func (s *Node) openListener(desc, addr string, h http.Handler) (net.Listener, error) {
+func (s *Node) openListener(desc, addr string, h http.Handler, tlsConfig *tls.Config) (net.Listener, error) {
 	var err error
 	listener, err := net.Listen("tcp", addr)
 	if err != nil {
 		return nil, err
 	}
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
 	go func() {
 		err := http.Serve(listener, h)
 
@@ -120,7 +130,7 @@ func (s *Node) openListener(desc, addr string, h http.Handler) (net.Listener, er
 
 func (s *Node) openAPIListener(addr string, h http.Handler) error {
 	var err error
-	s.apiListener, err = s.openListener("API", addr, h)
+	s.apiListener, err = s.openListener("API", addr, h, nil)
 	if err != nil {
 		return err
 	}
@@ -136,9 +146,9 @@ func (s *Node) closeAPIListener() error {
 	return err
 }
 
-func (s *Node) openClusterListener(addr string, h http.Handler) error {
+func (s *Node) openClusterListener(addr string, h http.Handler, tlsConfig *tls.Config) error {
 	var err error
-	s.clusterListener, err = s.openListener("Cluster", addr, h)
+	s.clusterListener, err = s.openListener("Cluster", addr, h, tlsConfig)
 	if err != nil {
 		return err
 	}
@@ -224,11 +234,33 @@ func (cmd *RunCommand) Run(args ...string) error {
 	cmd.CheckConfig()
 	cmd.Open(cmd.config, joinURLs)
 
-	// Wait indefinitely.
-	<-(chan struct{})(nil)
+	// Wait until the process is terminated.
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGTERM)
+	<-c
+	log.Println("received SIGTERM, shutting down")
+
+	// Hand off leadership before closing so the cluster doesn't have to
+	// wait for an election timeout.
+	cmd.transferLeadership()
+	cmd.Close()
 	return nil
 }
 
+// transferLeadership transfers raft leadership to another broker if this node
+// is currently the leader.
+func (cmd *RunCommand) transferLeadership() {
+	l := cmd.node.raftLog
+	if l == nil || l.State() != raft.Leader {
+		return
+	}
+
+	log.Println("transferring raft leadership")
+	if err := l.TransferLeadership(0); err != nil {
+		log.Printf("leadership transfer failed: %s", err)
+	}
+}
+
 // CheckConfig validates the configuration
 func (cmd *RunCommand) CheckConfig() {
 	if !(cmd.config.Data.Enabled || cmd.config.Broker.Enabled) {
@@ -242,6 +274,10 @@ func (cmd *RunCommand) CheckConfig() {
 	if cmd.config.Data.Enabled && cmd.config.Data.Dir == "" {
 		log.Fatal("Data.Dir must be specified.  Run `influxd config` to generate a valid configuration.")
 	}
+
+	if c := cmd.config.ClusterTLS; c.Enabled && (c.CertPath == "" || c.KeyPath == "" || c.CAPath == "") {
+		log.Fatal("ClusterTLS cert, key and ca must be specified when cluster TLS is enabled.")
+	}
 }
 
 func (cmd *RunCommand) Open(config *Config, join string) *Node {
@@ -254,6 +290,9 @@ func (cmd *RunCommand) Open(config *Config, join string) *Node {
 	// Parse join urls from the --join flag.
 	joinURLs := parseURLs(join)
 
+	// Set up TLS between nodes, if enabled.
+	cmd.openClusterTransport()
+
 	// Open broker & raft log, initialize or join as necessary.
 	if cmd.config.Broker.Enabled {
 		cmd.openBroker(joinURLs)
@@ -269,7 +308,7 @@ func (cmd *RunCommand) Open(config *Config, join string) *Node {
 		Log:    cmd.node.raftLog,
 	}
 
-	err := cmd.node.openClusterListener(cmd.config.ClusterAddr(), h)
+	err := cmd.node.openClusterListener(cmd.config.ClusterAddr(), h, cmd.clusterTLS)
 	if err != nil {
 		log.Fatalf("Cluster server failed to listen on %s. %s ", cmd.config.ClusterAddr(), err)
 	}
@@ -299,6 +338,11 @@ func (cmd *RunCommand) Open(config *Config, join string) *Node {
 			log.Fatalf("shard group pre-create failed: %s", err.Error())
 		}
 		log.Printf("shard group pre-create with check interval of %s", interval)
+
+		// Report the snapshots of a local broker with the server's diagnostics.
+		if cmd.node.raftLog != nil {
+			s.RegisterDiagnostics("broker_snapshot", &influxdb.SnapshotDiagnostics{Log: cmd.node.raftLog})
+		}
 	}
 
 	// Start the server handler. Attach to broker if listening on the same port.
@@ -449,6 +493,29 @@ func (cmd *RunCommand) Close() {
 	cmd.node.Close()
 }
 
+// openClusterTransport creates the HTTP transport used for requests to other
+// nodes. If cluster TLS is enabled then the transport presents this node's
+// certificate and verifies peers against the configured CA.
+func (cmd *RunCommand) openClusterTransport() {
+	if !cmd.config.ClusterTLS.Enabled {
+		cmd.clusterTLS = nil
+		cmd.clusterTransport = http.DefaultTransport.(*http.Transport)
+		return
+	}
+
+	tlsConfig, err := cmd.config.ClusterTLS.TLSConfig()
+	if err != nil {
+		log.Fatalf("cluster tls: %s", err)
+	}
+	cmd.clusterTLS = tlsConfig
+	cmd.clusterTransport = &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		TLSClientConfig:     tlsConfig,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+	log.Println("cluster tls enabled")
+}
+
 // write the current process id to a file specified by path.
 func writePIDFile(path string) {
 	if path == "" {
@@ -476,12 +543,16 @@ func (cmd *RunCommand) openBroker(brokerURLs []url.URL) {
 
 	// Create broker
 	b := influxdb.NewBroker()
+	b.Transport = cmd.clusterTransport
 	cmd.node.Broker = b
 
 	// Create raft log.
 	l := raft.NewLog()
 	l.SetURL(u)
+	l.Transport = &raft.HTTPTransport{Transport: cmd.clusterTransport}
 	l.DebugEnabled = raftTracing
+	l.SnapshotEntryThreshold = cmd.config.Broker.SnapshotEntryThreshold
+	l.SnapshotSizeThreshold = int64(cmd.config.Broker.SnapshotSizeThreshold)
 	b.Log = l
 	cmd.node.raftLog = l
 
@@ -538,7 +609,7 @@ func joinLog(l *raft.Log, brokerURLs []url.URL) {
 func (cmd *RunCommand) openServer(joinURLs []url.URL) *influxdb.Server {
 
 	// Create messaging client to the brokers.
-	c := influxdb.NewMessagingClient(cmd.config.ClusterURL())
+	c := influxdb.NewMessagingClientWithTransport(cmd.config.ClusterURL(), cmd.clusterTransport)
 	c.SetURLs(joinURLs)
 
 	if err := c.Open(filepath.Join(cmd.config.Data.Dir, messagingClientFile)); err != nil {
@@ -554,11 +625,41 @@ func (cmd *RunCommand) openServer(joinURLs []url.URL) *influxdb.Server {
 	s := influxdb.NewServer()
 
 	s.WriteTrace = cmd.config.Logging.WriteTracing
+	s.Transport = cmd.clusterTransport
 	s.RetentionAutoCreate = cmd.config.Data.RetentionAutoCreate
 	s.RecomputePreviousN = cmd.config.ContinuousQuery.RecomputePreviousN
 	s.RecomputeNoOlderThan = time.Duration(cmd.config.ContinuousQuery.RecomputeNoOlderThan)
 	s.ComputeRunsPerInterval = cmd.config.ContinuousQuery.ComputeRunsPerInterval
 	s.ComputeNoMoreThan = time.Duration(cmd.config.ContinuousQuery.ComputeNoMoreThan)
+	s.MaxSeriesPerQuery = cmd.config.Query.MaxSeries
+	s.MaxPointsScanned = cmd.config.Query.MaxPointsScanned
+	s.MaxGroupByBuckets = cmd.config.Query.MaxGroupByBuckets
+	s.QueryTimeout = time.Duration(cmd.config.Query.Timeout)
+	s.SlowQueryThreshold = time.Duration(cmd.config.Query.SlowQueryThreshold)
+	if cmd.config.Query.CacheEnabled {
+		s.QueryCache = influxdb.NewQueryCache()
+		s.QueryCache.MaxSize = int64(cmd.config.Query.CacheMaxSize)
+	}
+	s.PasswordPolicy = influxdb.PasswordPolicy{
+		MinLength:      cmd.config.Authentication.MinPasswordLength,
+		RequireUpper:   cmd.config.Authentication.PasswordRequireUpper,
+		RequireLower:   cmd.config.Authentication.PasswordRequireLower,
+		RequireDigit:   cmd.config.Authentication.PasswordRequireDigit,
+		RequireSpecial: cmd.config.Authentication.PasswordRequireSpecial,
+	}
+	s.MaxFailedLogins = cmd.config.Authentication.MaxFailedLogins
+	s.MaxFailedLoginsPerHost = cmd.config.Authentication.MaxFailedLoginsPerHost
+	s.LoginLockout = time.Duration(cmd.config.Authentication.LockoutDuration)
+	if cmd.config.Audit.Enabled {
+		l, err := influxdb.OpenAuditLog(cmd.config.Audit.Path)
+		if err != nil {
+			log.Fatalf("failed to open audit log: %s", err)
+		}
+		l.MaxSize = int64(cmd.config.Audit.MaxSize)
+		l.MaxBackups = cmd.config.Audit.MaxBackups
+		s.AuditLog = l
+		log.Printf("audit log opened at %s", cmd.config.Audit.Path)
+	}
 	s.Version = version
 	s.CommitHash = commit
 	cmd.node.DataNode = s
@@ -634,6 +634,162 @@ func runTestsData(t *testing.T, testName string, nodes Cluster, database, retent
 			expected: `{"results":[{"series":[{"name":"cpu","tags":{"region":"us-east"},"columns":["time","mean"],"values":[["2000-01-01T00:00:00Z",15]]},{"name":"cpu","tags":{"region":"us-west"},"columns":["time","mean"],"values":[["2000-01-01T00:00:00Z",30]]}]}]}`,
 		},
 
+		// Median, mode and distinct queries
+		{
+			reset: true,
+			name:  "median",
+			write: `{"database" : "%DB%", "retentionPolicy" : "%RP%", "points": [
+				{"name": "http", "timestamp": "2000-01-01T00:00:00Z", "tags": {"host": "serverA"}, "fields": {"latency": 10, "status": "ok"}},
+				{"name": "http", "timestamp": "2000-01-01T00:00:10Z", "tags": {"host": "serverB"}, "fields": {"latency": 40, "status": "error"}},
+				{"name": "http", "timestamp": "2000-01-01T00:00:20Z", "tags": {"host": "serverA"}, "fields": {"latency": 20, "status": "ok"}},
+				{"name": "http", "timestamp": "2000-01-01T00:00:30Z", "tags": {"host": "serverC"}, "fields": {"latency": 20, "status": "ok"}}
+			]}`,
+			query:    `SELECT median(latency) FROM http`,
+			queryDb:  "%DB%",
+			expected: `{"results":[{"series":[{"name":"http","columns":["time","median"],"values":[["1970-01-01T00:00:00Z",20]]}]}]}`,
+		},
+		{
+			name:     "mode",
+			query:    `SELECT mode(latency) FROM http`,
+			queryDb:  "%DB%",
+			expected: `{"results":[{"series":[{"name":"http","columns":["time","mode"],"values":[["1970-01-01T00:00:00Z",20]]}]}]}`,
+		},
+		{
+			name:     "mode on a string field",
+			query:    `SELECT mode(status) FROM http`,
+			queryDb:  "%DB%",
+			expected: `{"results":[{"series":[{"name":"http","columns":["time","mode"],"values":[["1970-01-01T00:00:00Z","ok"]]}]}]}`,
+		},
+		{
+			name:     "distinct",
+			query:    `SELECT distinct(latency) FROM http`,
+			queryDb:  "%DB%",
+			expected: `{"results":[{"series":[{"name":"http","columns":["time","distinct"],"values":[["1970-01-01T00:00:00Z",[10,20,40]]]}]}]}`,
+		},
+		{
+			name:     "distinct on a string field",
+			query:    `SELECT distinct(status) FROM http`,
+			queryDb:  "%DB%",
+			expected: `{"results":[{"series":[{"name":"http","columns":["time","distinct"],"values":[["1970-01-01T00:00:00Z",["error","ok"]]]}]}]}`,
+		},
+		{
+			name:     "count distinct",
+			query:    `SELECT count(distinct(latency)) FROM http`,
+			queryDb:  "%DB%",
+			expected: `{"results":[{"series":[{"name":"http","columns":["time","count"],"values":[["1970-01-01T00:00:00Z",3]]}]}]}`,
+		},
+		{
+			name:     "percentile_approx",
+			query:    `SELECT percentile_approx(latency, 50) FROM http`,
+			queryDb:  "%DB%",
+			expected: `{"results":[{"series":[{"name":"http","columns":["time","percentile_approx"],"values":[["1970-01-01T00:00:00Z",20]]}]}]}`,
+		},
+		{
+			name:     "percentile_approx with compression",
+			query:    `SELECT percentile_approx(latency, 100, 200) FROM http`,
+			queryDb:  "%DB%",
+			expected: `{"results":[{"series":[{"name":"http","columns":["time","percentile_approx"],"values":[["1970-01-01T00:00:00Z",40]]}]}]}`,
+		},
+		{
+			name:     "top",
+			query:    `SELECT top(latency, 2) FROM http`,
+			queryDb:  "%DB%",
+			expected: `{"results":[{"series":[{"name":"http","columns":["time","top"],"values":[["2000-01-01T00:00:10Z",40],["2000-01-01T00:00:20Z",20]]}]}]}`,
+		},
+		{
+			name:     "top with tag",
+			query:    `SELECT top(latency, host, 2) FROM http`,
+			queryDb:  "%DB%",
+			expected: `{"results":[{"series":[{"name":"http","columns":["time","top","host"],"values":[["2000-01-01T00:00:10Z",40,"serverB"],["2000-01-01T00:00:20Z",20,"serverA"]]}]}]}`,
+		},
+		{
+			name:     "bottom with tag",
+			query:    `SELECT bottom(latency, host, 3) FROM http`,
+			queryDb:  "%DB%",
+			expected: `{"results":[{"series":[{"name":"http","columns":["time","bottom","host"],"values":[["2000-01-01T00:00:00Z",10,"serverA"],["2000-01-01T00:00:30Z",20,"serverC"],["2000-01-01T00:00:10Z",40,"serverB"]]}]}]}`,
+		},
+
+		// Moving window functions
+		{
+			name:     "difference",
+			query:    `SELECT difference(latency) FROM http`,
+			queryDb:  "%DB%",
+			expected: `{"results":[{"series":[{"name":"http","columns":["time","difference"],"values":[["2000-01-01T00:00:10Z",30],["2000-01-01T00:00:20Z",-20],["2000-01-01T00:00:30Z",0]]}]}]}`,
+		},
+		{
+			name:     "cumulative_sum",
+			query:    `SELECT cumulative_sum(latency) FROM http`,
+			queryDb:  "%DB%",
+			expected: `{"results":[{"series":[{"name":"http","columns":["time","cumulative_sum"],"values":[["2000-01-01T00:00:00Z",10],["2000-01-01T00:00:10Z",50],["2000-01-01T00:00:20Z",70],["2000-01-01T00:00:30Z",90]]}]}]}`,
+		},
+		{
+			name:     "moving_average",
+			query:    `SELECT moving_average(latency, 2) FROM http`,
+			queryDb:  "%DB%",
+			expected: `{"results":[{"series":[{"name":"http","columns":["time","moving_average"],"values":[["2000-01-01T00:00:10Z",25],["2000-01-01T00:00:20Z",30],["2000-01-01T00:00:30Z",20]]}]}]}`,
+		},
+		{
+			name:     "elapsed",
+			query:    `SELECT elapsed(latency, 1s) FROM http`,
+			queryDb:  "%DB%",
+			expected: `{"results":[{"series":[{"name":"http","columns":["time","elapsed"],"values":[["2000-01-01T00:00:10Z",10],["2000-01-01T00:00:20Z",10],["2000-01-01T00:00:30Z",10]]}]}]}`,
+		},
+		{
+			name:     "cumulative_sum of an aggregate",
+			query:    `SELECT cumulative_sum(count(latency)) FROM http WHERE time >= '2000-01-01T00:00:00Z' AND time < '2000-01-01T00:00:39Z' GROUP BY time(20s)`,
+			queryDb:  "%DB%",
+			expected: `{"results":[{"series":[{"name":"http","columns":["time","cumulative_sum"],"values":[["2000-01-01T00:00:00Z",2],["2000-01-01T00:00:20Z",4]]}]}]}`,
+		},
+		{
+			name:     "difference of an aggregate per tag set",
+			query:    `SELECT difference(max(latency)) FROM http WHERE time >= '2000-01-01T00:00:00Z' AND time < '2000-01-01T00:00:39Z' GROUP BY time(20s), host`,
+			queryDb:  "%DB%",
+			expected: `{"results":[{"series":[{"name":"http","tags":{"host":"serverA"},"columns":["time","difference"],"values":[["2000-01-01T00:00:00Z",null],["2000-01-01T00:00:20Z",10]]},{"name":"http","tags":{"host":"serverB"},"columns":["time","difference"],"values":[["2000-01-01T00:00:00Z",null],["2000-01-01T00:00:20Z",null]]},{"name":"http","tags":{"host":"serverC"},"columns":["time","difference"],"values":[["2000-01-01T00:00:00Z",null],["2000-01-01T00:00:20Z",null]]}]}]}`,
+		},
+
+		// Subqueries
+		{
+			name:     "aggregate of a subquery",
+			query:    `SELECT max(m) FROM (SELECT mean(latency) AS m FROM http WHERE time >= '2000-01-01T00:00:00Z' AND time < '2000-01-01T00:00:39Z' GROUP BY time(20s), host) GROUP BY time(20s)`,
+			queryDb:  "%DB%",
+			expected: `{"results":[{"series":[{"name":"http","columns":["time","max"],"values":[["2000-01-01T00:00:00Z",40],["2000-01-01T00:00:20Z",20]]}]}]}`,
+		},
+		{
+			name:     "raw query of a subquery filtered by tag",
+			query:    `SELECT m FROM (SELECT mean(latency) AS m FROM http WHERE time >= '2000-01-01T00:00:00Z' AND time < '2000-01-01T00:00:39Z' GROUP BY time(20s), host) WHERE host = 'serverA'`,
+			queryDb:  "%DB%",
+			expected: `{"results":[{"series":[{"name":"http","columns":["time","m"],"values":[["2000-01-01T00:00:00Z",10],["2000-01-01T00:00:20Z",20]]}]}]}`,
+		},
+		{
+			name:     "subquery with an unknown field",
+			query:    `SELECT max(latency) FROM (SELECT mean(latency) AS m FROM http GROUP BY host)`,
+			queryDb:  "%DB%",
+			expected: `{"results":[{"error":"unknown field or tag name in select clause: latency"}]}`,
+		},
+
+		// Joins
+		{
+			name: "join aggregates of two measurements",
+			write: `{"database" : "%DB%", "retentionPolicy" : "%RP%", "points": [
+				{"name": "errors", "timestamp": "2000-01-01T00:00:00Z", "tags": {"host": "serverA"}, "fields": {"value": 1}},
+				{"name": "errors", "timestamp": "2000-01-01T00:00:10Z", "tags": {"host": "serverA"}, "fields": {"value": 3}},
+				{"name": "errors", "timestamp": "2000-01-01T00:00:20Z", "tags": {"host": "serverB"}, "fields": {"value": 5}},
+				{"name": "requests", "timestamp": "2000-01-01T00:00:00Z", "tags": {"host": "serverA"}, "fields": {"value": 10}},
+				{"name": "requests", "timestamp": "2000-01-01T00:00:10Z", "tags": {"host": "serverA"}, "fields": {"value": 30}},
+				{"name": "requests", "timestamp": "2000-01-01T00:00:20Z", "tags": {"host": "serverB"}, "fields": {"value": 50}},
+				{"name": "requests", "timestamp": "2000-01-01T00:00:30Z", "tags": {"host": "serverB"}, "fields": {"value": 50}}
+			]}`,
+			query:    `SELECT sum(errors.value) / sum(requests.value) AS rate FROM errors, requests WHERE time >= '2000-01-01T00:00:00Z' AND time < '2000-01-01T00:00:40Z' GROUP BY time(20s)`,
+			queryDb:  "%DB%",
+			expected: `{"results":[{"series":[{"name":"errors_requests","columns":["time","rate"],"values":[["2000-01-01T00:00:00Z",0.1],["2000-01-01T00:00:20Z",0.05]]}]}]}`,
+		},
+		{
+			name:     "join raw values on time and shared tags",
+			query:    `SELECT errors.value AS errors, requests.value AS requests FROM errors, requests WHERE host = 'serverA' GROUP BY host`,
+			queryDb:  "%DB%",
+			expected: `{"results":[{"series":[{"name":"errors_requests","tags":{"host":"serverA"},"columns":["time","errors","requests"],"values":[["2000-01-01T00:00:00Z",1,10],["2000-01-01T00:00:10Z",3,30]]}]}]}`,
+		},
+
 		// WHERE tag queries
 		{
 			reset: true,
@@ -907,6 +1063,26 @@ func runTestsData(t *testing.T, testName string, nodes Cluster, database, retent
 			query:    `select mean(val) from "%DB%"."%RP%".fills where time >= '2009-11-10T23:00:00Z' and time < '2009-11-10T23:00:20Z' group by time(5s) fill(none)`,
 			expected: `{"results":[{"series":[{"name":"fills","columns":["time","mean"],"values":[["2009-11-10T23:00:00Z",4],["2009-11-10T23:00:05Z",4],["2009-11-10T23:00:15Z",10]]}]}]}`,
 		},
+		{
+			name:     "fill with linear",
+			query:    `select mean(val) from "%DB%"."%RP%".fills where time >= '2009-11-10T23:00:00Z' and time < '2009-11-10T23:00:20Z' group by time(5s) fill(linear)`,
+			expected: `{"results":[{"series":[{"name":"fills","columns":["time","mean"],"values":[["2009-11-10T23:00:00Z",4],["2009-11-10T23:00:05Z",4],["2009-11-10T23:00:10Z",7],["2009-11-10T23:00:15Z",10]]}]}]}`,
+		},
+		{
+			name:     "fill with linear leaves the edges null",
+			query:    `select mean(val) from "%DB%"."%RP%".fills where time >= '2009-11-10T22:59:55Z' and time < '2009-11-10T23:00:25Z' group by time(5s) fill(linear)`,
+			expected: `{"results":[{"series":[{"name":"fills","columns":["time","mean"],"values":[["2009-11-10T22:59:55Z",null],["2009-11-10T23:00:00Z",4],["2009-11-10T23:00:05Z",4],["2009-11-10T23:00:10Z",7],["2009-11-10T23:00:15Z",10],["2009-11-10T23:00:20Z",null]]}]}]}`,
+		},
+		{
+			name:     "group by time with offset",
+			query:    `select mean(val) from "%DB%"."%RP%".fills where time >= '2009-11-10T23:00:02Z' and time < '2009-11-10T23:00:17Z' group by time(5s, 2s) fill(none)`,
+			expected: `{"results":[{"series":[{"name":"fills","columns":["time","mean"],"values":[["2009-11-10T23:00:02Z",4],["2009-11-10T23:00:12Z",10]]}]}]}`,
+		},
+		{
+			name:     "group by time with time zone",
+			query:    `select mean(val) from "%DB%"."%RP%".fills where time >= '2009-11-10T23:00:00Z' and time < '2009-11-10T23:00:20Z' group by time(5s) fill(none) tz('Europe/Berlin')`,
+			expected: `{"results":[{"series":[{"name":"fills","columns":["time","mean"],"values":[["2009-11-11T00:00:00+01:00",4],["2009-11-11T00:00:05+01:00",4],["2009-11-11T00:00:15+01:00",10]]}]}]}`,
+		},
 		{
 			name:     "fill defaults to null",
 			query:    `select mean(val) from "%DB%"."%RP%".fills where time >= '2009-11-10T23:00:00Z' and time < '2009-11-10T23:00:20Z' group by time(5s)`,
@@ -1212,7 +1388,7 @@ func runTestsData(t *testing.T, testName string, nodes Cluster, database, retent
 		{
 			name:     "show users, no actual users",
 			query:    `SHOW USERS`,
-			expected: `{"results":[{"series":[{"columns":["user","admin"]}]}]}`,
+			expected: `{"results":[{"series":[{"columns":["user","admin","locked","failed_logins"]}]}]}`,
 		},
 		{
 			query:    `CREATE USER jdoe WITH PASSWORD '1337'`,
@@ -1222,7 +1398,7 @@ func runTestsData(t *testing.T, testName string, nodes Cluster, database, retent
 		{
 			name:     "show users, 1 existing user",
 			query:    `SHOW USERS`,
-			expected: `{"results":[{"series":[{"columns":["user","admin"],"values":[["jdoe",false]]}]}]}`,
+			expected: `{"results":[{"series":[{"columns":["user","admin","locked","failed_logins"],"values":[["jdoe",false,false,0]]}]}]}`,
 		},
 		{
 			query:    `GRANT ALL PRIVILEGES TO jdoe`,
@@ -1231,7 +1407,7 @@ func runTestsData(t *testing.T, testName string, nodes Cluster, database, retent
 		{
 			name:     "show users, existing user as admin",
 			query:    `SHOW USERS`,
-			expected: `{"results":[{"series":[{"columns":["user","admin"],"values":[["jdoe",true]]}]}]}`,
+			expected: `{"results":[{"series":[{"columns":["user","admin","locked","failed_logins"],"values":[["jdoe",true,false,0]]}]}]}`,
 		},
 		{
 			name:     "grant DB privileges to user",
@@ -26,6 +26,7 @@ const (
 	createUserMessageType = messaging.MessageType(0x30)
 	updateUserMessageType = messaging.MessageType(0x31)
 	deleteUserMessageType = messaging.MessageType(0x32)
+	unlockUserMessageType = messaging.MessageType(0x33)
 
 	// Shard messages
 	createShardGroupIfNotExistsMessageType = messaging.MessageType(0x40)
@@ -47,6 +48,17 @@ const (
 
 	// Privilege messages
 	setPrivilegeMessageType = messaging.MessageType(0x90)
+
+	// Role messages
+	createRoleMessageType       = messaging.MessageType(0xA0)
+	dropRoleMessageType         = messaging.MessageType(0xA1)
+	setRolePrivilegeMessageType = messaging.MessageType(0xA2)
+	grantRoleMessageType        = messaging.MessageType(0xA3)
+	revokeRoleMessageType       = messaging.MessageType(0xA4)
+
+	// Token messages
+	createTokenMessageType = messaging.MessageType(0xB0)
+	dropTokenMessageType   = messaging.MessageType(0xB1)
 )
 
 type createDataNodeCommand struct {
@@ -88,6 +100,10 @@ type updateUserCommand struct {
 	Password string `json:"password,omitempty"`
 }
 
+type unlockUserCommand struct {
+	Username string `json:"username"`
+}
+
 type deleteUserCommand struct {
 	Username string `json:"username"`
 }
@@ -96,6 +112,26 @@ type setPrivilegeCommand struct {
 	Username  string             `json:"username"`
 	Database  string             `json:"database"`
 }
+
+type createRoleCommand struct {
+	Name string `json:"name"`
+}
+
+type dropRoleCommand struct {
+	Name string `json:"name"`
+}
+
+type setRolePrivilegeCommand struct {
+	Privilege   influxql.Privilege `json:"privilege"`
+	Role        string             `json:"role"`
+	Database    string             `json:"database"`
+	Measurement *Matcher           `json:"measurement,omitempty"`
+}
+
+type userRoleCommand struct {
+	Role     string `json:"role"`
+	Username string `json:"username"`
+}
 type createRetentionPolicyCommand struct {
 	Database           string        `json:"database"`
 	Name               string        `json:"name"`
@@ -214,3 +250,16 @@ type dropContinuousQueryCommand struct {
 	Name     string `json:"name"`
 	Database string `json:"database"`
 }
+
+type createTokenCommand struct {
+	Name      string             `json:"name"`
+	Username  string             `json:"username"`
+	Hash      string             `json:"hash"`
+	Privilege influxql.Privilege `json:"privilege"`
+	Database  string             `json:"database,omitempty"`
+	Expires   time.Time          `json:"expires"`
+}
+
+type dropTokenCommand struct {
+	Name string `json:"name"`
+}
@@ -143,6 +143,30 @@ func (m *Measurement) HasTagKey(k string) bool {
 	return m.seriesByTagKeyValue[k] != nil
 }
 
+// seriesTags returns the values of the given tag keys for each series id.
+func (m *Measurement) seriesTags(ids []uint64, keys []string) map[uint64]map[string]string {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	tags := make(map[uint64]map[string]string, len(ids))
+	for _, id := range ids {
+		s := m.seriesByID[id]
+		if s == nil {
+			continue
+		}
+
+		values := make(map[string]string, len(keys))
+		for _, k := range keys {
+			if v, ok := s.Tags[k]; ok {
+				values[k] = v
+			}
+		}
+		tags[id] = values
+	}
+	return tags
+}
+
 // createFieldIfNotExists creates a new field with an autoincrementing ID.
 // Returns an error if 255 fields have already been created on the measurement or
 // the fields already exists with a different type.
@@ -6,8 +6,14 @@ import (
 	"time"
 
 	"github.com/influxdb/influxdb/influxql"
+	"github.com/influxdb/influxdb/raft"
 )
 
+// Diagnostics represents diagnostic information that is reported as an InfluxQL row.
+type Diagnostics interface {
+	AsRow(measurement string, tags map[string]string) *influxql.Row
+}
+
 // GoDiagnostics captures basic information about the runtime.
 type GoDiagnostics struct {
 	GoMaxProcs   int
@@ -141,3 +147,22 @@ func (b *BuildDiagnostics) AsRow(measurement string, tags map[string]string) *in
 			b.Version, b.CommitHash}},
 	}
 }
+
+// SnapshotDiagnostics captures statistics about the snapshots of a broker's raft log.
+type SnapshotDiagnostics struct {
+	Log interface {
+		SnapshotStats() raft.SnapshotStats
+	}
+}
+
+// AsRow returns the SnapshotDiagnostics object as an InfluxQL row.
+func (d *SnapshotDiagnostics) AsRow(measurement string, tags map[string]string) *influxql.Row {
+	st := d.Log.SnapshotStats()
+	return &influxql.Row{
+		Name:    measurement,
+		Columns: []string{"time", "index", "count", "size", "duration", "installed"},
+		Tags:    tags,
+		Values: [][]interface{}{[]interface{}{time.Now().UTC(),
+			int64(st.Index), st.Count, st.Size, st.Duration.String(), st.Installed}},
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -55,6 +56,29 @@ type Handler struct {
 
 	Logger     *log.Logger
 	WriteTrace bool // Detailed logging of write path
+
+	// Max bytes of series in a non-chunked JSON query response. Zero means no limit.
+	MaxResponseSize int64
+
+	// Origins and request headers allowed in CORS requests. Any origin is allowed if
+	// AllowedOrigins is empty or contains "*".
+	AllowedOrigins []string
+	AllowedHeaders []string
+
+	// Request limits. Zero means no limit.
+	MaxWriteBodySize     int64   // max bytes of a /write request body
+	MaxConcurrentQueries int     // max queries being executed
+	MaxConcurrentWrites  int     // max writes being processed
+	RateLimit            float64 // max requests per second of each host, and of each user
+	RateLimitBurst       int     // max requests at once of each host or user, defaults to RateLimit
+
+	activeQueries int64 // queries being executed
+	activeWrites  int64 // writes being processed
+
+	bucketsMu sync.Mutex
+	buckets   map[string]*tokenBucket // rate limits by user or host
+
+	stats *influxdb.Stats
 }
 
 // NewClusterHandler is the http handler for cluster communication endpoints
@@ -145,9 +169,24 @@ func newHandler(s *influxdb.Server, requireAuthentication bool, version string)
 		requireAuthentication: requireAuthentication,
 		Logger:                log.New(os.Stderr, "[http] ", log.LstdFlags),
 		version:               version,
+		stats:                 newHandlerStats(),
 	}
 }
 
+// newHandlerStats returns the stats of a handler with its counters set to zero.
+func newHandlerStats() *influxdb.Stats {
+	stats := influxdb.NewStats("httpd")
+	for _, k := range []string{"requestsTooLarge", "queriesThrottled", "writesThrottled", "rateLimited"} {
+		stats.Set(k, 0)
+	}
+	return stats
+}
+
+// Stats returns the counts of requests rejected by the handler's limits.
+func (h *Handler) Stats() *influxdb.Stats {
+	return h.stats
+}
+
 func (h *Handler) SetRoutes(routes []route) {
 	h.routes = routes
 
@@ -156,7 +195,7 @@ func (h *Handler) SetRoutes(routes []route) {
 
 		// If it's a handler func that requires authorization, wrap it in authorization
 		if hf, ok := r.handlerFunc.(func(http.ResponseWriter, *http.Request, *influxdb.User)); ok {
-			handler = authenticate(hf, h, h.requireAuthentication)
+			handler = limitHosts(authenticate(limitUsers(hf, h), h, h.requireAuthentication), h)
 		}
 		// This is a normal handler signature and does not require authorization
 		if hf, ok := r.handlerFunc.(func(http.ResponseWriter, *http.Request)); ok {
@@ -167,7 +206,7 @@ func (h *Handler) SetRoutes(routes []route) {
 			handler = gzipFilter(handler)
 		}
 		handler = versionHeader(handler, h.version)
-		handler = cors(handler)
+		handler = cors(handler, h)
 		handler = requestID(handler)
 		if r.log {
 			handler = logging(handler, r.name, h.Logger)
@@ -205,6 +244,27 @@ func (h *Handler) serveQuery(w http.ResponseWriter, r *http.Request, user *influ
 		return
 	}
 
+	// Parse the values of bound parameters, they're bound by the server.
+	var params map[string]interface{}
+	if s := q.Get("params"); s != "" {
+		if err := json.Unmarshal([]byte(s), &params); err != nil {
+			httpError(w, "error parsing query parameters: "+err.Error(), pretty, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Timestamps are returned as RFC3339 unless an epoch precision is requested.
+	var epoch time.Duration
+	if s := q.Get("epoch"); s != "" {
+		d, ok := epochPrecisions[s]
+		if !ok {
+			httpError(w, fmt.Sprintf("invalid epoch: %q", s), pretty, http.StatusBadRequest)
+			return
+		}
+		epoch = d
+	}
+	enc := newResponseEncoder(r.Header.Get("Accept"), pretty)
+
 	// get the chunking settings
 	chunked := q.Get("chunked") == "true"
 	// even if we're not chunking, the engine will chunk at this size and then the handler will combine results
@@ -217,9 +277,16 @@ func (h *Handler) serveQuery(w http.ResponseWriter, r *http.Request, user *influ
 		}
 	}
 
+	if !acquire(&h.activeQueries, h.MaxConcurrentQueries) {
+		h.stats.Inc("queriesThrottled")
+		httpError(w, fmt.Sprintf("too many concurrent queries: the limit is %d", h.MaxConcurrentQueries), pretty, statusTooManyRequests)
+		return
+	}
+	defer release(&h.activeQueries)
+
 	// Send results to client.
-	w.Header().Add("content-type", "application/json")
-	results, err := h.server.ExecuteQuery(query, db, user, chunkSize)
+	w.Header().Add("content-type", enc.ContentType())
+	results, err := h.server.ExecuteQuery(query, db, params, user, r.RemoteAddr, chunkSize)
 	if err != nil {
 		if isAuthorizationError(err) {
 			w.WriteHeader(http.StatusUnauthorized)
@@ -229,8 +296,12 @@ func (h *Handler) serveQuery(w http.ResponseWriter, r *http.Request, user *influ
 		return
 	}
 
-	// if we're not chunking, this will be the in memory buffer for all results before sending to client
+	// if we're not chunking, JSON responses are streamed and other formats are buffered in memory
 	res := influxdb.Response{Results: make([]*influxdb.Result, 0)}
+	var stream *jsonResponseStream
+	if enc, ok := enc.(*jsonResponseEncoder); ok && !chunked {
+		stream = newJSONResponseStream(w, enc.pretty, h.MaxResponseSize)
+	}
 	statusWritten := false
 
 	// pull all results from the channel
@@ -259,15 +330,24 @@ func (h *Handler) serveQuery(w http.ResponseWriter, r *http.Request, user *influ
 		if r == nil {
 			continue
 		}
+		if epoch != 0 {
+			r = convertToEpoch(r, epoch)
+		}
 
 		// if chunked we write out this result and flush
 		if chunked {
 			res.Results = []*influxdb.Result{r}
-			w.Write(marshalPretty(res, pretty))
+			h.encodeResponse(enc, w, &res)
 			w.(http.Flusher).Flush()
 			continue
 		}
 
+		// write out the series of this result as they arrive. The stream combines results of the same statement.
+		if stream != nil {
+			stream.WriteResult(r)
+			continue
+		}
+
 		// it's not chunked so buffer results in memory.
 		// results for statements need to be combined together. We need to check if this new result is
 		// for the same statement as the last result, or for the next statement
@@ -282,9 +362,20 @@ func (h *Handler) serveQuery(w http.ResponseWriter, r *http.Request, user *influ
 		}
 	}
 
-	// if it's not chunked we buffered everything in memory, so write it out
-	if !chunked {
-		w.Write(marshalPretty(res, pretty))
+	// if it's not chunked we streamed or buffered everything, so finish the response
+	if stream != nil {
+		stream.Close()
+	} else if !chunked {
+		h.encodeResponse(enc, w, &res)
+	}
+}
+
+// encodeResponse writes a query response. If the response can't be encoded
+// then the error is written in its place.
+func (h *Handler) encodeResponse(enc responseEncoder, w http.ResponseWriter, res *influxdb.Response) {
+	if err := enc.Encode(w, res); err != nil {
+		h.Logger.Printf("failed to encode query response: %s", err)
+		enc.Encode(w, &influxdb.Response{Err: err})
 	}
 }
 
@@ -344,9 +435,9 @@ type Batch struct {
 }
 
 // Return all the measurements from the given DB
-func (h *Handler) showMeasurements(db string, user *influxdb.User) ([]string, error) {
+func (h *Handler) showMeasurements(db string, user *influxdb.User, addr string) ([]string, error) {
 	var measurements []string
-	c, err := h.server.ExecuteQuery(&influxql.Query{Statements: []influxql.Statement{&influxql.ShowMeasurementsStatement{}}}, db, user, 0)
+	c, err := h.server.ExecuteQuery(&influxql.Query{Statements: []influxql.Statement{&influxql.ShowMeasurementsStatement{}}}, db, nil, user, addr, 0)
 	if err != nil {
 		return measurements, err
 	}
@@ -377,7 +468,7 @@ func (h *Handler) serveDump(w http.ResponseWriter, r *http.Request, user *influx
 	db := q.Get("db")
 	pretty := q.Get("pretty") == "true"
 	delim := []byte("\n")
-	measurements, err := h.showMeasurements(db, user)
+	measurements, err := h.showMeasurements(db, user, r.RemoteAddr)
 	if err != nil {
 		httpError(w, "error with dump: "+err.Error(), pretty, http.StatusInternalServerError)
 		return
@@ -404,7 +495,7 @@ func (h *Handler) serveDump(w http.ResponseWriter, r *http.Request, user *influx
 			return
 		}
 
-		res, err := h.server.ExecuteQuery(query, db, user, DefaultChunkSize)
+		res, err := h.server.ExecuteQuery(query, db, nil, user, r.RemoteAddr, DefaultChunkSize)
 		if err != nil {
 			w.Write([]byte("*** SERVER-SIDE ERROR. MISSING DATA ***"))
 			w.Write(delim)
@@ -460,11 +551,32 @@ func (h *Handler) serveWrite(w http.ResponseWriter, r *http.Request, user *influ
 		return
 	}
 
+	if !acquire(&h.activeWrites, h.MaxConcurrentWrites) {
+		h.stats.Inc("writesThrottled")
+		writeError(influxdb.Result{Err: fmt.Errorf("too many concurrent writes: the limit is %d", h.MaxConcurrentWrites)}, statusTooManyRequests)
+		return
+	}
+	defer release(&h.activeWrites)
+
+	// Limit the size of the request body, before it's decompressed.
+	if h.MaxWriteBodySize > 0 {
+		if r.ContentLength > h.MaxWriteBodySize {
+			h.stats.Inc("requestsTooLarge")
+			writeError(influxdb.Result{Err: errBodyTooLarge(h.MaxWriteBodySize)}, http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, h.MaxWriteBodySize)
+	}
+
 	// Check to see if we have a gzip'd post
 	var body io.ReadCloser
 	if r.Header.Get("Content-encoding") == "gzip" {
 		b, err := gzip.NewReader(r.Body)
-		if err != nil {
+		if isBodyTooLarge(err) {
+			h.stats.Inc("requestsTooLarge")
+			writeError(influxdb.Result{Err: errBodyTooLarge(h.MaxWriteBodySize)}, http.StatusRequestEntityTooLarge)
+			return
+		} else if err != nil {
 			writeError(influxdb.Result{Err: err}, http.StatusBadRequest)
 			return
 		}
@@ -494,6 +606,10 @@ func (h *Handler) serveWrite(w http.ResponseWriter, r *http.Request, user *influ
 		if err.Error() == "EOF" {
 			w.WriteHeader(http.StatusOK)
 			return
+		} else if isBodyTooLarge(err) {
+			h.stats.Inc("requestsTooLarge")
+			writeError(influxdb.Result{Err: errBodyTooLarge(h.MaxWriteBodySize)}, http.StatusRequestEntityTooLarge)
+			return
 		}
 		writeError(influxdb.Result{Err: err}, http.StatusInternalServerError)
 		return
@@ -514,17 +630,19 @@ func (h *Handler) serveWrite(w http.ResponseWriter, r *http.Request, user *influ
 		return
 	}
 
-	if h.requireAuthentication && !user.Authorize(influxql.WritePrivilege, bp.Database) {
-		writeError(influxdb.Result{Err: fmt.Errorf("%q user is not authorized to write to database %q", user.Name, bp.Database)}, http.StatusUnauthorized)
-		return
-	}
-
 	points, err := influxdb.NormalizeBatchPoints(bp)
 	if err != nil {
 		writeError(influxdb.Result{Err: err}, http.StatusInternalServerError)
 		return
 	}
 
+	if h.requireAuthentication {
+		if err := h.server.AuthorizeWrite(user, bp.Database, points); err != nil {
+			writeError(influxdb.Result{Err: fmt.Errorf("%q user is not authorized to write to database %q: %s", user.Name, bp.Database, err)}, http.StatusUnauthorized)
+			return
+		}
+	}
+
 	if index, err := h.server.WriteSeries(bp.Database, bp.RetentionPolicy, points); err != nil {
 		writeError(influxdb.Result{Err: err}, http.StatusInternalServerError)
 		return
@@ -713,38 +831,63 @@ func (h *Handler) serveProcessContinuousQueries(w http.ResponseWriter, r *http.R
 }
 
 func (h *Handler) serveRunMapper(w http.ResponseWriter, r *http.Request) {
+	// respond using the binary protocol if the request used it. Older servers
+	// send JSON requests and expect JSON responses.
+	mw := &mapResponseWriter{w: w, binary: r.Header.Get("Content-Type") == influxdb.MapperContentType}
+
 	// we always return a 200, even if there's an error because we always include an error object
 	// that can be passed on
-	w.Header().Add("content-type", "application/json")
+	if mw.binary {
+		w.Header().Add("content-type", influxdb.MapperContentType)
+	} else {
+		w.Header().Add("content-type", "application/json")
+	}
 	w.WriteHeader(200)
 
 	// Read in the mapper info from the request body
-	var m influxdb.RemoteMapper
-
-	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
-		mapError(w, err)
-		return
+	var m *influxdb.RemoteMapper
+	if mw.binary {
+		var err error
+		if m, err = influxdb.ReadMapRequest(r.Body); err != nil {
+			mw.error(err)
+			return
+		}
+	} else {
+		m = &influxdb.RemoteMapper{}
+		if err := json.NewDecoder(r.Body).Decode(m); err != nil {
+			mw.error(err)
+			return
+		}
 	}
 
 	// create a local mapper and chunk out the results to the other server
-	lm, err := h.server.StartLocalMapper(&m)
+	lm, err := h.server.StartLocalMapper(m)
 	if err != nil {
-		mapError(w, err)
+		mw.error(err)
 		return
 	}
 	if err := lm.Open(); err != nil {
-		mapError(w, err)
+		mw.error(err)
 		return
 	}
 	defer lm.Close()
 	call, err := m.CallExpr()
 	if err != nil {
-		mapError(w, err)
+		mw.error(err)
 		return
 	}
 
+	// get the function for marshaling each interval
+	marshal := func(v interface{}) ([]byte, error) { return json.Marshal(&v) }
+	if mw.binary {
+		if marshal, err = influxql.InitializeBinaryMarshaller(call); err != nil {
+			mw.error(err)
+			return
+		}
+	}
+
 	if err := lm.Begin(call, m.TMin, m.ChunkSize); err != nil {
-		mapError(w, err)
+		mw.error(err)
 		return
 	}
 
@@ -758,7 +901,7 @@ func (h *Handler) serveRunMapper(w http.ResponseWriter, r *http.Request) {
 	for {
 		v, err := lm.NextInterval()
 		if err != nil {
-			mapError(w, err)
+			mw.error(err)
 			return
 		}
 
@@ -769,18 +912,15 @@ func (h *Handler) serveRunMapper(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// marshal and write out
-		d, err := json.Marshal(&v)
+		d, err := marshal(v)
 		if err != nil {
-			mapError(w, err)
+			mw.error(err)
 			return
 		}
-		b, err := json.Marshal(&influxdb.MapResponse{Data: d})
-		if err != nil {
-			mapError(w, err)
+		if err := mw.write(&influxdb.MapResponse{Data: d}); err != nil {
+			mw.error(err)
 			return
 		}
-		w.Write(b)
-		w.(http.Flusher).Flush()
 
 		// if this is an aggregate query, we should only call next interval as many times as the chunk size
 		if !isRaw {
@@ -796,13 +936,37 @@ func (h *Handler) serveRunMapper(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	d, err := json.Marshal(&influxdb.MapResponse{Completed: true})
-	if err != nil {
-		mapError(w, err)
+	if err := mw.write(&influxdb.MapResponse{Completed: true}); err != nil {
+		mw.error(err)
+	}
+}
+
+// mapResponseWriter writes map responses using either the binary or JSON mapper protocol.
+type mapResponseWriter struct {
+	w      http.ResponseWriter
+	binary bool
+}
+
+// write writes a single response and flushes it to the client.
+func (mw *mapResponseWriter) write(resp *influxdb.MapResponse) error {
+	if mw.binary {
+		if err := influxdb.WriteMapResponse(mw.w, resp); err != nil {
+			return err
+		}
 	} else {
-		w.Write(d)
-		w.(http.Flusher).Flush()
+		b, err := json.Marshal(resp)
+		if err != nil {
+			return err
+		}
+		mw.w.Write(b)
 	}
+	mw.w.(http.Flusher).Flush()
+	return nil
+}
+
+// error writes an error response.
+func (mw *mapResponseWriter) error(err error) {
+	mw.write(&influxdb.MapResponse{Err: err.Error()})
 }
 
 type dataNodeJSON struct {
@@ -828,12 +992,6 @@ func isFieldNotFoundError(err error) bool {
 	return (strings.HasPrefix(err.Error(), "field not found"))
 }
 
-// mapError writes an error result after trying to start a mapper
-func mapError(w http.ResponseWriter, err error) {
-	b, _ := json.Marshal(&influxdb.MapResponse{Err: err.Error()})
-	w.Write(b)
-}
-
 // httpError writes an error to the client in a standard format.
 func httpError(w http.ResponseWriter, error string, pretty bool, code int) {
 	w.Header().Add("content-type", "application/json")
@@ -869,6 +1027,16 @@ func parseCredentials(r *http.Request) (string, string, error) {
 	}
 }
 
+// parseToken parses an API token from an "Authorization: Token <token>" header.
+func parseToken(r *http.Request) (string, bool) {
+	const prefix = "Token "
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(auth[len(prefix):]), true
+}
+
 // authenticate wraps a handler and ensures that if user credentials are passed in
 // an attempt is made to authenticate that user. If authentication fails, an error is returned.
 //
@@ -885,6 +1053,18 @@ func authenticate(inner func(http.ResponseWriter, *http.Request, *influxdb.User)
 
 		// TODO corylanou: never allow this in the future without users
 		if requireAuthentication && h.server.UserCount() > 0 {
+			// API tokens are checked before user credentials.
+			if token, ok := parseToken(r); ok {
+				user, err := h.server.AuthenticateToken(token)
+				if err != nil {
+					h.server.Audit(&influxdb.AuditEvent{Event: influxdb.AuditAuthentication, Addr: r.RemoteAddr, Error: err.Error()})
+					httpError(w, err.Error(), false, http.StatusUnauthorized)
+					return
+				}
+				inner(w, r, user)
+				return
+			}
+
 			username, password, err := parseCredentials(r)
 			if err != nil {
 				httpError(w, err.Error(), false, http.StatusUnauthorized)
@@ -895,8 +1075,9 @@ func authenticate(inner func(http.ResponseWriter, *http.Request, *influxdb.User)
 				return
 			}
 
-			user, err = h.server.Authenticate(username, password)
+			user, err = h.server.Authenticate(username, password, r.RemoteAddr)
 			if err != nil {
+				h.server.Audit(&influxdb.AuditEvent{Event: influxdb.AuditAuthentication, User: username, Addr: r.RemoteAddr, Error: err.Error()})
 				httpError(w, err.Error(), false, http.StatusUnauthorized)
 				return
 			}
@@ -942,12 +1123,25 @@ func versionHeader(inner http.Handler, version string) http.Handler {
 	})
 }
 
+// allowOrigin returns true if CORS requests are allowed from an origin.
+func (h *Handler) allowOrigin(origin string) bool {
+	if len(h.AllowedOrigins) == 0 {
+		return true
+	}
+	for _, o := range h.AllowedOrigins {
+		if o == "*" || o == origin {
+			return true
+		}
+	}
+	return false
+}
+
 // cors responds to incoming requests and adds the appropriate cors headers
-// TODO: corylanou: add the ability to configure this in our config
-func cors(inner http.Handler) http.Handler {
+func cors(inner http.Handler, h *Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if origin := r.Header.Get("Origin"); origin != "" {
+		if origin := r.Header.Get("Origin"); origin != "" && h.allowOrigin(origin) {
 			w.Header().Set(`Access-Control-Allow-Origin`, origin)
+			w.Header().Add(`Vary`, `Origin`)
 			w.Header().Set(`Access-Control-Allow-Methods`, strings.Join([]string{
 				`DELETE`,
 				`GET`,
@@ -956,15 +1150,11 @@ func cors(inner http.Handler) http.Handler {
 				`PUT`,
 			}, ", "))
 
-			w.Header().Set(`Access-Control-Allow-Headers`, strings.Join([]string{
-				`Accept`,
-				`Accept-Encoding`,
-				`Authorization`,
-				`Content-Length`,
-				`Content-Type`,
-				`X-CSRF-Token`,
-				`X-HTTP-Method-Override`,
-			}, ", "))
+			headers := h.AllowedHeaders
+			if len(headers) == 0 {
+				headers = defaultAllowedHeaders
+			}
+			w.Header().Set(`Access-Control-Allow-Headers`, strings.Join(headers, ", "))
 		}
 
 		if r.Method == "OPTIONS" {
@@ -718,7 +718,7 @@ func TestHandler_Users_MultipleUsers(t *testing.T) {
 	status, body := MustHTTP("GET", s.URL+`/query`, query, nil, "")
 	if status != http.StatusOK {
 		t.Fatalf("unexpected status: %d", status)
-	} else if body != `{"results":[{"series":[{"columns":["user","admin"],"values":[["csmith",false],["jdoe",false],["mclark",true]]}]}]}` {
+	} else if body != `{"results":[{"series":[{"columns":["user","admin","locked","failed_logins"],"values":[["csmith",false,false,0],["jdoe",false,false,0],["mclark",true,false,0]]}]}]}` {
 		t.Fatalf("unexpected body: %s", body)
 	}
 }
@@ -901,6 +901,47 @@ func TestHandler_AuthenticatedDatabases_Unauthorized(t *testing.T) {
 	}
 }
 
+func TestHandler_AuthenticatedToken(t *testing.T) {
+	c := test.NewDefaultMessagingClient()
+	defer c.Close()
+	srvr := OpenAuthenticatedServer(c)
+	srvr.CreateDatabase("foo")
+	srvr.CreateRetentionPolicy("foo", influxdb.NewRetentionPolicy("bar"))
+	srvr.CreateUser("lisa", "password", true)
+	token, err := srvr.CreateToken("reader", "lisa", influxql.ReadPrivilege, "foo", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewAuthenticatedAPIServer(srvr)
+	defer s.Close()
+
+	// The token can read from foo.
+	headers := map[string]string{"Authorization": "Token " + token}
+	status, body := MustHTTP("GET", s.URL+`/query`, map[string]string{"q": "SHOW MEASUREMENTS", "db": "foo"}, headers, "")
+	if status != http.StatusOK {
+		t.Fatalf("unexpected status: %d: %s", status, body)
+	}
+
+	// The token is limited to reads even though the user is an admin.
+	status, _ = MustHTTP("GET", s.URL+`/query`, map[string]string{"q": "SHOW USERS"}, headers, "")
+	if status != http.StatusUnauthorized {
+		t.Fatalf("unexpected status: %d", status)
+	}
+	status, _ = MustHTTP("POST", s.URL+`/write`, nil, headers, `{"database" : "foo", "retentionPolicy" : "bar", "points": [{"name": "cpu", "tags": {"host": "server01"},"timestamp": "2009-11-10T23:00:00Z","fields": {"value": 100}}]}`)
+	if status != http.StatusUnauthorized {
+		t.Fatalf("unexpected status: %d", status)
+	}
+
+	// Revoked tokens are rejected.
+	srvr.DropToken("reader")
+	status, body = MustHTTP("GET", s.URL+`/query`, map[string]string{"q": "SHOW MEASUREMENTS", "db": "foo"}, headers, "")
+	if status != http.StatusUnauthorized {
+		t.Fatalf("unexpected status: %d", status)
+	} else if body != `{"error":"invalid or expired token"}` {
+		t.Fatalf("unexpected body: %s", body)
+	}
+}
+
 func TestHandler_QueryParamenterMissing(t *testing.T) {
 	c := test.NewDefaultMessagingClient()
 	defer c.Close()
@@ -1694,6 +1735,312 @@ func TestHandler_ChunkedResponses(t *testing.T) {
 	}
 }
 
+// Ensure query results can be returned as CSV, with one header per series.
+func TestHandler_Query_CSV(t *testing.T) {
+	c := test.NewDefaultMessagingClient()
+	defer c.Close()
+	srvr := OpenAuthlessServer(c)
+	srvr.CreateDatabase("foo")
+	srvr.CreateRetentionPolicy("foo", influxdb.NewRetentionPolicy("bar"))
+	srvr.SetDefaultRetentionPolicy("foo", "bar")
+
+	s := NewAPIServer(srvr)
+	defer s.Close()
+
+	status, body := MustHTTP("POST", s.URL+`/write`, nil, nil, `{"database" : "foo", "retentionPolicy" : "bar", "points": [
+			{"name": "cpu", "tags": {"host": "server01"},"timestamp": "2009-11-10T23:00:00Z", "fields": {"value": 100}},
+			{"name": "cpu", "tags": {"host": "server02"},"timestamp": "2009-11-10T23:30:00Z", "fields": {"value": 25.5}}]}`)
+	if status != http.StatusOK {
+		t.Fatalf("unexpected status: %d - %s", status, body)
+	}
+	time.Sleep(100 * time.Millisecond) // Ensure data node picks up write.
+
+	query := map[string]string{"db": "foo", "q": "select value from cpu group by host"}
+	status, body = MustHTTP("GET", s.URL+`/query`, query, map[string]string{"Accept": "text/csv"}, "")
+	if status != http.StatusOK {
+		t.Fatalf("unexpected status: %d - %s", status, body)
+	} else if exp := "name,host,time,value\ncpu,server01,2009-11-10T23:00:00Z,100\nname,host,time,value\ncpu,server02,2009-11-10T23:30:00Z,25.5"; body != exp {
+		t.Fatalf("unexpected body:\n  exp: %s\n  got: %s", exp, body)
+	}
+
+	// Timestamps can be returned as epochs.
+	query["epoch"] = "ms"
+	status, body = MustHTTP("GET", s.URL+`/query`, query, map[string]string{"Accept": "text/csv"}, "")
+	if status != http.StatusOK {
+		t.Fatalf("unexpected status: %d - %s", status, body)
+	} else if exp := "name,host,time,value\ncpu,server01,1257894000000,100\nname,host,time,value\ncpu,server02,1257895800000,25.5"; body != exp {
+		t.Fatalf("unexpected body:\n  exp: %s\n  got: %s", exp, body)
+	}
+}
+
+// Ensure query results can be returned as MessagePack.
+func TestHandler_Query_MsgPack(t *testing.T) {
+	c := test.NewDefaultMessagingClient()
+	defer c.Close()
+	srvr := OpenAuthlessServer(c)
+	srvr.CreateDatabase("foo")
+	srvr.CreateRetentionPolicy("foo", influxdb.NewRetentionPolicy("bar"))
+	srvr.SetDefaultRetentionPolicy("foo", "bar")
+
+	s := NewAPIServer(srvr)
+	defer s.Close()
+
+	status, body := MustHTTP("POST", s.URL+`/write`, nil, nil, `{"database" : "foo", "retentionPolicy" : "bar", "points": [
+			{"name": "cpu", "tags": {"host": "server01"},"timestamp": "2009-11-10T23:00:00Z", "fields": {"value": 100}}]}`)
+	if status != http.StatusOK {
+		t.Fatalf("unexpected status: %d - %s", status, body)
+	}
+	time.Sleep(100 * time.Millisecond) // Ensure data node picks up write.
+
+	query := map[string]string{"db": "foo", "q": "select value from cpu", "epoch": "s"}
+	status, body = MustHTTP("GET", s.URL+`/query`, query, map[string]string{"Accept": "application/x-msgpack"}, "")
+	if status != http.StatusOK {
+		t.Fatalf("unexpected status: %d - %s", status, body)
+	} else if exp := "\x81\xa7results\x91\x81\xa6series\x91\x83\xa4name\xa3cpu\xa7columns\x92\xa4time\xa5value\xa6values\x91\x92\xceJ\xf9\xf0p\xcb@Y\x00\x00\x00\x00\x00\x00"; body != exp {
+		t.Fatalf("unexpected body:\n  exp: %q\n  got: %q", exp, body)
+	}
+	// Distinct values are encoded as an array.
+	query["q"] = "select distinct(value) from cpu"
+	status, body = MustHTTP("GET", s.URL+`/query`, query, map[string]string{"Accept": "application/x-msgpack"}, "")
+	if status != http.StatusOK {
+		t.Fatalf("unexpected status: %d - %s", status, body)
+	} else if exp := "\x81\xa7results\x91\x81\xa6series\x91\x83\xa4name\xa3cpu\xa7columns\x92\xa4time\xa8distinct\xa6values\x91\x92\x00\x91\xcb@Y\x00\x00\x00\x00\x00\x00"; body != exp {
+		t.Fatalf("unexpected body:\n  exp: %q\n  got: %q", exp, body)
+	}
+
+	// Timestamps keep the offset of the query's time zone.
+	delete(query, "epoch")
+	query["q"] = "select sum(value) from cpu where time >= '2009-11-10T00:00:00Z' and time < '2009-11-11T00:00:00Z' group by time(1d) tz('Europe/Berlin')"
+	status, body = MustHTTP("GET", s.URL+`/query`, query, map[string]string{"Accept": "application/x-msgpack"}, "")
+	if status != http.StatusOK {
+		t.Fatalf("unexpected status: %d - %s", status, body)
+	} else if exp := "\x81\xa7results\x91\x81\xa6series\x91\x83\xa4name\xa3cpu\xa7columns\x92\xa4time\xa3sum\xa6values\x92\x92\xb92009-11-10T00:00:00+01:00\xc0\x92\xb92009-11-11T00:00:00+01:00\xcb@Y\x00\x00\x00\x00\x00\x00"; body != exp {
+		t.Fatalf("unexpected body:\n  exp: %q\n  got: %q", exp, body)
+	}
+}
+
+// Ensure query parameters are bound to the statements' bound parameters.
+func TestHandler_Query_BoundParams(t *testing.T) {
+	c := test.NewDefaultMessagingClient()
+	defer c.Close()
+	srvr := OpenAuthlessServer(c)
+	srvr.CreateDatabase("foo")
+	srvr.CreateRetentionPolicy("foo", influxdb.NewRetentionPolicy("bar"))
+	srvr.SetDefaultRetentionPolicy("foo", "bar")
+
+	s := NewAPIServer(srvr)
+	defer s.Close()
+
+	status, body := MustHTTP("POST", s.URL+`/write`, nil, nil, `{"database" : "foo", "retentionPolicy" : "bar", "points": [
+			{"name": "cpu", "tags": {"host": "server'01"},"timestamp": "2009-11-10T23:00:00Z", "fields": {"value": 100}},
+			{"name": "cpu", "tags": {"host": "server02"},"timestamp": "2009-11-10T23:30:00Z", "fields": {"value": 25}}]}`)
+	if status != http.StatusOK {
+		t.Fatalf("unexpected status: %d - %s", status, body)
+	}
+	time.Sleep(100 * time.Millisecond) // Ensure data node picks up write.
+
+	query := map[string]string{
+		"db":     "foo",
+		"q":      "select value from cpu where host = $host and time >= $start",
+		"params": `{"host": "server'01", "start": "2009-11-10T00:00:00Z"}`,
+	}
+	status, body = MustHTTP("GET", s.URL+`/query`, query, nil, "")
+	if status != http.StatusOK {
+		t.Fatalf("unexpected status: %d - %s", status, body)
+	} else if body != `{"results":[{"series":[{"name":"cpu","columns":["time","value"],"values":[["2009-11-10T23:00:00Z",100]]}]}]}` {
+		t.Fatalf("unexpected body: %s", body)
+	}
+
+	// Parameters without a value return an error.
+	query["params"] = `{"start": "2009-11-10T00:00:00Z"}`
+	status, body = MustHTTP("GET", s.URL+`/query`, query, nil, "")
+	if status != http.StatusInternalServerError {
+		t.Fatalf("unexpected status: %d - %s", status, body)
+	} else if body != `{"results":[{"error":"missing parameter: $host"}]}` {
+		t.Fatalf("unexpected body: %s", body)
+	}
+
+	// Invalid parameters are a bad request.
+	query["params"] = `["server01"]`
+	status, body = MustHTTP("GET", s.URL+`/query`, query, nil, "")
+	if status != http.StatusBadRequest {
+		t.Fatalf("unexpected status: %d - %s", status, body)
+	}
+}
+
+// Ensure an invalid epoch returns an error.
+func TestHandler_Query_InvalidEpoch(t *testing.T) {
+	c := test.NewDefaultMessagingClient()
+	defer c.Close()
+	srvr := OpenAuthlessServer(c)
+	s := NewAPIServer(srvr)
+	defer s.Close()
+
+	status, body := MustHTTP("GET", s.URL+`/query`, map[string]string{"q": "show databases", "epoch": "d"}, nil, "")
+	if status != http.StatusBadRequest {
+		t.Fatalf("unexpected status: %d", status)
+	} else if body != `{"error":"invalid epoch: \"d\""}` {
+		t.Fatalf("unexpected body: %s", body)
+	}
+}
+
+// Ensure non-chunked JSON responses combine the results of a statement and end with an error once too large.
+func TestHandler_Query_MaxResponseSize(t *testing.T) {
+	c := test.NewDefaultMessagingClient()
+	defer c.Close()
+	srvr := OpenAuthlessServer(c)
+	srvr.CreateDatabase("foo")
+	srvr.CreateRetentionPolicy("foo", influxdb.NewRetentionPolicy("bar"))
+	srvr.SetDefaultRetentionPolicy("foo", "bar")
+
+	s := NewAPIServer(srvr)
+	defer s.Close()
+
+	status, body := MustHTTP("POST", s.URL+`/write`, nil, nil, `{"database" : "foo", "retentionPolicy" : "bar", "points": [
+			{"name": "cpu", "tags": {"host": "server01"},"timestamp": "2009-11-10T23:00:00Z", "fields": {"value": 100}},
+			{"name": "cpu", "tags": {"host": "server02"},"timestamp": "2009-11-10T23:30:00Z", "fields": {"value": 25}}]}`)
+	if status != http.StatusOK {
+		t.Fatalf("unexpected status: %d - %s", status, body)
+	}
+	time.Sleep(100 * time.Millisecond) // Ensure data node picks up write.
+
+	query := map[string]string{"db": "foo", "q": "select value from cpu group by host; show databases"}
+	status, body = MustHTTP("GET", s.URL+`/query`, query, nil, "")
+	if status != http.StatusOK {
+		t.Fatalf("unexpected status: %d - %s", status, body)
+	} else if exp := `{"results":[{"series":[{"name":"cpu","tags":{"host":"server01"},"columns":["time","value"],"values":[["2009-11-10T23:00:00Z",100]]},{"name":"cpu","tags":{"host":"server02"},"columns":["time","value"],"values":[["2009-11-10T23:30:00Z",25]]}]},{"series":[{"name":"databases","columns":["name"],"values":[["foo"]]}]}]}`; body != exp {
+		t.Fatalf("unexpected body:\n  exp: %s\n  got: %s", exp, body)
+	}
+
+	s.Handler.MaxResponseSize = 200
+	status, body = MustHTTP("GET", s.URL+`/query`, query, nil, "")
+	if status != http.StatusOK {
+		t.Fatalf("unexpected status: %d - %s", status, body)
+	} else if exp := `{"results":[{"series":[{"name":"cpu","tags":{"host":"server01"},"columns":["time","value"],"values":[["2009-11-10T23:00:00Z",100]]}],"error":"max response size exceeded: response is larger than 200 bytes. maybe you forgot to use chunked=true?"}]}`; body != exp {
+		t.Fatalf("unexpected body:\n  exp: %s\n  got: %s", exp, body)
+	}
+}
+
+// Ensure CORS headers are only returned to allowed origins.
+func TestHandler_CORS_AllowedOrigins(t *testing.T) {
+	c := test.NewDefaultMessagingClient()
+	defer c.Close()
+	srvr := OpenAuthlessServer(c)
+	s := NewAPIServer(srvr)
+	defer s.Close()
+	s.Handler.AllowedOrigins = []string{"http://example.com"}
+	s.Handler.AllowedHeaders = []string{"Authorization"}
+
+	f := func(origin, expOrigin, expHeaders string) {
+		req, _ := http.NewRequest("GET", s.URL+`/ping`, nil)
+		req.Header.Set("Origin", origin)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if v := resp.Header.Get("Access-Control-Allow-Origin"); v != expOrigin {
+			t.Fatalf("%s: unexpected allowed origin: %q", origin, v)
+		} else if v := resp.Header.Get("Access-Control-Allow-Headers"); v != expHeaders {
+			t.Fatalf("%s: unexpected allowed headers: %q", origin, v)
+		}
+	}
+	f("http://example.com", "http://example.com", "Authorization")
+	f("http://evil.com", "", "")
+}
+
+// Ensure write bodies larger than the limit are rejected.
+func TestHandler_Write_MaxBodySize(t *testing.T) {
+	c := test.NewDefaultMessagingClient()
+	defer c.Close()
+	srvr := OpenAuthlessServer(c)
+	srvr.CreateDatabase("foo")
+	srvr.CreateRetentionPolicy("foo", influxdb.NewRetentionPolicy("bar"))
+	s := NewAPIServer(srvr)
+	defer s.Close()
+	s.Handler.MaxWriteBodySize = 100
+
+	body := `{"database" : "foo", "retentionPolicy" : "bar", "points": [{"name": "cpu", "timestamp": "2009-11-10T23:00:00Z", "fields": {"value": 100}}]}`
+	status, resp := MustHTTP("POST", s.URL+`/write`, nil, nil, body)
+	if status != http.StatusRequestEntityTooLarge {
+		t.Fatalf("unexpected status: %d - %s", status, resp)
+	} else if resp != `{"error":"request body too large: the limit is 100 bytes"}` {
+		t.Fatalf("unexpected body: %s", resp)
+	}
+
+	// Bodies of unknown length are rejected once they're read past the limit.
+	req, _ := http.NewRequest("POST", s.URL+`/write`, ioutil.NopCloser(strings.NewReader(body)))
+	r, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if r.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("unexpected status: %d - %s", r.StatusCode, b)
+	}
+
+	if n := s.Handler.Stats().Get("requestsTooLarge"); n != 2 {
+		t.Fatalf("unexpected requests too large: %d", n)
+	}
+
+	s.Handler.MaxWriteBodySize = int64(len(body))
+	if status, resp := MustHTTP("POST", s.URL+`/write`, nil, nil, body); status != http.StatusOK {
+		t.Fatalf("unexpected status: %d - %s", status, resp)
+	}
+}
+
+// Ensure requests over the rate limit of a host are rejected.
+func TestHandler_RateLimit(t *testing.T) {
+	c := test.NewDefaultMessagingClient()
+	defer c.Close()
+	srvr := OpenAuthlessServer(c)
+	s := NewAPIServer(srvr)
+	defer s.Close()
+	s.Handler.RateLimit = 0.001
+	s.Handler.RateLimitBurst = 2
+
+	query := map[string]string{"q": "show databases"}
+	for i := 0; i < 2; i++ {
+		if status, body := MustHTTP("GET", s.URL+`/query`, query, nil, ""); status != http.StatusOK {
+			t.Fatalf("unexpected status: %d - %s", status, body)
+		}
+	}
+	if status, body := MustHTTP("GET", s.URL+`/query`, query, nil, ""); status != 429 {
+		t.Fatalf("unexpected status: %d - %s", status, body)
+	} else if body != `{"error":"rate limit exceeded"}` {
+		t.Fatalf("unexpected body: %s", body)
+	}
+	if n := s.Handler.Stats().Get("rateLimited"); n != 1 {
+		t.Fatalf("unexpected rate limited requests: %d", n)
+	}
+}
+
+// Ensure requests failing to authenticate count against the rate limit of their host.
+func TestHandler_RateLimit_Unauthenticated(t *testing.T) {
+	c := test.NewDefaultMessagingClient()
+	defer c.Close()
+	srvr := OpenAuthenticatedServer(c)
+	srvr.CreateUser("admin", "admin", true)
+	s := NewAuthenticatedAPIServer(srvr)
+	defer s.Close()
+	s.Handler.RateLimit = 0.001
+	s.Handler.RateLimitBurst = 2
+
+	query := map[string]string{"q": "show databases", "u": "admin", "p": "wrong"}
+	for i := 0; i < 2; i++ {
+		if status, body := MustHTTP("GET", s.URL+`/query`, query, nil, ""); status != http.StatusUnauthorized {
+			t.Fatalf("unexpected status: %d - %s", status, body)
+		}
+	}
+
+	// The host is limited, whatever credentials it sends.
+	query["p"] = "admin"
+	if status, body := MustHTTP("GET", s.URL+`/query`, query, nil, ""); status != 429 {
+		t.Fatalf("unexpected status: %d - %s", status, body)
+	}
+}
+
 // batchWrite JSON Unmarshal tests
 
 // Utility functions for this test suite.
@@ -0,0 +1,156 @@
+package httpd
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/influxdb/influxdb"
+)
+
+// statusTooManyRequests is the status of requests over a limit. It isn't defined by net/http.
+const statusTooManyRequests = 429
+
+// maxRateLimitKeys is the number of users and hosts tracked by the rate limiter
+// before the buckets of idle clients are dropped.
+const maxRateLimitKeys = 10000
+
+// defaultAllowedHeaders are the request headers allowed in CORS requests
+// unless the handler is configured with its own.
+var defaultAllowedHeaders = []string{
+	`Accept`,
+	`Accept-Encoding`,
+	`Authorization`,
+	`Content-Length`,
+	`Content-Type`,
+	`X-CSRF-Token`,
+	`X-HTTP-Method-Override`,
+}
+
+// tokenBucket limits the rate of requests of a client. It holds up to burst
+// tokens and gains rate tokens per second. Each request takes a token.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take takes a token from the bucket. If the bucket is empty it returns false and
+// the time until a token is available.
+func (b *tokenBucket) take(now time.Time, rate float64, burst int) (bool, time.Duration) {
+	b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// full returns true if the bucket has refilled since its last request.
+func (b *tokenBucket) full(now time.Time, rate float64, burst int) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*rate >= float64(burst)
+}
+
+// limitHosts returns a handler that limits the rate of requests of each remote host.
+// It runs before authentication so requests failing to authenticate are limited too.
+func limitHosts(inner http.Handler, h *Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.RateLimit > 0 && !h.allowRequest(w, "host:"+remoteHost(r)) {
+			return
+		}
+		inner.ServeHTTP(w, r)
+	})
+}
+
+// limitUsers returns a handler that limits the rate of requests of each user,
+// whichever hosts the requests are sent from.
+func limitUsers(inner func(http.ResponseWriter, *http.Request, *influxdb.User), h *Handler) func(http.ResponseWriter, *http.Request, *influxdb.User) {
+	return func(w http.ResponseWriter, r *http.Request, user *influxdb.User) {
+		if h.RateLimit > 0 && user != nil && !h.allowRequest(w, "user:"+user.Name) {
+			return
+		}
+		inner(w, r, user)
+	}
+}
+
+// allowRequest takes a token from the bucket of a user or host. If there are
+// none left it writes an error to w and returns false.
+func (h *Handler) allowRequest(w http.ResponseWriter, key string) bool {
+	if ok, wait := h.takeToken(key, time.Now()); !ok {
+		h.stats.Inc("rateLimited")
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		httpError(w, "rate limit exceeded", false, statusTooManyRequests)
+		return false
+	}
+	return true
+}
+
+// takeToken takes a token from the bucket of a user or host.
+func (h *Handler) takeToken(key string, now time.Time) (bool, time.Duration) {
+	burst := h.RateLimitBurst
+	if burst < 1 {
+		burst = int(math.Max(1, math.Ceil(h.RateLimit)))
+	}
+
+	h.bucketsMu.Lock()
+	defer h.bucketsMu.Unlock()
+
+	b := h.buckets[key]
+	if b == nil {
+		if h.buckets == nil {
+			h.buckets = make(map[string]*tokenBucket)
+		}
+
+		// Drop the buckets of clients that are no longer limited.
+		if len(h.buckets) >= maxRateLimitKeys {
+			for k, b := range h.buckets {
+				if b.full(now, h.RateLimit, burst) {
+					delete(h.buckets, k)
+				}
+			}
+		}
+
+		b = &tokenBucket{tokens: float64(burst), last: now}
+		h.buckets[key] = b
+	}
+	return b.take(now, h.RateLimit, burst)
+}
+
+// acquire increments a count of active requests. It returns false, and leaves
+// the count unchanged, if the count would be greater than max. Zero means no limit.
+func acquire(active *int64, max int) bool {
+	if n := atomic.AddInt64(active, 1); max > 0 && n > int64(max) {
+		atomic.AddInt64(active, -1)
+		return false
+	}
+	return true
+}
+
+// release decrements a count of active requests.
+func release(active *int64) {
+	atomic.AddInt64(active, -1)
+}
+
+// errBodyTooLarge returns the error of a request body larger than max bytes.
+func errBodyTooLarge(max int64) error {
+	return fmt.Errorf("request body too large: the limit is %d bytes", max)
+}
+
+// isBodyTooLarge returns true if err is the error returned by a reader from
+// http.MaxBytesReader once the body is read past its limit.
+func isBodyTooLarge(err error) bool {
+	return err != nil && err.Error() == "http: request body too large"
+}
+
+// remoteHost returns the host of the remote address of a request.
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,606 @@
+package httpd
+
+import (
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdb/influxdb"
+	"github.com/influxdb/influxdb/influxql"
+)
+
+// responseEncoder encodes query responses in the format requested by the client.
+type responseEncoder interface {
+	// ContentType returns the content type of the encoded responses.
+	ContentType() string
+
+	// Encode writes a response to w. In chunked mode it's called once per chunk.
+	// Nothing is written if a value of the response can't be encoded.
+	Encode(w io.Writer, resp *influxdb.Response) error
+}
+
+// newResponseEncoder returns the encoder for the first supported media type
+// of an Accept header. It defaults to JSON.
+func newResponseEncoder(accept string, pretty bool) responseEncoder {
+	for _, s := range strings.Split(accept, ",") {
+		typ, _, err := mime.ParseMediaType(strings.TrimSpace(s))
+		if err != nil {
+			continue
+		}
+		switch typ {
+		case "application/json":
+			return &jsonResponseEncoder{pretty: pretty}
+		case "text/csv":
+			return &csvResponseEncoder{}
+		case "application/x-msgpack":
+			return &msgpackResponseEncoder{}
+		}
+	}
+	return &jsonResponseEncoder{pretty: pretty}
+}
+
+// jsonResponseEncoder encodes responses as JSON.
+type jsonResponseEncoder struct {
+	pretty bool
+}
+
+func (e *jsonResponseEncoder) ContentType() string { return "application/json" }
+
+func (e *jsonResponseEncoder) Encode(w io.Writer, resp *influxdb.Response) error {
+	_, err := w.Write(marshalPretty(resp, e.pretty))
+	return err
+}
+
+// csvResponseEncoder encodes responses as CSV. Each series starts with a header
+// of the measurement name, the series' tag keys and its columns. Errors are
+// written as an "error" header followed by the error message.
+type csvResponseEncoder struct{}
+
+func (e *csvResponseEncoder) ContentType() string { return "text/csv" }
+
+func (e *csvResponseEncoder) Encode(w io.Writer, resp *influxdb.Response) error {
+	cw := csv.NewWriter(w)
+	if resp.Err != nil {
+		cw.Write([]string{"error"})
+		cw.Write([]string{resp.Err.Error()})
+	}
+
+	for _, r := range resp.Results {
+		if r.Err != nil {
+			cw.Write([]string{"error"})
+			cw.Write([]string{r.Err.Error()})
+		}
+
+		for _, row := range r.Series {
+			// Sort tag keys so headers are stable across series.
+			keys := make([]string, 0, len(row.Tags))
+			for k := range row.Tags {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+
+			header := make([]string, 0, 1+len(keys)+len(row.Columns))
+			header = append(header, "name")
+			header = append(header, keys...)
+			header = append(header, row.Columns...)
+			cw.Write(header)
+
+			for _, values := range row.Values {
+				record := make([]string, 0, len(header))
+				record = append(record, row.Name)
+				for _, k := range keys {
+					record = append(record, row.Tags[k])
+				}
+				for _, v := range values {
+					record = append(record, formatCSVValue(v))
+				}
+				cw.Write(record)
+			}
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// formatCSVValue returns the string representation of a value in a CSV record.
+func formatCSVValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// msgpackResponseEncoder encodes responses as MessagePack, using the same
+// structure as the JSON encoding. In chunked mode each chunk is a separate object.
+type msgpackResponseEncoder struct{}
+
+func (e *msgpackResponseEncoder) ContentType() string { return "application/x-msgpack" }
+
+func (e *msgpackResponseEncoder) Encode(w io.Writer, resp *influxdb.Response) error {
+	var enc msgpackEncoder
+
+	var n int
+	if len(resp.Results) > 0 {
+		n++
+	}
+	if resp.Err != nil {
+		n++
+	}
+	enc.writeMapHeader(n)
+	if len(resp.Results) > 0 {
+		enc.writeString("results")
+		enc.writeArrayHeader(len(resp.Results))
+		for _, r := range resp.Results {
+			if err := enc.writeResult(r); err != nil {
+				return err
+			}
+		}
+	}
+	if resp.Err != nil {
+		enc.writeString("error")
+		enc.writeString(resp.Err.Error())
+	}
+
+	_, err := w.Write(enc.buf)
+	return err
+}
+
+// msgpackEncoder appends MessagePack encoded values to a buffer.
+type msgpackEncoder struct {
+	buf []byte
+}
+
+// writeResult encodes a statement result.
+func (enc *msgpackEncoder) writeResult(r *influxdb.Result) error {
+	var n int
+	if len(r.Series) > 0 {
+		n++
+	}
+	if r.Err != nil {
+		n++
+	}
+	enc.writeMapHeader(n)
+	if len(r.Series) > 0 {
+		enc.writeString("series")
+		enc.writeArrayHeader(len(r.Series))
+		for _, row := range r.Series {
+			if err := enc.writeRow(row); err != nil {
+				return err
+			}
+		}
+	}
+	if r.Err != nil {
+		enc.writeString("error")
+		enc.writeString(r.Err.Error())
+	}
+	return nil
+}
+
+// writeRow encodes a series, omitting the same empty fields as its JSON encoding.
+func (enc *msgpackEncoder) writeRow(row *influxql.Row) error {
+	n := 1
+	if row.Name != "" {
+		n++
+	}
+	if len(row.Tags) > 0 {
+		n++
+	}
+	if len(row.Values) > 0 {
+		n++
+	}
+	enc.writeMapHeader(n)
+
+	if row.Name != "" {
+		enc.writeString("name")
+		enc.writeString(row.Name)
+	}
+	if len(row.Tags) > 0 {
+		keys := make([]string, 0, len(row.Tags))
+		for k := range row.Tags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		enc.writeString("tags")
+		enc.writeMapHeader(len(keys))
+		for _, k := range keys {
+			enc.writeString(k)
+			enc.writeString(row.Tags[k])
+		}
+	}
+
+	enc.writeString("columns")
+	enc.writeArrayHeader(len(row.Columns))
+	for _, c := range row.Columns {
+		enc.writeString(c)
+	}
+
+	if len(row.Values) > 0 {
+		enc.writeString("values")
+		enc.writeArrayHeader(len(row.Values))
+		for _, values := range row.Values {
+			enc.writeArrayHeader(len(values))
+			for _, v := range values {
+				if err := enc.writeValue(v); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// writeValue encodes a value returned by the query engine.
+func (enc *msgpackEncoder) writeValue(v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		enc.buf = append(enc.buf, 0xc0)
+	case bool:
+		if v {
+			enc.buf = append(enc.buf, 0xc3)
+		} else {
+			enc.buf = append(enc.buf, 0xc2)
+		}
+	case int:
+		enc.writeInt(int64(v))
+	case int32:
+		enc.writeInt(int64(v))
+	case int64:
+		enc.writeInt(v)
+	case uint64:
+		enc.writeUint(v)
+	case float32:
+		enc.buf = append(enc.buf, 0xca)
+		enc.buf = appendUint32(enc.buf, math.Float32bits(v))
+	case float64:
+		enc.buf = append(enc.buf, 0xcb)
+		enc.buf = appendUint64(enc.buf, math.Float64bits(v))
+	case string:
+		enc.writeString(v)
+	case []byte:
+		enc.writeBinary(v)
+	case []interface{}:
+		enc.writeArrayHeader(len(v))
+		for _, v := range v {
+			if err := enc.writeValue(v); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		enc.writeMapHeader(len(keys))
+		for _, k := range keys {
+			enc.writeString(k)
+			if err := enc.writeValue(v[k]); err != nil {
+				return err
+			}
+		}
+	case time.Time:
+		enc.writeString(v.Format(time.RFC3339Nano))
+	default:
+		return fmt.Errorf("msgpack: unsupported type %T", v)
+	}
+	return nil
+}
+
+func (enc *msgpackEncoder) writeInt(v int64) {
+	switch {
+	case v >= 0:
+		enc.writeUint(uint64(v))
+	case v >= -32:
+		enc.buf = append(enc.buf, byte(v))
+	case v >= math.MinInt8:
+		enc.buf = append(enc.buf, 0xd0, byte(v))
+	case v >= math.MinInt16:
+		enc.buf = append(enc.buf, 0xd1)
+		enc.buf = appendUint16(enc.buf, uint16(v))
+	case v >= math.MinInt32:
+		enc.buf = append(enc.buf, 0xd2)
+		enc.buf = appendUint32(enc.buf, uint32(v))
+	default:
+		enc.buf = append(enc.buf, 0xd3)
+		enc.buf = appendUint64(enc.buf, uint64(v))
+	}
+}
+
+func (enc *msgpackEncoder) writeUint(v uint64) {
+	switch {
+	case v <= 0x7f:
+		enc.buf = append(enc.buf, byte(v))
+	case v <= math.MaxUint8:
+		enc.buf = append(enc.buf, 0xcc, byte(v))
+	case v <= math.MaxUint16:
+		enc.buf = append(enc.buf, 0xcd)
+		enc.buf = appendUint16(enc.buf, uint16(v))
+	case v <= math.MaxUint32:
+		enc.buf = append(enc.buf, 0xce)
+		enc.buf = appendUint32(enc.buf, uint32(v))
+	default:
+		enc.buf = append(enc.buf, 0xcf)
+		enc.buf = appendUint64(enc.buf, v)
+	}
+}
+
+func (enc *msgpackEncoder) writeString(s string) {
+	switch n := len(s); {
+	case n < 32:
+		enc.buf = append(enc.buf, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		enc.buf = append(enc.buf, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		enc.buf = append(enc.buf, 0xda)
+		enc.buf = appendUint16(enc.buf, uint16(n))
+	default:
+		enc.buf = append(enc.buf, 0xdb)
+		enc.buf = appendUint32(enc.buf, uint32(n))
+	}
+	enc.buf = append(enc.buf, s...)
+}
+
+func (enc *msgpackEncoder) writeBinary(b []byte) {
+	switch n := len(b); {
+	case n <= math.MaxUint8:
+		enc.buf = append(enc.buf, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		enc.buf = append(enc.buf, 0xc5)
+		enc.buf = appendUint16(enc.buf, uint16(n))
+	default:
+		enc.buf = append(enc.buf, 0xc6)
+		enc.buf = appendUint32(enc.buf, uint32(n))
+	}
+	enc.buf = append(enc.buf, b...)
+}
+
+func (enc *msgpackEncoder) writeArrayHeader(n int) {
+	switch {
+	case n < 16:
+		enc.buf = append(enc.buf, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		enc.buf = append(enc.buf, 0xdc)
+		enc.buf = appendUint16(enc.buf, uint16(n))
+	default:
+		enc.buf = append(enc.buf, 0xdd)
+		enc.buf = appendUint32(enc.buf, uint32(n))
+	}
+}
+
+func (enc *msgpackEncoder) writeMapHeader(n int) {
+	switch {
+	case n < 16:
+		enc.buf = append(enc.buf, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		enc.buf = append(enc.buf, 0xde)
+		enc.buf = appendUint16(enc.buf, uint16(n))
+	default:
+		enc.buf = append(enc.buf, 0xdf)
+		enc.buf = appendUint32(enc.buf, uint32(n))
+	}
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	var a [2]byte
+	binary.BigEndian.PutUint16(a[:], v)
+	return append(b, a[:]...)
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	var a [4]byte
+	binary.BigEndian.PutUint32(a[:], v)
+	return append(b, a[:]...)
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	var a [8]byte
+	binary.BigEndian.PutUint64(a[:], v)
+	return append(b, a[:]...)
+}
+
+// epochPrecisions are the values of the epoch query parameter and their durations.
+var epochPrecisions = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+}
+
+// convertToEpoch returns a copy of the result with its timestamps replaced
+// by the number of units since the Unix epoch.
+func convertToEpoch(r *influxdb.Result, unit time.Duration) *influxdb.Result {
+	other := *r
+	other.Series = make(influxql.Rows, len(r.Series))
+	for i, row := range r.Series {
+		rowCopy := *row
+		rowCopy.Values = make([][]interface{}, len(row.Values))
+		for j, values := range row.Values {
+			a := make([]interface{}, len(values))
+			for k, v := range values {
+				if t, ok := v.(time.Time); ok {
+					a[k] = t.UnixNano() / int64(unit)
+				} else {
+					a[k] = v
+				}
+			}
+			rowCopy.Values[j] = a
+		}
+		other.Series[i] = &rowCopy
+	}
+	return &other
+}
+
+// jsonResponseStream writes a JSON response one series at a time, producing the
+// same document as the JSON encoder without holding the response in memory.
+// Consecutive results of a statement are combined into one result.
+type jsonResponseStream struct {
+	w       io.Writer
+	pretty  bool
+	maxSize int64 // max bytes of series written, zero means no limit
+
+	n           int64 // bytes written
+	err         error // first write error
+	exceeded    bool  // the size limit was exceeded, remaining results are dropped
+	started     bool  // the results array is open
+	results     int   // results written
+	inResult    bool  // a result object is open
+	empty       bool  // the open result has no series or error
+	inSeries    bool  // the series array of the open result is open
+	statementID int   // the statement of the open result
+}
+
+// newJSONResponseStream returns a stream writing a JSON response to w.
+func newJSONResponseStream(w io.Writer, pretty bool, maxSize int64) *jsonResponseStream {
+	return &jsonResponseStream{w: w, pretty: pretty, maxSize: maxSize}
+}
+
+// WriteResult writes the series and error of a result.
+func (s *jsonResponseStream) WriteResult(r *influxdb.Result) {
+	if s.exceeded {
+		return
+	}
+	if !s.started {
+		s.write("{", s.newline(1), `"results":`, s.space(), "[")
+		s.started = true
+	}
+	if s.inResult && r.StatementID != s.statementID {
+		s.endResult()
+	}
+	if !s.inResult {
+		s.beginResult(r.StatementID)
+	}
+
+	for _, row := range r.Series {
+		b, err := s.marshal(row, 4)
+		if err != nil {
+			s.writeError(err)
+			return
+		} else if s.maxSize > 0 && s.n+int64(len(b)) > s.maxSize {
+			s.writeError(fmt.Errorf("max response size exceeded: response is larger than %d bytes. maybe you forgot to use chunked=true?", s.maxSize))
+			s.exceeded = true
+			return
+		}
+
+		if !s.inSeries {
+			s.write(s.newline(3), `"series":`, s.space(), "[")
+			s.inSeries, s.empty = true, false
+		} else {
+			s.write(",")
+		}
+		s.write(s.newline(4))
+		s.write(string(b))
+	}
+
+	if r.Err != nil {
+		s.writeError(r.Err)
+	}
+}
+
+// Close ends the response.
+func (s *jsonResponseStream) Close() error {
+	if !s.started {
+		s.write("{}")
+		return s.err
+	}
+	if s.inResult {
+		s.endResult()
+	}
+	s.write(s.newline(1), "]", s.newline(0), "}")
+	return s.err
+}
+
+// beginResult opens a result object.
+func (s *jsonResponseStream) beginResult(statementID int) {
+	if s.results > 0 {
+		s.write(",")
+	}
+	s.write(s.newline(2), "{")
+	s.inResult, s.empty, s.statementID = true, true, statementID
+	s.results++
+}
+
+// writeError ends the open result with an error. Later results of the same
+// statement are written to a new result.
+func (s *jsonResponseStream) writeError(err error) {
+	b, _ := json.Marshal(err.Error())
+	if s.inSeries {
+		s.write(s.newline(3), "]", ",")
+		s.inSeries = false
+	} else if !s.empty {
+		s.write(",")
+	}
+	s.write(s.newline(3), `"error":`, s.space(), string(b))
+	s.empty = false
+	s.endResult()
+}
+
+// endResult closes the open result object.
+func (s *jsonResponseStream) endResult() {
+	if s.inSeries {
+		s.write(s.newline(3), "]")
+		s.inSeries = false
+	}
+	if s.empty {
+		s.write("}")
+	} else {
+		s.write(s.newline(2), "}")
+	}
+	s.inResult = false
+}
+
+// marshal encodes a value at an indentation level of the document.
+func (s *jsonResponseStream) marshal(v interface{}, level int) ([]byte, error) {
+	if !s.pretty {
+		return json.Marshal(v)
+	}
+	return json.MarshalIndent(v, strings.Repeat("    ", level), "    ")
+}
+
+// newline returns the line break and indentation of a level of the document.
+func (s *jsonResponseStream) newline(level int) string {
+	if !s.pretty {
+		return ""
+	}
+	return "\n" + strings.Repeat("    ", level)
+}
+
+// space returns the space following a key.
+func (s *jsonResponseStream) space() string {
+	if !s.pretty {
+		return ""
+	}
+	return " "
+}
+
+// write writes strings to the underlying writer until a write fails.
+func (s *jsonResponseStream) write(a ...string) {
+	for _, str := range a {
+		if s.err != nil {
+			return
+		}
+		n, err := io.WriteString(s.w, str)
+		s.n += int64(n)
+		s.err = err
+	}
+}
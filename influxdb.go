@@ -67,6 +67,34 @@ var (
 	// ErrUsernameRequired is returned when using a blank username.
 	ErrUsernameRequired = errors.New("username required")
 
+	// ErrRoleExists is returned when creating a duplicate role.
+	ErrRoleExists = errors.New("role exists")
+
+	// ErrRoleNotFound is returned when referring to a non-existent role.
+	ErrRoleNotFound = errors.New("role not found")
+
+	// ErrRoleNameRequired is returned when using a blank role name.
+	ErrRoleNameRequired = errors.New("role name required")
+
+	// ErrPasswordRequired is returned when using a blank password.
+	ErrPasswordRequired = errors.New("password required")
+
+	// ErrLoginLocked is returned when authenticating a user or from a host locked out
+	// after too many failed logins.
+	ErrLoginLocked = errors.New("too many failed logins, try again later")
+
+	// ErrTokenExists is returned when creating a duplicate token.
+	ErrTokenExists = errors.New("token exists")
+
+	// ErrTokenNotFound is returned when referring to a non-existent token.
+	ErrTokenNotFound = errors.New("token not found")
+
+	// ErrTokenNameRequired is returned when using a blank token name.
+	ErrTokenNameRequired = errors.New("token name required")
+
+	// ErrInvalidToken is returned when authenticating with an unknown or expired token.
+	ErrInvalidToken = errors.New("invalid or expired token")
+
 	// ErrInvalidUsername is returned when using a username with invalid characters.
 	ErrInvalidUsername = errors.New("invalid username")
 
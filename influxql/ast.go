@@ -2,6 +2,7 @@ package influxql
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"regexp"
@@ -64,33 +65,45 @@ func (*AlterRetentionPolicyStatement) node()  {}
 func (*CreateContinuousQueryStatement) node() {}
 func (*CreateDatabaseStatement) node()        {}
 func (*CreateRetentionPolicyStatement) node() {}
+func (*CreateRoleStatement) node()            {}
+func (*CreateTokenStatement) node()           {}
 func (*CreateUserStatement) node()            {}
 func (*DeleteStatement) node()                {}
 func (*DropContinuousQueryStatement) node()   {}
 func (*DropDatabaseStatement) node()          {}
 func (*DropMeasurementStatement) node()       {}
 func (*DropRetentionPolicyStatement) node()   {}
+func (*DropRoleStatement) node()              {}
 func (*DropSeriesStatement) node()            {}
+func (*DropTokenStatement) node()             {}
 func (*DropUserStatement) node()              {}
+func (*ExplainStatement) node()               {}
+func (*GrantRoleStatement) node()             {}
 func (*GrantStatement) node()                 {}
 func (*ShowContinuousQueriesStatement) node() {}
 func (*ShowServersStatement) node()           {}
 func (*ShowDatabasesStatement) node()         {}
 func (*ShowFieldKeysStatement) node()         {}
+func (*ShowGrantsForUserStatement) node()     {}
 func (*ShowRetentionPoliciesStatement) node() {}
+func (*ShowRolesStatement) node()             {}
 func (*ShowMeasurementsStatement) node()      {}
 func (*ShowSeriesStatement) node()            {}
 func (*ShowStatsStatement) node()             {}
 func (*ShowDiagnosticsStatement) node()       {}
 func (*ShowTagKeysStatement) node()           {}
 func (*ShowTagValuesStatement) node()         {}
+func (*ShowTokensStatement) node()            {}
 func (*ShowUsersStatement) node()             {}
+func (*RevokeRoleStatement) node()            {}
 func (*RevokeStatement) node()                {}
 func (*SelectStatement) node()                {}
 func (*SetPasswordUserStatement) node()       {}
+func (*UnlockUserStatement) node()            {}
 
 func (*BinaryExpr) node()      {}
 func (*BooleanLiteral) node()  {}
+func (*BoundParameter) node()  {}
 func (*Call) node()            {}
 func (*Dimension) node()       {}
 func (Dimensions) node()       {}
@@ -107,6 +120,7 @@ func (*SortField) node()       {}
 func (SortFields) node()       {}
 func (Sources) node()          {}
 func (*StringLiteral) node()   {}
+func (*SubQuery) node()        {}
 func (*Target) node()          {}
 func (*TimeLiteral) node()     {}
 func (*VarRef) node()          {}
@@ -164,30 +178,41 @@ func (*AlterRetentionPolicyStatement) stmt()  {}
 func (*CreateContinuousQueryStatement) stmt() {}
 func (*CreateDatabaseStatement) stmt()        {}
 func (*CreateRetentionPolicyStatement) stmt() {}
+func (*CreateRoleStatement) stmt()            {}
+func (*CreateTokenStatement) stmt()           {}
 func (*CreateUserStatement) stmt()            {}
 func (*DeleteStatement) stmt()                {}
 func (*DropContinuousQueryStatement) stmt()   {}
 func (*DropDatabaseStatement) stmt()          {}
 func (*DropMeasurementStatement) stmt()       {}
 func (*DropRetentionPolicyStatement) stmt()   {}
+func (*DropRoleStatement) stmt()              {}
 func (*DropSeriesStatement) stmt()            {}
+func (*DropTokenStatement) stmt()             {}
 func (*DropUserStatement) stmt()              {}
+func (*ExplainStatement) stmt()               {}
+func (*GrantRoleStatement) stmt()             {}
 func (*GrantStatement) stmt()                 {}
 func (*ShowContinuousQueriesStatement) stmt() {}
 func (*ShowServersStatement) stmt()           {}
 func (*ShowDatabasesStatement) stmt()         {}
 func (*ShowFieldKeysStatement) stmt()         {}
+func (*ShowGrantsForUserStatement) stmt()     {}
 func (*ShowMeasurementsStatement) stmt()      {}
 func (*ShowRetentionPoliciesStatement) stmt() {}
+func (*ShowRolesStatement) stmt()             {}
 func (*ShowSeriesStatement) stmt()            {}
 func (*ShowStatsStatement) stmt()             {}
 func (*ShowDiagnosticsStatement) stmt()       {}
 func (*ShowTagKeysStatement) stmt()           {}
 func (*ShowTagValuesStatement) stmt()         {}
+func (*ShowTokensStatement) stmt()            {}
 func (*ShowUsersStatement) stmt()             {}
+func (*RevokeRoleStatement) stmt()            {}
 func (*RevokeStatement) stmt()                {}
 func (*SelectStatement) stmt()                {}
 func (*SetPasswordUserStatement) stmt()       {}
+func (*UnlockUserStatement) stmt()            {}
 
 // Expr represents an expression that can be evaluated to a value.
 type Expr interface {
@@ -197,6 +222,7 @@ type Expr interface {
 
 func (*BinaryExpr) expr()      {}
 func (*BooleanLiteral) expr()  {}
+func (*BoundParameter) expr()  {}
 func (*Call) expr()            {}
 func (*DurationLiteral) expr() {}
 func (*nilLiteral) expr()      {}
@@ -215,6 +241,7 @@ type Source interface {
 }
 
 func (*Measurement) source() {}
+func (*SubQuery) source()    {}
 
 // Sources represents a list of sources.
 type Sources []Source
@@ -418,8 +445,14 @@ type GrantStatement struct {
 	// Thing to grant privilege on (e.g., a DB).
 	On string
 
+	// Measurements of the DB the privilege is limited to, if any.
+	Measurement *Measurement
+
 	// Who to grant the privilege to.
 	User string
+
+	// Role to grant the privilege to, instead of a user.
+	Role string
 }
 
 // String returns a string representation of the grant statement.
@@ -430,9 +463,18 @@ func (s *GrantStatement) String() string {
 	if s.On != "" {
 		_, _ = buf.WriteString(" ON ")
 		_, _ = buf.WriteString(s.On)
+		if s.Measurement != nil {
+			_, _ = buf.WriteString(".")
+			_, _ = buf.WriteString(s.Measurement.String())
+		}
 	}
 	_, _ = buf.WriteString(" TO ")
-	_, _ = buf.WriteString(s.User)
+	if s.Role != "" {
+		_, _ = buf.WriteString("ROLE ")
+		_, _ = buf.WriteString(s.Role)
+	} else {
+		_, _ = buf.WriteString(s.User)
+	}
 	return buf.String()
 }
 
@@ -465,6 +507,26 @@ func (s *SetPasswordUserStatement) RequiredPrivileges() ExecutionPrivileges {
 	return ExecutionPrivileges{{Name: "", Privilege: AllPrivileges}}
 }
 
+// UnlockUserStatement represents a command for unlocking a user locked out after failed logins.
+type UnlockUserStatement struct {
+	// Name of the user to unlock.
+	Name string
+}
+
+// String returns a string representation of the unlock user statement.
+func (s *UnlockUserStatement) String() string {
+	var buf bytes.Buffer
+	_, _ = buf.WriteString("ALTER USER ")
+	_, _ = buf.WriteString(s.Name)
+	_, _ = buf.WriteString(" UNLOCK")
+	return buf.String()
+}
+
+// RequiredPrivileges returns the privilege required to execute an UnlockUserStatement.
+func (s *UnlockUserStatement) RequiredPrivileges() ExecutionPrivileges {
+	return ExecutionPrivileges{{Name: "", Privilege: AllPrivileges}}
+}
+
 // RevokeStatement represents a command to revoke a privilege from a user.
 type RevokeStatement struct {
 	// Privilege to be revoked.
@@ -473,8 +535,14 @@ type RevokeStatement struct {
 	// Thing to revoke privilege to (e.g., a DB)
 	On string
 
+	// Measurements of the DB the privilege was limited to, if any.
+	Measurement *Measurement
+
 	// Who to revoke privilege from.
 	User string
+
+	// Role to revoke the privilege from, instead of a user.
+	Role string
 }
 
 // String returns a string representation of the revoke statement.
@@ -485,9 +553,18 @@ func (s *RevokeStatement) String() string {
 	if s.On != "" {
 		_, _ = buf.WriteString(" ON ")
 		_, _ = buf.WriteString(s.On)
+		if s.Measurement != nil {
+			_, _ = buf.WriteString(".")
+			_, _ = buf.WriteString(s.Measurement.String())
+		}
 	}
 	_, _ = buf.WriteString(" FROM ")
-	_, _ = buf.WriteString(s.User)
+	if s.Role != "" {
+		_, _ = buf.WriteString("ROLE ")
+		_, _ = buf.WriteString(s.Role)
+	} else {
+		_, _ = buf.WriteString(s.User)
+	}
 	return buf.String()
 }
 
@@ -496,6 +573,154 @@ func (s *RevokeStatement) RequiredPrivileges() ExecutionPrivileges {
 	return ExecutionPrivileges{{Name: "", Privilege: AllPrivileges}}
 }
 
+// CreateRoleStatement represents a command for creating a new role.
+type CreateRoleStatement struct {
+	// Name of the role to be created.
+	Name string
+}
+
+// String returns a string representation of the create role statement.
+func (s *CreateRoleStatement) String() string {
+	var buf bytes.Buffer
+	_, _ = buf.WriteString("CREATE ROLE ")
+	_, _ = buf.WriteString(s.Name)
+	return buf.String()
+}
+
+// RequiredPrivileges returns the privilege(s) required to execute a CreateRoleStatement.
+func (s *CreateRoleStatement) RequiredPrivileges() ExecutionPrivileges {
+	return ExecutionPrivileges{{Name: "", Privilege: AllPrivileges}}
+}
+
+// DropRoleStatement represents a command for dropping a role.
+type DropRoleStatement struct {
+	// Name of the role to drop.
+	Name string
+}
+
+// String returns a string representation of the drop role statement.
+func (s *DropRoleStatement) String() string {
+	var buf bytes.Buffer
+	_, _ = buf.WriteString("DROP ROLE ")
+	_, _ = buf.WriteString(s.Name)
+	return buf.String()
+}
+
+// RequiredPrivileges returns the privilege(s) required to execute a DropRoleStatement.
+func (s *DropRoleStatement) RequiredPrivileges() ExecutionPrivileges {
+	return ExecutionPrivileges{{Name: "", Privilege: AllPrivileges}}
+}
+
+// CreateTokenStatement represents a command for creating an API token for a user.
+type CreateTokenStatement struct {
+	// Name of the token to be created.
+	Name string
+
+	// User the token authenticates as.
+	User string
+
+	// Privilege the token is limited to.
+	Privilege Privilege
+
+	// Database the token is limited to. Blank means all databases.
+	Database string
+
+	// Duration the token is valid for. Zero means the token doesn't expire.
+	Duration time.Duration
+}
+
+// String returns a string representation of the create token statement.
+func (s *CreateTokenStatement) String() string {
+	var buf bytes.Buffer
+	_, _ = buf.WriteString("CREATE TOKEN ")
+	_, _ = buf.WriteString(s.Name)
+	_, _ = buf.WriteString(" FOR ")
+	_, _ = buf.WriteString(s.User)
+	_, _ = buf.WriteString(" WITH ")
+	_, _ = buf.WriteString(s.Privilege.String())
+	if s.Database != "" {
+		_, _ = buf.WriteString(" ON ")
+		_, _ = buf.WriteString(s.Database)
+	}
+	if s.Duration > 0 {
+		_, _ = buf.WriteString(" DURATION ")
+		_, _ = buf.WriteString(FormatDuration(s.Duration))
+	}
+	return buf.String()
+}
+
+// RequiredPrivileges returns the privilege(s) required to execute a CreateTokenStatement.
+func (s *CreateTokenStatement) RequiredPrivileges() ExecutionPrivileges {
+	return ExecutionPrivileges{{Name: "", Privilege: AllPrivileges}}
+}
+
+// DropTokenStatement represents a command for revoking an API token.
+type DropTokenStatement struct {
+	// Name of the token to drop.
+	Name string
+}
+
+// String returns a string representation of the drop token statement.
+func (s *DropTokenStatement) String() string {
+	var buf bytes.Buffer
+	_, _ = buf.WriteString("DROP TOKEN ")
+	_, _ = buf.WriteString(s.Name)
+	return buf.String()
+}
+
+// RequiredPrivileges returns the privilege(s) required to execute a DropTokenStatement.
+func (s *DropTokenStatement) RequiredPrivileges() ExecutionPrivileges {
+	return ExecutionPrivileges{{Name: "", Privilege: AllPrivileges}}
+}
+
+// GrantRoleStatement represents a command for granting a role to a user.
+type GrantRoleStatement struct {
+	// Role to be granted.
+	Role string
+
+	// Who to grant the role to.
+	User string
+}
+
+// String returns a string representation of the grant role statement.
+func (s *GrantRoleStatement) String() string {
+	var buf bytes.Buffer
+	_, _ = buf.WriteString("GRANT ROLE ")
+	_, _ = buf.WriteString(s.Role)
+	_, _ = buf.WriteString(" TO ")
+	_, _ = buf.WriteString(s.User)
+	return buf.String()
+}
+
+// RequiredPrivileges returns the privilege required to execute a GrantRoleStatement.
+func (s *GrantRoleStatement) RequiredPrivileges() ExecutionPrivileges {
+	return ExecutionPrivileges{{Name: "", Privilege: AllPrivileges}}
+}
+
+// RevokeRoleStatement represents a command to revoke a role from a user.
+type RevokeRoleStatement struct {
+	// Role to be revoked.
+	Role string
+
+	// Who to revoke the role from.
+	User string
+}
+
+// String returns a string representation of the revoke role statement.
+func (s *RevokeRoleStatement) String() string {
+	var buf bytes.Buffer
+	_, _ = buf.WriteString("REVOKE ROLE ")
+	_, _ = buf.WriteString(s.Role)
+	_, _ = buf.WriteString(" FROM ")
+	_, _ = buf.WriteString(s.User)
+	return buf.String()
+}
+
+// RequiredPrivileges returns the privilege required to execute a RevokeRoleStatement.
+func (s *RevokeRoleStatement) RequiredPrivileges() ExecutionPrivileges {
+	return ExecutionPrivileges{{Name: "", Privilege: AllPrivileges}}
+}
+
 // CreateRetentionPolicyStatement represents a command to create a retention policy.
 type CreateRetentionPolicyStatement struct {
 	// Name of policy to create.
@@ -595,6 +820,9 @@ const (
 	NumberFill
 	// PreviousFill means that empty aggregate windows will be filled with whatever the previous aggregate window had
 	PreviousFill
+	// LinearFill means that empty aggregate windows will be filled by interpolating between the nearest non-empty
+	// windows on either side. Windows at the start or end of the range without a value on both sides are left null.
+	LinearFill
 )
 
 // SelectStatement represents a command for extracting data from the database.
@@ -640,6 +868,10 @@ type SelectStatement struct {
 
 	// The value to fill empty aggregate buckets with, if any
 	FillValue interface{}
+
+	// The time zone that GROUP BY time() intervals are aligned to and that result
+	// timestamps are returned in. UTC is used if nil.
+	Location *time.Location
 }
 
 // Clone returns a deep copy of the statement.
@@ -657,6 +889,7 @@ func (s *SelectStatement) Clone() *SelectStatement {
 		Fill:       s.Fill,
 		FillValue:  s.FillValue,
 		IsRawQuery: s.IsRawQuery,
+		Location:   s.Location,
 	}
 	if s.Target != nil {
 		clone.Target = &Target{
@@ -700,6 +933,8 @@ func cloneSource(s Source) Source {
 			m.Regex = &RegexLiteral{Val: regexp.MustCompile(s.Regex.Val.String())}
 		}
 		return m
+	case *SubQuery:
+		return &SubQuery{Statement: s.Statement.Clone()}
 	default:
 		panic("unreachable")
 	}
@@ -769,6 +1004,8 @@ func (s *SelectStatement) String() string {
 		_, _ = buf.WriteString(fmt.Sprintf(" fill(%v)", s.FillValue))
 	case PreviousFill:
 		_, _ = buf.WriteString(" fill(previous)")
+	case LinearFill:
+		_, _ = buf.WriteString(" fill(linear)")
 	}
 	if len(s.SortFields) > 0 {
 		_, _ = buf.WriteString(" ORDER BY ")
@@ -781,6 +1018,9 @@ func (s *SelectStatement) String() string {
 		_, _ = buf.WriteString(" OFFSET ")
 		_, _ = buf.WriteString(strconv.Itoa(s.Offset))
 	}
+	if s.Location != nil {
+		_, _ = fmt.Fprintf(&buf, " tz(%s)", QuoteString(s.Location.String()))
+	}
 	return buf.String()
 }
 
@@ -795,6 +1035,31 @@ func (s *SelectStatement) RequiredPrivileges() ExecutionPrivileges {
 	return ep
 }
 
+// ExplainStatement represents a command for describing how a SELECT statement is executed.
+type ExplainStatement struct {
+	// The statement to explain.
+	Statement *SelectStatement
+
+	// Whether to run the statement and report the time taken by each stage.
+	Analyze bool
+}
+
+// String returns a string representation of the explain statement.
+func (s *ExplainStatement) String() string {
+	var buf bytes.Buffer
+	_, _ = buf.WriteString("EXPLAIN ")
+	if s.Analyze {
+		_, _ = buf.WriteString("ANALYZE ")
+	}
+	_, _ = buf.WriteString(s.Statement.String())
+	return buf.String()
+}
+
+// RequiredPrivileges returns the privilege required to execute the ExplainStatement.
+func (s *ExplainStatement) RequiredPrivileges() ExecutionPrivileges {
+	return s.Statement.RequiredPrivileges()
+}
+
 // OnlyTimeDimensions returns true if the statement has a where clause with only time constraints
 func (s *SelectStatement) OnlyTimeDimensions() bool {
 	return s.walkForTime(s.Condition)
@@ -839,6 +1104,16 @@ func (s *SelectStatement) HasWildcard() bool {
 	return false
 }
 
+// SubQuery returns the subquery in the FROM clause, if there is one.
+func (s *SelectStatement) SubQuery() (*SubQuery, bool) {
+	for _, src := range s.Sources {
+		if sq, ok := src.(*SubQuery); ok {
+			return sq, true
+		}
+	}
+	return nil, false
+}
+
 // GroupByIterval extracts the time interval, if specified.
 func (s *SelectStatement) GroupByInterval() (time.Duration, error) {
 	// return if we've already pulled it out
@@ -853,16 +1128,26 @@ func (s *SelectStatement) GroupByInterval() (time.Duration, error) {
 
 	for _, d := range s.Dimensions {
 		if call, ok := d.Expr.(*Call); ok && strings.ToLower(call.Name) == "time" {
-			// Make sure there is exactly one argument.
-			if len(call.Args) != 1 {
-				return 0, errors.New("time dimension expected one argument")
+			// Make sure there is an interval and an optional offset.
+			if len(call.Args) != 1 && len(call.Args) != 2 {
+				return 0, errors.New("time dimension expected one or two arguments")
+			}
+
+			// The interval isn't known until its bound parameters are bound.
+			if isBoundParameter(call.Args[0]) || (len(call.Args) == 2 && isBoundParameter(call.Args[1])) {
+				return 0, nil
 			}
 
-			// Ensure the argument is a duration.
+			// Ensure the arguments are durations.
 			lit, ok := call.Args[0].(*DurationLiteral)
 			if !ok {
 				return 0, errors.New("time dimension must have one duration argument")
 			}
+			if len(call.Args) == 2 {
+				if _, ok := call.Args[1].(*DurationLiteral); !ok {
+					return 0, errors.New("time dimension offset must be a duration")
+				}
+			}
 			s.groupByInterval = lit.Val
 			return lit.Val, nil
 		}
@@ -870,6 +1155,84 @@ func (s *SelectStatement) GroupByInterval() (time.Duration, error) {
 	return 0, nil
 }
 
+// GroupByWindow returns the intervals of the GROUP BY time() clause, shifted by its
+// offset and aligned to the time zone of the statement. The interval is zero if the
+// statement isn't grouped by time.
+func (s *SelectStatement) GroupByWindow() (Window, error) {
+	interval, err := s.GroupByInterval()
+	if err != nil || interval == 0 {
+		return Window{}, err
+	}
+
+	w := Window{Interval: interval.Nanoseconds(), Location: s.Location}
+	for _, d := range s.Dimensions {
+		if call, ok := d.Expr.(*Call); ok && strings.ToLower(call.Name) == "time" && len(call.Args) == 2 {
+			w.Offset = call.Args[1].(*DurationLiteral).Val.Nanoseconds()
+		}
+	}
+	return w, nil
+}
+
+// Window represents the intervals of a GROUP BY time() clause. Intervals start on
+// multiples of the interval since the epoch, shifted forward by the offset. If a
+// location is set then intervals are aligned to its local time instead of UTC, so
+// a day may be 23 or 25 hours long when the clocks change.
+type Window struct {
+	Interval int64          // the length of each interval in nanoseconds
+	Offset   int64          // the amount each interval is shifted from the epoch in nanoseconds
+	Location *time.Location // the time zone intervals are aligned to, if any
+}
+
+// Truncate returns the start of the interval containing t.
+func (w Window) Truncate(t int64) int64 {
+	if w.Interval <= 0 {
+		return t
+	}
+
+	// find the start of the interval in local time
+	zone := w.zone(t)
+	dt := (t + zone - w.Offset) % w.Interval
+	if dt < 0 {
+		dt += w.Interval
+	}
+	start := t - dt
+
+	// the clocks may have changed between the start of the interval and t. Changes
+	// as long as the interval, such as an hour for hourly intervals, don't move it.
+	if diff := zone - w.zone(start); diff != 0 && abs(diff) < w.Interval {
+		start += diff
+	}
+	return start
+}
+
+// Next returns the start of the interval following the one containing t.
+func (w Window) Next(t int64) int64 {
+	start := w.Truncate(t)
+	next := start + w.Interval
+
+	// intervals that span a clock change are longer or shorter by the change.
+	if diff := w.zone(start) - w.zone(next); diff != 0 && abs(diff) < w.Interval {
+		next += diff
+	}
+	return w.Truncate(next)
+}
+
+// zone returns the offset from UTC of the window's location at t in nanoseconds.
+func (w Window) zone(t int64) int64 {
+	if w.Location == nil {
+		return 0
+	}
+	_, offset := time.Unix(0, t).In(w.Location).Zone()
+	return int64(offset) * int64(time.Second)
+}
+
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
 // SetTimeRange sets the start and end time of the select statement to [start, end). i.e. start inclusive, end exclusive.
 // This is used commonly for continuous queries so the start and end are in buckets.
 func (s *SelectStatement) SetTimeRange(start, end time.Time) error {
@@ -1003,12 +1366,24 @@ func walkNames(exp Expr) []string {
 		if len(expr.Args) == 0 {
 			return nil
 		}
-		lit, ok := expr.Args[0].(*VarRef)
-		if !ok {
-			return nil
+		switch arg := expr.Args[0].(type) {
+		case *VarRef:
+			names := []string{arg.Val}
+
+			// top() and bottom() can also select tag keys
+			if isTopBottom(expr) {
+				for _, arg := range expr.Args[1:] {
+					if ref, ok := arg.(*VarRef); ok {
+						names = append(names, ref.Val)
+					}
+				}
+			}
+			return names
+		case *Call:
+			// nested calls such as count(distinct(value))
+			return walkNames(arg)
 		}
-
-		return []string{lit.Val}
+		return nil
 	case *BinaryExpr:
 		var ret []string
 		ret = append(ret, walkNames(expr.LHS)...)
@@ -1036,6 +1411,13 @@ func walkFunctionCalls(exp Expr) []*Call {
 	case *VarRef:
 		return nil
 	case *Call:
+		// moving window functions are applied to the output of their argument
+		if isTransform(expr) {
+			if len(expr.Args) == 0 {
+				return nil
+			}
+			return walkFunctionCalls(expr.Args[0])
+		}
 		return []*Call{expr}
 	case *BinaryExpr:
 		var ret []*Call
@@ -1560,6 +1942,52 @@ func (s *ShowUsersStatement) RequiredPrivileges() ExecutionPrivileges {
 	return ExecutionPrivileges{{Name: "", Privilege: AllPrivileges}}
 }
 
+// ShowTokensStatement represents a command for listing API tokens.
+type ShowTokensStatement struct{}
+
+// String retuns a string representation of the ShowTokensStatement.
+func (s *ShowTokensStatement) String() string {
+	return "SHOW TOKENS"
+}
+
+// RequiredPrivileges returns the privilege(s) required to execute a ShowTokensStatement
+func (s *ShowTokensStatement) RequiredPrivileges() ExecutionPrivileges {
+	return ExecutionPrivileges{{Name: "", Privilege: AllPrivileges}}
+}
+
+// ShowRolesStatement represents a command for listing roles.
+type ShowRolesStatement struct{}
+
+// String retuns a string representation of the ShowRolesStatement.
+func (s *ShowRolesStatement) String() string {
+	return "SHOW ROLES"
+}
+
+// RequiredPrivileges returns the privilege(s) required to execute a ShowRolesStatement
+func (s *ShowRolesStatement) RequiredPrivileges() ExecutionPrivileges {
+	return ExecutionPrivileges{{Name: "", Privilege: AllPrivileges}}
+}
+
+// ShowGrantsForUserStatement represents a command for listing the privileges of a user,
+// including those granted through its roles.
+type ShowGrantsForUserStatement struct {
+	// Name of the user to display privileges.
+	Name string
+}
+
+// String returns a string representation of the show grants for user statement.
+func (s *ShowGrantsForUserStatement) String() string {
+	var buf bytes.Buffer
+	_, _ = buf.WriteString("SHOW GRANTS FOR ")
+	_, _ = buf.WriteString(s.Name)
+	return buf.String()
+}
+
+// RequiredPrivileges returns the privilege(s) required to execute a ShowGrantsForUserStatement
+func (s *ShowGrantsForUserStatement) RequiredPrivileges() ExecutionPrivileges {
+	return ExecutionPrivileges{{Name: "", Privilege: AllPrivileges}}
+}
+
 // ShowFieldKeysStatement represents a command for listing field keys.
 type ShowFieldKeysStatement struct {
 	// Data source that fields are extracted from.
@@ -1678,14 +2106,16 @@ func (a Dimensions) Normalize() (time.Duration, []string, error) {
 	for _, dim := range a {
 		switch expr := dim.Expr.(type) {
 		case *Call:
-			// Ensure the call is time() and it only has one duration argument.
+			// Ensure the call is time() and it only has a duration argument and an optional offset.
 			// If we already have a duration
 			if strings.ToLower(expr.Name) != "time" {
 				return 0, nil, errors.New("only time() calls allowed in dimensions")
-			} else if len(expr.Args) != 1 {
-				return 0, nil, errors.New("time dimension expected one argument")
+			} else if len(expr.Args) != 1 && len(expr.Args) != 2 {
+				return 0, nil, errors.New("time dimension expected one or two arguments")
 			} else if lit, ok := expr.Args[0].(*DurationLiteral); !ok {
 				return 0, nil, errors.New("time dimension must have one duration argument")
+			} else if _, ok := expr.Args[len(expr.Args)-1].(*DurationLiteral); !ok {
+				return 0, nil, errors.New("time dimension offset must be a duration")
 			} else if dur != 0 {
 				return 0, nil, errors.New("multiple time dimensions not allowed")
 			} else {
@@ -1759,6 +2189,17 @@ func (m *Measurement) String() string {
 	return buf.String()
 }
 
+// SubQuery represents a SELECT statement used as a datasource. The rows it returns
+// are queried by the outer statement as though they were series of a measurement.
+type SubQuery struct {
+	Statement *SelectStatement
+}
+
+// String returns a string representation of the subquery.
+func (s *SubQuery) String() string {
+	return fmt.Sprintf("(%s)", s.Statement.String())
+}
+
 // VarRef represents a reference to a variable.
 type VarRef struct {
 	Val string
@@ -1855,6 +2296,20 @@ type nilLiteral struct{}
 // String returns a string representation of the literal.
 func (l *nilLiteral) String() string { return `nil` }
 
+// BoundParameter represents a placeholder for a value bound when the query is executed.
+type BoundParameter struct {
+	Name string
+}
+
+// String returns a string representation of the bound parameter.
+func (p *BoundParameter) String() string { return "$" + p.Name }
+
+// isBoundParameter returns true if the expression is a bound parameter.
+func isBoundParameter(expr Expr) bool {
+	_, ok := expr.(*BoundParameter)
+	return ok
+}
+
 // BinaryExpr represents an operation between two expressions.
 type BinaryExpr struct {
 	Op  Token
@@ -2058,6 +2513,9 @@ func Walk(v Visitor, node Node) {
 			Walk(v, c)
 		}
 
+	case *ExplainStatement:
+		Walk(v, n.Statement)
+
 	case *ParenExpr:
 		Walk(v, n.Expr)
 
@@ -2101,6 +2559,9 @@ func Walk(v Visitor, node Node) {
 			Walk(v, s)
 		}
 
+	case *SubQuery:
+		Walk(v, n.Statement)
+
 	case *Target:
 		if n != nil {
 			Walk(v, n.Measurement)
@@ -2182,6 +2643,110 @@ type rewriterFunc func(Node) Node
 
 func (fn rewriterFunc) Rewrite(n Node) Node { return fn(n) }
 
+// BindParams replaces the bound parameters in a statement with literals of their values.
+// Strings that look like a date or a date time are bound as time literals, like they are in
+// queries, and a map with a single "duration" key is bound as a duration literal.
+// Returns an error if a parameter has no value or a value of an unsupported type.
+func BindParams(stmt Statement, params map[string]interface{}) (err error) {
+	bind := func(expr Expr) Expr {
+		if expr == nil || err != nil {
+			return expr
+		}
+		return RewriteFunc(expr, func(n Node) Node {
+			p, ok := n.(*BoundParameter)
+			if !ok || err != nil {
+				return n
+			}
+
+			v, ok := params[p.Name]
+			if !ok {
+				err = fmt.Errorf("missing parameter: %s", p)
+				return n
+			}
+			lit, e := bindValue(v)
+			if e != nil {
+				err = fmt.Errorf("invalid parameter %s: %s", p, e)
+				return n
+			}
+			return lit
+		}).(Expr)
+	}
+
+	WalkFunc(stmt, func(n Node) {
+		switch n := n.(type) {
+		case *Field:
+			n.Expr = bind(n.Expr)
+		case *Dimension:
+			n.Expr = bind(n.Expr)
+		case *SelectStatement:
+			n.Condition = bind(n.Condition)
+		case *DeleteStatement:
+			n.Condition = bind(n.Condition)
+		case *DropSeriesStatement:
+			n.Condition = bind(n.Condition)
+		case *ShowSeriesStatement:
+			n.Condition = bind(n.Condition)
+		case *ShowMeasurementsStatement:
+			n.Condition = bind(n.Condition)
+		case *ShowTagKeysStatement:
+			n.Condition = bind(n.Condition)
+		case *ShowTagValuesStatement:
+			n.Condition = bind(n.Condition)
+		}
+	})
+	return err
+}
+
+// bindValue returns the literal for a bound parameter value.
+func bindValue(v interface{}) (Expr, error) {
+	switch v := v.(type) {
+	case string:
+		if isDateTimeString(v) {
+			t, err := time.Parse(DateTimeFormat, v)
+			if err != nil {
+				if t, err = time.Parse(time.RFC3339Nano, v); err != nil {
+					return nil, errors.New("unable to parse datetime")
+				}
+			}
+			return &TimeLiteral{Val: t}, nil
+		} else if isDateString(v) {
+			t, err := time.Parse(DateFormat, v)
+			if err != nil {
+				return nil, errors.New("unable to parse date")
+			}
+			return &TimeLiteral{Val: t}, nil
+		}
+		return &StringLiteral{Val: v}, nil
+	case float64:
+		return &NumberLiteral{Val: v}, nil
+	case int:
+		return &NumberLiteral{Val: float64(v)}, nil
+	case int64:
+		return &NumberLiteral{Val: float64(v)}, nil
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return &NumberLiteral{Val: f}, nil
+	case bool:
+		return &BooleanLiteral{Val: v}, nil
+	case time.Time:
+		return &TimeLiteral{Val: v}, nil
+	case time.Duration:
+		return &DurationLiteral{Val: v}, nil
+	case map[string]interface{}:
+		if s, ok := v["duration"].(string); ok && len(v) == 1 {
+			d, err := ParseDuration(s)
+			if err != nil {
+				return nil, err
+			}
+			return &DurationLiteral{Val: d}, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported type %T", v)
+}
+
 // Eval evaluates expr against a map.
 func Eval(expr Expr, m map[string]interface{}) interface{} {
 	if expr == nil {
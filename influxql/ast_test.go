@@ -114,6 +114,64 @@ func TestSelectStatement_GroupByInterval(t *testing.T) {
 	}
 }
 
+// Ensure the SELECT statement can extract the GROUP BY intervals with their offset and time zone.
+func TestSelectStatement_GroupByWindow(t *testing.T) {
+	q := "SELECT sum(value) from foo GROUP BY time(1h, 15m) tz('Europe/Berlin')"
+	stmt, err := influxql.NewParser(strings.NewReader(q)).ParseStatement()
+	if err != nil {
+		t.Fatalf("invalid statement: %q: %s", stmt, err)
+	}
+
+	w, err := stmt.(*influxql.SelectStatement).GroupByWindow()
+	if err != nil {
+		t.Fatalf("error parsing group by window: %s", err.Error())
+	} else if w.Interval != int64(time.Hour) || w.Offset != int64(15*time.Minute) || w.Location.String() != "Europe/Berlin" {
+		t.Fatalf("unexpected window: %#v", w)
+	}
+}
+
+// Ensure a window aligns intervals to its offset and time zone.
+func TestWindow(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		w     influxql.Window
+		t     string
+		start string
+		next  string
+	}{
+		// intervals are aligned to the epoch by default
+		{w: influxql.Window{Interval: int64(time.Hour)}, t: "2015-03-10T10:30:00Z", start: "2015-03-10T10:00:00Z", next: "2015-03-10T11:00:00Z"},
+
+		// offsets shift intervals forward
+		{w: influxql.Window{Interval: int64(time.Hour), Offset: int64(15 * time.Minute)}, t: "2015-03-10T10:30:00Z", start: "2015-03-10T10:15:00Z", next: "2015-03-10T11:15:00Z"},
+		{w: influxql.Window{Interval: int64(time.Hour), Offset: int64(15 * time.Minute)}, t: "2015-03-10T10:10:00Z", start: "2015-03-10T09:15:00Z", next: "2015-03-10T10:15:00Z"},
+
+		// days start at local midnight
+		{w: influxql.Window{Interval: int64(24 * time.Hour), Location: berlin}, t: "2015-03-10T10:30:00Z", start: "2015-03-09T23:00:00Z", next: "2015-03-10T23:00:00Z"},
+
+		// days are 23 and 25 hours long when the clocks change
+		{w: influxql.Window{Interval: int64(24 * time.Hour), Location: berlin}, t: "2015-03-29T10:30:00Z", start: "2015-03-28T23:00:00Z", next: "2015-03-29T22:00:00Z"},
+		{w: influxql.Window{Interval: int64(24 * time.Hour), Location: berlin}, t: "2015-10-25T10:30:00Z", start: "2015-10-24T22:00:00Z", next: "2015-10-25T23:00:00Z"},
+
+		// hours aren't affected by the clocks changing
+		{w: influxql.Window{Interval: int64(time.Hour), Location: berlin}, t: "2015-03-29T01:30:00Z", start: "2015-03-29T01:00:00Z", next: "2015-03-29T02:00:00Z"},
+	}
+
+	for i, tt := range tests {
+		ts := mustParseTime(tt.t).UnixNano()
+		if start := time.Unix(0, tt.w.Truncate(ts)).UTC(); !start.Equal(mustParseTime(tt.start)) {
+			t.Errorf("%d. %s: start mismatch:\n  exp=%s\n  got=%s", i, tt.t, tt.start, start)
+		}
+		if next := time.Unix(0, tt.w.Next(ts)).UTC(); !next.Equal(mustParseTime(tt.next)) {
+			t.Errorf("%d. %s: next mismatch:\n  exp=%s\n  got=%s", i, tt.t, tt.next, next)
+		}
+	}
+}
+
 // Ensure the SELECT statment can have its start and end time set
 func TestSelectStatement_SetTimeRange(t *testing.T) {
 	q := "SELECT sum(value) from foo GROUP BY time(10m)"
@@ -574,6 +632,44 @@ func TestRewrite(t *testing.T) {
 	}
 }
 
+// Ensure bound parameters are replaced by literals of their values.
+func TestBindParams(t *testing.T) {
+	var tests = []struct {
+		s      string
+		params map[string]interface{}
+		stmt   string
+		err    string
+	}{
+		{
+			s:      `SELECT mean(value) FROM cpu WHERE host = $host AND value > $min AND time > $start GROUP BY time($interval)`,
+			params: map[string]interface{}{"host": `serverA'`, "min": float64(10), "start": "2000-01-01T00:00:00Z", "interval": map[string]interface{}{"duration": "10m"}},
+			stmt:   `SELECT mean(value) FROM cpu WHERE host = 'serverA\'' AND value > 10.000 AND time > "2000-01-01 00:00:00" GROUP BY time(10m)`,
+		},
+		{
+			s:      `SELECT value FROM cpu WHERE time > now() - $ago AND up = $up`,
+			params: map[string]interface{}{"ago": time.Hour, "up": true},
+			stmt:   `SELECT value FROM cpu WHERE time > now() - 1h AND up = true`,
+		},
+		{
+			s:      `SHOW MEASUREMENTS WHERE region = $region`,
+			params: map[string]interface{}{"region": "us-west"},
+			stmt:   `SHOW MEASUREMENTS WHERE region = 'us-west'`,
+		},
+		{s: `SELECT value FROM cpu WHERE host = $host`, err: `missing parameter: $host`},
+		{s: `SELECT value FROM cpu WHERE host = $host`, params: map[string]interface{}{"host": []string{"a"}}, err: `invalid parameter $host: unsupported type []string`},
+	}
+
+	for i, tt := range tests {
+		stmt := MustParseStatement(tt.s)
+		err := influxql.BindParams(stmt, tt.params)
+		if !reflect.DeepEqual(tt.err, errstring(err)) {
+			t.Errorf("%d. %s: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
+		} else if err == nil && stmt.String() != tt.stmt {
+			t.Errorf("%d. %s: mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.stmt, stmt.String())
+		}
+	}
+}
+
 // Ensure an expression can be reduced.
 func TestEval(t *testing.T) {
 	for i, tt := range []struct {
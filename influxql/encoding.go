@@ -0,0 +1,433 @@
+package influxql
+
+// This file contains the binary encoding of map function output. Mappers running on
+// remote servers use it to send each interval back to the server running the query.
+// Every value is prefixed with a one byte type tag so the reducers receive the same
+// types they would have received from a local mapper.
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// MarshalFunc represents a function that encodes the output of a MapFunc so it can
+// be sent to a remote server.
+type MarshalFunc func(interface{}) ([]byte, error)
+
+// Binary value type tags.
+const (
+	binaryNil byte = iota
+	binaryFloat
+	binaryInteger
+	binaryBoolean
+	binaryString
+	binaryMap
+	binaryArray
+	binaryStruct
+)
+
+// errBinaryShortBuffer is returned when a binary map output is truncated.
+var errBinaryShortBuffer = errors.New("binary map output: short buffer")
+
+// InitializeBinaryMarshaller takes an aggregate call from the query and returns the
+// function used to encode the output of its MapFunc.
+func InitializeBinaryMarshaller(c *Call) (MarshalFunc, error) {
+	// if c is nil it's a raw data query
+	if c == nil {
+		return func(v interface{}) ([]byte, error) {
+			a, _ := v.([]*rawQueryMapOutput)
+			b := appendUvarint(nil, uint64(len(a)))
+			for _, o := range a {
+				var err error
+				b = appendVarint(b, o.Timestamp)
+				if b, err = appendBinaryValue(b, o.Values); err != nil {
+					return nil, err
+				}
+			}
+			return b, nil
+		}, nil
+	}
+
+	// Retrieve marshal function by name
+	switch strings.ToLower(c.Name) {
+	case "mean":
+		return func(v interface{}) ([]byte, error) {
+			o, ok := v.(*meanMapOutput)
+			if !ok || o == nil {
+				return []byte{binaryNil}, nil
+			}
+			b := appendUvarint([]byte{binaryStruct}, uint64(o.Count))
+			return appendBinaryFloat(b, o.Sum), nil
+		}, nil
+	case "spread":
+		return func(v interface{}) ([]byte, error) {
+			o, ok := v.(spreadMapOutput)
+			if !ok {
+				return []byte{binaryNil}, nil
+			}
+			return appendBinaryFloat(appendBinaryFloat([]byte{binaryStruct}, o.Min), o.Max), nil
+		}, nil
+	case "top", "bottom":
+		return func(v interface{}) ([]byte, error) {
+			a, _ := v.(topBottomPoints)
+			b := appendUvarint(nil, uint64(len(a)))
+			for _, p := range a {
+				var err error
+				b = appendVarint(b, p.Time)
+				if b, err = appendBinaryValue(b, p.Value); err != nil {
+					return nil, err
+				}
+
+				// Encode tags in sorted order so the output is deterministic.
+				keys := make([]string, 0, len(p.Tags))
+				for k := range p.Tags {
+					keys = append(keys, k)
+				}
+				sort.Strings(keys)
+
+				b = appendUvarint(b, uint64(len(keys)))
+				for _, k := range keys {
+					b = appendBinaryString(appendBinaryString(b, k), p.Tags[k])
+				}
+			}
+			return b, nil
+		}, nil
+	case "percentile_approx":
+		return func(v interface{}) ([]byte, error) {
+			t, ok := v.(*tdigest)
+			if !ok || t == nil {
+				return []byte{binaryNil}, nil
+			}
+			t.Compress()
+
+			// centroid counts are always whole numbers so they're encoded as varints.
+			b := appendBinaryFloat([]byte{binaryStruct}, t.Compression)
+			b = appendBinaryFloat(appendBinaryFloat(b, t.Min), t.Max)
+			b = appendUvarint(b, uint64(len(t.Centroids)))
+			for _, c := range t.Centroids {
+				b = appendUvarint(appendBinaryFloat(b, c.Mean), uint64(c.Count))
+			}
+			return b, nil
+		}, nil
+	case "first", "last":
+		return func(v interface{}) ([]byte, error) {
+			o, ok := v.(firstLastMapOutput)
+			if !ok {
+				return []byte{binaryNil}, nil
+			}
+			return appendBinaryValue(appendVarint([]byte{binaryStruct}, o.Time), o.Val)
+		}, nil
+	default:
+		return func(v interface{}) ([]byte, error) {
+			return appendBinaryValue(nil, v)
+		}, nil
+	}
+}
+
+// InitializeBinaryUnmarshaller takes an aggregate call from the query and returns the
+// function used to decode the output of its MapFunc from a remote server.
+func InitializeBinaryUnmarshaller(c *Call) (UnmarshalFunc, error) {
+	// if c is nil it's a raw data query
+	if c == nil {
+		return func(b []byte) (interface{}, error) {
+			d := &binaryDecoder{b: b}
+			n := d.uvarint()
+			if d.err != nil {
+				return nil, d.err
+			} else if n > uint64(len(b)) {
+				return nil, errBinaryShortBuffer
+			}
+
+			// the engine treats a nil slice as an empty interval
+			var a []*rawQueryMapOutput
+			for i := uint64(0); i < n && d.err == nil; i++ {
+				o := &rawQueryMapOutput{Timestamp: d.varint()}
+				o.Values = d.value()
+				a = append(a, o)
+			}
+			return a, d.err
+		}, nil
+	}
+
+	// Retrieve unmarshal function by name
+	switch strings.ToLower(c.Name) {
+	case "mean":
+		return func(b []byte) (interface{}, error) {
+			d := &binaryDecoder{b: b}
+			if d.byte() == binaryNil {
+				return nil, d.err
+			}
+			o := &meanMapOutput{Count: int(d.uvarint()), Sum: d.float()}
+			return o, d.err
+		}, nil
+	case "spread":
+		return func(b []byte) (interface{}, error) {
+			d := &binaryDecoder{b: b}
+			if d.byte() == binaryNil {
+				return nil, d.err
+			}
+			o := spreadMapOutput{Min: d.float(), Max: d.float()}
+			return o, d.err
+		}, nil
+	case "top", "bottom":
+		return func(b []byte) (interface{}, error) {
+			d := &binaryDecoder{b: b}
+			n := d.uvarint()
+			if d.err != nil {
+				return nil, d.err
+			} else if n > uint64(len(b)) {
+				return nil, errBinaryShortBuffer
+			}
+
+			var a topBottomPoints
+			for i := uint64(0); i < n && d.err == nil; i++ {
+				p := topBottomPoint{Time: d.varint()}
+				p.Value = d.value()
+				if tagN := d.uvarint(); tagN > 0 && tagN <= uint64(len(d.b)) {
+					p.Tags = make(map[string]string, tagN)
+					for j := uint64(0); j < tagN && d.err == nil; j++ {
+						k := d.string()
+						p.Tags[k] = d.string()
+					}
+				} else if tagN > 0 {
+					d.err = errBinaryShortBuffer
+				}
+				a = append(a, p)
+			}
+			if d.err != nil || len(a) == 0 {
+				return nil, d.err
+			}
+			return a, nil
+		}, nil
+	case "percentile_approx":
+		return func(b []byte) (interface{}, error) {
+			d := &binaryDecoder{b: b}
+			if d.byte() == binaryNil {
+				return nil, d.err
+			}
+
+			t := &tdigest{Compression: d.float(), Min: d.float(), Max: d.float()}
+			n := d.uvarint()
+			if d.err != nil {
+				return nil, d.err
+			} else if n > uint64(len(b)) {
+				return nil, errBinaryShortBuffer
+			}
+			t.Centroids = make([]tdigestCentroid, 0, n)
+			for i := uint64(0); i < n && d.err == nil; i++ {
+				c := tdigestCentroid{Mean: d.float()}
+				c.Count = float64(d.uvarint())
+				t.Centroids = append(t.Centroids, c)
+			}
+			if d.err != nil {
+				return nil, d.err
+			}
+			return t, nil
+		}, nil
+	case "first", "last":
+		return func(b []byte) (interface{}, error) {
+			d := &binaryDecoder{b: b}
+			if d.byte() == binaryNil {
+				return nil, d.err
+			}
+			o := firstLastMapOutput{Time: d.varint()}
+			o.Val = d.value()
+			return o, d.err
+		}, nil
+	default:
+		return func(b []byte) (interface{}, error) {
+			d := &binaryDecoder{b: b}
+			v := d.value()
+			return v, d.err
+		}, nil
+	}
+}
+
+// appendBinaryValue appends the tagged encoding of a field value to b.
+func appendBinaryValue(b []byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(b, binaryNil), nil
+	case float64:
+		return appendBinaryFloat(append(b, binaryFloat), v), nil
+	case int64:
+		return appendVarint(append(b, binaryInteger), v), nil
+	case int:
+		return appendVarint(append(b, binaryInteger), int64(v)), nil
+	case bool:
+		if v {
+			return append(b, binaryBoolean, 1), nil
+		}
+		return append(b, binaryBoolean, 0), nil
+	case string:
+		return appendBinaryString(append(b, binaryString), v), nil
+	case map[string]interface{}:
+		// Encode keys in sorted order so the output is deterministic.
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		b = appendUvarint(append(b, binaryMap), uint64(len(keys)))
+		for _, k := range keys {
+			var err error
+			b = appendBinaryString(b, k)
+			if b, err = appendBinaryValue(b, v[k]); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case []interface{}:
+		b = appendUvarint(append(b, binaryArray), uint64(len(v)))
+		for _, e := range v {
+			var err error
+			if b, err = appendBinaryValue(b, e); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	default:
+		return nil, fmt.Errorf("unable to encode map output type: %T", v)
+	}
+}
+
+func appendBinaryFloat(b []byte, f float64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], math.Float64bits(f))
+	return append(b, buf[:]...)
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
+
+func appendVarint(b []byte, v int64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
+
+func appendBinaryString(b []byte, s string) []byte {
+	return append(appendUvarint(b, uint64(len(s))), s...)
+}
+
+// binaryDecoder reads values from a binary map output. The first error
+// encountered is saved and all subsequent reads return zero values.
+type binaryDecoder struct {
+	b   []byte
+	err error
+}
+
+func (d *binaryDecoder) byte() byte {
+	if d.err != nil {
+		return 0
+	} else if len(d.b) == 0 {
+		d.err = errBinaryShortBuffer
+		return 0
+	}
+	v := d.b[0]
+	d.b = d.b[1:]
+	return v
+}
+
+func (d *binaryDecoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		d.err = errBinaryShortBuffer
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *binaryDecoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.b)
+	if n <= 0 {
+		d.err = errBinaryShortBuffer
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *binaryDecoder) float() float64 {
+	if d.err != nil {
+		return 0
+	} else if len(d.b) < 8 {
+		d.err = errBinaryShortBuffer
+		return 0
+	}
+	v := math.Float64frombits(binary.BigEndian.Uint64(d.b))
+	d.b = d.b[8:]
+	return v
+}
+
+func (d *binaryDecoder) string() string {
+	n := d.uvarint()
+	if d.err != nil {
+		return ""
+	} else if uint64(len(d.b)) < n {
+		d.err = errBinaryShortBuffer
+		return ""
+	}
+	v := string(d.b[:n])
+	d.b = d.b[n:]
+	return v
+}
+
+// value reads a tagged field value.
+func (d *binaryDecoder) value() interface{} {
+	switch typ := d.byte(); typ {
+	case binaryNil:
+		return nil
+	case binaryFloat:
+		return d.float()
+	case binaryInteger:
+		return d.varint()
+	case binaryBoolean:
+		return d.byte() != 0
+	case binaryString:
+		return d.string()
+	case binaryMap:
+		n := d.uvarint()
+		if n > uint64(len(d.b)) {
+			d.err = errBinaryShortBuffer
+			return nil
+		}
+		m := make(map[string]interface{}, n)
+		for i := uint64(0); i < n && d.err == nil; i++ {
+			k := d.string()
+			m[k] = d.value()
+		}
+		return m
+	case binaryArray:
+		n := d.uvarint()
+		if n > uint64(len(d.b)) {
+			d.err = errBinaryShortBuffer
+			return nil
+		}
+		a := make([]interface{}, 0, n)
+		for i := uint64(0); i < n && d.err == nil; i++ {
+			a = append(a, d.value())
+		}
+		return a
+	default:
+		if d.err == nil {
+			d.err = fmt.Errorf("unknown binary map output type: %d", typ)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,124 @@
+package influxql_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/influxdb/influxdb/influxql"
+)
+
+// Ensure the output of each map function can be encoded and decoded.
+func TestBinaryMarshaller(t *testing.T) {
+	points := []point{
+		{seriesID: 1, timestamp: 10, value: float64(3)},
+		{seriesID: 1, timestamp: 20, value: float64(5)},
+		{seriesID: 2, timestamp: 5, value: float64(-2)},
+	}
+
+	for i, tt := range []struct {
+		call string
+		mapf influxql.MapFunc
+		pts  []point
+	}{
+		{call: `count(value)`, mapf: influxql.MapCount, pts: points},
+		{call: `sum(value)`, mapf: influxql.MapSum, pts: points},
+		{call: `sum(value)`, mapf: influxql.MapSum},
+		{call: `mean(value)`, mapf: influxql.MapMean, pts: points},
+		{call: `min(value)`, mapf: influxql.MapMin, pts: points},
+		{call: `max(value)`, mapf: influxql.MapMax, pts: points},
+		{call: `spread(value)`, mapf: influxql.MapSpread, pts: points},
+		{call: `spread(value)`, mapf: influxql.MapSpread},
+		{call: `first(value)`, mapf: influxql.MapFirst, pts: points},
+		{call: `last(value)`, mapf: influxql.MapLast, pts: points},
+		{call: `last(value)`, mapf: influxql.MapLast},
+		{call: `percentile(value, 90)`, mapf: influxql.MapEcho, pts: points},
+		{call: `percentile_approx(value, 90)`, mapf: influxql.MapTDigest(100), pts: points},
+		{call: `percentile_approx(value, 90)`, mapf: influxql.MapTDigest(100)},
+		{call: `top(value, 2)`, mapf: influxql.MapTop(2, nil), pts: points},
+		{call: `bottom(value, host, 2)`, mapf: influxql.MapBottom(2, []string{"host"}), pts: points},
+		{call: `top(value, 2)`, mapf: influxql.MapTop(2, nil)},
+		{mapf: influxql.MapRawQuery, pts: points},
+		{mapf: influxql.MapRawQuery, pts: []point{
+			{seriesID: 1, timestamp: 10, value: map[string]interface{}{"a": float64(1), "b": "x", "c": true, "d": int64(-7), "e": nil}},
+		}},
+	} {
+		var c *influxql.Call
+		if tt.call != "" {
+			expr, err := influxql.ParseExpr(tt.call)
+			if err != nil {
+				t.Fatalf("%d. parse: %s", i, err)
+			}
+			c = expr.(*influxql.Call)
+		}
+
+		marshal, err := influxql.InitializeBinaryMarshaller(c)
+		if err != nil {
+			t.Fatalf("%d. marshaller: %s", i, err)
+		}
+		unmarshal, err := influxql.InitializeBinaryUnmarshaller(c)
+		if err != nil {
+			t.Fatalf("%d. unmarshaller: %s", i, err)
+		}
+
+		exp := tt.mapf(&iterator{points: tt.pts, tags: map[uint64]map[string]string{1: {"host": "serverA"}, 2: {"host": "serverB"}}})
+		b, err := marshal(exp)
+		if err != nil {
+			t.Errorf("%d. %s: marshal: %s", i, tt.call, err)
+			continue
+		}
+		v, err := unmarshal(b)
+		if err != nil {
+			t.Errorf("%d. %s: unmarshal: %s", i, tt.call, err)
+		} else if !reflect.DeepEqual(normalize(exp), normalize(v)) {
+			t.Errorf("%d. %s: mismatch:\n\nexp=%#v\n\ngot=%#v\n\n", i, tt.call, exp, v)
+		}
+	}
+}
+
+// Ensure a truncated binary map output returns an error.
+func TestBinaryUnmarshaller_ErrShortBuffer(t *testing.T) {
+	c := &influxql.Call{Name: "mean", Args: []influxql.Expr{&influxql.VarRef{Val: "value"}}}
+	marshal, _ := influxql.InitializeBinaryMarshaller(c)
+	unmarshal, _ := influxql.InitializeBinaryUnmarshaller(c)
+
+	b, err := marshal(influxql.MapMean(&iterator{points: []point{{seriesID: 1, timestamp: 10, value: float64(1)}}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := unmarshal(b[:len(b)-1]); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+// normalize converts empty slices to nil so encoded outputs can be compared.
+func normalize(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Slice && rv.Len() == 0 {
+		return nil
+	}
+	return v
+}
+
+// point represents a single value returned by iterator.
+type point struct {
+	seriesID  uint64
+	timestamp int64
+	value     interface{}
+}
+
+// iterator represents an influxql.TagIterator over a fixed set of points.
+type iterator struct {
+	points []point
+	tags   map[uint64]map[string]string
+}
+
+func (itr *iterator) Tags(seriesID uint64) map[string]string { return itr.tags[seriesID] }
+
+func (itr *iterator) Next() (seriesID uint64, timestamp int64, value interface{}) {
+	if len(itr.points) == 0 {
+		return 0, 0, nil
+	}
+	p := itr.points[0]
+	itr.points = itr.points[1:]
+	return p.seriesID, p.timestamp, p.value
+}
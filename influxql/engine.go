@@ -3,9 +3,11 @@ package influxql
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"hash/fnv"
 	"math"
 	"sort"
+	"strings"
 	"time"
 )
 
@@ -41,8 +43,13 @@ type MapReduceJob struct {
 	TMax            int64            // maximum time specified in the query
 	key             []byte           // a key that identifies the MRJob so it can be sorted
 	interval        int64            // the group by interval of the query
+	window          Window           // the group by intervals of the query, with their offset and time zone
 	stmt            *SelectStatement // the select statement this job was created for
 	chunkSize       int              // the number of points to buffer in raw queries before returning a chunked response
+	processors      []processor      // the processors of each field, kept between chunks for moving window functions
+	maxBuckets      int              // the max number of group by intervals in the result, zero for no limit
+	timeout         time.Duration    // the max time the query can run for, zero for no limit
+	deadline        time.Time        // the time the query times out
 }
 
 func (m *MapReduceJob) Open() error {
@@ -76,6 +83,11 @@ func (m *MapReduceJob) Execute(out chan *Row, filterEmptyResults bool) {
 	}
 	defer m.Close()
 
+	if err := m.checkDeadline(); err != nil {
+		out <- &Row{Err: err}
+		return
+	}
+
 	// if it's a raw query we handle processing differently
 	if m.stmt.IsRawQuery {
 		m.processRawQuery(out, filterEmptyResults)
@@ -98,14 +110,21 @@ func (m *MapReduceJob) Execute(out chan *Row, filterEmptyResults bool) {
 	var pointCountInResult int
 
 	// if the user didn't specify a start time or a group by interval, we're returning a single point that describes the entire range
+	window := m.window
 	if m.TMin == 0 || m.interval == 0 {
 		// they want a single aggregate point for the entire time range
 		m.interval = m.TMax - m.TMin
+		window = Window{Interval: m.interval}
 		pointCountInResult = 1
 	} else {
 		intervalTop := m.TMax/m.interval*m.interval + m.interval
 		intervalBottom := m.TMin / m.interval * m.interval
 		pointCountInResult = int((intervalTop - intervalBottom) / m.interval)
+
+		// offsets and time zones can split an interval at either end of the range
+		if window.Offset != 0 || window.Location != nil {
+			pointCountInResult++
+		}
 	}
 
 	// For group by time queries, limit the number of data points returned by the limit and offset
@@ -123,37 +142,32 @@ func (m *MapReduceJob) Execute(out chan *Row, filterEmptyResults bool) {
 		}
 	}
 
-	// If we are exceeding our MaxGroupByPoints and we aren't a raw query, error out
-	if pointCountInResult > MaxGroupByPoints {
+	// If we are exceeding the max number of buckets and we aren't a raw query, error out
+	if m.maxBuckets > 0 && pointCountInResult > m.maxBuckets {
 		out <- &Row{
 			Err: errors.New("too many points in the group by interval. maybe you forgot to specify a where time clause?"),
 		}
 		return
 	}
 
-	// initialize the times of the aggregate points
-	resultValues := make([][]interface{}, pointCountInResult)
+	// initialize the times of the aggregate points. Intervals can differ in length if the
+	// query has a time zone so they're found by stepping through the window.
+	resultValues := make([][]interface{}, 0, pointCountInResult)
 
 	// ensure that the start time for the results is on the start of the window
-	startTimeBucket := m.TMin / m.interval * m.interval
-
-	for i, _ := range resultValues {
-		var t int64
-		if m.stmt.Offset > 0 {
-			t = startTimeBucket + (int64(i+1) * m.interval * int64(m.stmt.Offset))
-		} else {
-			t = startTimeBucket + (int64(i+1) * m.interval) - m.interval
-		}
-
-		// If we start getting out of our max time range, then truncate values and return
-		if t > m.TMax {
-			resultValues = resultValues[:i]
-			break
-		}
+	t := window.Truncate(m.TMin)
+	for i := 0; i < m.stmt.Offset; i++ {
+		t = window.Next(t)
+	}
 
+	// stop once we get out of our max time range
+	for ; t <= m.TMax && len(resultValues) < pointCountInResult; t = window.Next(t) {
 		// we always include time so we need one more column than we have aggregates
 		vals := make([]interface{}, 0, len(aggregates)+1)
-		resultValues[i] = append(vals, time.Unix(0, t).UTC())
+		resultValues = append(resultValues, append(vals, m.resultTime(t)))
+	}
+	if len(resultValues) == 0 {
+		return
 	}
 
 	// This just makes sure that if they specify a start time less than what the start time would be with the offset,
@@ -190,6 +204,13 @@ func (m *MapReduceJob) Execute(out chan *Row, filterEmptyResults bool) {
 	// processes the result values if there's any math in there
 	resultValues = m.processResults(resultValues)
 
+	// top() and bottom() return a row for each point selected along with its tag values
+	if len(aggregates) == 1 && isTopBottom(aggregates[0]) {
+		_, tagKeys, _ := topBottomArgs(aggregates[0])
+		columnNames = append(columnNames, tagKeys...)
+		resultValues = m.processTopBottom(resultValues, tagKeys)
+	}
+
 	// handle any fill options
 	resultValues = m.processFill(resultValues)
 
@@ -204,6 +225,22 @@ func (m *MapReduceJob) Execute(out chan *Row, filterEmptyResults bool) {
 	out <- row
 }
 
+// checkDeadline returns an error if the query has run for longer than its timeout.
+func (m *MapReduceJob) checkDeadline() error {
+	if !m.deadline.IsZero() && time.Now().After(m.deadline) {
+		return fmt.Errorf("query timeout exceeded: query ran for longer than %s", m.timeout)
+	}
+	return nil
+}
+
+// resultTime returns a timestamp for the results in the time zone of the query.
+func (m *MapReduceJob) resultTime(t int64) time.Time {
+	if m.stmt.Location != nil {
+		return time.Unix(0, t).In(m.stmt.Location)
+	}
+	return time.Unix(0, t).UTC()
+}
+
 // processRawQuery will handle running the mappers and then reducing their output
 // for queries that pull back raw data values without computing any kind of aggregates.
 func (m *MapReduceJob) processRawQuery(out chan *Row, filterEmptyResults bool) {
@@ -227,6 +264,11 @@ func (m *MapReduceJob) processRawQuery(out chan *Row, filterEmptyResults bool) {
 
 	// loop until we've emptied out all the mappers and sent everything out
 	for {
+		if err := m.checkDeadline(); err != nil {
+			out <- &Row{Err: err}
+			return
+		}
+
 		// collect up to the limit for each mapper
 		for j, mm := range m.Mappers {
 			// only pull from mappers that potentially have more data and whose last output has been completely sent out.
@@ -321,6 +363,7 @@ func (m *MapReduceJob) processRawQuery(out chan *Row, filterEmptyResults bool) {
 			row := m.processRawResults(valuesToReturn)
 			// perform post-processing, such as math.
 			row.Values = m.processResults(row.Values)
+			m.processRawTransforms(row)
 			out <- row
 			valuesToReturn = make([]*rawQueryMapOutput, 0)
 		}
@@ -333,19 +376,22 @@ func (m *MapReduceJob) processRawQuery(out chan *Row, filterEmptyResults bool) {
 
 	if len(valuesToReturn) == 0 {
 		if !filterEmptyResults {
-			out <- m.processRawResults(nil)
+			row := m.processRawResults(nil)
+			m.processRawTransforms(row)
+			out <- row
 		}
 	} else {
 		row := m.processRawResults(valuesToReturn)
 		// perform post-processing, such as math.
 		row.Values = m.processResults(row.Values)
+		m.processRawTransforms(row)
 		out <- row
 	}
 }
 
 // processsResults will apply any math that was specified in the select statement against the passed in results
 func (m *MapReduceJob) processResults(results [][]interface{}) [][]interface{} {
-	hasMath := false
+	hasMath := m.hasTransforms()
 	for _, f := range m.stmt.Fields {
 		if _, ok := f.Expr.(*BinaryExpr); ok {
 			hasMath = true
@@ -358,11 +404,15 @@ func (m *MapReduceJob) processResults(results [][]interface{}) [][]interface{} {
 		return results
 	}
 
-	processors := make([]processor, len(m.stmt.Fields))
-	startIndex := 1
-	for i, f := range m.stmt.Fields {
-		processors[i], startIndex = getProcessor(f.Expr, startIndex)
+	// moving window functions carry state from one chunk of results to the next
+	if m.processors == nil {
+		m.processors = make([]processor, len(m.stmt.Fields))
+		startIndex := 1
+		for i, f := range m.stmt.Fields {
+			m.processors[i], startIndex = getProcessor(f.Expr, startIndex)
+		}
 	}
+	processors := m.processors
 
 	mathResults := make([][]interface{}, len(results))
 	for i, _ := range mathResults {
@@ -377,6 +427,74 @@ func (m *MapReduceJob) processResults(results [][]interface{}) [][]interface{} {
 	return mathResults
 }
 
+// hasTransforms returns true if any field of the statement uses a moving window function.
+func (m *MapReduceJob) hasTransforms() bool {
+	var ok bool
+	WalkFunc(m.stmt.Fields, func(n Node) {
+		if c, isCall := n.(*Call); isCall && isTransform(c) {
+			ok = true
+		}
+	})
+	return ok
+}
+
+// processRawTransforms names the columns of a raw query row after its fields and removes
+// points for which moving window functions had nothing to compute, such as the first
+// point of difference().
+func (m *MapReduceJob) processRawTransforms(row *Row) {
+	if !m.hasTransforms() {
+		return
+	}
+
+	row.Columns = make([]string, len(m.stmt.Fields)+1)
+	row.Columns[0] = "time"
+	for i, f := range m.stmt.Fields {
+		row.Columns[i+1] = f.Name()
+	}
+
+	values := row.Values[:0]
+	for _, vals := range row.Values {
+		for _, v := range vals[1:] {
+			if v != nil {
+				values = append(values, vals)
+				break
+			}
+		}
+	}
+	row.Values = values
+}
+
+// processTopBottom expands the points selected by top() or bottom() for each interval into
+// separate rows containing the point's time, value and the values of the requested tag keys.
+func (m *MapReduceJob) processTopBottom(results [][]interface{}, tagKeys []string) [][]interface{} {
+	values := make([][]interface{}, 0, len(results))
+	for _, vals := range results {
+		points, _ := vals[1].(topBottomPoints)
+
+		// keep the interval if nothing was selected so it can be filled
+		if len(points) == 0 {
+			row := make([]interface{}, 2+len(tagKeys))
+			row[0] = vals[0]
+			values = append(values, row)
+			continue
+		}
+
+		for _, p := range points {
+			row := make([]interface{}, 2, 2+len(tagKeys))
+			row[0], row[1] = m.resultTime(p.Time), p.Value
+			for _, key := range tagKeys {
+				if v, ok := p.Tags[key]; ok {
+					row = append(row, v)
+				} else {
+					row = append(row, nil)
+				}
+			}
+			values = append(values, row)
+		}
+	}
+	return values
+}
+
 // processFill will take the results and return new reaults (or the same if no fill modifications are needed) with whatever fill options the query has.
 func (m *MapReduceJob) processFill(results [][]interface{}) [][]interface{} {
 	// don't do anything if we're supposed to leave the nulls
@@ -404,6 +522,10 @@ func (m *MapReduceJob) processFill(results [][]interface{}) [][]interface{} {
 		return newResults
 	}
 
+	if m.stmt.Fill == LinearFill {
+		return processLinearFill(results)
+	}
+
 	// they're either filling with previous values or a specific number
 	for i, vals := range results {
 		// start at 1 because the first value is always time
@@ -423,11 +545,46 @@ func (m *MapReduceJob) processFill(results [][]interface{}) [][]interface{} {
 	return results
 }
 
+// processLinearFill fills each run of nil values in a column by interpolating between the
+// numeric values on either side of it, based on the time of each row. Runs at the start or
+// end of the results, or next to a non-numeric value, are left as nil.
+func processLinearFill(results [][]interface{}) [][]interface{} {
+	if len(results) == 0 {
+		return results
+	}
+
+	// start at 1 because the first value is always time
+	for j := 1; j < len(results[0]); j++ {
+		prev := -1
+		for i, vals := range results {
+			if vals[j] == nil {
+				continue
+			}
+
+			if prev >= 0 && i-prev > 1 && isNumeric(results[prev][j]) && isNumeric(vals[j]) {
+				t0 := results[prev][0].(time.Time).UnixNano()
+				t1 := vals[0].(time.Time).UnixNano()
+				v0, v1 := toFloat(results[prev][j]), toFloat(vals[j])
+				for k := prev + 1; k < i; k++ {
+					t := results[k][0].(time.Time).UnixNano()
+					results[k][j] = v0 + (v1-v0)*float64(t-t0)/float64(t1-t0)
+				}
+			}
+			prev = i
+		}
+	}
+	return results
+}
+
 func getProcessor(expr Expr, startIndex int) (processor, int) {
 	switch expr := expr.(type) {
 	case *VarRef:
 		return newEchoProcessor(startIndex), startIndex + 1
 	case *Call:
+		if isTransform(expr) {
+			inner, index := getProcessor(expr.Args[0], startIndex)
+			return newTransformProcessor(expr, inner), index
+		}
 		return newEchoProcessor(startIndex), startIndex + 1
 	case *BinaryExpr:
 		return getBinaryProcessor(expr, startIndex)
@@ -461,6 +618,75 @@ func newLiteralProcessor(val interface{}) processor {
 	}
 }
 
+// newTransformProcessor returns a processor that applies a moving window function to the
+// values of the inner processor. It keeps state between calls so it must be given the
+// rows of a single series in time order. Nil and non-numeric values are skipped.
+func newTransformProcessor(c *Call, inner processor) processor {
+	switch strings.ToLower(c.Name) {
+	case "moving_average":
+		n := int(c.Args[1].(*NumberLiteral).Val)
+		var window []float64
+		var sum float64
+		return func(values []interface{}) interface{} {
+			v := inner(values)
+			if !isNumeric(v) {
+				return nil
+			}
+			window = append(window, toFloat(v))
+			sum += toFloat(v)
+			if len(window) > n {
+				sum -= window[0]
+				window = window[1:]
+			}
+			if len(window) < n {
+				return nil
+			}
+			return sum / float64(n)
+		}
+	case "difference":
+		var prev interface{}
+		return func(values []interface{}) interface{} {
+			v := inner(values)
+			if !isNumeric(v) {
+				return nil
+			}
+			defer func() { prev = v }()
+			if prev == nil {
+				return nil
+			}
+			return toFloat(v) - toFloat(prev)
+		}
+	case "cumulative_sum":
+		var sum float64
+		return func(values []interface{}) interface{} {
+			v := inner(values)
+			if !isNumeric(v) {
+				return nil
+			}
+			sum += toFloat(v)
+			return sum
+		}
+	case "elapsed":
+		unit := time.Nanosecond
+		if len(c.Args) == 2 {
+			unit = c.Args[1].(*DurationLiteral).Val
+		}
+		var prev time.Time
+		return func(values []interface{}) interface{} {
+			t, ok := values[0].(time.Time)
+			if !ok || inner(values) == nil {
+				return nil
+			}
+			defer func() { prev = t }()
+			if prev.IsZero() {
+				return nil
+			}
+			return int64(t.Sub(prev) / unit)
+		}
+	}
+	panic("unreachable")
+}
+
 func getBinaryProcessor(expr *BinaryExpr, startIndex int) (processor, int) {
 	lhs, index := getProcessor(expr.LHS, startIndex)
 	rhs, index := getProcessor(expr.RHS, index)
@@ -584,13 +810,13 @@ func (m *MapReduceJob) processRawResults(values []*rawQueryMapOutput) *Row {
 		vals := make([]interface{}, len(selectNames))
 
 		if singleValue {
-			vals[0] = time.Unix(0, v.Timestamp).UTC()
+			vals[0] = m.resultTime(v.Timestamp)
 			vals[1] = v.Values.(interface{})
 		} else {
 			fields := v.Values.(map[string]interface{})
 
 			// time is always the first value
-			vals[0] = time.Unix(0, v.Timestamp).UTC()
+			vals[0] = m.resultTime(v.Timestamp)
 
 			// populate the other values
 			for i := 1; i < len(selectNames); i++ {
@@ -618,6 +844,10 @@ func (m *MapReduceJob) processAggregate(c *Call, reduceFunc ReduceFunc, resultVa
 
 	// populate the result values for each interval of time
 	for i, _ := range resultValues {
+		if err := m.checkDeadline(); err != nil {
+			return err
+		}
+
 		// collect the results from each mapper
 		for j, mm := range m.Mappers {
 			res, err := mm.NextInterval()
@@ -677,13 +907,19 @@ type Planner struct {
 
 	// Returns the current time. Defaults to time.Now().
 	Now func() time.Time
+
+	// Limits on the resources a query can use. Zero means no limit.
+	MaxSeries  int           // max number of series selected by a query
+	MaxBuckets int           // max number of group by intervals per series. Defaults to MaxGroupByPoints.
+	Timeout    time.Duration // max time a query can run for, including planning
 }
 
 // NewPlanner returns a new instance of Planner.
 func NewPlanner(db DB) *Planner {
 	return &Planner{
-		DB:  db,
-		Now: time.Now,
+		DB:         db,
+		Now:        time.Now,
+		MaxBuckets: MaxGroupByPoints,
 	}
 }
 
@@ -691,9 +927,20 @@ func NewPlanner(db DB) *Planner {
 func (p *Planner) Plan(stmt *SelectStatement, chunkSize int) (*Executor, error) {
 	now := p.Now().UTC()
 
+	// The timeout is measured in real time, even if the planner's clock isn't.
+	var deadline time.Time
+	if p.Timeout > 0 {
+		deadline = time.Now().Add(p.Timeout)
+	}
+
 	// Replace instances of "now()" with the current time.
 	stmt.Condition = Reduce(stmt.Condition, &nowValuer{Now: now})
 
+	// Fields that refer to several measurements are planned per measurement and joined.
+	if isJoin(stmt) {
+		return p.planJoin(stmt, chunkSize)
+	}
+
 	// Begin an unopened transaction.
 	tx, err := p.DB.Begin()
 	if err != nil {
@@ -705,9 +952,18 @@ func (p *Planner) Plan(stmt *SelectStatement, chunkSize int) (*Executor, error)
 	if err != nil {
 		return nil, err
 	}
+	window, err := stmt.GroupByWindow()
+	if err != nil {
+		return nil, err
+	}
 
 	// TODO: hanldle queries that select from multiple measurements. This assumes that we're only selecting from a single one
-	jobs, err := tx.CreateMapReduceJobs(stmt, tags)
+	var jobs []*MapReduceJob
+	if sq, ok := stmt.SubQuery(); ok {
+		jobs, err = p.planSubQuery(stmt, sq, tags, chunkSize)
+	} else {
+		jobs, err = tx.CreateMapReduceJobs(stmt, tags)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -725,10 +981,25 @@ func (p *Planner) Plan(stmt *SelectStatement, chunkSize int) (*Executor, error)
 		}
 	}
 
+	// Ensure the query doesn't select more series than allowed.
+	if p.MaxSeries > 0 {
+		var n int
+		for _, j := range jobs {
+			n += len(j.TagSet.SeriesIDs)
+		}
+		if n > p.MaxSeries {
+			return nil, fmt.Errorf("max series exceeded: query selects %d series, the limit is %d. maybe you forgot a where or slimit clause?", n, p.MaxSeries)
+		}
+	}
+
 	for _, j := range jobs {
 		j.interval = interval.Nanoseconds()
+		j.window = window
 		j.stmt = stmt
 		j.chunkSize = chunkSize
+		j.maxBuckets = p.MaxBuckets
+		j.timeout = p.Timeout
+		j.deadline = deadline
 	}
 
 	return &Executor{tx: tx, stmt: stmt, jobs: jobs, interval: interval.Nanoseconds()}, nil
@@ -741,6 +1012,20 @@ type Executor struct {
 	stmt     *SelectStatement // original statement
 	jobs     []*MapReduceJob  // one job per unique tag set that will return in the query
 	interval int64            // the group by interval of the query in nanoseconds
+	join     *join            // the statements joined by the query, if it joins measurements
+}
+
+// Jobs returns the MapReduceJobs the executor runs, including those of each measurement of a join.
+func (e *Executor) Jobs() []*MapReduceJob {
+	if e.join == nil {
+		return e.jobs
+	}
+
+	var jobs []*MapReduceJob
+	for _, other := range e.join.executors {
+		jobs = append(jobs, other.Jobs()...)
+	}
+	return jobs
 }
 
 // Execute begins execution of the query and returns a channel to receive rows.
@@ -763,6 +1048,13 @@ func (e *Executor) execute(out chan *Row) {
 	// Ensure the the MRJobs close after execution.
 	defer e.close()
 
+	// Joins run a statement for each measurement and combine their rows
+	if e.join != nil {
+		e.join.execute(out)
+		close(out)
+		return
+	}
+
 	// If we have multiple tag sets we'll want to filter out the empty ones
 	filterEmptyResults := len(e.jobs) > 1
 
@@ -7,6 +7,8 @@ package influxql
 // When adding an aggregate function, define a mapper, a reducer, and add them in the switch statement in the MapReduceFuncs function
 
 import (
+	"bytes"
+	"container/heap"
 	"encoding/json"
 	"fmt"
 	"math"
@@ -20,6 +22,13 @@ type Iterator interface {
 	Next() (seriesID uint64, timestamp int64, value interface{})
 }
 
+// TagIterator represents an iterator that can also return the tags of the series it iterates
+// over. Map functions that return tag values, such as top() and bottom(), require it.
+type TagIterator interface {
+	Iterator
+	Tags(seriesID uint64) map[string]string
+}
+
 // MapFunc represents a function used for mapping over a sequential series of data.
 // The iterator represents a single group by interval
 type MapFunc func(Iterator) interface{}
@@ -43,13 +52,31 @@ func InitializeMapFunc(c *Call) (MapFunc, error) {
 		if len(c.Args) != 2 {
 			return nil, fmt.Errorf("expected two arguments for percentile()")
 		}
+	} else if strings.ToLower(c.Name) == "percentile_approx" {
+		if _, _, err := percentileApproxArgs(c); err != nil {
+			return nil, err
+		}
+	} else if isTopBottom(c) {
+		if _, _, err := topBottomArgs(c); err != nil {
+			return nil, err
+		}
 	} else if len(c.Args) != 1 {
 		return nil, fmt.Errorf("expected one argument for %s()", c.Name)
 	}
 
-	// Ensure the argument is a variable reference.
-	_, ok := c.Args[0].(*VarRef)
-	if !ok {
+	// Ensure the argument is a variable reference or, for count(), a call to distinct().
+	switch arg := c.Args[0].(type) {
+	case *VarRef:
+	case *Call:
+		if !isCountDistinct(c) {
+			return nil, fmt.Errorf("expected field argument in %s()", c.Name)
+		} else if len(arg.Args) != 1 {
+			return nil, fmt.Errorf("expected one argument for %s()", arg.Name)
+		} else if _, ok := arg.Args[0].(*VarRef); !ok {
+			return nil, fmt.Errorf("expected field argument in %s()", arg.Name)
+		}
+		return MapDistinct, nil
+	default:
 		return nil, fmt.Errorf("expected field argument in %s()", c.Name)
 	}
 
@@ -73,12 +100,25 @@ func InitializeMapFunc(c *Call) (MapFunc, error) {
 		return MapFirst, nil
 	case "last":
 		return MapLast, nil
+	case "median", "mode":
+		return MapEcho, nil
+	case "distinct":
+		return MapDistinct, nil
+	case "top":
+		n, tagKeys, _ := topBottomArgs(c)
+		return MapTop(n, tagKeys), nil
+	case "bottom":
+		n, tagKeys, _ := topBottomArgs(c)
+		return MapBottom(n, tagKeys), nil
 	case "percentile":
 		_, ok := c.Args[1].(*NumberLiteral)
 		if !ok {
 			return nil, fmt.Errorf("expected float argument in percentile()")
 		}
 		return MapEcho, nil
+	case "percentile_approx":
+		_, compression, _ := percentileApproxArgs(c)
+		return MapTDigest(compression), nil
 	default:
 		return nil, fmt.Errorf("function not found: %q", c.Name)
 	}
@@ -89,6 +129,9 @@ func InitializeReduceFunc(c *Call) (ReduceFunc, error) {
 	// Retrieve reduce function by name.
 	switch strings.ToLower(c.Name) {
 	case "count":
+		if isCountDistinct(c) {
+			return ReduceCountDistinct, nil
+		}
 		return ReduceSum, nil
 	case "sum":
 		return ReduceSum, nil
@@ -106,12 +149,33 @@ func InitializeReduceFunc(c *Call) (ReduceFunc, error) {
 		return ReduceFirst, nil
 	case "last":
 		return ReduceLast, nil
+	case "median":
+		return ReduceMedian, nil
+	case "mode":
+		return ReduceMode, nil
+	case "distinct":
+		return ReduceDistinct, nil
+	case "top", "bottom":
+		n, tagKeys, err := topBottomArgs(c)
+		if err != nil {
+			return nil, err
+		}
+		if strings.ToLower(c.Name) == "top" {
+			return ReduceTop(n, tagKeys), nil
+		}
+		return ReduceBottom(n, tagKeys), nil
 	case "percentile":
 		lit, ok := c.Args[1].(*NumberLiteral)
 		if !ok {
 			return nil, fmt.Errorf("expected float argument in percentile()")
 		}
 		return ReducePercentile(lit.Val), nil
+	case "percentile_approx":
+		percentile, compression, err := percentileApproxArgs(c)
+		if err != nil {
+			return nil, err
+		}
+		return ReducePercentileApprox(percentile, compression), nil
 	default:
 		return nil, fmt.Errorf("function not found: %q", c.Name)
 	}
@@ -128,8 +192,27 @@ func InitializeUnmarshaller(c *Call) (UnmarshalFunc, error) {
 		}, nil
 	}
 
+	// count(distinct()) is mapped by MapDistinct
+	if isCountDistinct(c) {
+		return unmarshalValues, nil
+	}
+
 	// Retrieve marshal function by name
 	switch strings.ToLower(c.Name) {
+	case "median", "mode", "distinct":
+		return unmarshalValues, nil
+	case "top", "bottom":
+		return func(b []byte) (interface{}, error) {
+			var o topBottomPoints
+			err := json.Unmarshal(b, &o)
+			return o, err
+		}, nil
+	case "percentile_approx":
+		return func(b []byte) (interface{}, error) {
+			var o *tdigest
+			err := json.Unmarshal(b, &o)
+			return o, err
+		}, nil
 	case "mean":
 		return func(b []byte) (interface{}, error) {
 			var o meanMapOutput
@@ -137,22 +220,23 @@ func InitializeUnmarshaller(c *Call) (UnmarshalFunc, error) {
 			return &o, err
 		}, nil
 	case "spread":
+		// The spread, first and last reducers assert map outputs by value, not by pointer.
 		return func(b []byte) (interface{}, error) {
 			var o spreadMapOutput
 			err := json.Unmarshal(b, &o)
-			return &o, err
+			return o, err
 		}, nil
 	case "first":
 		return func(b []byte) (interface{}, error) {
 			var o firstLastMapOutput
 			err := json.Unmarshal(b, &o)
-			return &o, err
+			return o, err
 		}, nil
 	case "last":
 		return func(b []byte) (interface{}, error) {
 			var o firstLastMapOutput
 			err := json.Unmarshal(b, &o)
-			return &o, err
+			return o, err
 		}, nil
 	default:
 		return func(b []byte) (interface{}, error) {
@@ -163,6 +247,22 @@ func InitializeUnmarshaller(c *Call) (UnmarshalFunc, error) {
 	}
 }
 
+// unmarshalValues unmarshals the list of values output by MapEcho and MapDistinct.
+func unmarshalValues(b []byte) (interface{}, error) {
+	var a []interface{}
+	err := json.Unmarshal(b, &a)
+	return a, err
+}
+
+// isCountDistinct returns true if the call is count(distinct(field)).
+func isCountDistinct(c *Call) bool {
+	if strings.ToLower(c.Name) != "count" || len(c.Args) != 1 {
+		return false
+	}
+	arg, ok := c.Args[0].(*Call)
+	return ok && strings.ToLower(arg.Name) == "distinct"
+}
+
 // MapCount computes the number of values in an iterator.
 func MapCount(itr Iterator) interface{} {
 	n := 0
@@ -561,6 +661,468 @@ func ReducePercentile(percentile float64) ReduceFunc {
 	}
 }
 
+// percentileApproxArgs returns the percentile and compression passed to percentile_approx().
+// The compression is optional and defaults to DefaultTDigestCompression.
+func percentileApproxArgs(c *Call) (float64, float64, error) {
+	if len(c.Args) != 2 && len(c.Args) != 3 {
+		return 0, 0, fmt.Errorf("expected two or three arguments for percentile_approx()")
+	}
+
+	lit, ok := c.Args[1].(*NumberLiteral)
+	if !ok || lit.Val < 0 || lit.Val > 100 {
+		return 0, 0, fmt.Errorf("expected percentile between 0 and 100 in percentile_approx()")
+	}
+
+	compression := float64(DefaultTDigestCompression)
+	if len(c.Args) == 3 {
+		arg, ok := c.Args[2].(*NumberLiteral)
+		if !ok || arg.Val < 1 || arg.Val > MaxTDigestCompression {
+			return 0, 0, fmt.Errorf("expected compression between 1 and %d in percentile_approx()", MaxTDigestCompression)
+		}
+		compression = arg.Val
+	}
+	return lit.Val, compression, nil
+}
+
+// MapTDigest builds a t-digest of the numeric values for each group by interval so
+// that percentiles can be estimated without sending every value to the reducer.
+func MapTDigest(compression float64) MapFunc {
+	return func(itr Iterator) interface{} {
+		var t *tdigest
+		for _, k, v := itr.Next(); k != 0; _, k, v = itr.Next() {
+			if !isNumeric(v) {
+				continue
+			} else if t == nil {
+				t = newTDigest(compression)
+			}
+			t.Add(toFloat(v), 1)
+		}
+		if t == nil {
+			return nil
+		}
+		t.Compress()
+		return t
+	}
+}
+
+// ReducePercentileApprox merges the t-digests from each mapper and estimates the percentile.
+func ReducePercentileApprox(percentile, compression float64) ReduceFunc {
+	return func(values []interface{}) interface{} {
+		var t *tdigest
+		for _, v := range values {
+			other, ok := v.(*tdigest)
+			if !ok || other == nil {
+				continue
+			} else if t == nil {
+				t = newTDigest(compression)
+			}
+			t.Merge(other)
+		}
+		if t == nil || t.Count() == 0 {
+			return nil
+		}
+		return t.Quantile(percentile / 100)
+	}
+}
+
+// ReduceMedian computes the median of values. If there are an even number of values
+// then the mean of the two middle values is returned.
+func ReduceMedian(values []interface{}) interface{} {
+	var data []float64
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+		for _, v := range v.([]interface{}) {
+			switch v := v.(type) {
+			case float64:
+				data = append(data, v)
+			case int64:
+				data = append(data, float64(v))
+			}
+		}
+	}
+
+	length := len(data)
+	if length == 0 {
+		return nil
+	}
+
+	sort.Float64s(data)
+	if length%2 == 0 {
+		return (data[length/2-1] + data[length/2]) / 2
+	}
+	return data[length/2]
+}
+
+// ReduceMode computes the most frequent value. If multiple values occur the same
+// number of times then the lowest value is returned.
+func ReduceMode(values []interface{}) interface{} {
+	counts := make(map[interface{}]int)
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+		for _, v := range v.([]interface{}) {
+			if v != nil {
+				counts[v]++
+			}
+		}
+	}
+
+	var mode interface{}
+	var max int
+	for v, n := range counts {
+		if n > max || (n == max && lessValue(v, mode)) {
+			mode, max = v, n
+		}
+	}
+	return mode
+}
+
+// MapDistinct collects the unique values for each group by interval
+func MapDistinct(itr Iterator) interface{} {
+	set := make(map[interface{}]struct{})
+	for _, k, v := itr.Next(); k != 0; _, k, v = itr.Next() {
+		if v != nil {
+			set[v] = struct{}{}
+		}
+	}
+	if len(set) == 0 {
+		return nil
+	}
+
+	values := make([]interface{}, 0, len(set))
+	for v := range set {
+		values = append(values, v)
+	}
+	return values
+}
+
+// ReduceDistinct computes the unique values across all mappers sorted in ascending order.
+func ReduceDistinct(values []interface{}) interface{} {
+	set := make(map[interface{}]struct{})
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+		for _, v := range v.([]interface{}) {
+			set[v] = struct{}{}
+		}
+	}
+	if len(set) == 0 {
+		return nil
+	}
+
+	distinct := make(interfaceValues, 0, len(set))
+	for v := range set {
+		distinct = append(distinct, v)
+	}
+	sort.Sort(distinct)
+	return []interface{}(distinct)
+}
+
+// ReduceCountDistinct computes the number of unique values across all mappers.
+func ReduceCountDistinct(values []interface{}) interface{} {
+	set := make(map[interface{}]struct{})
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+		for _, v := range v.([]interface{}) {
+			set[v] = struct{}{}
+		}
+	}
+	return float64(len(set))
+}
+
+// interfaceValues sorts field values of mixed types.
+type interfaceValues []interface{}
+
+func (a interfaceValues) Len() int           { return len(a) }
+func (a interfaceValues) Less(i, j int) bool { return lessValue(a[i], a[j]) }
+func (a interfaceValues) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+
+// lessValue returns true if a sorts before b. Values of different types are
+// ordered by type: nil, booleans, numbers, then strings.
+func lessValue(a, b interface{}) bool {
+	if ra, rb := valueRank(a), valueRank(b); ra != rb {
+		return ra < rb
+	}
+
+	switch a := a.(type) {
+	case bool:
+		return !a && b.(bool)
+	case float64:
+		return a < toFloat(b)
+	case int64:
+		return float64(a) < toFloat(b)
+	case string:
+		return a < b.(string)
+	}
+	return false
+}
+
+// valueRank returns the sort order of a value's type.
+func valueRank(v interface{}) int {
+	switch v.(type) {
+	case nil:
+		return 0
+	case bool:
+		return 1
+	case float64, int64:
+		return 2
+	case string:
+		return 3
+	}
+	return 4
+}
+
+// toFloat converts a numeric value to a float64.
+func toFloat(v interface{}) float64 {
+	switch v := v.(type) {
+	case float64:
+		return v
+	case int64:
+		return float64(v)
+	}
+	return 0
+}
+
+// topBottomPoint represents a point selected by top() or bottom().
+type topBottomPoint struct {
+	Time  int64
+	Value interface{}
+	Tags  map[string]string `json:",omitempty"`
+}
+
+type topBottomPoints []topBottomPoint
+
+// topBottomLess returns true if a sorts before b. It orders points by value and then by time.
+type topBottomLess func(a, b *topBottomPoint) bool
+
+func topLess(a, b *topBottomPoint) bool {
+	if av, bv := toFloat(a.Value), toFloat(b.Value); av != bv {
+		return av > bv
+	}
+	return timeTagsLess(a, b)
+}
+
+func bottomLess(a, b *topBottomPoint) bool {
+	if av, bv := toFloat(a.Value), toFloat(b.Value); av != bv {
+		return av < bv
+	}
+	return timeTagsLess(a, b)
+}
+
+// timeTagsLess orders points with equal values by time and then by tag values.
+func timeTagsLess(a, b *topBottomPoint) bool {
+	if a.Time != b.Time {
+		return a.Time < b.Time
+	}
+	return tagsString(a.Tags) < tagsString(b.Tags)
+}
+
+// tagsString returns the tags as a string sorted by key.
+func tagsString(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	for _, k := range keys {
+		buf.WriteString(k)
+		buf.WriteByte(0)
+		buf.WriteString(tags[k])
+		buf.WriteByte(0)
+	}
+	return buf.String()
+}
+
+// isTopBottom returns true if the call is top() or bottom().
+func isTopBottom(c *Call) bool {
+	name := strings.ToLower(c.Name)
+	return name == "top" || name == "bottom"
+}
+
+// topBottomArgs returns the number of points and the tag keys passed to top() or bottom().
+// The arguments are a field, zero or more tag keys, and the number of points.
+func topBottomArgs(c *Call) (int, []string, error) {
+	if len(c.Args) < 2 {
+		return 0, nil, fmt.Errorf("expected at least two arguments for %s()", c.Name)
+	}
+
+	lit, ok := c.Args[len(c.Args)-1].(*NumberLiteral)
+	if !ok || lit.Val < 1 || lit.Val != math.Trunc(lit.Val) {
+		return 0, nil, fmt.Errorf("expected positive integer as last argument in %s()", c.Name)
+	}
+
+	var tagKeys []string
+	for _, arg := range c.Args[1 : len(c.Args)-1] {
+		ref, ok := arg.(*VarRef)
+		if !ok {
+			return 0, nil, fmt.Errorf("expected tag key argument in %s()", c.Name)
+		}
+		tagKeys = append(tagKeys, ref.Val)
+	}
+	return int(lit.Val), tagKeys, nil
+}
+
+// MapTop collects the n points with the highest values. If tag keys are given then
+// only the highest point for each unique set of tag values is collected.
+func MapTop(n int, tagKeys []string) MapFunc {
+	return mapTopBottom(n, tagKeys, topLess)
+}
+
+// MapBottom collects the n points with the lowest values. If tag keys are given then
+// only the lowest point for each unique set of tag values is collected.
+func MapBottom(n int, tagKeys []string) MapFunc {
+	return mapTopBottom(n, tagKeys, bottomLess)
+}
+
+func mapTopBottom(n int, tagKeys []string, less topBottomLess) MapFunc {
+	return func(itr Iterator) interface{} {
+		var points topBottomPoints
+
+		if len(tagKeys) > 0 {
+			// keep the best point of each series and group them by tag values once done.
+			best := make(map[uint64]topBottomPoint)
+			for id, k, v := itr.Next(); k != 0; id, k, v = itr.Next() {
+				p := topBottomPoint{Time: k, Value: v}
+				if !isNumeric(v) {
+					continue
+				} else if cur, ok := best[id]; !ok || less(&p, &cur) {
+					best[id] = p
+				}
+			}
+
+			tagger, _ := itr.(TagIterator)
+			for id, p := range best {
+				p.Tags = make(map[string]string, len(tagKeys))
+				if tagger != nil {
+					tags := tagger.Tags(id)
+					for _, key := range tagKeys {
+						if v, ok := tags[key]; ok {
+							p.Tags[key] = v
+						}
+					}
+				}
+				points = append(points, p)
+			}
+		} else {
+			// keep only the best n points seen so far.
+			h := &topBottomHeap{less: less}
+			for _, k, v := itr.Next(); k != 0; _, k, v = itr.Next() {
+				if !isNumeric(v) {
+					continue
+				}
+				heap.Push(h, topBottomPoint{Time: k, Value: v})
+				if h.Len() > n {
+					heap.Pop(h)
+				}
+			}
+			points = h.points
+		}
+
+		if points = points.best(n, tagKeys, less); len(points) > 0 {
+			return points
+		}
+		return nil
+	}
+}
+
+// ReduceTop computes the n points with the highest values across all mappers.
+func ReduceTop(n int, tagKeys []string) ReduceFunc {
+	return reduceTopBottom(n, tagKeys, topLess)
+}
+
+// ReduceBottom computes the n points with the lowest values across all mappers.
+func ReduceBottom(n int, tagKeys []string) ReduceFunc {
+	return reduceTopBottom(n, tagKeys, bottomLess)
+}
+
+func reduceTopBottom(n int, tagKeys []string, less topBottomLess) ReduceFunc {
+	return func(values []interface{}) interface{} {
+		var points topBottomPoints
+		for _, v := range values {
+			if v, ok := v.(topBottomPoints); ok {
+				points = append(points, v...)
+			}
+		}
+
+		if points = points.best(n, tagKeys, less); len(points) > 0 {
+			return points
+		}
+		return nil
+	}
+}
+
+// best returns up to n points in sorted order. If tag keys are given then only the
+// first point for each unique set of tag values is kept.
+func (a topBottomPoints) best(n int, tagKeys []string, less topBottomLess) topBottomPoints {
+	sort.Sort(topBottomSorter{a, less})
+
+	if len(tagKeys) > 0 {
+		seen := make(map[string]struct{})
+		other := make(topBottomPoints, 0, len(a))
+		for _, p := range a {
+			values := make([]string, len(tagKeys))
+			for i, key := range tagKeys {
+				values[i] = p.Tags[key]
+			}
+
+			key := strings.Join(values, "\x00")
+			if _, ok := seen[key]; !ok {
+				seen[key] = struct{}{}
+				other = append(other, p)
+			}
+		}
+		a = other
+	}
+
+	if len(a) > n {
+		a = a[:n]
+	}
+	return a
+}
+
+type topBottomSorter struct {
+	points topBottomPoints
+	less   topBottomLess
+}
+
+func (s topBottomSorter) Len() int           { return len(s.points) }
+func (s topBottomSorter) Less(i, j int) bool { return s.less(&s.points[i], &s.points[j]) }
+func (s topBottomSorter) Swap(i, j int)      { s.points[i], s.points[j] = s.points[j], s.points[i] }
+
+// topBottomHeap is a heap of points with the worst point on top so it can be removed
+// when the heap grows larger than the number of points requested.
+type topBottomHeap struct {
+	points topBottomPoints
+	less   topBottomLess
+}
+
+func (h *topBottomHeap) Len() int           { return len(h.points) }
+func (h *topBottomHeap) Less(i, j int) bool { return h.less(&h.points[j], &h.points[i]) }
+func (h *topBottomHeap) Swap(i, j int)      { h.points[i], h.points[j] = h.points[j], h.points[i] }
+func (h *topBottomHeap) Push(x interface{}) { h.points = append(h.points, x.(topBottomPoint)) }
+func (h *topBottomHeap) Pop() interface{} {
+	p := h.points[len(h.points)-1]
+	h.points = h.points[:len(h.points)-1]
+	return p
+}
+
+// isNumeric returns true if the value is a float or integer.
+func isNumeric(v interface{}) bool {
+	switch v.(type) {
+	case float64, int64:
+		return true
+	}
+	return false
+}
+
 // MapRawQuery is for queries without aggregates
 func MapRawQuery(itr Iterator) interface{} {
 	var values []*rawQueryMapOutput
@@ -581,3 +1143,61 @@ type rawOutputs []*rawQueryMapOutput
 func (a rawOutputs) Len() int           { return len(a) }
 func (a rawOutputs) Less(i, j int) bool { return a[i].Timestamp < a[j].Timestamp }
 func (a rawOutputs) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+
+// isTransform returns true if the call is evaluated over the reduced values of each
+// series in time order instead of being mapped and reduced. The argument of a transform
+// is either a field of a raw query or an aggregate of a GROUP BY time() query.
+func isTransform(c *Call) bool {
+	switch strings.ToLower(c.Name) {
+	case "moving_average", "difference", "cumulative_sum", "elapsed":
+		return true
+	}
+	return false
+}
+
+// validateTransform returns an error if the arguments of a transform call are invalid.
+func validateTransform(c *Call) error {
+	name := strings.ToLower(c.Name)
+	switch name {
+	case "moving_average":
+		if len(c.Args) != 2 {
+			return fmt.Errorf("expected two arguments for moving_average()")
+		} else if lit, ok := c.Args[1].(*NumberLiteral); !ok || lit.Val < 1 || lit.Val != math.Trunc(lit.Val) {
+			return fmt.Errorf("expected positive integer as second argument in moving_average()")
+		}
+	case "elapsed":
+		if len(c.Args) != 1 && len(c.Args) != 2 {
+			return fmt.Errorf("expected one or two arguments for elapsed()")
+		} else if len(c.Args) == 2 {
+			if lit, ok := c.Args[1].(*DurationLiteral); !ok || lit.Val <= 0 {
+				return fmt.Errorf("expected duration as second argument in elapsed()")
+			}
+		}
+	default:
+		if len(c.Args) != 1 {
+			return fmt.Errorf("expected one argument for %s()", name)
+		}
+	}
+
+	switch arg := c.Args[0].(type) {
+	case *VarRef:
+	case *Call:
+		if isTopBottom(arg) {
+			return fmt.Errorf("%s() cannot be applied to %s()", name, arg.Name)
+		}
+	default:
+		return fmt.Errorf("expected field or aggregate argument in %s()", name)
+	}
+	return nil
+}
+
+// transformField returns the innermost argument of a chain of transforms.
+func transformField(c *Call) Expr {
+	for {
+		inner, ok := c.Args[0].(*Call)
+		if !ok || !isTransform(inner) {
+			return c.Args[0]
+		}
+		c = inner
+	}
+}
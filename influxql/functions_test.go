@@ -0,0 +1,252 @@
+package influxql_test
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/influxdb/influxdb/influxql"
+)
+
+// Ensure the median reducer returns the middle value or the mean of the two middle values.
+func TestReduceMedian(t *testing.T) {
+	for i, tt := range []struct {
+		values []interface{}
+		exp    interface{}
+	}{
+		{values: []interface{}{[]interface{}{float64(5), float64(1)}, []interface{}{float64(3)}}, exp: float64(3)},
+		{values: []interface{}{[]interface{}{float64(4), float64(1)}, []interface{}{float64(2), int64(3)}}, exp: float64(2.5)},
+		{values: []interface{}{[]interface{}{float64(7)}, nil}, exp: float64(7)},
+		{values: []interface{}{nil}, exp: nil},
+	} {
+		if v := influxql.ReduceMedian(tt.values); !reflect.DeepEqual(tt.exp, v) {
+			t.Errorf("%d. unexpected median: exp=%v, got=%v", i, tt.exp, v)
+		}
+	}
+}
+
+// Ensure the mode reducer returns the most frequent value, preferring the lowest on ties.
+func TestReduceMode(t *testing.T) {
+	for i, tt := range []struct {
+		values []interface{}
+		exp    interface{}
+	}{
+		{values: []interface{}{[]interface{}{float64(1), float64(2)}, []interface{}{float64(2)}}, exp: float64(2)},
+		{values: []interface{}{[]interface{}{float64(3), float64(1)}, []interface{}{float64(2)}}, exp: float64(1)},
+		{values: []interface{}{[]interface{}{"us-west", "us-east"}, []interface{}{"us-west"}}, exp: "us-west"},
+		{values: []interface{}{nil}, exp: nil},
+	} {
+		if v := influxql.ReduceMode(tt.values); !reflect.DeepEqual(tt.exp, v) {
+			t.Errorf("%d. unexpected mode: exp=%v, got=%v", i, tt.exp, v)
+		}
+	}
+}
+
+// Ensure the distinct reducers combine the unique values from each mapper.
+func TestReduceDistinct(t *testing.T) {
+	values := []interface{}{
+		influxql.MapDistinct(&iterator{points: []point{
+			{seriesID: 1, timestamp: 10, value: "ok"},
+			{seriesID: 1, timestamp: 20, value: "error"},
+			{seriesID: 2, timestamp: 30, value: "ok"},
+		}}),
+		influxql.MapDistinct(&iterator{points: []point{
+			{seriesID: 3, timestamp: 10, value: "timeout"},
+			{seriesID: 3, timestamp: 20, value: "ok"},
+		}}),
+		influxql.MapDistinct(&iterator{}),
+	}
+
+	if v := influxql.ReduceDistinct(values); !reflect.DeepEqual(v, []interface{}{"error", "ok", "timeout"}) {
+		t.Fatalf("unexpected distinct values: %#v", v)
+	}
+	if v := influxql.ReduceCountDistinct(values); v != float64(3) {
+		t.Fatalf("unexpected distinct count: %#v", v)
+	}
+}
+
+// Ensure count(distinct()) uses the distinct map function and counts in the reducer.
+func TestInitializeMapFunc_CountDistinct(t *testing.T) {
+	c := MustParseExpr(`count(distinct(value))`).(*influxql.Call)
+	if _, err := influxql.InitializeMapFunc(c); err != nil {
+		t.Fatal(err)
+	}
+	reduce, err := influxql.InitializeReduceFunc(c)
+	if err != nil {
+		t.Fatal(err)
+	} else if v := reduce([]interface{}{[]interface{}{float64(1), float64(2)}, []interface{}{float64(2)}}); v != float64(2) {
+		t.Fatalf("unexpected count: %#v", v)
+	}
+
+	// Only count() accepts a nested distinct() call.
+	for _, s := range []string{`sum(distinct(value))`, `count(mean(value))`, `count(distinct(1))`} {
+		if _, err := influxql.InitializeMapFunc(MustParseExpr(s).(*influxql.Call)); err == nil {
+			t.Errorf("%s: expected error", s)
+		}
+	}
+}
+
+// Ensure map outputs unmarshaled from remote mappers can be passed to the reducers.
+func TestInitializeUnmarshaller_Reduce(t *testing.T) {
+	for i, tt := range []struct {
+		expr string
+		data string
+		exp  interface{}
+	}{
+		{expr: `spread(value)`, data: `{"Min":1,"Max":5}`, exp: float64(4)},
+		{expr: `first(value)`, data: `{"Time":10,"Val":"a"}`, exp: "a"},
+		{expr: `last(value)`, data: `{"Time":10,"Val":"a"}`, exp: "a"},
+	} {
+		c := MustParseExpr(tt.expr).(*influxql.Call)
+		unmarshal, err := influxql.InitializeUnmarshaller(c)
+		if err != nil {
+			t.Fatalf("%d. %s", i, err)
+		}
+		reduce, err := influxql.InitializeReduceFunc(c)
+		if err != nil {
+			t.Fatalf("%d. %s", i, err)
+		}
+
+		v, err := unmarshal([]byte(tt.data))
+		if err != nil {
+			t.Fatalf("%d. unexpected error: %s", i, err)
+		} else if v := reduce([]interface{}{v}); !reflect.DeepEqual(tt.exp, v) {
+			t.Errorf("%d. %s: unexpected value: exp=%v, got=%v", i, tt.expr, tt.exp, v)
+		}
+	}
+}
+
+// Ensure top() and bottom() select the n best points across mappers.
+func TestReduceTopBottom(t *testing.T) {
+	tags := map[uint64]map[string]string{
+		1: {"host": "serverA"},
+		2: {"host": "serverB"},
+		3: {"host": "serverC"},
+	}
+	shard0 := []point{
+		{seriesID: 1, timestamp: 10, value: float64(90)},
+		{seriesID: 1, timestamp: 20, value: float64(95)},
+		{seriesID: 2, timestamp: 10, value: float64(20)},
+		{seriesID: 2, timestamp: 20, value: float64(95)},
+	}
+	shard1 := []point{
+		{seriesID: 1, timestamp: 30, value: float64(80)},
+		{seriesID: 3, timestamp: 30, value: float64(60)},
+		{seriesID: 3, timestamp: 40, value: float64(10)},
+	}
+
+	for i, tt := range []struct {
+		call string
+		exp  string
+	}{
+		{call: `top(value, 3)`, exp: `[{"Time":20,"Value":95},{"Time":20,"Value":95},{"Time":10,"Value":90}]`},
+		{call: `top(value, host, 2)`, exp: `[{"Time":20,"Value":95,"Tags":{"host":"serverA"}},{"Time":20,"Value":95,"Tags":{"host":"serverB"}}]`},
+		{call: `bottom(value, 2)`, exp: `[{"Time":40,"Value":10},{"Time":10,"Value":20}]`},
+		{call: `bottom(value, host, 5)`, exp: `[{"Time":40,"Value":10,"Tags":{"host":"serverC"}},{"Time":10,"Value":20,"Tags":{"host":"serverB"}},{"Time":30,"Value":80,"Tags":{"host":"serverA"}}]`},
+	} {
+		c := MustParseExpr(tt.call).(*influxql.Call)
+		mapf, err := influxql.InitializeMapFunc(c)
+		if err != nil {
+			t.Fatalf("%d. %s: %s", i, tt.call, err)
+		}
+		reduce, err := influxql.InitializeReduceFunc(c)
+		if err != nil {
+			t.Fatalf("%d. %s: %s", i, tt.call, err)
+		}
+
+		v := reduce([]interface{}{
+			mapf(&iterator{points: shard0, tags: tags}),
+			mapf(&iterator{points: shard1, tags: tags}),
+			nil,
+		})
+		if got := string(mustMarshalJSON(v)); got != tt.exp {
+			t.Errorf("%d. %s: unexpected points:\n\nexp=%s\n\ngot=%s\n\n", i, tt.call, tt.exp, got)
+		}
+	}
+}
+
+// Ensure top() and bottom() validate their arguments.
+func TestInitializeMapFunc_TopBottom_Err(t *testing.T) {
+	for i, tt := range []struct {
+		call string
+		err  string
+	}{
+		{call: `top(value)`, err: `expected at least two arguments for top()`},
+		{call: `top(value, 1.5)`, err: `expected positive integer as last argument in top()`},
+		{call: `bottom(value, 0)`, err: `expected positive integer as last argument in bottom()`},
+		{call: `top(value, 'host', 2)`, err: `expected tag key argument in top()`},
+		{call: `bottom(1, 2)`, err: `expected field argument in bottom()`},
+	} {
+		_, err := influxql.InitializeMapFunc(MustParseExpr(tt.call).(*influxql.Call))
+		if errstring(err) != tt.err {
+			t.Errorf("%d. %s: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.call, tt.err, err)
+		}
+	}
+}
+
+// Ensure percentile_approx() estimates percentiles from the sketches of each mapper.
+func TestReducePercentileApprox(t *testing.T) {
+	// Spread 0..9999 across three mappers in an interleaved order.
+	var shards [3][]point
+	for i := 0; i < 10000; i++ {
+		v := float64((i * 7919) % 10000)
+		shards[i%3] = append(shards[i%3], point{seriesID: 1, timestamp: int64(i + 1), value: v})
+	}
+
+	for i, tt := range []struct {
+		call string
+		exp  float64
+		tol  float64
+	}{
+		{call: `percentile_approx(value, 50)`, exp: 4999.5, tol: 50},
+		{call: `percentile_approx(value, 99)`, exp: 9899.5, tol: 10},
+		{call: `percentile_approx(value, 99.9, 500)`, exp: 9989.5, tol: 2},
+		{call: `percentile_approx(value, 0)`, exp: 0, tol: 0},
+		{call: `percentile_approx(value, 100)`, exp: 9999, tol: 0},
+	} {
+		c := MustParseExpr(tt.call).(*influxql.Call)
+		mapf, err := influxql.InitializeMapFunc(c)
+		if err != nil {
+			t.Fatalf("%d. %s: %s", i, tt.call, err)
+		}
+		reduce, err := influxql.InitializeReduceFunc(c)
+		if err != nil {
+			t.Fatalf("%d. %s: %s", i, tt.call, err)
+		}
+
+		v := reduce([]interface{}{
+			mapf(&iterator{points: shards[0]}),
+			mapf(&iterator{points: shards[1]}),
+			mapf(&iterator{points: shards[2]}),
+			mapf(&iterator{}),
+		})
+		if f, ok := v.(float64); !ok || math.Abs(f-tt.exp) > tt.tol {
+			t.Errorf("%d. %s: unexpected value: exp=%v±%v, got=%v", i, tt.call, tt.exp, tt.tol, v)
+		}
+	}
+
+	// An interval without any values returns nil.
+	reduce := influxql.ReducePercentileApprox(50, 100)
+	if v := reduce([]interface{}{nil, influxql.MapTDigest(100)(&iterator{})}); v != nil {
+		t.Fatalf("unexpected value: %#v", v)
+	}
+}
+
+// Ensure percentile_approx() validates its arguments.
+func TestInitializeMapFunc_PercentileApprox_Err(t *testing.T) {
+	for i, tt := range []struct {
+		call string
+		err  string
+	}{
+		{call: `percentile_approx(value)`, err: `expected two or three arguments for percentile_approx()`},
+		{call: `percentile_approx(value, 101)`, err: `expected percentile between 0 and 100 in percentile_approx()`},
+		{call: `percentile_approx(value, 'p99')`, err: `expected percentile between 0 and 100 in percentile_approx()`},
+		{call: `percentile_approx(value, 99, 0)`, err: `expected compression between 1 and 10000 in percentile_approx()`},
+		{call: `percentile_approx(1, 99)`, err: `expected field argument in percentile_approx()`},
+	} {
+		_, err := influxql.InitializeMapFunc(MustParseExpr(tt.call).(*influxql.Call))
+		if errstring(err) != tt.err {
+			t.Errorf("%d. %s: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.call, tt.err, err)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package influxql
+
+// This file is run within the "influxql" package and allows for internal unit tests.
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Ensure the fields of a join are rewritten to columns of a statement per measurement.
+func TestJoin_rewrite(t *testing.T) {
+	stmt := mustParseSelectStatement(`SELECT errors.value / requests.value, sum(errors.value) + sum(requests.value), errors.value * 2 FROM errors, requests WHERE host = 'serverA' GROUP BY region`)
+	j := &join{stmt: stmt}
+
+	var fields []string
+	for _, f := range stmt.Fields {
+		expr, err := j.rewrite(f.Expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fields = append(fields, expr.String())
+	}
+	if exp := []string{
+		`errors.value / requests.value`,
+		`errors.sum(errors.value) + requests.sum(requests.value)`,
+		`errors.value * 2.000`,
+	}; !reflect.DeepEqual(fields, exp) {
+		t.Fatalf("unexpected fields:\n  exp: %s\n  got: %s", exp, fields)
+	}
+
+	var statements []string
+	for _, s := range j.statements {
+		statements = append(statements, s.String())
+	}
+	if exp := []string{
+		`SELECT value, sum(value) AS sum(errors.value) FROM errors WHERE host = 'serverA' GROUP BY region`,
+		`SELECT value, sum(value) AS sum(requests.value) FROM requests WHERE host = 'serverA' GROUP BY region`,
+	}; !reflect.DeepEqual(statements, exp) {
+		t.Fatalf("unexpected statements:\n  exp: %s\n  got: %s", exp, statements)
+	}
+
+	// Fields must refer to a measurement.
+	if _, err := j.rewrite(mustParseExpr(`cpu.value`)); err == nil || err.Error() != `field source not found: cpu.value` {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure the condition of a join is narrowed to each measurement.
+func TestJoin_joinCondition(t *testing.T) {
+	sources := Sources{&Measurement{Name: "errors"}, &Measurement{Name: "requests"}}
+	for i, tt := range []struct {
+		expr     string
+		errors   string
+		requests string
+	}{
+		// AND keeps the side of each measurement.
+		{expr: `errors.value > 5 AND requests.value > 100`, errors: `value > 5.000`, requests: `value > 100.000`},
+
+		// OR referring to another measurement can't be narrowed.
+		{expr: `errors.value > 5 OR requests.value > 100`, errors: ``, requests: ``},
+		{expr: `(errors.value > 5 OR errors.value < 1) AND requests.value > 100`, errors: `(value > 5.000 OR value < 1.000)`, requests: `value > 100.000`},
+		{expr: `time > 10s AND (errors.value > 5 OR requests.value > 100)`, errors: `time > 10s`, requests: `time > 10s`},
+
+		// Time and unqualified tags apply to every measurement.
+		{expr: `time > 10s AND time < 20s`, errors: `time > 10s AND time < 20s`, requests: `time > 10s AND time < 20s`},
+		{expr: `host = 'serverA' AND errors.code = '500'`, errors: `host = 'serverA' AND code = '500'`, requests: `host = 'serverA'`},
+	} {
+		for _, m := range []struct {
+			name string
+			exp  string
+		}{{"errors", tt.errors}, {"requests", tt.requests}} {
+			var s string
+			if expr := joinCondition(sources, &Measurement{Name: m.name}, mustParseExpr(tt.expr)); expr != nil {
+				s = expr.String()
+			}
+			if s != m.exp {
+				t.Errorf("%d. %s: %s: unexpected condition:\n  exp: %s\n  got: %s", i, tt.expr, m.name, m.exp, s)
+			}
+		}
+	}
+}
+
+// Ensure the rows of a join's statements are combined by tag values and time.
+func TestJoin_send(t *testing.T) {
+	ts := func(s int) time.Time { return time.Unix(int64(s), 0).UTC() }
+	f := func(query string, chunkSize int) []*Row {
+		stmt := mustParseSelectStatement(query)
+		j := &join{stmt: stmt, name: "errors_requests", chunkSize: chunkSize}
+		for _, f := range stmt.Fields {
+			expr, err := j.rewrite(f.Expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			j.fields = append(j.fields, expr)
+		}
+
+		j.add("errors", &Row{Name: "errors", Tags: map[string]string{"host": "a"}, Columns: []string{"time", "value"}, Values: [][]interface{}{{ts(0), 1.0}, {ts(10), 2.0}, {ts(20), nil}}})
+		j.add("errors", &Row{Name: "errors", Tags: map[string]string{"host": "c"}, Columns: []string{"time", "value"}, Values: [][]interface{}{{ts(0), 7.0}}})
+		j.add("requests", &Row{Name: "requests", Tags: map[string]string{"host": "a"}, Columns: []string{"time", "value"}, Values: [][]interface{}{{ts(0), 10.0}, {ts(10), 20.0}, {ts(20), nil}}})
+		j.add("requests", &Row{Name: "requests", Tags: map[string]string{"host": "b"}, Columns: []string{"time", "value"}, Values: [][]interface{}{{ts(10), 5.0}}})
+
+		out := make(chan *Row, 10)
+		j.send(out)
+		close(out)
+
+		var rows []*Row
+		for row := range out {
+			rows = append(rows, row)
+		}
+		return rows
+	}
+
+	for i, tt := range []struct {
+		query     string
+		chunkSize int
+		exp       []*Row
+	}{
+		// Series are matched on their tags and points on time. Raw points without values are dropped.
+		{
+			query: `SELECT errors.value / requests.value FROM errors, requests GROUP BY host`,
+			exp: []*Row{
+				{Name: "errors_requests", Tags: map[string]string{"host": "a"}, Columns: []string{"time", ""}, Values: [][]interface{}{{ts(0), 0.1}, {ts(10), 0.1}}},
+				{Name: "errors_requests", Tags: map[string]string{"host": "c"}, Columns: []string{"time", ""}, Values: [][]interface{}{{ts(0), 0.0}}},
+			},
+		},
+
+		// Empty intervals are only kept if they're filled.
+		{
+			query: `SELECT sum(errors.value) + sum(requests.value) FROM errors, requests WHERE time < 30s GROUP BY time(10s), host SLIMIT 1`,
+			exp: []*Row{
+				{Name: "errors_requests", Tags: map[string]string{"host": "a"}, Columns: []string{"time", ""}, Values: [][]interface{}{{ts(0), nil}, {ts(10), nil}, {ts(20), nil}}},
+			},
+		},
+
+		// LIMIT, OFFSET, SLIMIT, SOFFSET and descending order.
+		{
+			query: `SELECT errors.value, requests.value FROM errors, requests GROUP BY host ORDER BY time DESC LIMIT 1 OFFSET 1 SLIMIT 1`,
+			exp: []*Row{
+				{Name: "errors_requests", Tags: map[string]string{"host": "a"}, Columns: []string{"time", "errors.value", "requests.value"}, Values: [][]interface{}{{ts(0), 1.0, 10.0}}},
+			},
+		},
+		{
+			query: `SELECT errors.value, requests.value FROM errors, requests GROUP BY host SLIMIT 1 SOFFSET 2`,
+			exp: []*Row{
+				{Name: "errors_requests", Tags: map[string]string{"host": "c"}, Columns: []string{"time", "errors.value", "requests.value"}, Values: [][]interface{}{{ts(0), 7.0, nil}}},
+			},
+		},
+
+		// Raw points are chunked.
+		{
+			query:     `SELECT errors.value, requests.value FROM errors, requests GROUP BY host SLIMIT 1`,
+			chunkSize: 1,
+			exp: []*Row{
+				{Name: "errors_requests", Tags: map[string]string{"host": "a"}, Columns: []string{"time", "errors.value", "requests.value"}, Values: [][]interface{}{{ts(0), 1.0, 10.0}}},
+				{Name: "errors_requests", Tags: map[string]string{"host": "a"}, Columns: []string{"time", "errors.value", "requests.value"}, Values: [][]interface{}{{ts(10), 2.0, 20.0}}},
+			},
+		},
+	} {
+		if rows := f(tt.query, tt.chunkSize); !reflect.DeepEqual(rows, tt.exp) {
+			t.Errorf("%d. %s: unexpected rows:\n  exp: %s\n  got: %s", i, tt.query, mustMarshalJSON(tt.exp), mustMarshalJSON(rows))
+		}
+	}
+}
+
+// Ensure points of different series of a measurement at the same time are each joined.
+func TestJoin_send_SameTime(t *testing.T) {
+	ts := func(s int) time.Time { return time.Unix(int64(s), 0).UTC() }
+	stmt := mustParseSelectStatement(`SELECT errors.value / requests.value FROM errors, requests`)
+	j := &join{stmt: stmt, name: "errors_requests"}
+	for _, f := range stmt.Fields {
+		expr, err := j.rewrite(f.Expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		j.fields = append(j.fields, expr)
+	}
+
+	// The points of hosts a and b aren't grouped so they're returned in the same row.
+	j.add("errors", &Row{Name: "errors", Columns: []string{"time", "value"}, Values: [][]interface{}{{ts(0), 1.0}, {ts(0), 3.0}, {ts(10), 2.0}}})
+	j.add("requests", &Row{Name: "requests", Columns: []string{"time", "value"}, Values: [][]interface{}{{ts(0), 10.0}, {ts(10), 20.0}, {ts(10), 40.0}}})
+
+	out := make(chan *Row, 10)
+	j.send(out)
+	close(out)
+
+	var rows []*Row
+	for row := range out {
+		rows = append(rows, row)
+	}
+	exp := []*Row{{Name: "errors_requests", Columns: []string{"time", ""}, Values: [][]interface{}{{ts(0), 0.1}, {ts(0), 0.3}, {ts(10), 0.1}, {ts(10), 0.05}}}}
+	if !reflect.DeepEqual(rows, exp) {
+		t.Errorf("unexpected rows:\n  exp: %s\n  got: %s", mustMarshalJSON(exp), mustMarshalJSON(rows))
+	}
+}
+
+// mustParseSelectStatement parses a select statement. Panic on error.
+func mustParseSelectStatement(s string) *SelectStatement {
+	stmt, err := NewParser(strings.NewReader(s)).ParseStatement()
+	if err != nil {
+		panic(err.Error())
+	}
+	return stmt.(*SelectStatement)
+}
+
+// mustParseExpr parses an expression. Panic on error.
+func mustParseExpr(s string) Expr {
+	expr, err := NewParser(strings.NewReader(s)).ParseExpr()
+	if err != nil {
+		panic(err.Error())
+	}
+	return expr
+}
+
+// mustMarshalJSON encodes a value to a JSON string. Panic on error.
+func mustMarshalJSON(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err.Error())
+	}
+	return string(b)
+}
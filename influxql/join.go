@@ -0,0 +1,425 @@
+package influxql
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// isJoin returns true if the statement selects from several measurements and its fields
+// refer to them by name, e.g. SELECT errors.value / requests.value FROM errors, requests.
+func isJoin(stmt *SelectStatement) bool {
+	if len(stmt.Sources) < 2 {
+		return false
+	}
+
+	var found bool
+	WalkFunc(stmt.Fields, func(n Node) {
+		if ref, ok := n.(*VarRef); ok && joinSource(stmt.Sources, ref.Val) != nil {
+			found = true
+		}
+	})
+	return found
+}
+
+// joinSource returns the measurement whose name prefixes a variable reference.
+// Returns nil if no measurement matches.
+func joinSource(sources Sources, name string) *Measurement {
+	var match *Measurement
+	for _, src := range sources {
+		m, ok := src.(*Measurement)
+		if !ok || m.Name == "" || !strings.HasPrefix(name, m.Name+".") {
+			continue
+		}
+		if match == nil || len(m.Name) > len(match.Name) {
+			match = m
+		}
+	}
+	return match
+}
+
+// join combines the rows returned by the statements planned for each measurement of a
+// join. Rows are matched on their tag values and the values of each row on time.
+//
+// The rows of every statement are held in memory until they're joined, so joins are
+// bounded by the series and points limits of the statements rather than chunked reads.
+type join struct {
+	stmt       *SelectStatement   // the statement being joined
+	name       string             // the name of the joined rows
+	fields     []Expr             // the fields of the statement, referring to the columns of the statements
+	statements []*SelectStatement // a statement for each measurement
+	executors  []*Executor        // the executors of the statements
+	chunkSize  int                // the max values of each row returned by raw joins
+
+	series map[string]*joinedSeries // the values of the statements' rows by tag values
+	keys   []string                 // the keys of series in the order they were added
+}
+
+// planJoin creates a statement for each measurement of a join with the calls and variables
+// of the fields that refer to it, and plans them. The returned executor has no jobs of its
+// own, its Jobs are the jobs of each measurement's executor.
+func (p *Planner) planJoin(stmt *SelectStatement, chunkSize int) (*Executor, error) {
+	j := &join{stmt: stmt, chunkSize: chunkSize}
+
+	j.fields = make([]Expr, len(stmt.Fields))
+	for i, f := range stmt.Fields {
+		expr, err := j.rewrite(f.Expr)
+		if err != nil {
+			return nil, err
+		}
+		j.fields[i] = expr
+	}
+
+	var names []string
+	for _, s := range j.statements {
+		// Moving window functions of a field don't make a query an aggregate.
+		s.IsRawQuery = len(s.FunctionCalls()) == 0
+
+		e, err := p.Plan(s, chunkSize)
+		if err != nil {
+			return nil, err
+		}
+		j.executors = append(j.executors, e)
+		names = append(names, s.Sources[0].(*Measurement).Name)
+	}
+	j.name = strings.Join(names, "_")
+
+	return &Executor{stmt: stmt, join: j}, nil
+}
+
+// rewrite replaces each call and variable reference in a field with a reference to a column
+// of the statement for the measurement it refers to. That statement selects the call or
+// variable with the measurement's name removed. Columns are referred to by the name of the
+// measurement followed by the name of the column.
+func (j *join) rewrite(expr Expr) (Expr, error) {
+	switch expr := expr.(type) {
+	case *BinaryExpr:
+		lhs, err := j.rewrite(expr.LHS)
+		if err != nil {
+			return nil, err
+		}
+		rhs, err := j.rewrite(expr.RHS)
+		if err != nil {
+			return nil, err
+		}
+		return &BinaryExpr{Op: expr.Op, LHS: lhs, RHS: rhs}, nil
+
+	case *ParenExpr:
+		inner, err := j.rewrite(expr.Expr)
+		if err != nil {
+			return nil, err
+		}
+		return &ParenExpr{Expr: inner}, nil
+
+	case *Call, *VarRef:
+		// Find the measurement from the first variable reference.
+		var m *Measurement
+		WalkFunc(expr, func(n Node) {
+			if ref, ok := n.(*VarRef); ok && m == nil {
+				m = joinSource(j.stmt.Sources, ref.Val)
+			}
+		})
+		if m == nil {
+			return nil, fmt.Errorf("field source not found: %s", expr.String())
+		}
+
+		// Select the expression without the measurement name in the measurement's statement.
+		// Raw queries name their columns after the fields so only calls need an alias.
+		other := RewriteFunc(CloneExpr(expr), func(n Node) Node {
+			if ref, ok := n.(*VarRef); ok && strings.HasPrefix(ref.Val, m.Name+".") {
+				return &VarRef{Val: strings.TrimPrefix(ref.Val, m.Name+".")}
+			}
+			return n
+		}).(Expr)
+		f := &Field{Expr: other}
+		if _, ok := other.(*Call); ok {
+			f.Alias = expr.String()
+		}
+
+		s := j.statement(m)
+		if !s.Fields.has(f) {
+			s.Fields = append(s.Fields, f)
+		}
+		return &VarRef{Val: m.Name + "." + f.Name()}, nil
+
+	default:
+		return expr, nil
+	}
+}
+
+// statement returns the statement for a measurement of the join, creating it if needed.
+func (j *join) statement(m *Measurement) *SelectStatement {
+	for _, s := range j.statements {
+		if s.Sources[0].(*Measurement).Name == m.Name {
+			return s
+		}
+	}
+
+	s := &SelectStatement{
+		Sources:    Sources{cloneSource(m)},
+		Dimensions: j.stmt.Dimensions,
+		Condition:  joinCondition(j.stmt.Sources, m, j.stmt.Condition),
+		Fill:       j.stmt.Fill,
+		FillValue:  j.stmt.FillValue,
+		Location:   j.stmt.Location,
+	}
+	j.statements = append(j.statements, s)
+	return s
+}
+
+// has returns true if one of the fields is the same as f.
+func (a Fields) has(f *Field) bool {
+	for _, other := range a {
+		if other.String() == f.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// joinCondition returns the parts of a join's condition that apply to a measurement, with the
+// measurement's name removed from its variable references. Comparisons that refer to another
+// measurement are removed, as are ORs containing one. Time and tags without a measurement name
+// apply to all measurements.
+func joinCondition(sources Sources, m *Measurement, expr Expr) Expr {
+	switch expr := expr.(type) {
+	case *VarRef:
+		other := joinSource(sources, expr.Val)
+		if other == nil {
+			return expr
+		} else if other.Name != m.Name {
+			return nil
+		}
+		return &VarRef{Val: strings.TrimPrefix(expr.Val, m.Name+".")}
+
+	case *BinaryExpr:
+		lhs := joinCondition(sources, m, expr.LHS)
+		rhs := joinCondition(sources, m, expr.RHS)
+
+		// AND can be narrowed to either side. OR and arithmetic or comparative
+		// expressions require both sides, dropping a side of an OR would exclude
+		// the points matching only that side.
+		if expr.Op == AND {
+			if lhs == nil {
+				return rhs
+			} else if rhs == nil {
+				return lhs
+			}
+		} else if lhs == nil || rhs == nil {
+			return nil
+		}
+		return &BinaryExpr{Op: expr.Op, LHS: lhs, RHS: rhs}
+
+	case *ParenExpr:
+		inner := joinCondition(sources, m, expr.Expr)
+		if inner == nil {
+			return nil
+		}
+		return &ParenExpr{Expr: inner}
+	}
+	return expr
+}
+
+// joinedSeries holds the points of the rows with the same tags, by time and measurement.
+// Rows not grouped by every tag can have several points of a measurement at the same time.
+type joinedSeries struct {
+	tags   map[string]string
+	times  map[int64]time.Time
+	points map[int64]map[string][]map[string]interface{} // values by column, by measurement, by time
+}
+
+// execute runs the statements of the join and sends the joined rows to out.
+func (j *join) execute(out chan *Row) {
+	var err error
+	for i, e := range j.executors {
+		name := j.statements[i].Sources[0].(*Measurement).Name
+
+		// Always drain the channel so the executor can finish.
+		for row := range e.Execute() {
+			if row.Err != nil {
+				if err == nil {
+					err = row.Err
+				}
+				continue
+			}
+			j.add(name, row)
+		}
+	}
+	if err != nil {
+		out <- &Row{Err: err}
+		return
+	}
+	j.send(out)
+}
+
+// add adds the values of a row returned by the statement for a measurement.
+func (j *join) add(name string, row *Row) {
+	if j.series == nil {
+		j.series = make(map[string]*joinedSeries)
+	}
+
+	key := string(marshalRowTags(row.Tags))
+	s := j.series[key]
+	if s == nil {
+		s = &joinedSeries{tags: row.Tags, times: make(map[int64]time.Time), points: make(map[int64]map[string][]map[string]interface{})}
+		j.series[key] = s
+		j.keys = append(j.keys, key)
+	}
+
+	for _, vals := range row.Values {
+		t, ok := vals[0].(time.Time)
+		if !ok {
+			continue
+		}
+		ts := t.UnixNano()
+		if _, ok := s.points[ts]; !ok {
+			s.times[ts] = t
+			s.points[ts] = make(map[string][]map[string]interface{})
+		}
+
+		values := make(map[string]interface{}, len(vals)-1)
+		for i := 1; i < len(vals) && i < len(row.Columns); i++ {
+			values[name+"."+row.Columns[i]] = vals[i]
+		}
+		s.points[ts][name] = append(s.points[ts][name], values)
+	}
+}
+
+// combine returns the joined points at a time. Each point of a measurement is joined with
+// each point of the other measurements at that time.
+func (j *join) combine(points map[string][]map[string]interface{}) []map[string]interface{} {
+	combined := []map[string]interface{}{{}}
+	for _, stmt := range j.statements {
+		other := points[stmt.Sources[0].(*Measurement).Name]
+		if len(other) == 0 {
+			continue
+		}
+
+		product := make([]map[string]interface{}, 0, len(combined)*len(other))
+		for _, a := range combined {
+			for _, b := range other {
+				values := make(map[string]interface{}, len(a)+len(b))
+				for k, v := range a {
+					values[k] = v
+				}
+				for k, v := range b {
+					values[k] = v
+				}
+				product = append(product, values)
+			}
+		}
+		combined = product
+	}
+	return combined
+}
+
+// send evaluates the fields of the join over the values added and sends the joined rows to out.
+func (j *join) send(out chan *Row) {
+	keys := make([]string, len(j.keys))
+	copy(keys, j.keys)
+
+	columnNames := make([]string, len(j.stmt.Fields)+1)
+	columnNames[0] = "time"
+	for i, f := range j.stmt.Fields {
+		columnNames[i+1] = f.Name()
+	}
+
+	// Points missing from every measurement are only kept if empty buckets are filled.
+	keepEmpty := !j.stmt.IsRawQuery && j.stmt.Fill != NoFill
+
+	// SLIMIT and SOFFSET the joined series.
+	sort.Strings(keys)
+	if j.stmt.SOffset > 0 {
+		if j.stmt.SOffset >= len(keys) {
+			keys = nil
+		} else {
+			keys = keys[j.stmt.SOffset:]
+		}
+	}
+	if j.stmt.SLimit > 0 && j.stmt.SLimit < len(keys) {
+		keys = keys[:j.stmt.SLimit]
+	}
+
+	descending := len(j.stmt.SortFields) > 0 && !j.stmt.SortFields[0].Ascending
+	for _, key := range keys {
+		s := j.series[key]
+
+		times := make([]int64, 0, len(s.points))
+		for ts := range s.points {
+			times = append(times, ts)
+		}
+		if descending {
+			sort.Sort(sort.Reverse(int64Slice(times)))
+		} else {
+			sort.Sort(int64Slice(times))
+		}
+
+		var values [][]interface{}
+		for _, ts := range times {
+			for _, point := range j.combine(s.points[ts]) {
+				vals := make([]interface{}, 1, len(j.fields)+1)
+				vals[0] = s.times[ts]
+
+				empty := true
+				for _, f := range j.fields {
+					v := Eval(f, point)
+					if v != nil {
+						empty = false
+					}
+					vals = append(vals, v)
+				}
+				if empty && !keepEmpty {
+					continue
+				}
+				values = append(values, vals)
+			}
+		}
+
+		// LIMIT and OFFSET the joined points of each series
+		if j.stmt.Offset > 0 {
+			if j.stmt.Offset >= len(values) {
+				values = nil
+			} else {
+				values = values[j.stmt.Offset:]
+			}
+		}
+		if j.stmt.Limit > 0 && j.stmt.Limit < len(values) {
+			values = values[:j.stmt.Limit]
+		}
+
+		// Raw points are returned in chunks, like the points of other raw queries.
+		for len(values) > 0 {
+			n := len(values)
+			if j.stmt.IsRawQuery && j.chunkSize > 0 && j.chunkSize < n {
+				n = j.chunkSize
+			}
+			out <- &Row{Name: j.name, Tags: s.tags, Columns: columnNames, Values: values[:n]}
+			values = values[n:]
+		}
+	}
+}
+
+// marshalRowTags returns a key identifying the tag values of a row.
+func marshalRowTags(tags map[string]string) []byte {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b []byte
+	for _, k := range keys {
+		b = append(b, k...)
+		b = append(b, '=')
+		b = append(b, tags[k]...)
+		b = append(b, ',')
+	}
+	return b
+}
+
+type int64Slice []int64
+
+func (a int64Slice) Len() int           { return len(a) }
+func (a int64Slice) Less(i, j int) bool { return a[i] < a[j] }
+func (a int64Slice) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
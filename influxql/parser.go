@@ -81,11 +81,38 @@ func (p *Parser) ParseStatement() (Statement, error) {
 		return p.parseAlterStatement()
 	case SET:
 		return p.parseSetStatement()
+	case EXPLAIN:
+		return p.parseExplainStatement()
 	default:
-		return nil, newParseError(tokstr(tok, lit), []string{"SELECT", "DELETE", "SHOW", "CREATE", "DROP", "GRANT", "REVOKE", "ALTER", "SET"}, pos)
+		return nil, newParseError(tokstr(tok, lit), []string{"SELECT", "DELETE", "SHOW", "CREATE", "DROP", "GRANT", "REVOKE", "ALTER", "SET", "EXPLAIN"}, pos)
 	}
 }
 
+// parseExplainStatement parses a string and returns an ExplainStatement.
+// This function assumes the EXPLAIN token has already been consumed.
+func (p *Parser) parseExplainStatement() (*ExplainStatement, error) {
+	stmt := &ExplainStatement{}
+
+	// Parse optional ANALYZE token.
+	tok, pos, lit := p.scanIgnoreWhitespace()
+	if tok == ANALYZE {
+		stmt.Analyze = true
+		tok, pos, lit = p.scanIgnoreWhitespace()
+	}
+
+	// Parse the statement to explain.
+	if tok != SELECT {
+		return nil, newParseError(tokstr(tok, lit), []string{"SELECT"}, pos)
+	}
+	source, err := p.parseSelectStatement(targetNotRequired)
+	if err != nil {
+		return nil, err
+	}
+	stmt.Statement = source
+
+	return stmt, nil
+}
+
 // parseShowStatement parses a string and returns a list statement.
 // This function assumes the SHOW token has already been consumed.
 func (p *Parser) parseShowStatement() (Statement, error) {
@@ -103,6 +130,8 @@ func (p *Parser) parseShowStatement() (Statement, error) {
 			return p.parseShowFieldKeysStatement()
 		}
 		return nil, newParseError(tokstr(tok, lit), []string{"KEYS", "VALUES"}, pos)
+	case GRANTS:
+		return p.parseShowGrantsForUserStatement()
 	case MEASUREMENTS:
 		return p.parseShowMeasurementsStatement()
 	case RETENTION:
@@ -111,6 +140,8 @@ func (p *Parser) parseShowStatement() (Statement, error) {
 			return p.parseShowRetentionPoliciesStatement()
 		}
 		return nil, newParseError(tokstr(tok, lit), []string{"POLICIES"}, pos)
+	case ROLES:
+		return &ShowRolesStatement{}, nil
 	case SERIES:
 		return p.parseShowSeriesStatement()
 	case STATS:
@@ -125,11 +156,13 @@ func (p *Parser) parseShowStatement() (Statement, error) {
 			return p.parseShowTagValuesStatement()
 		}
 		return nil, newParseError(tokstr(tok, lit), []string{"KEYS", "VALUES"}, pos)
+	case TOKENS:
+		return &ShowTokensStatement{}, nil
 	case USERS:
 		return p.parseShowUsersStatement()
 	}
 
-	return nil, newParseError(tokstr(tok, lit), []string{"CONTINUOUS", "DATABASES", "FIELD", "MEASUREMENTS", "RETENTION", "SERIES", "SERVERS", "TAG", "USERS"}, pos)
+	return nil, newParseError(tokstr(tok, lit), []string{"CONTINUOUS", "DATABASES", "FIELD", "GRANTS", "MEASUREMENTS", "RETENTION", "ROLES", "SERIES", "SERVERS", "TAG", "TOKENS", "USERS"}, pos)
 }
 
 // parseCreateStatement parses a string and returns a create statement.
@@ -142,6 +175,10 @@ func (p *Parser) parseCreateStatement() (Statement, error) {
 		return p.parseCreateDatabaseStatement()
 	} else if tok == USER {
 		return p.parseCreateUserStatement()
+	} else if tok == ROLE {
+		return p.parseCreateRoleStatement()
+	} else if tok == TOKEN {
+		return p.parseCreateTokenStatement()
 	} else if tok == RETENTION {
 		tok, pos, lit = p.scanIgnoreWhitespace()
 		if tok != POLICY {
@@ -150,7 +187,7 @@ func (p *Parser) parseCreateStatement() (Statement, error) {
 		return p.parseCreateRetentionPolicyStatement()
 	}
 
-	return nil, newParseError(tokstr(tok, lit), []string{"CONTINUOUS", "DATABASE", "USER", "RETENTION"}, pos)
+	return nil, newParseError(tokstr(tok, lit), []string{"CONTINUOUS", "DATABASE", "USER", "ROLE", "TOKEN", "RETENTION"}, pos)
 }
 
 // parseDropStatement parses a string and returns a drop statement.
@@ -172,6 +209,10 @@ func (p *Parser) parseDropStatement() (Statement, error) {
 		return p.parseDropRetentionPolicyStatement()
 	} else if tok == USER {
 		return p.parseDropUserStatement()
+	} else if tok == ROLE {
+		return p.parseDropRoleStatement()
+	} else if tok == TOKEN {
+		return p.parseDropTokenStatement()
 	}
 
 	return nil, newParseError(tokstr(tok, lit), []string{"SERIES", "CONTINUOUS", "MEASUREMENT"}, pos)
@@ -186,9 +227,31 @@ func (p *Parser) parseAlterStatement() (Statement, error) {
 			return nil, newParseError(tokstr(tok, lit), []string{"POLICY"}, pos)
 		}
 		return p.parseAlterRetentionPolicyStatement()
+	} else if tok == USER {
+		return p.parseUnlockUserStatement()
 	}
 
-	return nil, newParseError(tokstr(tok, lit), []string{"RETENTION"}, pos)
+	return nil, newParseError(tokstr(tok, lit), []string{"RETENTION", "USER"}, pos)
+}
+
+// parseUnlockUserStatement parses a string and returns an UnlockUserStatement.
+// This function assumes the "ALTER USER" tokens have already been consumed.
+func (p *Parser) parseUnlockUserStatement() (*UnlockUserStatement, error) {
+	stmt := &UnlockUserStatement{}
+
+	// Parse the name of the user to be unlocked.
+	lit, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Name = lit
+
+	// Consume the required UNLOCK token.
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != UNLOCK {
+		return nil, newParseError(tokstr(tok, lit), []string{"UNLOCK"}, pos)
+	}
+
+	return stmt, nil
 }
 
 // parseSetStatement parses a string and returns a set statement.
@@ -510,7 +573,13 @@ func (p *Parser) parseString() (string, error) {
 
 // parseRevokeStatement parses a string and returns a revoke statement.
 // This function assumes the REVOKE token has already been consumend.
-func (p *Parser) parseRevokeStatement() (*RevokeStatement, error) {
+func (p *Parser) parseRevokeStatement() (Statement, error) {
+	// Check for a role being revoked from a user.
+	if tok, _, _ := p.scanIgnoreWhitespace(); tok == ROLE {
+		return p.parseRevokeRoleStatement()
+	}
+	p.unscan()
+
 	stmt := &RevokeStatement{}
 
 	// Parse the privilege to be revoked.
@@ -524,11 +593,11 @@ func (p *Parser) parseRevokeStatement() (*RevokeStatement, error) {
 	tok, pos, lit := p.scanIgnoreWhitespace()
 	if tok == ON {
 		// Parse the name of the thing we're revoking a privilege to use.
-		lit, err := p.parseIdent()
+		lit, m, err := p.parsePrivilegeTarget()
 		if err != nil {
 			return nil, err
 		}
-		stmt.On = lit
+		stmt.On, stmt.Measurement = lit, m
 
 		tok, pos, lit = p.scanIgnoreWhitespace()
 	} else if priv != AllPrivileges {
@@ -542,7 +611,15 @@ func (p *Parser) parseRevokeStatement() (*RevokeStatement, error) {
 		return nil, newParseError(tokstr(tok, lit), []string{"FROM"}, pos)
 	}
 
-	// Parse the name of the user we're revoking the privilege from.
+	// Parse the name of the user or role we're revoking the privilege from.
+	if tok, _, _ := p.scanIgnoreWhitespace(); tok == ROLE {
+		if stmt.Role, err = p.parseIdent(); err != nil {
+			return nil, err
+		}
+		return stmt, nil
+	}
+	p.unscan()
+
 	lit, err = p.parseIdent()
 	if err != nil {
 		return nil, err
@@ -552,9 +629,40 @@ func (p *Parser) parseRevokeStatement() (*RevokeStatement, error) {
 	return stmt, nil
 }
 
+// parseRevokeRoleStatement parses a string and returns a RevokeRoleStatement.
+// This function assumes the "REVOKE ROLE" tokens have already been consumed.
+func (p *Parser) parseRevokeRoleStatement() (*RevokeRoleStatement, error) {
+	stmt := &RevokeRoleStatement{}
+
+	// Parse the name of the role to be revoked.
+	lit, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Role = lit
+
+	// Check for required FROM token.
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != FROM {
+		return nil, newParseError(tokstr(tok, lit), []string{"FROM"}, pos)
+	}
+
+	// Parse the name of the user we're revoking the role from.
+	if stmt.User, err = p.parseIdent(); err != nil {
+		return nil, err
+	}
+
+	return stmt, nil
+}
+
 // parseGrantStatement parses a string and returns a grant statement.
 // This function assumes the GRANT token has already been consumed.
-func (p *Parser) parseGrantStatement() (*GrantStatement, error) {
+func (p *Parser) parseGrantStatement() (Statement, error) {
+	// Check for a role being granted to a user.
+	if tok, _, _ := p.scanIgnoreWhitespace(); tok == ROLE {
+		return p.parseGrantRoleStatement()
+	}
+	p.unscan()
+
 	stmt := &GrantStatement{}
 
 	// Parse the privilege to be granted.
@@ -568,11 +676,11 @@ func (p *Parser) parseGrantStatement() (*GrantStatement, error) {
 	tok, pos, lit := p.scanIgnoreWhitespace()
 	if tok == ON {
 		// Parse the name of the thing we're granting a privilege to use.
-		lit, err := p.parseIdent()
+		lit, m, err := p.parsePrivilegeTarget()
 		if err != nil {
 			return nil, err
 		}
-		stmt.On = lit
+		stmt.On, stmt.Measurement = lit, m
 
 		tok, pos, lit = p.scanIgnoreWhitespace()
 	} else if priv != AllPrivileges {
@@ -586,7 +694,15 @@ func (p *Parser) parseGrantStatement() (*GrantStatement, error) {
 		return nil, newParseError(tokstr(tok, lit), []string{"TO"}, pos)
 	}
 
-	// Parse the name of the user we're granting the privilege to.
+	// Parse the name of the user or role we're granting the privilege to.
+	if tok, _, _ := p.scanIgnoreWhitespace(); tok == ROLE {
+		if stmt.Role, err = p.parseIdent(); err != nil {
+			return nil, err
+		}
+		return stmt, nil
+	}
+	p.unscan()
+
 	lit, err = p.parseIdent()
 	if err != nil {
 		return nil, err
@@ -596,6 +712,59 @@ func (p *Parser) parseGrantStatement() (*GrantStatement, error) {
 	return stmt, nil
 }
 
+// parseGrantRoleStatement parses a string and returns a GrantRoleStatement.
+// This function assumes the "GRANT ROLE" tokens have already been consumed.
+func (p *Parser) parseGrantRoleStatement() (*GrantRoleStatement, error) {
+	stmt := &GrantRoleStatement{}
+
+	// Parse the name of the role to be granted.
+	lit, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Role = lit
+
+	// Check for required TO token.
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != TO {
+		return nil, newParseError(tokstr(tok, lit), []string{"TO"}, pos)
+	}
+
+	// Parse the name of the user we're granting the role to.
+	if stmt.User, err = p.parseIdent(); err != nil {
+		return nil, err
+	}
+
+	return stmt, nil
+}
+
+// parsePrivilegeTarget parses the database a privilege is granted on, optionally
+// followed by a measurement name or regex the privilege is limited to.
+// e.g. mydb, mydb.cpu or mydb./^cpu.*/
+func (p *Parser) parsePrivilegeTarget() (string, *Measurement, error) {
+	db, err := p.parseIdent()
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Check for an optional measurement.
+	if tok, _, _ := p.scan(); tok != DOT {
+		p.unscan()
+		return db, nil, nil
+	}
+
+	// Parse either a regex or the name of a measurement.
+	if re, err := p.parseRegex(); err != nil {
+		return "", nil, err
+	} else if re != nil {
+		return db, &Measurement{Regex: re}, nil
+	}
+	name, err := p.parseIdent()
+	if err != nil {
+		return "", nil, err
+	}
+	return db, &Measurement{Name: name}, nil
+}
+
 // parsePrivilege parses a string and returns a Privilege
 func (p *Parser) parsePrivilege() (Privilege, error) {
 	tok, pos, lit := p.scanIgnoreWhitespace()
@@ -638,6 +807,9 @@ func (p *Parser) parseSelectStatement(tr targetRequirement) (*SelectStatement, e
 	if stmt.Sources, err = p.parseSources(); err != nil {
 		return nil, err
 	}
+	if _, ok := stmt.SubQuery(); ok && len(stmt.Sources) > 1 {
+		return nil, errors.New("subquery must be the only source")
+	}
 
 	// Parse condition: "WHERE EXPR".
 	if stmt.Condition, err = p.parseCondition(); err != nil {
@@ -679,18 +851,52 @@ func (p *Parser) parseSelectStatement(tr targetRequirement) (*SelectStatement, e
 		return nil, err
 	}
 
-	// Set if the query is a raw data query or one with an aggregate
-	stmt.IsRawQuery = true
+	// Parse time zone: "tz('<name>')".
+	if stmt.Location, err = p.parseLocation(); err != nil {
+		return nil, err
+	}
+
+	// Validate the arguments of any moving window functions.
 	WalkFunc(stmt.Fields, func(n Node) {
-		if _, ok := n.(*Call); ok {
-			stmt.IsRawQuery = false
+		if c, ok := n.(*Call); ok && isTransform(c) && err == nil {
+			err = validateTransform(c)
 		}
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Set if the query is a raw data query or one with an aggregate.
+	// Moving window functions of a field don't make a query an aggregate.
+	stmt.IsRawQuery = len(stmt.FunctionCalls()) == 0
 
-	if d, _ := stmt.GroupByInterval(); stmt.IsRawQuery && d > 0 {
+	// Moving window functions can only be mixed with aggregates if they're applied to one.
+	if !stmt.IsRawQuery {
+		WalkFunc(stmt.Fields, func(n Node) {
+			if c, ok := n.(*Call); ok && isTransform(c) && err == nil {
+				if _, ok := transformField(c).(*VarRef); ok {
+					err = fmt.Errorf("%s() of a field cannot be combined with aggregate functions", c.Name)
+				}
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if d, err := stmt.GroupByInterval(); err != nil {
+		return nil, err
+	} else if stmt.IsRawQuery && d > 0 {
 		return nil, fmt.Errorf("GROUP BY requires at least one aggregate function")
 	}
 
+	// top() and bottom() return multiple points per interval so they must be the only field.
+	for _, c := range stmt.FunctionCalls() {
+		if isTopBottom(c) && (len(stmt.Fields) != 1 || stmt.Fields[0].Expr != c) {
+			return nil, fmt.Errorf("%s() cannot be combined with other fields", c.Name)
+		}
+	}
+
 	return stmt, nil
 }
 
@@ -1233,6 +1439,119 @@ func (p *Parser) parseCreateUserStatement() (*CreateUserStatement, error) {
 	return stmt, nil
 }
 
+// parseCreateRoleStatement parses a string and returns a CreateRoleStatement.
+// This function assumes the "CREATE ROLE" tokens have already been consumed.
+func (p *Parser) parseCreateRoleStatement() (*CreateRoleStatement, error) {
+	stmt := &CreateRoleStatement{}
+
+	// Parse the name of the role to be created.
+	lit, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Name = lit
+
+	return stmt, nil
+}
+
+// parseDropRoleStatement parses a string and returns a DropRoleStatement.
+// This function assumes the "DROP ROLE" tokens have already been consumed.
+func (p *Parser) parseDropRoleStatement() (*DropRoleStatement, error) {
+	stmt := &DropRoleStatement{}
+
+	// Parse the name of the role to be dropped.
+	lit, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Name = lit
+
+	return stmt, nil
+}
+
+// parseCreateTokenStatement parses a string and returns a CreateTokenStatement.
+// This function assumes the "CREATE TOKEN" tokens have already been consumed.
+func (p *Parser) parseCreateTokenStatement() (*CreateTokenStatement, error) {
+	stmt := &CreateTokenStatement{Privilege: AllPrivileges}
+
+	// Parse the name of the token to be created.
+	lit, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Name = lit
+
+	// Parse the name of the user the token authenticates as.
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != FOR {
+		return nil, newParseError(tokstr(tok, lit), []string{"FOR"}, pos)
+	}
+	if stmt.User, err = p.parseIdent(); err != nil {
+		return nil, err
+	}
+
+	// Parse the optional privilege and database the token is limited to.
+	if tok, _, _ := p.scanIgnoreWhitespace(); tok == WITH {
+		if stmt.Privilege, err = p.parsePrivilege(); err != nil {
+			return nil, err
+		}
+		if tok, _, _ := p.scanIgnoreWhitespace(); tok == ON {
+			if stmt.Database, err = p.parseIdent(); err != nil {
+				return nil, err
+			}
+		} else {
+			p.unscan()
+		}
+	} else {
+		p.unscan()
+	}
+
+	// Parse the optional duration the token is valid for.
+	if tok, _, _ := p.scanIgnoreWhitespace(); tok == DURATION {
+		if stmt.Duration, err = p.parseDuration(); err != nil {
+			return nil, err
+		}
+	} else {
+		p.unscan()
+	}
+
+	return stmt, nil
+}
+
+// parseDropTokenStatement parses a string and returns a DropTokenStatement.
+// This function assumes the "DROP TOKEN" tokens have already been consumed.
+func (p *Parser) parseDropTokenStatement() (*DropTokenStatement, error) {
+	stmt := &DropTokenStatement{}
+
+	// Parse the name of the token to be dropped.
+	lit, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Name = lit
+
+	return stmt, nil
+}
+
+// parseShowGrantsForUserStatement parses a string and returns a ShowGrantsForUserStatement.
+// This function assumes the "SHOW GRANTS" tokens have already been consumed.
+func (p *Parser) parseShowGrantsForUserStatement() (*ShowGrantsForUserStatement, error) {
+	stmt := &ShowGrantsForUserStatement{}
+
+	// Consume the required FOR token.
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != FOR {
+		return nil, newParseError(tokstr(tok, lit), []string{"FOR"}, pos)
+	}
+
+	// Parse the name of the user to be displayed.
+	lit, err := p.parseIdent()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Name = lit
+
+	return stmt, nil
+}
+
 // parseDropUserStatement parses a string and returns a DropUserStatement.
 // This function assumes the DROP USER tokens have already been consumed.
 func (p *Parser) parseDropUserStatement() (*DropUserStatement, error) {
@@ -1421,6 +1740,27 @@ func (p *Parser) parseSources() (Sources, error) {
 	return sources, nil
 }
 
+// parseSubQuery parses a SELECT statement in the FROM clause, e.g. (SELECT mean(value) FROM cpu).
+// This function assumes the opening parenthesis has already been consumed.
+func (p *Parser) parseSubQuery() (*SubQuery, error) {
+	tok, pos, lit := p.scanIgnoreWhitespace()
+	if tok != SELECT {
+		return nil, newParseError(tokstr(tok, lit), []string{"SELECT"}, pos)
+	}
+
+	stmt, err := p.parseSelectStatement(targetNotRequired)
+	if err != nil {
+		return nil, err
+	} else if stmt.Target != nil {
+		return nil, &ParseError{Message: "subquery cannot have an INTO clause", Pos: pos}
+	}
+
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != RPAREN {
+		return nil, newParseError(tokstr(tok, lit), []string{")"}, pos)
+	}
+	return &SubQuery{Statement: stmt}, nil
+}
+
 // peekRune returns the next rune that would be read by the scanner.
 func (p *Parser) peekRune() rune {
 	r, _, _ := p.s.s.r.ReadRune()
@@ -1432,6 +1772,16 @@ func (p *Parser) peekRune() rune {
 }
 
 func (p *Parser) parseSource() (Source, error) {
+	// Attempt to parse a subquery. Peek at the next character so that regexes can
+	// still be scanned if it isn't one.
+	if isWhitespace(p.peekRune()) {
+		p.consumeWhitespace()
+	}
+	if p.peekRune() == '(' {
+		p.scan()
+		return p.parseSubQuery()
+	}
+
 	m := &Measurement{}
 
 	// Attempt to parse a regex.
@@ -1548,6 +1898,13 @@ func (p *Parser) parseDimension() (*Dimension, error) {
 
 // parseFill parses the fill call and its optios.
 func (p *Parser) parseFill() (FillOption, interface{}, error) {
+	// Check for the fill keyword so that a following clause, such as tz(), isn't consumed.
+	tok, _, lit := p.scanIgnoreWhitespace()
+	p.unscan()
+	if tok != IDENT || strings.ToLower(lit) != "fill" {
+		return NullFill, nil, nil
+	}
+
 	// Parse the expression first.
 	expr, err := p.ParseExpr()
 	if err != nil {
@@ -1563,7 +1920,7 @@ func (p *Parser) parseFill() (FillOption, interface{}, error) {
 			return NullFill, nil, nil
 		}
 		if len(lit.Args) != 1 {
-			return NullFill, nil, errors.New("fill requires an argument, e.g.: 0, null, none, previous")
+			return NullFill, nil, errors.New("fill requires an argument, e.g.: 0, null, none, previous, linear")
 		}
 		switch lit.Args[0].String() {
 		case "null":
@@ -1572,6 +1929,8 @@ func (p *Parser) parseFill() (FillOption, interface{}, error) {
 			return NoFill, nil, nil
 		case "previous":
 			return PreviousFill, nil, nil
+		case "linear":
+			return LinearFill, nil, nil
 		default:
 			num, ok := lit.Args[0].(*NumberLiteral)
 			if !ok {
@@ -1582,6 +1941,32 @@ func (p *Parser) parseFill() (FillOption, interface{}, error) {
 	}
 }
 
+// parseLocation parses an optional time zone clause, e.g. tz('Europe/Berlin').
+func (p *Parser) parseLocation() (*time.Location, error) {
+	if tok, _, lit := p.scanIgnoreWhitespace(); tok != IDENT || strings.ToLower(lit) != "tz" {
+		p.unscan()
+		return nil, nil
+	}
+
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != LPAREN {
+		return nil, newParseError(tokstr(tok, lit), []string{"("}, pos)
+	}
+
+	tok, pos, lit := p.scanIgnoreWhitespace()
+	if tok != STRING {
+		return nil, newParseError(tokstr(tok, lit), []string{"string"}, pos)
+	}
+	loc, err := time.LoadLocation(lit)
+	if err != nil {
+		return nil, &ParseError{Message: fmt.Sprintf("unknown time zone: %s", lit), Pos: pos}
+	}
+
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != RPAREN {
+		return nil, newParseError(tokstr(tok, lit), []string{")"}, pos)
+	}
+	return loc, nil
+}
+
 // parseOptionalTokenAndInt parses the specified token followed
 // by an int, if it exists.
 func (p *Parser) parseOptionalTokenAndInt(t Token) (int, error) {
@@ -1815,6 +2200,8 @@ func (p *Parser) parseUnaryExpr() (Expr, error) {
 	case DURATION_VAL:
 		v, _ := ParseDuration(lit)
 		return &DurationLiteral{Val: v}, nil
+	case BOUNDPARAM:
+		return &BoundParameter{Name: lit}, nil
 	case MUL:
 		return &Wildcard{}, nil
 	case REGEX:
@@ -73,6 +73,34 @@ func TestParser_ParseStatement(t *testing.T) {
 			},
 		},
 
+		// SELECT moving window function of a field
+		{
+			s: `SELECT difference(value) FROM cpu`,
+			stmt: &influxql.SelectStatement{
+				IsRawQuery: true,
+				Fields: []*influxql.Field{
+					{Expr: &influxql.Call{Name: "difference", Args: []influxql.Expr{&influxql.VarRef{Val: "value"}}}},
+				},
+				Sources: []influxql.Source{&influxql.Measurement{Name: "cpu"}},
+			},
+		},
+
+		// SELECT moving window function of an aggregate
+		{
+			s: `SELECT moving_average(mean(value), 3) FROM cpu GROUP BY time(1m)`,
+			stmt: &influxql.SelectStatement{
+				IsRawQuery: false,
+				Fields: []*influxql.Field{
+					{Expr: &influxql.Call{Name: "moving_average", Args: []influxql.Expr{
+						&influxql.Call{Name: "mean", Args: []influxql.Expr{&influxql.VarRef{Val: "value"}}},
+						&influxql.NumberLiteral{Val: 3},
+					}}},
+				},
+				Sources:    []influxql.Source{&influxql.Measurement{Name: "cpu"}},
+				Dimensions: []*influxql.Dimension{{Expr: &influxql.Call{Name: "time", Args: []influxql.Expr{&influxql.DurationLiteral{Val: time.Minute}}}}},
+			},
+		},
+
 		// SELECT statement
 		{
 			s: `SELECT mean(field1), sum(field2) ,count(field3) AS field_x FROM myseries WHERE host = 'hosta.influxdb.org' GROUP BY time(10h) ORDER BY ASC LIMIT 20 OFFSET 10;`,
@@ -345,6 +373,88 @@ func TestParser_ParseStatement(t *testing.T) {
 			},
 		},
 
+		// SELECT statement with linear fill
+		{
+			s: `SELECT mean(value) FROM cpu GROUP BY time(5m) fill(linear)`,
+			stmt: &influxql.SelectStatement{
+				Fields: []*influxql.Field{{
+					Expr: &influxql.Call{
+						Name: "mean",
+						Args: []influxql.Expr{&influxql.VarRef{Val: "value"}}}}},
+				Sources:    []influxql.Source{&influxql.Measurement{Name: "cpu"}},
+				Dimensions: []*influxql.Dimension{{Expr: &influxql.Call{Name: "time", Args: []influxql.Expr{&influxql.DurationLiteral{Val: 5 * time.Minute}}}}},
+				Fill:       influxql.LinearFill,
+			},
+		},
+
+		// SELECT statement with a GROUP BY time offset and time zone
+		{
+			s: `SELECT mean(value) FROM cpu GROUP BY time(1h, 15m) tz('Europe/Berlin')`,
+			stmt: &influxql.SelectStatement{
+				Fields: []*influxql.Field{{
+					Expr: &influxql.Call{
+						Name: "mean",
+						Args: []influxql.Expr{&influxql.VarRef{Val: "value"}}}}},
+				Sources: []influxql.Source{&influxql.Measurement{Name: "cpu"}},
+				Dimensions: []*influxql.Dimension{{Expr: &influxql.Call{Name: "time", Args: []influxql.Expr{
+					&influxql.DurationLiteral{Val: time.Hour},
+					&influxql.DurationLiteral{Val: 15 * time.Minute},
+				}}}},
+				Location: mustLoadLocation("Europe/Berlin"),
+			},
+		},
+
+		// SELECT statement with a subquery
+		{
+			s: `SELECT max(m) FROM (SELECT mean(value) AS m FROM cpu GROUP BY time(1m), host) GROUP BY time(1m)`,
+			stmt: &influxql.SelectStatement{
+				Fields: []*influxql.Field{{
+					Expr: &influxql.Call{
+						Name: "max",
+						Args: []influxql.Expr{&influxql.VarRef{Val: "m"}}}}},
+				Sources: []influxql.Source{&influxql.SubQuery{Statement: &influxql.SelectStatement{
+					Fields: []*influxql.Field{{
+						Expr: &influxql.Call{
+							Name: "mean",
+							Args: []influxql.Expr{&influxql.VarRef{Val: "value"}}},
+						Alias: "m"}},
+					Sources: []influxql.Source{&influxql.Measurement{Name: "cpu"}},
+					Dimensions: []*influxql.Dimension{
+						{Expr: &influxql.Call{Name: "time", Args: []influxql.Expr{&influxql.DurationLiteral{Val: time.Minute}}}},
+						{Expr: &influxql.VarRef{Val: "host"}},
+					},
+				}}},
+				Dimensions: []*influxql.Dimension{{Expr: &influxql.Call{Name: "time", Args: []influxql.Expr{&influxql.DurationLiteral{Val: time.Minute}}}}},
+			},
+		},
+
+		// EXPLAIN statement
+		{
+			s: `EXPLAIN SELECT mean(value) FROM cpu`,
+			stmt: &influxql.ExplainStatement{
+				Statement: &influxql.SelectStatement{
+					Fields: []*influxql.Field{{
+						Expr: &influxql.Call{
+							Name: "mean",
+							Args: []influxql.Expr{&influxql.VarRef{Val: "value"}}}}},
+					Sources: []influxql.Source{&influxql.Measurement{Name: "cpu"}},
+				},
+			},
+		},
+
+		// EXPLAIN ANALYZE statement
+		{
+			s: `EXPLAIN ANALYZE SELECT value FROM cpu`,
+			stmt: &influxql.ExplainStatement{
+				Analyze: true,
+				Statement: &influxql.SelectStatement{
+					Fields:     []*influxql.Field{{Expr: &influxql.VarRef{Val: "value"}}},
+					Sources:    []influxql.Source{&influxql.Measurement{Name: "cpu"}},
+					IsRawQuery: true,
+				},
+			},
+		},
+
 		// DELETE statement
 		{
 			s: `DELETE FROM myseries WHERE host = 'hosta.influxdb.org'`,
@@ -840,6 +950,110 @@ func TestParser_ParseStatement(t *testing.T) {
 			},
 		},
 
+		// GRANT READ on measurements to a role
+		{
+			s: `GRANT READ ON testdb./^cpu.*/ TO ROLE ops`,
+			stmt: &influxql.GrantStatement{
+				Privilege:   influxql.ReadPrivilege,
+				On:          "testdb",
+				Measurement: &influxql.Measurement{Regex: &influxql.RegexLiteral{Val: regexp.MustCompile(`^cpu.*`)}},
+				Role:        "ops",
+			},
+		},
+
+		// GRANT WRITE on a database to a role
+		{
+			s: `GRANT WRITE ON testdb TO ROLE ops`,
+			stmt: &influxql.GrantStatement{
+				Privilege: influxql.WritePrivilege,
+				On:        "testdb",
+				Role:      "ops",
+			},
+		},
+
+		// REVOKE WRITE on a measurement from a role
+		{
+			s: `REVOKE WRITE ON testdb.cpu FROM ROLE ops`,
+			stmt: &influxql.RevokeStatement{
+				Privilege:   influxql.WritePrivilege,
+				On:          "testdb",
+				Measurement: &influxql.Measurement{Name: "cpu"},
+				Role:        "ops",
+			},
+		},
+
+		// CREATE ROLE
+		{
+			s:    `CREATE ROLE ops`,
+			stmt: &influxql.CreateRoleStatement{Name: "ops"},
+		},
+
+		// DROP ROLE
+		{
+			s:    `DROP ROLE ops`,
+			stmt: &influxql.DropRoleStatement{Name: "ops"},
+		},
+
+		// GRANT ROLE
+		{
+			s:    `GRANT ROLE ops TO jdoe`,
+			stmt: &influxql.GrantRoleStatement{Role: "ops", User: "jdoe"},
+		},
+
+		// REVOKE ROLE
+		{
+			s:    `REVOKE ROLE ops FROM jdoe`,
+			stmt: &influxql.RevokeRoleStatement{Role: "ops", User: "jdoe"},
+		},
+
+		// SHOW ROLES
+		{
+			s:    `SHOW ROLES`,
+			stmt: &influxql.ShowRolesStatement{},
+		},
+
+		// ALTER USER ... UNLOCK
+		{
+			s:    `ALTER USER jdoe UNLOCK`,
+			stmt: &influxql.UnlockUserStatement{Name: "jdoe"},
+		},
+
+		// CREATE TOKEN
+		{
+			s:    `CREATE TOKEN collector FOR jdoe`,
+			stmt: &influxql.CreateTokenStatement{Name: "collector", User: "jdoe", Privilege: influxql.AllPrivileges},
+		},
+
+		// CREATE TOKEN with privilege, database and duration
+		{
+			s: `CREATE TOKEN collector FOR jdoe WITH WRITE ON testdb DURATION 30d`,
+			stmt: &influxql.CreateTokenStatement{
+				Name:      "collector",
+				User:      "jdoe",
+				Privilege: influxql.WritePrivilege,
+				Database:  "testdb",
+				Duration:  30 * 24 * time.Hour,
+			},
+		},
+
+		// DROP TOKEN
+		{
+			s:    `DROP TOKEN collector`,
+			stmt: &influxql.DropTokenStatement{Name: "collector"},
+		},
+
+		// SHOW TOKENS
+		{
+			s:    `SHOW TOKENS`,
+			stmt: &influxql.ShowTokensStatement{},
+		},
+
+		// SHOW GRANTS FOR
+		{
+			s:    `SHOW GRANTS FOR jdoe`,
+			stmt: &influxql.ShowGrantsForUserStatement{Name: "jdoe"},
+		},
+
 		// CREATE RETENTION POLICY
 		{
 			s: `CREATE RETENTION POLICY policy1 ON testdb DURATION 1h REPLICATION 2`,
@@ -942,9 +1156,9 @@ func TestParser_ParseStatement(t *testing.T) {
 		},
 
 		// Errors
-		{s: ``, err: `found EOF, expected SELECT, DELETE, SHOW, CREATE, DROP, GRANT, REVOKE, ALTER, SET at line 1, char 1`},
+		{s: ``, err: `found EOF, expected SELECT, DELETE, SHOW, CREATE, DROP, GRANT, REVOKE, ALTER, SET, EXPLAIN at line 1, char 1`},
 		{s: `SELECT`, err: `found EOF, expected identifier, string, number, bool at line 1, char 8`},
-		{s: `blah blah`, err: `found blah, expected SELECT, DELETE, SHOW, CREATE, DROP, GRANT, REVOKE, ALTER, SET at line 1, char 1`},
+		{s: `blah blah`, err: `found blah, expected SELECT, DELETE, SHOW, CREATE, DROP, GRANT, REVOKE, ALTER, SET, EXPLAIN at line 1, char 1`},
 		{s: `SELECT field1 X`, err: `found X, expected FROM at line 1, char 15`},
 		{s: `SELECT field1 FROM "series" WHERE X +;`, err: `found ;, expected identifier, string, number, bool at line 1, char 38`},
 		{s: `SELECT field1 FROM myseries GROUP`, err: `found EOF, expected BY at line 1, char 35`},
@@ -957,6 +1171,24 @@ func TestParser_ParseStatement(t *testing.T) {
 		{s: `SELECT field1 FROM myseries ORDER BY 1`, err: `found 1, expected identifier, ASC, or DESC at line 1, char 38`},
 		{s: `SELECT field1 AS`, err: `found EOF, expected identifier at line 1, char 18`},
 		{s: `SELECT field1 FROM foo group by time(1s)`, err: `GROUP BY requires at least one aggregate function`},
+		{s: `SELECT top(value, 10), mean(value) FROM cpu`, err: `top() cannot be combined with other fields`},
+		{s: `SELECT moving_average(value) FROM cpu`, err: `expected two arguments for moving_average()`},
+		{s: `SELECT moving_average(value, 0) FROM cpu`, err: `expected positive integer as second argument in moving_average()`},
+		{s: `SELECT difference(value, 2) FROM cpu`, err: `expected one argument for difference()`},
+		{s: `SELECT elapsed(value, 10) FROM cpu`, err: `expected duration as second argument in elapsed()`},
+		{s: `SELECT cumulative_sum('value') FROM cpu`, err: `expected field or aggregate argument in cumulative_sum()`},
+		{s: `SELECT difference(top(value, 2)) FROM cpu`, err: `difference() cannot be applied to top()`},
+		{s: `SELECT mean(value), difference(value) FROM cpu`, err: `difference() of a field cannot be combined with aggregate functions`},
+		{s: `SELECT bottom(value, 10) * 2 FROM cpu`, err: `bottom() cannot be combined with other fields`},
+		{s: `SELECT mean(value) FROM cpu GROUP BY time(1h, 'a')`, err: `time dimension offset must be a duration`},
+		{s: `SELECT mean(value) FROM cpu GROUP BY time(1h) tz(Europe)`, err: `found Europe, expected string at line 1, char 50`},
+		{s: `SELECT mean(value) FROM cpu GROUP BY time(1h) tz('Mars/Olympus')`, err: `unknown time zone: Mars/Olympus at line 1, char 49`},
+		{s: `SELECT max(m) FROM (SELECT mean(value) AS m FROM cpu`, err: `found EOF, expected ) at line 1, char 54`},
+		{s: `SELECT max(m) FROM (SHOW MEASUREMENTS)`, err: `found SHOW, expected SELECT at line 1, char 21`},
+		{s: `SELECT max(m) FROM (SELECT value INTO cpu2 FROM cpu)`, err: `subquery cannot have an INTO clause at line 1, char 21`},
+		{s: `SELECT max(m) FROM (SELECT mean(value) AS m FROM cpu), mem`, err: `subquery must be the only source`},
+		{s: `EXPLAIN`, err: `found EOF, expected SELECT at line 1, char 9`},
+		{s: `EXPLAIN ANALYZE SHOW SERIES`, err: `found SHOW, expected SELECT at line 1, char 17`},
 		{s: `SELECT field1 FROM 12`, err: `found 12, expected identifier at line 1, char 20`},
 		{s: `SELECT 1000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000 FROM myseries`, err: `unable to parse number at line 1, char 8`},
 		{s: `SELECT 10.5h FROM myseries`, err: `found h, expected FROM at line 1, char 12`},
@@ -970,7 +1202,8 @@ func TestParser_ParseStatement(t *testing.T) {
 		{s: `SHOW CONTINUOUS`, err: `found EOF, expected QUERIES at line 1, char 17`},
 		{s: `SHOW RETENTION`, err: `found EOF, expected POLICIES at line 1, char 16`},
 		{s: `SHOW RETENTION POLICIES`, err: `found EOF, expected identifier at line 1, char 25`},
-		{s: `SHOW FOO`, err: `found FOO, expected CONTINUOUS, DATABASES, FIELD, MEASUREMENTS, RETENTION, SERIES, SERVERS, TAG, USERS at line 1, char 6`},
+		{s: `SHOW FOO`, err: `found FOO, expected CONTINUOUS, DATABASES, FIELD, GRANTS, MEASUREMENTS, RETENTION, ROLES, SERIES, SERVERS, TAG, TOKENS, USERS at line 1, char 6`},
+		{s: `SHOW GRANTS`, err: `found EOF, expected FOR at line 1, char 13`},
 		{s: `SHOW STATS ON`, err: `found EOF, expected string at line 1, char 15`},
 		{s: `DROP CONTINUOUS`, err: `found EOF, expected QUERY at line 1, char 17`},
 		{s: `DROP CONTINUOUS QUERY`, err: `found EOF, expected identifier at line 1, char 23`},
@@ -1003,6 +1236,16 @@ func TestParser_ParseStatement(t *testing.T) {
 		{s: `REVOKE READ ON`, err: `found EOF, expected identifier at line 1, char 16`},
 		{s: `REVOKE READ ON testdb`, err: `found EOF, expected FROM at line 1, char 23`},
 		{s: `REVOKE READ ON testdb FROM`, err: `found EOF, expected identifier at line 1, char 28`},
+		{s: `GRANT READ ON testdb. TO ROLE ops`, err: `found TO, expected identifier at line 1, char 23`},
+		{s: `GRANT READ ON testdb TO ROLE`, err: `found EOF, expected identifier at line 1, char 30`},
+		{s: `GRANT ROLE ops`, err: `found EOF, expected TO at line 1, char 16`},
+		{s: `REVOKE ROLE ops TO jdoe`, err: `found TO, expected FROM at line 1, char 17`},
+		{s: `CREATE ROLE`, err: `found EOF, expected identifier at line 1, char 13`},
+		{s: `CREATE TOKEN collector`, err: `found EOF, expected FOR at line 1, char 24`},
+		{s: `CREATE TOKEN collector FOR jdoe WITH`, err: `found EOF, expected READ, WRITE, ALL [PRIVILEGES] at line 1, char 38`},
+		{s: `CREATE TOKEN collector FOR jdoe WITH READ ON`, err: `found EOF, expected identifier at line 1, char 46`},
+		{s: `CREATE TOKEN collector FOR jdoe DURATION`, err: `found EOF, expected duration at line 1, char 42`},
+		{s: `DROP TOKEN`, err: `found EOF, expected identifier at line 1, char 12`},
 		{s: `CREATE RETENTION`, err: `found EOF, expected POLICY at line 1, char 18`},
 		{s: `CREATE RETENTION POLICY`, err: `found EOF, expected identifier at line 1, char 25`},
 		{s: `CREATE RETENTION POLICY policy1`, err: `found EOF, expected ON at line 1, char 33`},
@@ -1015,7 +1258,9 @@ func TestParser_ParseStatement(t *testing.T) {
 		{s: `CREATE RETENTION POLICY policy1 ON testdb DURATION 1h REPLICATION 3.14`, err: `number must be an integer at line 1, char 67`},
 		{s: `CREATE RETENTION POLICY policy1 ON testdb DURATION 1h REPLICATION 0`, err: `invalid value 0: must be 1 <= n <= 2147483647 at line 1, char 67`},
 		{s: `CREATE RETENTION POLICY policy1 ON testdb DURATION 1h REPLICATION bad`, err: `found bad, expected number at line 1, char 67`},
-		{s: `ALTER`, err: `found EOF, expected RETENTION at line 1, char 7`},
+		{s: `ALTER`, err: `found EOF, expected RETENTION, USER at line 1, char 7`},
+		{s: `ALTER USER`, err: `found EOF, expected identifier at line 1, char 12`},
+		{s: `ALTER USER jdoe`, err: `found EOF, expected UNLOCK at line 1, char 17`},
 		{s: `ALTER RETENTION`, err: `found EOF, expected POLICY at line 1, char 17`},
 		{s: `ALTER RETENTION POLICY`, err: `found EOF, expected identifier at line 1, char 24`},
 		{s: `ALTER RETENTION POLICY policy1`, err: `found EOF, expected ON at line 1, char 32`}, {s: `ALTER RETENTION POLICY policy1 ON`, err: `found EOF, expected identifier at line 1, char 35`},
@@ -1035,6 +1280,9 @@ func TestParser_ParseStatement(t *testing.T) {
 		// We are memoizing a field so for testing we need to...
 		if s, ok := tt.stmt.(*influxql.SelectStatement); ok {
 			s.GroupByInterval()
+			if sq, ok := s.SubQuery(); ok {
+				sq.Statement.GroupByInterval()
+			}
 		}
 		if !reflect.DeepEqual(tt.err, errstring(err)) {
 			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
@@ -1146,6 +1394,16 @@ func TestParser_ParseExpr(t *testing.T) {
 			},
 		},
 
+		// Binary expression with a bound parameter.
+		{
+			s: `host = $host`,
+			expr: &influxql.BinaryExpr{
+				Op:  influxql.EQ,
+				LHS: &influxql.VarRef{Val: "host"},
+				RHS: &influxql.BoundParameter{Name: "host"},
+			},
+		},
+
 		// Complex binary expression.
 		{
 			s: `value + 3 < 30 AND 1 + 2 OR true`,
@@ -1372,6 +1630,15 @@ func BenchmarkParserParseStatement(b *testing.B) {
 	b.SetBytes(int64(len(s)))
 }
 
+// MustParseStatement parses a statement. Panic on error.
+func MustParseStatement(s string) influxql.Statement {
+	stmt, err := influxql.NewParser(strings.NewReader(s)).ParseStatement()
+	if err != nil {
+		panic(err.Error())
+	}
+	return stmt
+}
+
 // MustParseSelectStatement parses a select statement. Panic on error.
 func MustParseSelectStatement(s string) *influxql.SelectStatement {
 	stmt, err := influxql.NewParser(strings.NewReader(s)).ParseStatement()
@@ -1418,6 +1685,15 @@ func newAlterRetentionPolicyStatement(name string, DB string, d time.Duration, r
 }
 
 // mustMarshalJSON encodes a value to JSON.
+// mustLoadLocation returns the time zone with the given name. Panic on error.
+func mustLoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
 func mustMarshalJSON(v interface{}) []byte {
 	b, err := json.Marshal(v)
 	if err != nil {
@@ -96,6 +96,13 @@ func (s *Scanner) Scan() (tok Token, pos Pos, lit string) {
 		return COMMA, pos, ""
 	case ';':
 		return SEMICOLON, pos, ""
+	case '$':
+		if ch1, _ := s.r.read(); !isIdentChar(ch1) {
+			s.r.unread()
+			return ILLEGAL, pos, "$"
+		}
+		s.r.unread()
+		return BOUNDPARAM, pos, ScanBareIdent(s.r)
 	}
 
 	return ILLEGAL, pos, string(ch0)
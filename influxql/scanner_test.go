@@ -103,6 +103,11 @@ func TestScanner_Scan(t *testing.T) {
 		{s: `10w`, tok: influxql.DURATION_VAL, lit: `10w`},
 		{s: `10x`, tok: influxql.NUMBER, lit: `10`}, // non-duration unit
 
+		// Bound parameters
+		{s: `$host`, tok: influxql.BOUNDPARAM, lit: `host`},
+		{s: `$host_2`, tok: influxql.BOUNDPARAM, lit: `host_2`},
+		{s: `$`, tok: influxql.ILLEGAL, lit: `$`},
+
 		// Keywords
 		{s: `ALL`, tok: influxql.ALL},
 		{s: `ALTER`, tok: influxql.ALTER},
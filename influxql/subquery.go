@@ -0,0 +1,313 @@
+package influxql
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// planSubQuery runs the subquery in the FROM clause of stmt to completion and creates a
+// MapReduceJob over the rows it returned for each unique set of the outer GROUP BY tags.
+func (p *Planner) planSubQuery(stmt *SelectStatement, sq *SubQuery, tagKeys []string, chunkSize int) ([]*MapReduceJob, error) {
+	// The outer statement can only refer to the fields and tags returned by the subquery.
+	_, innerTags, err := sq.Statement.Dimensions.Normalize()
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]bool{"time": true}
+	for _, f := range sq.Statement.Fields {
+		names[f.Name()] = true
+	}
+	for _, k := range innerTags {
+		names[k] = true
+	}
+	for _, n := range stmt.NamesInSelect() {
+		if !names[n] {
+			return nil, fmt.Errorf("unknown field or tag name in select clause: %s", n)
+		}
+	}
+	for _, n := range stmt.NamesInWhere() {
+		if !names[n] {
+			return nil, fmt.Errorf("unknown field or tag name in where clause: %s", n)
+		}
+	}
+	for _, k := range tagKeys {
+		if !names[k] || k == "time" {
+			return nil, fmt.Errorf("unknown tag key in group by clause: %s", k)
+		}
+	}
+
+	// Run the subquery. The channel is always drained so the executor can finish.
+	e, err := p.Plan(sq.Statement, chunkSize)
+	if err != nil {
+		return nil, err
+	}
+	var rows []*Row
+	for row := range e.Execute() {
+		if row.Err != nil && err == nil {
+			err = row.Err
+		}
+		rows = append(rows, row)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Use the time range of the subquery unless the outer statement narrows it.
+	tmin, tmax := TimeRange(stmt.Condition)
+	innerMin, innerMax := TimeRange(sq.Statement.Condition)
+	if tmin.IsZero() {
+		tmin = innerMin
+	}
+	if tmax.IsZero() {
+		tmax = innerMax
+	}
+	if tmax.IsZero() {
+		tmax = p.Now()
+	}
+	if tmin.IsZero() {
+		tmin = time.Unix(0, 0)
+	}
+
+	// Time is limited by the intervals of each job so only the rest of the condition is
+	// evaluated against the points.
+	filter := conditionWithoutTime(stmt.Condition)
+
+	sortedKeys := make([]string, len(tagKeys))
+	copy(sortedKeys, tagKeys)
+	sort.Strings(sortedKeys)
+
+	// Group the rows by the values of the outer GROUP BY tags.
+	var jobs []*MapReduceJob
+	mappers := make(map[string]*rowMapper)
+	for _, row := range rows {
+		tags := make(map[string]string, len(sortedKeys))
+		pairs := make([]string, len(sortedKeys))
+		for i, k := range sortedKeys {
+			tags[k] = row.Tags[k]
+			pairs[i] = k + "=" + row.Tags[k]
+		}
+		key := strings.Join(pairs, ",")
+
+		mapper := mappers[key]
+		if mapper == nil {
+			job := &MapReduceJob{
+				MeasurementName: row.Name,
+				TagSet:          &TagSet{Tags: tags, Key: []byte(key)},
+				TMin:            tmin.UnixNano(),
+				TMax:            tmax.UnixNano(),
+			}
+			mapper = &rowMapper{job: job, filter: filter}
+			job.Mappers = []Mapper{mapper}
+
+			mappers[key] = mapper
+			jobs = append(jobs, job)
+		}
+		mapper.rows = append(mapper.rows, row)
+	}
+
+	// always return them in sorted order so the results from running the jobs are returned in a deterministic order
+	sort.Sort(MapReduceJobs(jobs))
+	return jobs, nil
+}
+
+// conditionWithoutTime returns a copy of the condition with any comparisons against
+// time replaced by true.
+func conditionWithoutTime(expr Expr) Expr {
+	if expr == nil {
+		return nil
+	}
+	return RewriteFunc(CloneExpr(expr), func(n Node) Node {
+		if e, ok := n.(*BinaryExpr); ok {
+			if isTimeRef(e.LHS) || isTimeRef(e.RHS) {
+				return &BooleanLiteral{Val: true}
+			}
+		}
+		return n
+	}).(Expr)
+}
+
+// isTimeRef returns true if the expression is a reference to time.
+func isTimeRef(expr Expr) bool {
+	ref, ok := expr.(*VarRef)
+	return ok && strings.ToLower(ref.Val) == "time"
+}
+
+// rowMapper is a Mapper over the rows returned by a subquery. Each row is treated
+// as a series with the row's tags, and the columns of its values as the fields.
+type rowMapper struct {
+	job              *MapReduceJob // the MRJob this mapper belongs to
+	rows             []*Row        // the rows of the subquery in this tag set
+	filter           Expr          // the condition of the outer statement without time, if any
+	points           []rowPoint    // the points of all rows in time order
+	index            int           // the index of the next point to read
+	mapFunc          MapFunc       // the map func
+	fieldName        string        // the field name associated with the mapFunc currently being run
+	selectNames      []string      // field names that occur in the select clause of a raw query
+	isRaw            bool          // if the query is a non-aggregate query
+	tmin             int64         // the min of the current group by interval being iterated over
+	tmax             int64         // the max of the current group by interval being iterated over
+	perIntervalLimit int           // used for raw queries to determine how far into a chunk we are
+	chunkSize        int           // used for raw queries to determine how much data to read before flushing to client
+}
+
+// rowPoint is a single value of a subquery row.
+type rowPoint struct {
+	seriesID  uint64                 // the index of the row the point belongs to
+	timestamp int64                  // the time of the point
+	values    map[string]interface{} // the columns and tags of the row by name
+}
+
+type rowPoints []rowPoint
+
+func (a rowPoints) Len() int           { return len(a) }
+func (a rowPoints) Less(i, j int) bool { return a[i].timestamp < a[j].timestamp }
+func (a rowPoints) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+
+// Open collects the points of the rows that match the filter in time order.
+func (r *rowMapper) Open() error {
+	r.points = nil
+	for i, row := range r.rows {
+		for _, vals := range row.Values {
+			t, ok := vals[0].(time.Time)
+			if !ok {
+				return fmt.Errorf("subquery returned an invalid time: %v", vals[0])
+			}
+
+			values := make(map[string]interface{}, len(row.Columns)+len(row.Tags))
+			for k, v := range row.Tags {
+				values[k] = v
+			}
+			for j := 1; j < len(vals) && j < len(row.Columns); j++ {
+				values[row.Columns[j]] = vals[j]
+			}
+
+			if r.filter != nil {
+				if ok, _ := Eval(r.filter, values).(bool); !ok {
+					continue
+				}
+			}
+			r.points = append(r.points, rowPoint{seriesID: uint64(i), timestamp: t.UnixNano(), values: values})
+		}
+	}
+	sort.Stable(rowPoints(r.points))
+	return nil
+}
+
+// Close is a no-op since the rows are held in memory.
+func (r *rowMapper) Close() {}
+
+// Begin will set up the mapper to run the map function for a given aggregate call starting at the passed in time
+func (r *rowMapper) Begin(c *Call, startingTime int64, chunkSize int) error {
+	mapFunc, err := InitializeMapFunc(c)
+	if err != nil {
+		return err
+	}
+	r.mapFunc = mapFunc
+	r.chunkSize = chunkSize
+	r.tmin = startingTime
+	r.tmax = r.job.TMax
+	r.index = 0
+
+	// raw queries return the selected fields, aggregates read the field of the call
+	r.isRaw = c == nil
+	if r.isRaw {
+		r.selectNames = nil
+		for _, n := range r.job.stmt.NamesInSelect() {
+			if n != "time" {
+				r.selectNames = append(r.selectNames, n)
+			}
+		}
+		return nil
+	}
+
+	// count(distinct(field)) reads the field of the inner call
+	arg := c.Args[0]
+	if inner, ok := arg.(*Call); ok && len(inner.Args) > 0 {
+		arg = inner.Args[0]
+	}
+	ref, ok := arg.(*VarRef)
+	if !ok {
+		return fmt.Errorf("aggregate call didn't contain a field %s", c.String())
+	}
+	r.fieldName = ref.Val
+	return nil
+}
+
+// NextInterval will get the time ordered next interval of the given interval size from the mapper. This is a
+// forward only operation from the start time passed into Begin. Will return nil when there is no more data to be read.
+func (r *rowMapper) NextInterval() (interface{}, error) {
+	if r.index >= len(r.points) || r.points[r.index].timestamp > r.job.TMax || r.tmin > r.job.TMax {
+		return nil, nil
+	}
+
+	// after we call to the mapper, this will be the tmin for the next interval.
+	nextMin := r.tmin + r.job.window.Interval
+
+	// Set the upper bound of the interval.
+	if r.isRaw {
+		r.perIntervalLimit = r.chunkSize
+	} else if r.job.window.Interval > 0 {
+		nextMin = r.job.window.Next(r.tmin)
+		r.tmax = nextMin - 1
+	}
+
+	// Execute the map function. This mapper acts as the iterator
+	val := r.mapFunc(r)
+
+	// Move the interval forward if it's not a raw query. For raw queries we use the limit to advance intervals.
+	if !r.isRaw {
+		r.tmin = nextMin
+	}
+
+	return val, nil
+}
+
+// Next returns the next matching timestamped value in the current interval.
+func (r *rowMapper) Next() (seriesID uint64, timestamp int64, value interface{}) {
+	for r.index < len(r.points) {
+		// if it's a raw query and we've read a full chunk, bail
+		if r.isRaw && r.perIntervalLimit == 0 {
+			return 0, 0, nil
+		}
+
+		// return if there is no more data in this group by interval
+		p := r.points[r.index]
+		if p.timestamp > r.tmax {
+			return 0, 0, nil
+		}
+		r.index++
+		if p.timestamp < r.tmin {
+			continue
+		}
+
+		// raw queries selecting multiple fields return them by name
+		var v interface{}
+		if !r.isRaw {
+			v = p.values[r.fieldName]
+		} else if len(r.selectNames) == 1 {
+			v = p.values[r.selectNames[0]]
+		} else if len(r.selectNames) > 1 {
+			fields := make(map[string]interface{}, len(r.selectNames))
+			for _, n := range r.selectNames {
+				fields[n] = p.values[n]
+			}
+			v = fields
+		}
+		if v == nil {
+			continue
+		}
+
+		if r.isRaw {
+			r.perIntervalLimit--
+		}
+		return p.seriesID, p.timestamp, v
+	}
+	return 0, 0, nil
+}
+
+// Tags returns the tags of the row a point was read from.
+func (r *rowMapper) Tags(seriesID uint64) map[string]string {
+	return r.rows[seriesID].Tags
+}
@@ -0,0 +1,167 @@
+package influxql
+
+// This file implements a t-digest, a mergeable sketch used to estimate percentiles
+// without holding every value in memory. Values are grouped into weighted centroids
+// that are kept small near the tails of the distribution so extreme percentiles stay
+// accurate. See "Computing Extremely Accurate Quantiles Using t-Digests" by Ted Dunning.
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	// DefaultTDigestCompression is the compression used by percentile_approx() when one
+	// isn't specified. Higher values are more accurate but use more memory. A digest
+	// holds roughly twice the compression in centroids.
+	DefaultTDigestCompression = 100
+
+	// MaxTDigestCompression is the largest compression that can be requested.
+	MaxTDigestCompression = 10000
+)
+
+// tdigestCentroid represents the mean of a group of values and the number of values in it.
+type tdigestCentroid struct {
+	Mean  float64
+	Count float64
+}
+
+// tdigest represents a t-digest sketch of a set of values.
+type tdigest struct {
+	Compression float64
+	Min         float64
+	Max         float64
+	Centroids   []tdigestCentroid
+
+	// values added since the last compression
+	buffer []tdigestCentroid
+}
+
+// newTDigest returns a new, empty digest with the given compression.
+func newTDigest(compression float64) *tdigest {
+	return &tdigest{
+		Compression: compression,
+		Min:         math.Inf(1),
+		Max:         math.Inf(-1),
+	}
+}
+
+// Add adds a weighted value to the digest.
+func (t *tdigest) Add(v, count float64) {
+	t.Min = math.Min(t.Min, v)
+	t.Max = math.Max(t.Max, v)
+	t.buffer = append(t.buffer, tdigestCentroid{Mean: v, Count: count})
+
+	// compress periodically so memory stays proportional to the compression
+	if len(t.buffer) > int(t.Compression)*4 {
+		t.Compress()
+	}
+}
+
+// Merge adds all of the centroids of another digest.
+func (t *tdigest) Merge(other *tdigest) {
+	other.Compress()
+	if len(other.Centroids) == 0 {
+		return
+	}
+	t.Min = math.Min(t.Min, other.Min)
+	t.Max = math.Max(t.Max, other.Max)
+	t.buffer = append(t.buffer, other.Centroids...)
+	t.Compress()
+}
+
+// Count returns the total number of values in the digest.
+func (t *tdigest) Count() float64 {
+	var n float64
+	for _, c := range t.Centroids {
+		n += c.Count
+	}
+	for _, c := range t.buffer {
+		n += c.Count
+	}
+	return n
+}
+
+// Compress merges buffered values into the centroids. Adjacent centroids are combined
+// as long as the combined centroid stays under the size allowed for its quantile.
+func (t *tdigest) Compress() {
+	if len(t.buffer) == 0 {
+		return
+	}
+
+	all := append(t.Centroids, t.buffer...)
+	sort.Sort(tdigestCentroids(all))
+	t.buffer = nil
+
+	var total float64
+	for _, c := range all {
+		total += c.Count
+	}
+
+	merged := make([]tdigestCentroid, 0, len(all))
+	cur := all[0]
+	var before float64
+	for _, c := range all[1:] {
+		// the quantile at the center of the combined centroid determines its size limit
+		q := (before + (cur.Count+c.Count)/2) / total
+		if limit := 4 * total * q * (1 - q) / t.Compression; cur.Count+c.Count <= math.Max(1, limit) {
+			cur.Count += c.Count
+			cur.Mean += (c.Mean - cur.Mean) * c.Count / cur.Count
+			continue
+		}
+
+		before += cur.Count
+		merged = append(merged, cur)
+		cur = c
+	}
+	t.Centroids = append(merged, cur)
+}
+
+// Quantile returns the estimated value at quantile q, between 0 and 1. Returns NaN
+// if the digest is empty.
+func (t *tdigest) Quantile(q float64) float64 {
+	t.Compress()
+	if len(t.Centroids) == 0 {
+		return math.NaN()
+	} else if len(t.Centroids) == 1 {
+		return t.Centroids[0].Mean
+	}
+
+	var total float64
+	for _, c := range t.Centroids {
+		total += c.Count
+	}
+	target := q * total
+
+	// interpolate between the minimum and the center of the first centroid
+	first := t.Centroids[0]
+	if target < first.Count/2 {
+		return t.Min + (first.Mean-t.Min)*target/(first.Count/2)
+	}
+
+	// interpolate between the centers of the two centroids the target falls between
+	var before float64
+	for i := 0; i < len(t.Centroids)-1; i++ {
+		a, b := t.Centroids[i], t.Centroids[i+1]
+		lo := before + a.Count/2
+		hi := before + a.Count + b.Count/2
+		if target <= hi {
+			return a.Mean + (b.Mean-a.Mean)*(target-lo)/(hi-lo)
+		}
+		before += a.Count
+	}
+
+	// interpolate between the center of the last centroid and the maximum
+	last := t.Centroids[len(t.Centroids)-1]
+	lo := total - last.Count/2
+	if lo >= total {
+		return t.Max
+	}
+	return last.Mean + (t.Max-last.Mean)*(target-lo)/(total-lo)
+}
+
+type tdigestCentroids []tdigestCentroid
+
+func (a tdigestCentroids) Len() int           { return len(a) }
+func (a tdigestCentroids) Less(i, j int) bool { return a[i].Mean < a[j].Mean }
+func (a tdigestCentroids) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
@@ -25,6 +25,7 @@ const (
 	FALSE        // false
 	REGEX        // Regular expressions
 	BADREGEX     // `.*
+	BOUNDPARAM   // $param
 	literal_end
 
 	operator_beg
@@ -57,6 +58,7 @@ const (
 	// Keywords
 	ALL
 	ALTER
+	ANALYZE
 	AS
 	ASC
 	BEGIN
@@ -77,6 +79,7 @@ const (
 	FOR
 	FROM
 	GRANT
+	GRANTS
 	GROUP
 	IF
 	IN
@@ -102,6 +105,8 @@ const (
 	REPLICATION
 	RETENTION
 	REVOKE
+	ROLE
+	ROLES
 	SELECT
 	SERIES
 	SERVERS
@@ -113,6 +118,9 @@ const (
 	SOFFSET
 	TAG
 	TO
+	TOKEN
+	TOKENS
+	UNLOCK
 	USER
 	USERS
 	VALUES
@@ -136,6 +144,7 @@ var tokens = [...]string{
 	TRUE:         "TRUE",
 	FALSE:        "FALSE",
 	REGEX:        "REGEX",
+	BOUNDPARAM:   "BOUNDPARAM",
 
 	ADD: "+",
 	SUB: "-",
@@ -162,6 +171,7 @@ var tokens = [...]string{
 
 	ALL:          "ALL",
 	ALTER:        "ALTER",
+	ANALYZE:      "ANALYZE",
 	AS:           "AS",
 	ASC:          "ASC",
 	BEGIN:        "BEGIN",
@@ -182,6 +192,7 @@ var tokens = [...]string{
 	FOR:          "FOR",
 	FROM:         "FROM",
 	GRANT:        "GRANT",
+	GRANTS:       "GRANTS",
 	GROUP:        "GROUP",
 	IF:           "IF",
 	IN:           "IN",
@@ -207,6 +218,8 @@ var tokens = [...]string{
 	REPLICATION:  "REPLICATION",
 	RETENTION:    "RETENTION",
 	REVOKE:       "REVOKE",
+	ROLE:         "ROLE",
+	ROLES:        "ROLES",
 	SELECT:       "SELECT",
 	SERIES:       "SERIES",
 	SERVERS:      "SERVERS",
@@ -218,6 +231,9 @@ var tokens = [...]string{
 	DIAGNOSTICS:  "DIAGNOSTICS",
 	TAG:          "TAG",
 	TO:           "TO",
+	TOKEN:        "TOKEN",
+	TOKENS:       "TOKENS",
+	UNLOCK:       "UNLOCK",
 	USER:         "USER",
 	USERS:        "USERS",
 	VALUES:       "VALUES",
@@ -4,6 +4,7 @@ package influxdb
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"testing"
@@ -371,3 +372,89 @@ func MustParseExpr(s string) influxql.Expr {
 func strref(s string) *string {
 	return &s
 }
+
+// Ensure writes while a result is computed only drop the intervals they're in.
+func TestQueryCache_put_Reservation(t *testing.T) {
+	c := NewQueryCache()
+	w := influxql.Window{Interval: 10}
+	entry := func(key string) *queryCacheEntry {
+		rows := []*influxql.Row{{Name: "cpu", Columns: []string{"time", "sum"}, Values: [][]interface{}{
+			{time.Unix(0, 0).UTC(), 1.0}, {time.Unix(0, 10).UTC(), 2.0}, {time.Unix(0, 20).UTC(), 3.0},
+		}}}
+		return &queryCacheEntry{key: key, window: w, start: 0, end: 30, shards: map[uint64]struct{}{1: {}}, rows: rows, size: estimateRowsSize(rows)}
+	}
+
+	// Writes to other shards and after the result don't affect it.
+	r := c.reserve(map[uint64]struct{}{1: {}})
+	c.invalidate(2, 0)
+	c.invalidate(1, 30)
+	c.put(entry("a"), r)
+	c.release(r)
+	if e := c.get("a"); e == nil || e.end != 30 {
+		t.Fatalf("unexpected entry: %#v", e)
+	}
+
+	// Writes within the result drop the intervals from the one written to.
+	r = c.reserve(map[uint64]struct{}{1: {}})
+	c.invalidate(1, 15)
+	c.put(entry("b"), r)
+	c.release(r)
+	if e := c.get("b"); e == nil || e.end != 10 || len(e.rows[0].Values) != 1 {
+		t.Fatalf("unexpected entry: %#v", e)
+	}
+
+	// The cached entries are also invalidated by shard.
+	if e := c.get("a"); e == nil || e.end != 10 {
+		t.Fatalf("unexpected entry: %#v", e)
+	} else if len(c.reservations) != 0 {
+		t.Fatalf("unexpected reservations: %d", len(c.reservations))
+	}
+}
+
+// Ensure a scan counter limits the points read and the time spent by a query.
+func TestScanCounter(t *testing.T) {
+	c := newScanCounter(2*deadlineCheckInterval, time.Minute, time.Minute)
+	if err := c.add(deadlineCheckInterval); err != nil {
+		t.Fatal(err)
+	} else if points, d, err := c.remaining(time.Now()); err != nil || points != deadlineCheckInterval || d <= 0 || d > time.Minute {
+		t.Fatalf("unexpected remaining: %d, %s, %v", points, d, err)
+	}
+
+	// Remote mappers can't begin once the query has timed out.
+	if _, _, err := c.remaining(time.Now().Add(2 * time.Minute)); err == nil || err.Error() != "query timeout exceeded: query ran for longer than 1m0s" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The deadline is checked as points are read.
+	c.deadline = time.Now().Add(-time.Second)
+	for i := 1; i < deadlineCheckInterval; i++ {
+		if err := c.add(1); err != nil {
+			t.Fatalf("unexpected error after %d points: %s", i, err)
+		}
+	}
+	if err := c.add(1); err == nil || err.Error() != "query timeout exceeded: query ran for longer than 1m0s" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Reading past the max fails regardless of the deadline.
+	c.deadline = time.Time{}
+	if err := c.add(1); err == nil || err.Error() != "max points scanned exceeded: query read more than 2000 points. maybe you forgot to specify a where time clause?" {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, _, err := c.remaining(time.Now()); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+// Ensure the regex of a decoded matcher is compiled once.
+func TestMatcher_UnmarshalJSON(t *testing.T) {
+	var m Matcher
+	if err := json.Unmarshal([]byte(`{"regex":true,"name":"^cpu"}`), &m); err != nil {
+		t.Fatal(err)
+	} else if m.re == nil {
+		t.Fatal("expected compiled regex")
+	} else if !m.Matches("cpu0") || m.Matches("mem") {
+		t.Fatal("unexpected match")
+	} else if !m.equals(&Matcher{IsRegex: true, Name: "^cpu"}) {
+		t.Fatal("expected matchers to be equal")
+	}
+}
@@ -51,6 +51,10 @@ type Client struct {
 	// The amount of time between pings to verify the broker is alive.
 	PingInterval time.Duration
 
+	// The HTTP transport used to connect to brokers. This is passed to
+	// all connections created by the client.
+	Transport *http.Transport
+
 	// The logging interface used by the client for out-of-band errors.
 	Logger *log.Logger
 }
@@ -60,6 +64,7 @@ func NewClient(dataURL url.URL) *Client {
 	c := &Client{
 		ReconnectTimeout: DefaultReconnectTimeout,
 		PingInterval:     DefaultPingInterval,
+		Transport:        http.DefaultTransport.(*http.Transport),
 		dataURL:          dataURL,
 	}
 	return c
@@ -177,8 +182,8 @@ func (c *Client) close() error {
 	c.conns = nil
 
 	// Shutdown any "keep-alive" connections held open
-	// by the default transport.
-	http.DefaultTransport.(*http.Transport).CloseIdleConnections()
+	// by the transport.
+	c.Transport.CloseIdleConnections()
 
 	// Close goroutines.
 	if c.closing != nil {
@@ -321,7 +326,7 @@ func (c *Client) do(method, path string, values url.Values, contentType string,
 
 		// Send HTTP request.
 		// If it cannot connect then select a different URL from the config.
-		resp, err := http.DefaultClient.Do(req)
+		resp, err := (&http.Client{Transport: c.Transport}).Do(req)
 		if err != nil {
 			c.randomizeURL()
 			return nil, err
@@ -351,6 +356,7 @@ func (c *Client) Conn(topicID uint64) *Conn {
 
 	// Create connection and set current URL.
 	conn := NewConn(topicID, &c.dataURL)
+	conn.Transport = c.Transport
 	conn.SetURL(c.url)
 
 	// Add to list of client connections.
@@ -433,6 +439,9 @@ type Conn struct {
 	// The amount of time between heartbeats from data nodes to brokers
 	HeartbeatInterval time.Duration
 
+	// The HTTP transport used to connect to the broker.
+	Transport *http.Transport
+
 	// The logging interface used by the connection for out-of-band errors.
 	Logger *log.Logger
 }
@@ -444,6 +453,7 @@ func NewConn(topicID uint64, dataURL *url.URL) *Conn {
 		dataURL:           *dataURL,
 		ReconnectTimeout:  DefaultReconnectTimeout,
 		HeartbeatInterval: DefaultHeartbeatInterval,
+		Transport:         http.DefaultTransport.(*http.Transport),
 		Logger:            log.New(os.Stderr, "[messaging] ", log.LstdFlags),
 	}
 }
@@ -582,7 +592,7 @@ func (c *Conn) Heartbeat() error {
 		"index":   {strconv.FormatUint(index, 10)},
 		"url":     {c.dataURL.String()},
 	}.Encode()
-	resp, err = http.Post(u.String(), "application/octet-stream", nil)
+	resp, err = (&http.Client{Transport: c.Transport}).Post(u.String(), "application/octet-stream", nil)
 	if err != nil {
 		return err
 	}
@@ -658,14 +668,14 @@ func (c *Conn) streamer(closing <-chan struct{}) {
 	// Close in-flight request.
 	reqlock.Lock()
 	if req != nil {
-		http.DefaultTransport.(*http.Transport).CancelRequest(req)
+		c.Transport.CancelRequest(req)
 	}
 	reqlock.Unlock()
 }
 
 // stream connects to a broker server and streams the topic messages.
 func (c *Conn) stream(req *http.Request, closing <-chan struct{}) error {
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := (&http.Client{Transport: c.Transport}).Do(req)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,531 @@
+package influxdb
+
+import (
+	"container/list"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdb/influxdb/influxql"
+)
+
+// DefaultQueryCacheMaxSize is the default estimated size of the query cache's results.
+const DefaultQueryCacheMaxSize = 64 * 1024 * 1024 // 64MB
+
+// cacheableCalls are the aggregates whose value for a GROUP BY time() interval only
+// depends on the points within that interval.
+var cacheableCalls = map[string]bool{
+	"count": true, "distinct": true, "first": true, "last": true, "max": true,
+	"mean": true, "median": true, "min": true, "mode": true, "percentile": true,
+	"percentile_approx": true, "spread": true, "stddev": true, "sum": true,
+}
+
+// QueryCache caches the results of aggregate queries grouped by time. Intervals that
+// ended before a query was executed are complete and reused by later executions of the
+// same statement, so only the intervals that can still change are computed again.
+//
+// Cached intervals are invalidated when a shard applies points within them.
+type QueryCache struct {
+	mu           sync.Mutex
+	entries      map[string]*list.Element
+	byShard      map[uint64]map[string]struct{} // entry keys by shard
+	lru          *list.List                     // entries, most recently used first
+	size         int64
+	reservations map[*queryCacheReservation]struct{}
+
+	// Estimated size of the cached results before the least recently used
+	// entries are evicted.
+	MaxSize int64
+
+	stats *Stats
+}
+
+// queryCacheEntry represents the complete intervals of a statement's result.
+type queryCacheEntry struct {
+	key    string
+	window influxql.Window
+	start  int64 // start of the first cached interval
+	end    int64 // end of the last cached interval
+	shards map[uint64]struct{}
+	rows   []*influxql.Row
+	size   int64
+}
+
+// queryCacheReservation tracks the writes to the shards read by a result being
+// computed, so intervals written to during the computation aren't cached.
+type queryCacheReservation struct {
+	shards      map[uint64]struct{}
+	invalidated int64 // earliest timestamp written to the shards, math.MaxInt64 if none
+}
+
+// NewQueryCache returns a new instance of QueryCache.
+func NewQueryCache() *QueryCache {
+	c := &QueryCache{
+		entries:      make(map[string]*list.Element),
+		byShard:      make(map[uint64]map[string]struct{}),
+		lru:          list.New(),
+		reservations: make(map[*queryCacheReservation]struct{}),
+		MaxSize:      DefaultQueryCacheMaxSize,
+		stats:        NewStats("queryCache"),
+	}
+	for _, k := range []string{"hits", "misses", "invalidations", "evictions", "entries", "size"} {
+		c.stats.Set(k, 0)
+	}
+	return c
+}
+
+// Stats returns the hit, miss, invalidation and eviction counts of the cache.
+func (c *QueryCache) Stats() *Stats { return c.stats }
+
+// reserve starts tracking the writes to shards while a result is computed.
+// The reservation must be released once the result is stored or discarded.
+func (c *QueryCache) reserve(shards map[uint64]struct{}) *queryCacheReservation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	r := &queryCacheReservation{shards: shards, invalidated: math.MaxInt64}
+	c.reservations[r] = struct{}{}
+	return r
+}
+
+// release stops tracking the writes of a reservation.
+func (c *QueryCache) release(r *queryCacheReservation) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.reservations, r)
+}
+
+// get returns the entry for a key. Returns nil if the key isn't cached.
+func (c *QueryCache) get(key string) *queryCacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el := c.entries[key]
+	if el == nil {
+		return nil
+	}
+	c.lru.MoveToFront(el)
+	return el.Value.(*queryCacheEntry)
+}
+
+// put stores an entry computed under a reservation, replacing any entry with the same
+// key. Intervals written to since the reservation was made aren't stored. The entry
+// isn't stored if it's larger than the cache.
+func (c *QueryCache) put(e *queryCacheEntry, r *queryCacheReservation) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if r.invalidated <= e.start {
+		return
+	} else if r.invalidated < e.end {
+		e.end = e.window.Truncate(r.invalidated)
+		if e.end <= e.start {
+			return
+		}
+		e.rows = trimRows(e.rows, e.start, e.end)
+		e.size = estimateRowsSize(e.rows)
+	}
+	if e.size > c.MaxSize {
+		return
+	}
+	if el := c.entries[e.key]; el != nil {
+		c.remove(el)
+	}
+	c.add(e, true)
+
+	// Evict the least recently used entries.
+	for c.size > c.MaxSize {
+		c.remove(c.lru.Back())
+		c.stats.Inc("evictions")
+	}
+	c.stats.Set("size", c.size)
+	c.stats.Set("entries", int64(len(c.entries)))
+}
+
+// add adds an entry to the front or the back of the least recently used list.
+func (c *QueryCache) add(e *queryCacheEntry, front bool) {
+	if front {
+		c.entries[e.key] = c.lru.PushFront(e)
+	} else {
+		c.entries[e.key] = c.lru.PushBack(e)
+	}
+	for id := range e.shards {
+		keys := c.byShard[id]
+		if keys == nil {
+			keys = make(map[string]struct{})
+			c.byShard[id] = keys
+		}
+		keys[e.key] = struct{}{}
+	}
+	c.size += e.size
+}
+
+// remove removes an entry from the cache.
+func (c *QueryCache) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*queryCacheEntry)
+	delete(c.entries, e.key)
+	for id := range e.shards {
+		delete(c.byShard[id], e.key)
+		if len(c.byShard[id]) == 0 {
+			delete(c.byShard, id)
+		}
+	}
+	c.size -= e.size
+}
+
+// invalidate removes the cached intervals at or after timestamp for a shard.
+func (c *QueryCache) invalidate(shardID uint64, timestamp int64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for r := range c.reservations {
+		if _, ok := r.shards[shardID]; ok && timestamp < r.invalidated {
+			r.invalidated = timestamp
+		}
+	}
+
+	for key := range c.byShard[shardID] {
+		el := c.entries[key]
+		e := el.Value.(*queryCacheEntry)
+		if timestamp >= e.end {
+			continue
+		}
+		c.stats.Inc("invalidations")
+
+		// Keep the intervals before the timestamp.
+		c.remove(el)
+		if end := e.window.Truncate(timestamp); end > e.start {
+			other := *e
+			other.end = end
+			other.rows = trimRows(e.rows, e.start, end)
+			other.size = estimateRowsSize(other.rows)
+			c.add(&other, false)
+		}
+	}
+	c.stats.Set("size", c.size)
+	c.stats.Set("entries", int64(len(c.entries)))
+}
+
+// reset removes all entries from the cache.
+func (c *QueryCache) reset() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Results being computed may be from before the reset.
+	for r := range c.reservations {
+		r.invalidated = math.MinInt64
+	}
+	c.entries = make(map[string]*list.Element)
+	c.byShard = make(map[uint64]map[string]struct{})
+	c.lru.Init()
+	c.size = 0
+	c.stats.Set("size", 0)
+	c.stats.Set("entries", 0)
+}
+
+// isCacheableSelectStatement returns true if the statement is an aggregate over
+// GROUP BY time() intervals whose values only depend on the points in each interval.
+func isCacheableSelectStatement(stmt *influxql.SelectStatement) bool {
+	if stmt.IsRawQuery || stmt.Target != nil || len(stmt.Sources) != 1 {
+		return false
+	} else if stmt.Limit != 0 || stmt.Offset != 0 || stmt.SLimit != 0 || stmt.SOffset != 0 {
+		return false
+	} else if stmt.Fill == influxql.PreviousFill || stmt.Fill == influxql.LinearFill {
+		return false
+	}
+	if _, ok := stmt.Sources[0].(*influxql.Measurement); !ok {
+		return false
+	}
+	for _, f := range stmt.SortFields {
+		if !f.Ascending {
+			return false
+		}
+	}
+	for _, c := range stmt.FunctionCalls() {
+		if !cacheableCalls[strings.ToLower(c.Name)] {
+			return false
+		}
+	}
+	interval, err := stmt.GroupByInterval()
+	return err == nil && interval > 0
+}
+
+// executeCachedSelectStatement executes a select statement, reusing the cached intervals
+// of earlier executions. Returns false if the statement can't be cached.
+func (s *Server) executeCachedSelectStatement(stmt *influxql.SelectStatement, chunkSize int, plan *selectPlanStats) ([]*influxql.Row, bool, error) {
+	if !isCacheableSelectStatement(stmt) {
+		return nil, false, nil
+	}
+	window, err := stmt.GroupByWindow()
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Replace now() so the time range is the same for every interval computed.
+	now := time.Now().UTC()
+	stmt = stmt.Clone()
+	stmt.Condition = influxql.Reduce(stmt.Condition, nowValuer(now))
+
+	tmin, tmax := influxql.TimeRange(stmt.Condition)
+	if tmin.IsZero() {
+		return nil, false, nil
+	} else if tmax.IsZero() {
+		tmax = now
+	}
+	min, max := tmin.UnixNano(), tmax.UnixNano()
+
+	// Intervals are complete if they're entirely within the time range and ended before now.
+	// The maximum time is inclusive, to the microsecond.
+	start := window.Truncate(min)
+	if start < min {
+		start = window.Next(min)
+	}
+	end := window.Truncate(max + int64(time.Microsecond))
+	if t := window.Truncate(now.UnixNano()); t < end {
+		end = t
+	}
+	if end <= start {
+		return nil, false, nil
+	}
+
+	// Only cache statements reading shards owned by this server,
+	// invalidations aren't sent by other servers.
+	shards, ok := s.localShardIDs(stmt.Sources[0].(*influxql.Measurement), tmin, tmax)
+	if !ok {
+		return nil, false, nil
+	}
+
+	// Statements with different time ranges share an entry.
+	other := stmt.Clone()
+	if err := other.SetTimeRange(time.Unix(0, 0), time.Unix(0, 0)); err != nil {
+		return nil, false, err
+	}
+	key := other.String()
+
+	r := s.QueryCache.reserve(shards)
+	defer s.QueryCache.release(r)
+
+	var rows []*influxql.Row
+	if e := s.QueryCache.get(key); e != nil && e.start <= start && start < e.end {
+		s.QueryCache.stats.Inc("hits")
+
+		// Compute the partial interval before the cached ones and the ones after them.
+		from := e.end
+		if end < from {
+			from = end
+		}
+
+		var head, tail []*influxql.Row
+		if min < start {
+			if head, err = s.selectTimeRange(stmt, min, start, chunkSize, plan); err != nil {
+				return nil, true, err
+			}
+		}
+		if from <= max {
+			if tail, err = s.selectTimeRange(stmt, from, max+int64(time.Microsecond), chunkSize, plan); err != nil {
+				return nil, true, err
+			}
+		}
+		rows = mergeRows(stmt, window, min, max, head, trimRows(e.rows, start, from), tail)
+	} else {
+		s.QueryCache.stats.Inc("misses")
+		if rows, err = s.selectTimeRange(stmt, min, max+int64(time.Microsecond), chunkSize, plan); err != nil {
+			return nil, true, err
+		}
+	}
+
+	// Cache the complete intervals.
+	e := &queryCacheEntry{key: key, window: window, start: start, end: end, shards: shards}
+	e.rows = trimRows(rows, start, end)
+	e.size = estimateRowsSize(e.rows)
+	s.QueryCache.put(e, r)
+
+	return rows, true, nil
+}
+
+// selectTimeRange executes a select statement over the time range [min, max),
+// adding the executed plan to plan.
+func (s *Server) selectTimeRange(stmt *influxql.SelectStatement, min, max int64, chunkSize int, plan *selectPlanStats) ([]*influxql.Row, error) {
+	stmt = stmt.Clone()
+	if err := stmt.SetTimeRange(time.Unix(0, min), time.Unix(0, max)); err != nil {
+		return nil, err
+	}
+
+	e, err := s.planSelectStatement(stmt, chunkSize)
+	if err != nil {
+		return nil, err
+	}
+
+	// Drain the rows after an error so the plan has finished when it's described.
+	var rows []*influxql.Row
+	for row := range e.Execute() {
+		if err != nil {
+			continue
+		} else if row.Err != nil {
+			err = row.Err
+			continue
+		}
+		rows = append(rows, row)
+	}
+	plan.add(e)
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// localShardIDs returns the shards read by a measurement over a time range.
+// Returns false if a shard isn't owned by the server.
+func (s *Server) localShardIDs(mm *influxql.Measurement, tmin, tmax time.Time) (map[uint64]struct{}, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	db := s.databases[mm.Database]
+	if db == nil {
+		return nil, false
+	}
+	rp := db.policies[mm.RetentionPolicy]
+	if rp == nil {
+		return nil, false
+	}
+
+	ids := make(map[uint64]struct{})
+	for _, g := range rp.shardGroups {
+		if !g.Contains(tmin, tmax) {
+			continue
+		}
+		for _, sh := range g.Shards {
+			if !sh.HasDataNodeID(s.id) {
+				return nil, false
+			}
+			ids[sh.ID] = struct{}{}
+		}
+	}
+	return ids, true
+}
+
+// mergeRows combines the rows of the same series from consecutive time ranges. The rows are
+// sorted like the query engine sorts them and, unless the statement uses fill(none), missing
+// intervals between min and max are filled.
+func mergeRows(stmt *influxql.SelectStatement, window influxql.Window, min, max int64, a ...[]*influxql.Row) []*influxql.Row {
+	var keys []string
+	m := make(map[string]*influxql.Row)
+	for _, rows := range a {
+		for _, row := range rows {
+			key := string(marshalTags(row.Tags))
+			other := m[key]
+			if other == nil {
+				other = &influxql.Row{Name: row.Name, Tags: row.Tags, Columns: row.Columns}
+				m[key] = other
+				keys = append(keys, key)
+			}
+			other.Values = append(other.Values, row.Values...)
+		}
+	}
+	sort.Strings(keys)
+
+	rows := make([]*influxql.Row, len(keys))
+	for i, key := range keys {
+		row := m[key]
+		sort.Sort(rowValuesByTime(row.Values))
+		if stmt.Fill != influxql.NoFill {
+			row.Values = fillRowValues(stmt, window, min, max, row)
+		}
+		rows[i] = row
+	}
+	return rows
+}
+
+// fillRowValues returns the values of a row with a value for every interval between min and max.
+func fillRowValues(stmt *influxql.SelectStatement, window influxql.Window, min, max int64, row *influxql.Row) [][]interface{} {
+	values := make([][]interface{}, 0, len(row.Values))
+	i := 0
+	for t := window.Truncate(min); t <= max; t = window.Next(t) {
+		if i < len(row.Values) && row.Values[i][0].(time.Time).UnixNano() == t {
+			values = append(values, row.Values[i])
+			i++
+			continue
+		}
+
+		v := make([]interface{}, len(row.Columns))
+		v[0] = time.Unix(0, t).UTC()
+		if stmt.Location != nil {
+			v[0] = time.Unix(0, t).In(stmt.Location)
+		}
+		if stmt.Fill == influxql.NumberFill {
+			for j := 1; j < len(v); j++ {
+				v[j] = stmt.FillValue
+			}
+		}
+		values = append(values, v)
+	}
+	return values
+}
+
+// trimRows returns copies of the rows with only the values in the time range [min, max).
+// Rows without values are removed.
+func trimRows(rows []*influxql.Row, min, max int64) []*influxql.Row {
+	var other []*influxql.Row
+	for _, row := range rows {
+		var values [][]interface{}
+		for _, v := range row.Values {
+			if t := v[0].(time.Time).UnixNano(); t >= min && t < max {
+				values = append(values, v)
+			}
+		}
+		if len(values) > 0 {
+			other = append(other, &influxql.Row{Name: row.Name, Tags: row.Tags, Columns: row.Columns, Values: values})
+		}
+	}
+	return other
+}
+
+// estimateRowsSize returns the approximate memory used by rows in bytes.
+func estimateRowsSize(rows []*influxql.Row) int64 {
+	var n int64
+	for _, row := range rows {
+		n += int64(len(row.Name)) + 64
+		for k, v := range row.Tags {
+			n += int64(len(k) + len(v))
+		}
+		for _, c := range row.Columns {
+			n += int64(len(c))
+		}
+		for _, values := range row.Values {
+			n += int64(len(values)) * 24
+			for _, v := range values {
+				if s, ok := v.(string); ok {
+					n += int64(len(s))
+				}
+			}
+		}
+	}
+	return n
+}
+
+// rowValuesByTime sorts the values of a row by their time.
+type rowValuesByTime [][]interface{}
+
+func (a rowValuesByTime) Len() int      { return len(a) }
+func (a rowValuesByTime) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a rowValuesByTime) Less(i, j int) bool {
+	return a[i][0].(time.Time).Before(a[j][0].(time.Time))
+}
+
+// nowValuer returns the value of now() when reducing an expression.
+type nowValuer time.Time
+
+func (v nowValuer) Value(key string) (interface{}, bool) {
+	if key == "now()" {
+		return time.Time(v), true
+	}
+	return nil, false
+}
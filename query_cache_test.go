@@ -0,0 +1,88 @@
+package influxdb_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdb/influxdb"
+	"github.com/influxdb/influxdb/test"
+)
+
+// Ensure aggregate queries reuse cached intervals and are invalidated by writes.
+func TestServer_QueryCache(t *testing.T) {
+	c := test.NewDefaultMessagingClient()
+	defer c.Close()
+	s := OpenServer(c)
+	defer s.Close()
+	s.QueryCache = influxdb.NewQueryCache()
+	s.CreateDatabase("foo")
+	s.CreateRetentionPolicy("foo", &influxdb.RetentionPolicy{Name: "raw", Duration: 1 * time.Hour})
+	s.SetDefaultRetentionPolicy("foo", "raw")
+
+	write := func(host, timestamp string, value float64) {
+		s.MustWriteSeries("foo", "raw", []influxdb.Point{{Name: "cpu", Tags: map[string]string{"host": host}, Timestamp: mustParseTime(timestamp), Fields: map[string]interface{}{"value": value}}})
+	}
+	write("serverA", "2000-01-01T00:10:00Z", 1)
+	write("serverA", "2000-01-01T00:40:00Z", 2)
+	write("serverB", "2000-01-01T00:50:00Z", 5)
+	write("serverA", "2000-01-01T01:10:00Z", 3)
+	write("serverA", "2000-01-01T02:10:00Z", 4)
+
+	// Execute the query with and without the cache, the results must be the same.
+	query := `SELECT sum(value) FROM cpu WHERE time >= '2000-01-01T00:30:00Z' AND time < '2000-01-01T03:00:00Z' GROUP BY time(1h), host`
+	f := func(exp string) {
+		if res := s.executeQuery(MustParseQuery(query), "foo", nil); res.Err != nil || res.Results[0].Err != nil {
+			t.Fatalf("unexpected error: %s", res.Error())
+		} else if s := mustMarshalJSON(res); s != exp {
+			t.Fatalf("unexpected results:\n  exp: %s\n  got: %s", exp, s)
+		}
+	}
+
+	cache := s.QueryCache
+	s.QueryCache = nil
+	exp := mustMarshalJSON(s.executeQuery(MustParseQuery(query), "foo", nil))
+	if exp != `{"results":[{"series":[{"name":"cpu","tags":{"host":"serverA"},"columns":["time","sum"],"values":[["2000-01-01T00:00:00Z",2],["2000-01-01T01:00:00Z",3],["2000-01-01T02:00:00Z",4]]},{"name":"cpu","tags":{"host":"serverB"},"columns":["time","sum"],"values":[["2000-01-01T00:00:00Z",5],["2000-01-01T01:00:00Z",null],["2000-01-01T02:00:00Z",null]]}]}]}` {
+		t.Fatalf("unexpected results: %s", exp)
+	}
+	s.QueryCache = cache
+
+	f(exp)
+	f(exp)
+	if hits, misses := cache.Stats().Get("hits"), cache.Stats().Get("misses"); hits != 1 || misses != 1 {
+		t.Fatalf("unexpected hits and misses: %d, %d", hits, misses)
+	}
+
+	// Writing into a cached interval invalidates it.
+	write("serverA", "2000-01-01T01:20:00Z", 10)
+	if n := cache.Stats().Get("invalidations"); n != 1 {
+		t.Fatalf("unexpected invalidations: %d", n)
+	}
+	f(`{"results":[{"series":[{"name":"cpu","tags":{"host":"serverA"},"columns":["time","sum"],"values":[["2000-01-01T00:00:00Z",2],["2000-01-01T01:00:00Z",13],["2000-01-01T02:00:00Z",4]]},{"name":"cpu","tags":{"host":"serverB"},"columns":["time","sum"],"values":[["2000-01-01T00:00:00Z",5],["2000-01-01T01:00:00Z",null],["2000-01-01T02:00:00Z",null]]}]}]}`)
+	if misses := cache.Stats().Get("misses"); misses != 2 {
+		t.Fatalf("unexpected misses: %d", misses)
+	}
+}
+
+// Ensure the least recently used entries are evicted once the cache is full.
+func TestServer_QueryCache_Evict(t *testing.T) {
+	c := test.NewDefaultMessagingClient()
+	defer c.Close()
+	s := OpenServer(c)
+	defer s.Close()
+	s.QueryCache = influxdb.NewQueryCache()
+	s.QueryCache.MaxSize = 150
+	s.CreateDatabase("foo")
+	s.CreateRetentionPolicy("foo", &influxdb.RetentionPolicy{Name: "raw", Duration: 1 * time.Hour})
+	s.SetDefaultRetentionPolicy("foo", "raw")
+	s.MustWriteSeries("foo", "raw", []influxdb.Point{{Name: "cpu", Timestamp: mustParseTime("2000-01-01T00:10:00Z"), Fields: map[string]interface{}{"value": float64(1)}}})
+
+	for _, fn := range []string{"sum", "mean", "sum"} {
+		q := `SELECT ` + fn + `(value) FROM cpu WHERE time >= '2000-01-01T00:00:00Z' AND time < '2000-01-01T01:00:00Z' GROUP BY time(1h)`
+		if res := s.executeQuery(MustParseQuery(q), "foo", nil); res.Error() != nil {
+			t.Fatalf("unexpected error: %s", res.Error())
+		}
+	}
+	if st := s.QueryCache.Stats(); st.Get("evictions") != 2 || st.Get("entries") != 1 || st.Get("misses") != 3 {
+		t.Fatalf("unexpected stats: evictions=%d entries=%d misses=%d", st.Get("evictions"), st.Get("entries"), st.Get("misses"))
+	}
+}
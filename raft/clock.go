@@ -48,6 +48,9 @@ func (c *Clock) AfterElectionTimeout() <-chan chan struct{} {
 	return newClockChan(d)
 }
 
+// MinElectionTimeout returns the shortest time before an election is started.
+func (c *Clock) MinElectionTimeout() time.Duration { return c.ElectionTimeout }
+
 // AfterHeartbeatInterval returns a channel that fires after the heartbeat interval.
 func (c *Clock) AfterHeartbeatInterval() <-chan chan struct{} {
 	return newClockChan(c.HeartbeatInterval)
@@ -38,6 +38,15 @@ func TestClock_AfterElectionTimeout(t *testing.T) {
 	}
 }
 
+// Ensure the MinElectionTimeout returns the clock's election timeout.
+func TestClock_MinElectionTimeout(t *testing.T) {
+	c := raft.NewClock()
+	c.ElectionTimeout = 10 * time.Millisecond
+	if d := c.MinElectionTimeout(); d != c.ElectionTimeout {
+		t.Fatalf("unexpected timeout: %v", d)
+	}
+}
+
 // Ensure the AfterHeartbeatInterval returns a channel that fires after the clock's heartbeat interval.
 func TestClock_AfterHeartbeatInterval(t *testing.T) {
 	c := raft.NewClock()
@@ -77,6 +86,7 @@ type Clock struct {
 	reconnectChan chan chan struct{}
 
 	NowFunc                    func() time.Time
+	MinElectionTimeoutFunc     func() time.Duration
 	AfterApplyIntervalFunc     func() <-chan chan struct{}
 	AfterElectionTimeoutFunc   func() <-chan chan struct{}
 	AfterHeartbeatIntervalFunc func() <-chan chan struct{}
@@ -95,6 +105,7 @@ func NewClock() *Clock {
 
 	// Set default functions.
 	c.NowFunc = func() time.Time { return c.now }
+	c.MinElectionTimeoutFunc = func() time.Duration { return raft.DefaultElectionTimeout }
 	c.AfterApplyIntervalFunc = func() <-chan chan struct{} { return c.applyChan }
 	c.AfterElectionTimeoutFunc = func() <-chan chan struct{} { return c.electionChan }
 	c.AfterHeartbeatIntervalFunc = func() <-chan chan struct{} { return c.heartbeatChan }
@@ -120,6 +131,15 @@ func (c *Clock) heartbeat() {
 	<-ch
 }
 
+// expireOnRead advances the clock by an election timeout every time it is
+// read so that any heartbeat received is already stale on the next read.
+func (c *Clock) expireOnRead() {
+	c.NowFunc = func() time.Time {
+		c.now = c.now.Add(raft.DefaultElectionTimeout)
+		return c.now
+	}
+}
+
 func (c *Clock) reconnect() {
 	ch := make(chan struct{}, 0)
 	c.reconnectChan <- ch
@@ -127,6 +147,7 @@ func (c *Clock) reconnect() {
 }
 
 func (c *Clock) Now() time.Time                               { return c.NowFunc() }
+func (c *Clock) MinElectionTimeout() time.Duration            { return c.MinElectionTimeoutFunc() }
 func (c *Clock) AfterApplyInterval() <-chan chan struct{}     { return c.AfterApplyIntervalFunc() }
 func (c *Clock) AfterElectionTimeout() <-chan chan struct{}   { return c.AfterElectionTimeoutFunc() }
 func (c *Clock) AfterHeartbeatInterval() <-chan chan struct{} { return c.AfterHeartbeatIntervalFunc() }
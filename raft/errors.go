@@ -28,6 +28,10 @@ var (
 	// ErrOutOfDateLog is returned when a candidate's log is not up to date.
 	ErrOutOfDateLog = errors.New("out of date log")
 
+	// ErrLeaderActive is returned when a pre-vote is requested while the
+	// current leader is still in contact.
+	ErrLeaderActive = errors.New("leader active")
+
 	// ErrAlreadyVoted is returned when a vote has already been cast for
 	// a different candidate in the same election term.
 	ErrAlreadyVoted = errors.New("already voted")
@@ -54,6 +58,17 @@ var (
 	// ErrSnapshotting is returned when an action cannot be performed because
 	// the log is in the middle of a snapshot.
 	ErrSnapshotting = errors.New("snapshotting")
+
+	// ErrNotFollower is returned performing follower operations on a non-follower.
+	ErrNotFollower = errors.New("not follower")
+
+	// ErrTransferring is returned when an action cannot be performed because
+	// the leader is transferring leadership to another node.
+	ErrTransferring = errors.New("leadership transfer in progress")
+
+	// ErrTransferTimeout is returned when a leadership transfer does not
+	// complete within the transfer timeout.
+	ErrTransferTimeout = errors.New("leadership transfer timeout")
 )
 
 // Internal marker errors.
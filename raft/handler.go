@@ -17,6 +17,9 @@ type Handler struct {
 		Heartbeat(term, commitIndex, leaderID uint64) (currentIndex uint64, err error)
 		WriteEntriesTo(w io.Writer, id, term, index uint64) error
 		RequestVote(term, candidateID, lastLogIndex, lastLogTerm uint64) (peerTerm uint64, err error)
+		RequestPreVote(term, candidateID, lastLogIndex, lastLogTerm uint64) (peerTerm uint64, err error)
+		TransferLeadership(id uint64) error
+		TimeoutNow(term, leaderID uint64) error
 	}
 }
 
@@ -31,8 +34,12 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		h.serveHeartbeat(w, r)
 	case "stream":
 		h.serveStream(w, r)
-	case "vote":
+	case "vote", "prevote":
 		h.serveRequestVote(w, r)
+	case "transfer":
+		h.serveTransfer(w, r)
+	case "timeout":
+		h.serveTimeoutNow(w, r)
 	case "ping":
 		w.WriteHeader(http.StatusOK)
 	default:
@@ -174,7 +181,7 @@ func (h *Handler) serveStream(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// serveRequestVote serves a vote request to the underlying log.
+// serveRequestVote serves a vote or pre-vote request to the underlying log.
 func (h *Handler) serveRequestVote(w http.ResponseWriter, r *http.Request) {
 	var err error
 	var term, candidateID, lastLogIndex, lastLogTerm uint64
@@ -202,7 +209,11 @@ func (h *Handler) serveRequestVote(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Request vote from log.
-	peerTerm, err := h.Log.RequestVote(term, candidateID, lastLogIndex, lastLogTerm)
+	requestVote := h.Log.RequestVote
+	if path.Base(r.URL.Path) == "prevote" {
+		requestVote = h.Log.RequestPreVote
+	}
+	peerTerm, err := requestVote(term, candidateID, lastLogIndex, lastLogTerm)
 
 	// Write current term.
 	w.Header().Set("X-Raft-Term", strconv.FormatUint(peerTerm, 10))
@@ -216,3 +227,55 @@ func (h *Handler) serveRequestVote(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusOK)
 }
+
+// serveTransfer transfers leadership from the underlying log to another node.
+// If no id is specified then the most up-to-date follower is chosen.
+func (h *Handler) serveTransfer(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var id uint64
+
+	// Parse optional target id.
+	if s := r.FormValue("id"); s != "" {
+		if id, err = strconv.ParseUint(s, 10, 64); err != nil {
+			w.Header().Set("X-Raft-Error", "invalid raft id")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Transfer leadership.
+	if err := h.Log.TransferLeadership(id); err != nil {
+		w.Header().Set("X-Raft-Error", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// serveTimeoutNow causes the underlying log to start an election immediately.
+func (h *Handler) serveTimeoutNow(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var term, leaderID uint64
+
+	// Parse arguments.
+	if term, err = strconv.ParseUint(r.FormValue("term"), 10, 64); err != nil {
+		w.Header().Set("X-Raft-Error", "invalid term")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if leaderID, err = strconv.ParseUint(r.FormValue("leaderID"), 10, 64); err != nil {
+		w.Header().Set("X-Raft-Error", "invalid leader id")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// Notify the log.
+	if err := h.Log.TimeoutNow(term, leaderID); err != nil {
+		w.Header().Set("X-Raft-Error", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -338,6 +338,149 @@ func TestHandler_HandleRequestVote_Error(t *testing.T) {
 	}
 }
 
+// Ensure a leadership transfer can be requested over HTTP.
+func TestHandler_HandleTransfer(t *testing.T) {
+	h := NewHandler()
+	h.TransferLeadershipFunc = func(id uint64) error {
+		if id != 2 {
+			t.Fatalf("unexpected id: %d", id)
+		}
+		return nil
+	}
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	// Send transfer request.
+	resp, err := http.Get(s.URL + "/transfer?id=2")
+	defer resp.Body.Close()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status: %d", resp.StatusCode)
+	} else if s := resp.Header.Get("X-Raft-Error"); s != "" {
+		t.Fatalf("unexpected raft error: %s", s)
+	}
+}
+
+// Ensure sending invalid parameters in a transfer request returns an error.
+func TestHandler_HandleTransfer_Error(t *testing.T) {
+	h := NewHandler()
+	h.TransferLeadershipFunc = func(id uint64) error {
+		return raft.ErrNotLeader
+	}
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	var tests = []struct {
+		query string
+		code  int
+		err   string
+	}{
+		{query: `id=XXX`, code: http.StatusBadRequest, err: `invalid raft id`},
+		{query: ``, code: http.StatusInternalServerError, err: `not leader`},
+	}
+	for i, tt := range tests {
+		resp, err := http.Get(s.URL + "/transfer?" + tt.query)
+		defer resp.Body.Close()
+		if err != nil {
+			t.Fatalf("%d. unexpected error: %s", i, err)
+		} else if resp.StatusCode != tt.code {
+			t.Fatalf("%d. unexpected status: %d", i, resp.StatusCode)
+		} else if s := resp.Header.Get("X-Raft-Error"); s != tt.err {
+			t.Fatalf("%d. unexpected raft error: %s", i, s)
+		}
+	}
+}
+
+// Ensure a timeout now request can be sent over HTTP.
+func TestHandler_HandleTimeoutNow(t *testing.T) {
+	h := NewHandler()
+	h.TimeoutNowFunc = func(term, leaderID uint64) error {
+		if term != 1 {
+			t.Fatalf("unexpected term: %d", term)
+		} else if leaderID != 2 {
+			t.Fatalf("unexpected leader id: %d", leaderID)
+		}
+		return nil
+	}
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	// Send timeout now request.
+	resp, err := http.Get(s.URL + "/timeout?term=1&leaderID=2")
+	defer resp.Body.Close()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status: %d", resp.StatusCode)
+	} else if s := resp.Header.Get("X-Raft-Error"); s != "" {
+		t.Fatalf("unexpected raft error: %s", s)
+	}
+}
+
+// Ensure sending invalid parameters in a timeout now request returns an error.
+func TestHandler_HandleTimeoutNow_Error(t *testing.T) {
+	h := NewHandler()
+	h.TimeoutNowFunc = func(term, leaderID uint64) error {
+		return raft.ErrStaleTerm
+	}
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	var tests = []struct {
+		query string
+		code  int
+		err   string
+	}{
+		{query: `term=XXX&leaderID=2`, code: http.StatusBadRequest, err: `invalid term`},
+		{query: `term=1&leaderID=XXX`, code: http.StatusBadRequest, err: `invalid leader id`},
+		{query: `term=0&leaderID=2`, code: http.StatusInternalServerError, err: `stale term`},
+	}
+	for i, tt := range tests {
+		resp, err := http.Get(s.URL + "/timeout?" + tt.query)
+		defer resp.Body.Close()
+		if err != nil {
+			t.Fatalf("%d. unexpected error: %s", i, err)
+		} else if resp.StatusCode != tt.code {
+			t.Fatalf("%d. unexpected status: %d", i, resp.StatusCode)
+		} else if s := resp.Header.Get("X-Raft-Error"); s != tt.err {
+			t.Fatalf("%d. unexpected raft error: %s", i, s)
+		}
+	}
+}
+
+// Ensure a pre-vote request is routed to the log's pre-vote.
+func TestHandler_HandleRequestPreVote(t *testing.T) {
+	h := NewHandler()
+	h.RequestPreVoteFunc = func(term, candidateID, lastLogIndex, lastLogTerm uint64) (uint64, error) {
+		if term != 1 {
+			t.Fatalf("unexpected term: %d", term)
+		} else if candidateID != 2 {
+			t.Fatalf("unexpected candidate id: %d", candidateID)
+		} else if lastLogIndex != 3 {
+			t.Fatalf("unexpected last log index: %d", lastLogIndex)
+		} else if lastLogTerm != 4 {
+			t.Fatalf("unexpected last log term: %d", lastLogTerm)
+		}
+		return 5, raft.ErrLeaderActive
+	}
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	// Send pre-vote request.
+	resp, err := http.Get(s.URL + "/prevote?term=1&candidateID=2&lastLogIndex=3&lastLogTerm=4")
+	defer resp.Body.Close()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if resp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("unexpected status: %d", resp.StatusCode)
+	} else if term := resp.Header.Get("X-Raft-Term"); term != "5" {
+		t.Fatalf("unexpected raft term: %s", term)
+	} else if s := resp.Header.Get("X-Raft-Error"); s != "leader active" {
+		t.Fatalf("unexpected raft error: %s", s)
+	}
+}
+
 // Ensure an invalid path returns a 404.
 func TestHandler_NotFound(t *testing.T) {
 	s := httptest.NewServer(NewHandler())
@@ -376,6 +519,10 @@ type Handler struct {
 	HeartbeatFunc      func(term, commitIndex, leaderID uint64) (currentIndex uint64, err error)
 	WriteEntriesToFunc func(w io.Writer, id, term, index uint64) error
 	RequestVoteFunc    func(term, candidateID, lastLogIndex, lastLogTerm uint64) (peerTerm uint64, err error)
+	RequestPreVoteFunc func(term, candidateID, lastLogIndex, lastLogTerm uint64) (peerTerm uint64, err error)
+
+	TransferLeadershipFunc func(id uint64) error
+	TimeoutNowFunc         func(term, leaderID uint64) error
 }
 
 // NewHandler returns a new instance of Handler.
@@ -399,3 +546,12 @@ func (h *Handler) WriteEntriesTo(w io.Writer, id, term, index uint64) error {
 func (h *Handler) RequestVote(term, candidateID, lastLogIndex, lastLogTerm uint64) (uint64, error) {
 	return h.RequestVoteFunc(term, candidateID, lastLogIndex, lastLogTerm)
 }
+
+func (h *Handler) RequestPreVote(term, candidateID, lastLogIndex, lastLogTerm uint64) (uint64, error) {
+	return h.RequestPreVoteFunc(term, candidateID, lastLogIndex, lastLogTerm)
+}
+
+func (h *Handler) TransferLeadership(id uint64) error { return h.TransferLeadershipFunc(id) }
+func (h *Handler) TimeoutNow(term, leaderID uint64) error {
+	return h.TimeoutNowFunc(term, leaderID)
+}
@@ -45,6 +45,10 @@ const logEntryHeaderSize = 8 + 8 + 8 // sz+index+term
 // This is used by clients wanting to wait until a given index is processed.
 const WaitInterval = 1 * time.Millisecond
 
+// DefaultTransferTimeout is the maximum time a leadership transfer can take
+// before it is aborted and the leader resumes accepting commands.
+const DefaultTransferTimeout = 10 * time.Second
+
 // State represents whether the log is a follower, candidate, or leader.
 type State int
 
@@ -73,8 +77,19 @@ const (
 const (
 	// DefaultLogEntryCacheSize is the default number of entries to keep before trimming.
 	DefaultLogEntryCacheSize = 1000
+
+	// DefaultSnapshotEntryThreshold is the default number of applied entries
+	// between snapshots. Zero disables entry based snapshotting.
+	DefaultSnapshotEntryThreshold = 0
+
+	// DefaultSnapshotSizeThreshold is the default number of applied bytes
+	// between snapshots. Zero disables size based snapshotting.
+	DefaultSnapshotSizeThreshold = 0
 )
 
+// snapshotHeaderSize is the size of the index header on a snapshot file.
+const snapshotHeaderSize = 8
+
 // Log represents a replicated log of commands based on the Raft protocol.
 //
 // The log can exist in one of four states that transition based on the following rules:
@@ -127,6 +142,16 @@ type Log struct {
 	// An atomic flag stating if a snapshot is currently being loaded.
 	snapshotting uint32
 
+	// Serializes writing snapshots to disk with loading snapshots from the leader.
+	snapshotMu sync.Mutex
+
+	// Index of the last snapshot written to disk and the number of entries
+	// and bytes that have been applied since that snapshot.
+	snapshotIndex  uint64
+	snapshotEntryN int
+	snapshotSize   int64
+	snapshotStats  SnapshotStats
+
 	// In-memory log entries.
 	// Followers replicate these entries from the Leader.
 	// Leader appends to the end of these entries.
@@ -166,6 +191,22 @@ type Log struct {
 	heartbeats chan heartbeat
 	terms      chan struct{}
 
+	// Signals a follower to start an election immediately.
+	// This is sent by the leader when transferring leadership.
+	timeoutNow chan struct{}
+
+	// Set while the leader is transferring leadership to another node.
+	// New commands are rejected until the transfer completes or fails.
+	transferring bool
+
+	// Set when an election is started by a leadership transfer. The pre-vote
+	// is skipped since followers will have recently heard from the leader.
+	skipPreVote bool
+
+	// The last time a heartbeat was received from a leader.
+	// Pre-votes are denied while the leader is still in contact.
+	lastContact time.Time
+
 	// Close notification and wait.
 	wg      sync.WaitGroup
 	closing chan struct{}
@@ -181,6 +222,16 @@ type Log struct {
 	// momentarily. Otherwise a reconnecting node would have to resnapshot.
 	LogEntryCacheSize int
 
+	// SnapshotEntryThreshold is the number of entries that can be applied
+	// before the state machine is snapshotted to disk and the log is trimmed.
+	// Set to zero to disable entry based snapshotting.
+	SnapshotEntryThreshold int
+
+	// SnapshotSizeThreshold is the number of bytes of entry data that can be
+	// applied before the state machine is snapshotted to disk and the log is
+	// trimmed. Set to zero to disable size based snapshotting.
+	SnapshotSizeThreshold int64
+
 	// The transport used to communicate with other nodes in the cluster.
 	Transport interface {
 		Join(u url.URL, nodeURL url.URL) (id uint64, leaderID uint64, config *Config, err error)
@@ -188,11 +239,14 @@ type Log struct {
 		Heartbeat(u url.URL, term, commitIndex, leaderID uint64) (lastIndex uint64, err error)
 		ReadFrom(u url.URL, id, term, index uint64) (io.ReadCloser, error)
 		RequestVote(u url.URL, term, candidateID, lastLogIndex, lastLogTerm uint64) (peerTerm uint64, err error)
+		RequestPreVote(u url.URL, term, candidateID, lastLogIndex, lastLogTerm uint64) (peerTerm uint64, err error)
+		TimeoutNow(u url.URL, term, leaderID uint64) error
 	}
 
 	// Clock is an abstraction of time.
 	Clock interface {
 		Now() time.Time
+		MinElectionTimeout() time.Duration
 		AfterApplyInterval() <-chan chan struct{}
 		AfterElectionTimeout() <-chan chan struct{}
 		AfterHeartbeatInterval() <-chan chan struct{}
@@ -217,9 +271,12 @@ func NewLog() *Log {
 		Rand:       rand.NewSource(time.Now().UnixNano()).Int63,
 		heartbeats: make(chan heartbeat, 10),
 		terms:      make(chan struct{}, 1),
+		timeoutNow: make(chan struct{}, 1),
 		Logger:     log.New(os.Stderr, "[raft] ", log.LstdFlags),
 
-		LogEntryCacheSize: DefaultLogEntryCacheSize,
+		LogEntryCacheSize:      DefaultLogEntryCacheSize,
+		SnapshotEntryThreshold: DefaultSnapshotEntryThreshold,
+		SnapshotSizeThreshold:  DefaultSnapshotSizeThreshold,
 	}
 	l.Logger.SetPrefix("[raft] ")
 	return l
@@ -277,6 +334,8 @@ func (l *Log) idPath() string     { return filepath.Join(l.path, "id") }
 func (l *Log) termPath() string   { return filepath.Join(l.path, "term") }
 func (l *Log) configPath() string { return filepath.Join(l.path, "config") }
 
+func (l *Log) snapshotPath() string { return filepath.Join(l.path, "snapshot") }
+
 // Opened returns true if the log is currently open.
 func (l *Log) Opened() bool {
 	l.lock()
@@ -310,6 +369,13 @@ func (l *Log) LastLogIndexTerm() (index, term uint64) {
 	return l.lastLogIndex, l.lastLogTerm
 }
 
+// SnapshotStats returns statistics about the snapshots taken by the log.
+func (l *Log) SnapshotStats() SnapshotStats {
+	l.lock()
+	defer l.unlock()
+	return l.snapshotStats
+}
+
 // CommtIndex returns the highest committed index.
 func (l *Log) CommitIndex() uint64 {
 	l.lock()
@@ -377,6 +443,14 @@ func (l *Log) Open(path string) error {
 		}
 		l.config = c
 
+		// Read the index of the last snapshot written to disk.
+		snapshotIndex, err := l.readSnapshotIndex()
+		if err != nil {
+			return fmt.Errorf("read snapshot index: %s", err)
+		}
+		l.snapshotIndex = snapshotIndex
+		l.snapshotStats.Index = snapshotIndex
+
 		// Determine last applied index from FSM.
 		index := l.FSM.Index()
 		l.tracef("Open: fsm: index=%d", index)
@@ -456,6 +530,7 @@ func (l *Log) close() error {
 	l.lastLogIndex, l.lastLogTerm = 0, 0
 	l.term, l.votedFor = 0, 0
 	l.config = nil
+	l.snapshotIndex, l.snapshotEntryN, l.snapshotSize = 0, 0, 0
 
 	l.tracef("closed")
 
@@ -617,6 +692,24 @@ func (l *Log) writeConfig(config *Config) error {
 	return nil
 }
 
+// readSnapshotIndex reads the index of the last snapshot from disk.
+// Returns zero if no snapshot has been written.
+func (l *Log) readSnapshotIndex() (uint64, error) {
+	f, err := os.Open(l.snapshotPath())
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var index uint64
+	if err := binary.Read(f, binary.BigEndian, &index); err != nil {
+		return 0, err
+	}
+	return index, nil
+}
+
 // Initialize a new log.
 // Returns an error if log data already exists.
 func (l *Log) Initialize() error {
@@ -890,8 +983,12 @@ func (l *Log) followerLoop(closing <-chan struct{}) State {
 				continue
 			}
 
-			// TODO: Prevote before becoming candidate.
-
+			return Candidate
+		case <-l.timeoutNow:
+			l.Logger.Println("leadership transfer: starting election")
+			l.lock()
+			l.skipPreVote = true
+			l.unlock()
 			return Candidate
 		case hb := <-l.heartbeats:
 			l.tracef("followerLoop: heartbeat: term=%d, idx=%d", hb.term, hb.commitIndex)
@@ -982,7 +1079,22 @@ func (l *Log) candidateLoop(closing <-chan struct{}) State {
 	l.tracef("candidateLoop")
 	defer l.tracef("candidateLoop: exit")
 
-	// TODO: prevote
+	// Ensure a majority of the cluster would vote for this log before
+	// incrementing the term. This stops a partitioned node from forcing a
+	// healthy leader to step down when it rejoins.
+	l.lock()
+	skipPreVote := l.skipPreVote
+	l.skipPreVote = false
+	l.unlock()
+	if !skipPreVote && !l.preElect(closing) {
+		close(l.transitioning)
+		select {
+		case <-closing:
+			return Stopped
+		default:
+			return Follower
+		}
+	}
 
 	// Increment term and request votes.
 	l.lock()
@@ -994,6 +1106,10 @@ func (l *Log) candidateLoop(closing <-chan struct{}) State {
 	case <-l.terms:
 	default:
 	}
+	select {
+	case <-l.timeoutNow:
+	default:
+	}
 	l.unlock()
 
 	// Ensure all candidate goroutines complete before transitioning to another state.
@@ -1028,6 +1144,79 @@ func (l *Log) candidateLoop(closing <-chan struct{}) State {
 	}
 }
 
+// preElect requests pre-votes from peers for the next term.
+// Returns true if a majority of the cluster would grant a vote. Returns false
+// if the election times out or a leader makes contact before then.
+func (l *Log) preElect(closing <-chan struct{}) bool {
+	// Copy properties under lock.
+	l.lock()
+	id, config := l.id, l.config
+	term := l.term + 1
+	lastLogIndex, lastLogTerm := l.lastLogIndex, l.lastLogTerm
+
+	// Discard term changes and heartbeats received before the election timeout.
+	// Only those received during the pre-vote cancel it.
+	select {
+	case <-l.terms:
+	default:
+	}
+	for n := len(l.heartbeats); n > 0; n-- {
+		<-l.heartbeats
+	}
+	l.unlock()
+
+	// Request pre-votes from peers.
+	votes := make(chan bool, len(config.Nodes))
+	for _, n := range config.Nodes {
+		if n.ID == id {
+			continue
+		}
+		go func(n *ConfigNode) {
+			peerTerm, err := l.Transport.RequestPreVote(n.URL, term, id, lastLogIndex, lastLogTerm)
+			l.Logger.Printf("send req prevote(term=%d, candidateID=%d, lastLogIndex=%d, lastLogTerm=%d) (term=%d, err=%v)", term, id, lastLogIndex, lastLogTerm, peerTerm, err)
+			votes <- (err == nil)
+		}(n)
+	}
+
+	// Wait until we have a quorum or every peer has responded.
+	voteN, respN := 1, 0
+	for voteN < (len(config.Nodes)/2)+1 {
+		if respN == len(config.Nodes)-1 {
+			l.Logger.Printf("prevote failed: term=%d, votes=%d", term, voteN)
+			return false
+		}
+
+		select {
+		case <-closing:
+			return false
+		case ok := <-votes:
+			respN++
+			if ok {
+				voteN++
+			}
+		case hb := <-l.heartbeats:
+			// A leader is active so step down and follow it.
+			l.lock()
+			l.mustSetTermIfHigher(hb.term)
+			if hb.commitIndex > l.commitIndex {
+				l.commitIndex = hb.commitIndex
+			}
+			l.leaderID = hb.leaderID
+			l.unlock()
+			l.Logger.Printf("prevote canceled: heartbeat from leader %d", hb.leaderID)
+			return false
+		case <-l.terms:
+			return false
+		case ch := <-l.Clock.AfterElectionTimeout():
+			// Peers that never respond must not block the candidate.
+			close(ch)
+			l.Logger.Printf("prevote timed out: term=%d, votes=%d", term, voteN)
+			return false
+		}
+	}
+	return true
+}
+
 func (l *Log) elect(term uint64, elected chan struct{}, wg *sync.WaitGroup) {
 	defer wg.Done()
 
@@ -1227,8 +1416,11 @@ func (l *Log) internalApply(typ LogEntryType, command []byte) (index uint64, err
 	defer l.unlock()
 
 	// Do not apply if this node is not the leader.
+	// Do not apply while leadership is being transferred.
 	if l.state != Leader {
 		return 0, ErrNotLeader
+	} else if l.transferring {
+		return 0, ErrTransferring
 	}
 
 	// Create log entry.
@@ -1386,6 +1578,13 @@ func (l *Log) applier(closing <-chan struct{}) {
 			}
 		}
 
+		// Snapshot the state machine if enough data has been applied.
+		if l.snapshotRequired() {
+			if err := l.snapshot(); err != nil {
+				l.Logger.Printf("snapshot: %s", err)
+			}
+		}
+
 		// Trim entries.
 		l.lock()
 		l.trim()
@@ -1445,6 +1644,10 @@ func (l *Log) applyNextUnappliedEntry(closing <-chan struct{}) error {
 		return fmt.Errorf("apply: %s", err)
 	}
 
+	// Track the amount of data applied since the last snapshot.
+	l.snapshotEntryN++
+	l.snapshotSize += int64(len(e.Data))
+
 	return nil
 }
 
@@ -1455,12 +1658,17 @@ func (l *Log) trim() {
 	}
 
 	// Determine lowest index to trim to.
+	// Entries after the last snapshot are retained when snapshotting is
+	// enabled so that new readers can be started from the snapshot.
 	index := l.FSM.Index()
 	for _, w := range l.writers {
 		if w.snapshotIndex > 0 && w.snapshotIndex < index {
 			index = w.snapshotIndex
 		}
 	}
+	if l.snapshotEnabled() && l.snapshotIndex < index {
+		index = l.snapshotIndex
+	}
 
 	// Ignore if the index is lower than the first entry.
 	// This can occur on a new snapshot.
@@ -1478,6 +1686,135 @@ func (l *Log) trim() {
 	l.entries = l.entries[offset:]
 }
 
+// snapshotEnabled returns true if either snapshot threshold is set.
+func (l *Log) snapshotEnabled() bool {
+	return l.SnapshotEntryThreshold > 0 || l.SnapshotSizeThreshold > 0
+}
+
+// snapshotRequired returns true if enough entries or bytes have been applied
+// since the last snapshot to exceed one of the snapshot thresholds.
+func (l *Log) snapshotRequired() bool {
+	l.lock()
+	defer l.unlock()
+
+	if l.SnapshotEntryThreshold > 0 && l.snapshotEntryN >= l.SnapshotEntryThreshold {
+		return true
+	} else if l.SnapshotSizeThreshold > 0 && l.snapshotSize >= l.SnapshotSizeThreshold {
+		return true
+	}
+	return false
+}
+
+// snapshot writes a snapshot of the state machine to disk.
+// The snapshot is written to a temporary file and then atomically renamed.
+// This must only be called from the applier so the FSM does not change
+// while the snapshot is being written.
+func (l *Log) snapshot() error {
+	l.snapshotMu.Lock()
+	defer l.snapshotMu.Unlock()
+
+	// Retrieve snapshot path and the index being snapshotted.
+	l.lock()
+	if !l.opened() {
+		l.unlock()
+		return ErrClosed
+	}
+	path, index := l.snapshotPath(), l.FSM.Index()
+	l.unlock()
+
+	start := time.Now()
+	l.tracef("snapshot: begin: index=%d", index)
+
+	// Write the index header and the FSM data to a temporary file.
+	size, err := func() (int64, error) {
+		f, err := os.Create(path + ".tmp")
+		if err != nil {
+			return 0, err
+		}
+		defer func() { _ = f.Close() }()
+
+		if err := binary.Write(f, binary.BigEndian, index); err != nil {
+			return 0, fmt.Errorf("write header: %s", err)
+		}
+		if _, err := l.FSM.WriteTo(f); err != nil {
+			return 0, fmt.Errorf("write fsm: %s", err)
+		}
+		if err := f.Sync(); err != nil {
+			return 0, err
+		}
+
+		fi, err := f.Stat()
+		if err != nil {
+			return 0, err
+		}
+		return fi.Size(), nil
+	}()
+	if err != nil {
+		_ = os.Remove(path + ".tmp")
+
+		// Reset counters so the snapshot is not retried until the threshold is reached again.
+		l.lock()
+		l.snapshotEntryN, l.snapshotSize = 0, 0
+		l.unlock()
+		return err
+	}
+
+	// Replace the previous snapshot.
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("rename: %s", err)
+	}
+	d := time.Since(start)
+
+	// Reset counters and update stats.
+	l.lock()
+	l.snapshotIndex = index
+	l.snapshotEntryN, l.snapshotSize = 0, 0
+	l.snapshotStats.Index = index
+	l.snapshotStats.Count++
+	l.snapshotStats.Size = size
+	l.snapshotStats.Duration = d
+	l.unlock()
+
+	l.Logger.Printf("snapshot: index=%d, size=%d, duration=%s", index, size, d)
+
+	return nil
+}
+
+// openSnapshot opens the last snapshot written to disk and returns its index.
+// Returns a nil file if there is no snapshot or if the entries following the
+// snapshot are no longer available in the log. Must be called under lock.
+func (l *Log) openSnapshot() (*os.File, uint64, error) {
+	if !l.snapshotEnabled() || l.snapshotIndex == 0 {
+		return nil, 0, nil
+	}
+
+	// Open the file and read the index from the header since the snapshot
+	// may have been replaced since the in-memory index was updated.
+	f, err := os.Open(l.snapshotPath())
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	} else if err != nil {
+		return nil, 0, err
+	}
+	var index uint64
+	if err := binary.Read(f, binary.BigEndian, &index); err != nil {
+		_ = f.Close()
+		return nil, 0, err
+	}
+
+	// Ensure all entries after the snapshot are still in the log.
+	firstIndex := l.lastLogIndex + 1
+	if len(l.entries) > 0 {
+		firstIndex = l.entries[0].Index
+	}
+	if index == 0 || index+1 < firstIndex || index > l.lastLogIndex {
+		_ = f.Close()
+		return nil, 0, nil
+	}
+
+	return f, index, nil
+}
+
 // mustApplyInitialize a log initialization command by parsing and setting the configuration.
 func (l *Log) mustApplyInitialize(e *LogEntry) {
 	// Parse the configuration from the log entry.
@@ -1578,6 +1915,151 @@ func (l *Log) RemovePeer(id uint64) error {
 	return nil
 }
 
+// TransferLeadership hands leadership over to the follower with the given id.
+// If id is zero then the most up-to-date follower is chosen. New commands are
+// rejected while the follower is caught up to the leader's log. The follower
+// is then told to start an election immediately. Returns once the log has
+// stepped down or returns an error if the transfer times out.
+func (l *Log) TransferLeadership(id uint64) error {
+	// Validate state and block new commands under lock.
+	l.lock()
+	if !l.opened() {
+		l.unlock()
+		return ErrClosed
+	} else if l.state != Leader {
+		l.unlock()
+		return ErrNotLeader
+	} else if l.transferring {
+		l.unlock()
+		return ErrTransferring
+	}
+	l.transferring = true
+	term, leaderID, config := l.term, l.id, l.config
+	l.unlock()
+
+	// Allow commands again once the transfer is done.
+	defer func() {
+		l.lock()
+		l.transferring = false
+		l.unlock()
+	}()
+
+	l.Logger.Printf("leadership transfer: begin (term=%d, id=%d)", term, id)
+	timeout := time.After(DefaultTransferTimeout)
+
+	// Catch up the target node to the leader's last index.
+	n, err := l.catchUpTransferTarget(id, term, config, timeout)
+	if err != nil {
+		return err
+	}
+
+	// Tell the target to start an election immediately.
+	if err := l.Transport.TimeoutNow(n.URL, term, leaderID); err != nil {
+		return fmt.Errorf("timeout now: %s", err)
+	}
+
+	// Wait until the log has stepped down.
+	for {
+		l.lock()
+		state, currentTerm := l.state, l.term
+		l.unlock()
+
+		if state != Leader || currentTerm != term {
+			l.Logger.Printf("leadership transfer: complete (node=%d)", n.ID)
+			return nil
+		}
+
+		select {
+		case <-timeout:
+			return ErrTransferTimeout
+		case <-time.After(WaitInterval):
+		}
+	}
+}
+
+// catchUpTransferTarget heartbeats followers until the transfer target has
+// replicated the entire log. Returns the target node.
+func (l *Log) catchUpTransferTarget(id, term uint64, config *Config, timeout <-chan time.Time) (*ConfigNode, error) {
+	// Validate that the target is a follower.
+	leaderID := l.ID()
+	if id == leaderID {
+		return nil, fmt.Errorf("cannot transfer leadership to self")
+	} else if id != 0 && config.NodeByID(id) == nil {
+		return nil, ErrNodeNotFound
+	} else if len(config.Nodes) < 2 {
+		return nil, fmt.Errorf("no followers to transfer leadership to")
+	}
+
+	for {
+		l.lock()
+		if l.state != Leader || l.term != term {
+			l.unlock()
+			return nil, ErrNotLeader
+		}
+		commitIndex, lastLogIndex := l.commitIndex, l.lastLogIndex
+		l.unlock()
+
+		// Check the replicated index of the target or of every follower if
+		// no target was specified.
+		var target *ConfigNode
+		var targetIndex uint64
+		for _, n := range config.Nodes {
+			if n.ID == leaderID || (id != 0 && n.ID != id) {
+				continue
+			}
+
+			peerIndex, err := l.Transport.Heartbeat(n.URL, term, commitIndex, leaderID)
+			if err != nil {
+				l.tracef("leadership transfer: heartbeat: node=%d, err=%s", n.ID, err)
+				continue
+			}
+			if target == nil || peerIndex > targetIndex {
+				target, targetIndex = n, peerIndex
+			}
+		}
+
+		// Return once the target has caught up.
+		if target != nil && targetIndex >= lastLogIndex {
+			return target, nil
+		}
+
+		select {
+		case <-timeout:
+			return nil, ErrTransferTimeout
+		case <-time.After(WaitInterval):
+		}
+	}
+}
+
+// TimeoutNow causes a follower to start an election immediately.
+// This is sent by the leader when transferring leadership.
+func (l *Log) TimeoutNow(term, leaderID uint64) error {
+	l.lock()
+	defer l.unlock()
+
+	// Check if log is closed.
+	if !l.opened() || l.state == Stopped {
+		return ErrClosed
+	}
+
+	// Ignore requests from stale leaders.
+	if term < l.term {
+		return ErrStaleTerm
+	} else if l.state != Follower {
+		return ErrNotFollower
+	}
+
+	l.Logger.Printf("recv timeout now: (term=%d, leaderID=%d)", term, leaderID)
+
+	// Notify the follower loop.
+	select {
+	case l.timeoutNow <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
 // Heartbeat establishes dominance by the current leader.
 // Returns the current term and highest written log entry index.
 func (l *Log) Heartbeat(term, commitIndex, leaderID uint64) (currentIndex uint64, err error) {
@@ -1602,6 +2084,9 @@ func (l *Log) Heartbeat(term, commitIndex, leaderID uint64) (currentIndex uint64
 		return l.lastLogIndex, ErrStaleTerm
 	}
 
+	// Track leader contact so pre-votes can be denied.
+	l.lastContact = l.Clock.Now()
+
 	// Send heartbeat to channel for the state loop to process.
 	select {
 	case l.heartbeats <- heartbeat{term: term, commitIndex: commitIndex, leaderID: leaderID}:
@@ -1658,6 +2143,44 @@ func (l *Log) RequestVote(term, candidateID, lastLogIndex, lastLogTerm uint64) (
 	return l.term, nil
 }
 
+// RequestPreVote asks the log if it would vote for a candidate in a given term.
+// Unlike RequestVote, the log's term and vote are left unchanged.
+func (l *Log) RequestPreVote(term, candidateID, lastLogIndex, lastLogTerm uint64) (peerTerm uint64, err error) {
+	// Ignore if snapshotting.
+	if l.isSnapshotting() {
+		return 0, ErrSnapshotting
+	}
+
+	// Otherwise obtain lock and process pre-vote.
+	l.lock()
+	defer l.unlock()
+
+	// Check if log is closed.
+	if !l.opened() {
+		return l.term, ErrClosed
+	}
+
+	defer func() {
+		l.Logger.Printf("recv req prevote(term=%d, candidateID=%d, lastLogIndex=%d, lastLogTerm=%d) (err=%v)", term, candidateID, lastLogIndex, lastLogTerm, err)
+	}()
+
+	// Deny pre-vote if:
+	//   1. Candidate is requesting a vote from an earlier term.
+	//   2. This log is the leader or has heard from the leader recently.
+	//   3. Candidate log is less up-to-date than local log.
+	if term < l.term {
+		return l.term, ErrStaleTerm
+	} else if l.state == Leader || l.Clock.Now().Sub(l.lastContact) < l.Clock.MinElectionTimeout() {
+		return l.term, ErrLeaderActive
+	} else if lastLogTerm < l.lastLogTerm {
+		return l.term, ErrOutOfDateLog
+	} else if lastLogTerm == l.lastLogTerm && lastLogIndex < l.lastLogIndex {
+		return l.term, ErrOutOfDateLog
+	}
+
+	return l.term, nil
+}
+
 // WriteEntriesTo attaches a writer to the log from a given index.
 // The index specified must be a committed index.
 func (l *Log) WriteEntriesTo(w io.Writer, id, term, index uint64) error {
@@ -1728,6 +2251,17 @@ func (l *Log) initWriter(w io.Writer, id, term, index uint64) (*logWriter, error
 		snapshotIndex: l.FSM.Index(),
 		done:          make(chan struct{}),
 	}
+
+	// Start from the last snapshot on disk, if available, instead of
+	// generating a new snapshot from the state machine.
+	f, snapshotIndex, err := l.openSnapshot()
+	if err != nil {
+		l.Logger.Printf("open snapshot: %s", err)
+	} else if f != nil {
+		writer.snapshot = f
+		writer.snapshotIndex = snapshotIndex
+	}
+
 	l.writers = append(l.writers, writer)
 
 	return writer, nil
@@ -1744,7 +2278,14 @@ func (l *Log) writeTo(writer *logWriter, id, term, index uint64) error {
 	}
 
 	// Begin streaming the snapshot.
-	if _, err := l.FSM.WriteTo(w); err != nil {
+	// Use the snapshot on disk if one was opened. Otherwise use the FSM.
+	if writer.snapshot != nil {
+		_, err := io.Copy(w, writer.snapshot)
+		_ = writer.snapshot.Close()
+		if err != nil {
+			return err
+		}
+	} else if _, err := l.FSM.WriteTo(w); err != nil {
 		return err
 	}
 	flushWriter(w)
@@ -1894,6 +2435,9 @@ func (l *Log) applyConfigLogEntry(e *LogEntry) error {
 
 // applySnapshotLogEntry restores a snapshot log entry.
 func (l *Log) applySnapshotLogEntry(e *LogEntry, r io.Reader) error {
+	l.snapshotMu.Lock()
+	defer l.snapshotMu.Unlock()
+
 	l.lock()
 	defer l.unlock()
 
@@ -1916,6 +2460,8 @@ func (l *Log) applySnapshotLogEntry(e *LogEntry, r io.Reader) error {
 	l.lastLogIndex = index
 	l.commitIndex = index
 	l.entries = nil
+	l.snapshotEntryN, l.snapshotSize = 0, 0
+	l.snapshotStats.Installed++
 
 	return nil
 }
@@ -1947,11 +2493,28 @@ type heartbeat struct {
 	leaderID    uint64
 }
 
+// SnapshotStats represents statistics about the snapshots taken by a log.
+type SnapshotStats struct {
+	// Index of the last snapshot written to disk.
+	Index uint64
+
+	// Number of snapshots written to disk since the log was created.
+	Count int
+
+	// Size, in bytes, and write duration of the last snapshot.
+	Size     int64
+	Duration time.Duration
+
+	// Number of snapshots installed from the leader.
+	Installed int
+}
+
 // logWriter wraps writers to provide a channel for close notification.
 type logWriter struct {
 	io.Writer
 	id            uint64        // target's log id
 	snapshotIndex uint64        // snapshot index, if zero then ignored.
+	snapshot      *os.File      // snapshot on disk, if nil then the FSM is used.
 	done          chan struct{} // close notification
 }
 
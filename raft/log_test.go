@@ -215,6 +215,114 @@ func TestLog_Apply(t *testing.T) {
 	}
 }
 
+// Ensure that a log snapshots its state machine once the entry threshold is reached.
+func TestLog_Snapshot_EntryThreshold(t *testing.T) {
+	l := NewLog(url.URL{Host: "log0"})
+	l.Log.FSM = &FSM{}
+	l.SnapshotEntryThreshold = 3
+	l.MustOpen()
+	l.MustInitialize()
+	defer l.Close()
+
+	// Apply a command and ensure the threshold has not been reached.
+	// The initialization entry counts toward the threshold.
+	if _, err := l.Apply([]byte("foo")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	l.Clock.apply()
+	if n := l.SnapshotStats().Count; n != 0 {
+		t.Fatalf("unexpected snapshot count: %d", n)
+	}
+
+	// Apply another command and ensure a snapshot was written.
+	index, err := l.Apply([]byte("bar"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	l.Clock.apply()
+	if stats := l.SnapshotStats(); stats.Count != 1 {
+		t.Fatalf("unexpected snapshot count: %d", stats.Count)
+	} else if stats.Index != index {
+		t.Fatalf("unexpected snapshot index: %d", stats.Index)
+	} else if stats.Size <= 0 {
+		t.Fatalf("unexpected snapshot size: %d", stats.Size)
+	}
+	if _, err := os.Stat(filepath.Join(l.Path(), "snapshot")); err != nil {
+		t.Fatalf("snapshot not written: %s", err)
+	}
+
+	// Reopen the log and ensure the snapshot index is restored.
+	path := l.Path()
+	l.Log.Close()
+	if err := l.Open(path); err != nil {
+		t.Fatalf("unexpected open error: %s", err)
+	} else if n := l.SnapshotStats().Index; n != index {
+		t.Fatalf("unexpected restored snapshot index: %d", n)
+	}
+}
+
+// Ensure that a log snapshots its state machine once the size threshold is reached.
+func TestLog_Snapshot_SizeThreshold(t *testing.T) {
+	l := NewLog(url.URL{Host: "log0"})
+	l.Log.FSM = &FSM{}
+	l.SnapshotSizeThreshold = 1000
+	l.MustOpen()
+	l.MustInitialize()
+	defer l.Close()
+
+	// Apply a large command and ensure a snapshot was written.
+	if _, err := l.Apply(make([]byte, 1000)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	l.Clock.apply()
+	if n := l.SnapshotStats().Count; n != 1 {
+		t.Fatalf("unexpected snapshot count: %d", n)
+	}
+}
+
+// Ensure that a new peer can be started from the leader's snapshot on disk.
+func TestLog_Snapshot_Join(t *testing.T) {
+	t0 := NewTransport()
+	l0 := NewLog(url.URL{Host: "log0"})
+	l0.Log.FSM = &FSM{}
+	l0.Transport = t0
+	l0.SnapshotEntryThreshold = 1
+	t0.register(l0.Log)
+	l0.MustOpen()
+	l0.MustInitialize()
+	defer l0.Close()
+
+	// Apply a command to the leader and snapshot it to disk.
+	index, err := l0.Apply([]byte("foo"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	l0.Clock.apply()
+	if n := l0.SnapshotStats().Index; n != index {
+		t.Fatalf("unexpected snapshot index: %d", n)
+	}
+
+	// Join a new log and ensure the command is installed from the snapshot.
+	l1 := NewLog(url.URL{Host: "log1"})
+	l1.Log.FSM = &FSM{}
+	l1.Transport = t0
+	t0.register(l1.Log)
+	l1.MustOpen()
+	defer l1.Close()
+	go func() {
+		l0.MustWaitUncommitted(index + 1)
+		l0.Clock.apply()
+	}()
+	if err := l1.Join(l0.URL()); err != nil {
+		t.Fatalf("unexpected join error: %s", err)
+	}
+	if n := len(l1.FSM.(*FSM).Commands); n != 1 {
+		t.Fatalf("unexpected command count: %d", n)
+	} else if n := l1.SnapshotStats().Installed; n != 1 {
+		t.Fatalf("unexpected installed snapshot count: %d", n)
+	}
+}
+
 // Ensure that a node has no configuration after it's closed.
 func TestLog_Config_Closed(t *testing.T) {
 	l := NewInitializedLog(url.URL{Host: "log0"})
@@ -333,6 +441,9 @@ func TestLog_Elect(t *testing.T) {
 	path := c.Logs[0].Path()
 	c.Logs[0].Log.Close()
 
+	// Expire node 2's leader contact so it grants a pre-vote.
+	c.Logs[2].Clock.expireOnRead()
+
 	// Signal election on node 1. Then heartbeat to establish leadership.
 	c.Logs[1].Clock.now = c.Logs[1].Clock.now.Add(raft.DefaultElectionTimeout)
 	c.Logs[1].Clock.election()
@@ -375,6 +486,195 @@ func TestLog_Elect(t *testing.T) {
 	}
 }
 
+// Ensure that a follower cannot disrupt a healthy leader by starting an election.
+func TestCluster_Elect_PreVoteDenied(t *testing.T) {
+	c := NewCluster(fsmFunc)
+	defer c.Close()
+
+	// Time out node 1 while the leader is still heartbeating node 2.
+	// The second timeout ensures the first pre-vote has finished.
+	c.Logs[1].Clock.now = c.Logs[1].Clock.now.Add(raft.DefaultElectionTimeout)
+	c.Logs[1].Clock.election()
+	c.Logs[1].Clock.election()
+
+	// Ensure the term has not changed and the leader was not deposed.
+	if term := c.Logs[1].Term(); term != 1 {
+		t.Fatalf("unexpected node 1 term: %d", term)
+	} else if state := c.Logs[0].State(); state != raft.Leader {
+		t.Fatalf("node 0 unexpectedly deposed: %s", state)
+	} else if term := c.Logs[0].Term(); term != 1 {
+		t.Fatalf("unexpected node 0 term: %d", term)
+	}
+
+	// Ensure the leader can still commit commands.
+	index, err := c.Logs[0].Apply([]byte("abc"))
+	if err != nil {
+		t.Fatalf("unexpected apply error: %s", err)
+	}
+	c.Logs[0].HeartbeatUntil(index)
+	c.Logs[0].Clock.apply()
+	if err := c.Logs[0].Wait(index); err != nil {
+		t.Fatalf("unexpected wait error: %s", err)
+	}
+}
+
+// Ensure that a candidate doesn't wait forever on peers that never answer a
+// pre-vote and steps down when it hears from the leader.
+func TestCluster_Elect_PreVoteUnresponsive(t *testing.T) {
+	c := NewCluster(fsmFunc)
+	defer c.Close()
+
+	tr := &UnresponsiveTransport{Transport: c.Logs[1].Transport.(*Transport), done: make(chan struct{})}
+	defer close(tr.done)
+	c.Logs[1].Transport = tr
+
+	// Time out node 1 so it requests pre-votes, once the leader's last
+	// heartbeat from creating the cluster is received.
+	gosched()
+	c.Logs[1].Clock.now = c.Logs[1].Clock.now.Add(raft.DefaultElectionTimeout)
+	c.Logs[1].Clock.election()
+	gosched()
+	if state := c.Logs[1].State(); state != raft.Candidate {
+		t.Fatalf("expected node 1 to be a candidate: %s", state)
+	}
+
+	// Ensure the next election timeout returns node 1 to a follower.
+	c.Logs[1].Clock.election()
+	gosched()
+	if state := c.Logs[1].State(); state != raft.Follower {
+		t.Fatalf("expected node 1 to time out to follower: %s", state)
+	} else if term := c.Logs[1].Term(); term != 1 {
+		t.Fatalf("unexpected node 1 term: %d", term)
+	}
+
+	// Ensure a heartbeat from the leader also returns node 1 to a follower.
+	c.Logs[1].Clock.election()
+	gosched()
+	c.Logs[0].Clock.heartbeat()
+	gosched()
+	if state := c.Logs[1].State(); state != raft.Follower {
+		t.Fatalf("expected node 1 to follow the leader: %s", state)
+	} else if state := c.Logs[0].State(); state != raft.Leader {
+		t.Fatalf("node 0 unexpectedly deposed: %s", state)
+	}
+}
+
+// UnresponsiveTransport is a transport whose pre-vote requests never return until closed.
+type UnresponsiveTransport struct {
+	*Transport
+	done chan struct{}
+}
+
+func (t *UnresponsiveTransport) RequestPreVote(u url.URL, term, candidateID, lastLogIndex, lastLogTerm uint64) (uint64, error) {
+	<-t.done
+	return 0, fmt.Errorf("transport closed")
+}
+
+// Ensure that a pre-vote is denied while the leader is in contact and does
+// not change the log's term once granted.
+func TestLog_RequestPreVote(t *testing.T) {
+	c := NewCluster(fsmFunc)
+	defer c.Close()
+	l := c.Logs[2]
+
+	// Deny while the leader is in contact.
+	l.MustWaitUncommitted(3)
+	if _, err := l.Heartbeat(1, 0, 1); err != nil {
+		t.Fatalf("unexpected heartbeat error: %s", err)
+	}
+	gosched()
+	if _, err := l.RequestPreVote(2, 2, 3, 1); err != raft.ErrLeaderActive {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// Deny stale terms and out of date logs once the leader is lost.
+	l.Clock.expireOnRead()
+	if _, err := l.RequestPreVote(0, 2, 3, 1); err != raft.ErrStaleTerm {
+		t.Fatalf("unexpected error: %s", err)
+	} else if _, err := l.RequestPreVote(2, 2, 1, 0); err != raft.ErrOutOfDateLog {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// Grant an up-to-date candidate without changing the term.
+	if peerTerm, err := l.RequestPreVote(2, 2, 3, 1); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if peerTerm != 1 {
+		t.Fatalf("unexpected peer term: %d", peerTerm)
+	} else if term := l.Term(); term != 1 {
+		t.Fatalf("unexpected term: %d", term)
+	}
+
+	// Ensure a leader always denies a pre-vote.
+	if _, err := c.Logs[0].RequestPreVote(2, 2, 3, 1); err != raft.ErrLeaderActive {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+// Ensure that a pre-vote is granted once the clock's election timeout has
+// passed since the last contact with the leader.
+func TestLog_RequestPreVote_ElectionTimeout(t *testing.T) {
+	c := NewCluster(fsmFunc)
+	defer c.Close()
+	l := c.Logs[2]
+
+	// Contact with the leader is never recent with a zero timeout.
+	l.Clock.MinElectionTimeoutFunc = func() time.Duration { return 0 }
+	if _, err := l.RequestPreVote(2, 2, 3, 1); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+// Ensure that leadership can be transferred to a follower.
+func TestCluster_TransferLeadership(t *testing.T) {
+	c := NewCluster(fsmFunc)
+	defer c.Close()
+
+	// Transfer leadership from node 1 to node 2.
+	if err := c.Logs[0].TransferLeadership(2); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if state := c.Logs[0].State(); state == raft.Leader {
+		t.Fatalf("expected node 1 to step down: %s", state)
+	}
+
+	// Wait for node 2 to become leader in the next term.
+	for i := 0; c.Logs[1].State() != raft.Leader; i++ {
+		if i > 1000 {
+			t.Fatalf("expected node 2 to become leader: %s", c.Logs[1].State())
+		}
+		time.Sleep(raft.WaitInterval)
+	}
+	if term := c.Logs[1].Term(); term != 2 {
+		t.Fatalf("expected term 2: got %d", term)
+	}
+}
+
+// Ensure that leadership cannot be transferred by a follower.
+func TestCluster_TransferLeadership_ErrNotLeader(t *testing.T) {
+	c := NewCluster(fsmFunc)
+	defer c.Close()
+	if err := c.Logs[1].TransferLeadership(3); err != raft.ErrNotLeader {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+// Ensure that leadership cannot be transferred to an unknown node.
+func TestCluster_TransferLeadership_ErrNodeNotFound(t *testing.T) {
+	c := NewCluster(fsmFunc)
+	defer c.Close()
+	if err := c.Logs[0].TransferLeadership(100); err != raft.ErrNodeNotFound {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+// Ensure that a timeout now request is rejected by a leader.
+func TestLog_TimeoutNow_ErrNotFollower(t *testing.T) {
+	l := NewInitializedLog(url.URL{Host: "log0"})
+	defer l.Close()
+	if err := l.TimeoutNow(l.Term(), 0); err != raft.ErrNotFollower {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
 // Ensure that state can be stringified.
 func TestState_String(t *testing.T) {
 	var tests = []struct {
@@ -12,7 +12,16 @@ import (
 )
 
 // HTTPTransport represents a transport for sending RPCs over the HTTP protocol.
-type HTTPTransport struct{}
+type HTTPTransport struct {
+	// The underlying HTTP transport used to send requests.
+	// This can be set to use TLS between nodes. Defaults to http.DefaultTransport.
+	Transport http.RoundTripper
+}
+
+// client returns an HTTP client that uses the transport's round tripper.
+func (t *HTTPTransport) client() *http.Client {
+	return &http.Client{Transport: t.Transport}
+}
 
 // Join requests membership into a node's cluster.
 func (t *HTTPTransport) Join(uri url.URL, nodeURL url.URL) (uint64, uint64, *Config, error) {
@@ -22,7 +31,7 @@ func (t *HTTPTransport) Join(uri url.URL, nodeURL url.URL) (uint64, uint64, *Con
 	u.RawQuery = (&url.Values{"url": {nodeURL.String()}}).Encode()
 
 	// Send HTTP request.
-	resp, err := http.Get(u.String())
+	resp, err := t.client().Get(u.String())
 	if err != nil {
 		return 0, 0, nil, err
 	}
@@ -62,7 +71,7 @@ func (t *HTTPTransport) Leave(uri url.URL, id uint64) error {
 	u.RawQuery = (&url.Values{"id": {strconv.FormatUint(id, 10)}}).Encode()
 
 	// Send HTTP request.
-	resp, err := http.Get(u.String())
+	resp, err := t.client().Get(u.String())
 	if err != nil {
 		return err
 	}
@@ -90,7 +99,7 @@ func (t *HTTPTransport) Heartbeat(uri url.URL, term, commitIndex, leaderID uint6
 	u.RawQuery = v.Encode()
 
 	// Send HTTP request.
-	resp, err := http.Get(u.String())
+	resp, err := t.client().Get(u.String())
 	if err != nil {
 		return 0, err
 	}
@@ -125,7 +134,7 @@ func (t *HTTPTransport) ReadFrom(uri url.URL, id, term, index uint64) (io.ReadCl
 	u.RawQuery = v.Encode()
 
 	// Send HTTP request.
-	resp, err := http.Get(u.String())
+	resp, err := t.client().Get(u.String())
 	if err != nil {
 		return nil, err
 	}
@@ -141,9 +150,18 @@ func (t *HTTPTransport) ReadFrom(uri url.URL, id, term, index uint64) (io.ReadCl
 
 // RequestVote requests a vote for a candidate in a given term.
 func (t *HTTPTransport) RequestVote(uri url.URL, term, candidateID, lastLogIndex, lastLogTerm uint64) (uint64, error) {
+	return t.requestVote(uri, "raft/vote", term, candidateID, lastLogIndex, lastLogTerm)
+}
+
+// RequestPreVote checks if a candidate could win an election in a given term.
+func (t *HTTPTransport) RequestPreVote(uri url.URL, term, candidateID, lastLogIndex, lastLogTerm uint64) (uint64, error) {
+	return t.requestVote(uri, "raft/prevote", term, candidateID, lastLogIndex, lastLogTerm)
+}
+
+func (t *HTTPTransport) requestVote(uri url.URL, p string, term, candidateID, lastLogIndex, lastLogTerm uint64) (uint64, error) {
 	// Construct URL.
 	u := uri
-	u.Path = path.Join(u.Path, "raft/vote")
+	u.Path = path.Join(u.Path, p)
 
 	// Set URL parameters.
 	v := &url.Values{}
@@ -154,7 +172,7 @@ func (t *HTTPTransport) RequestVote(uri url.URL, term, candidateID, lastLogIndex
 	u.RawQuery = v.Encode()
 
 	// Send HTTP request.
-	resp, err := http.Get(u.String())
+	resp, err := t.client().Get(u.String())
 	if err != nil {
 		return 0, err
 	}
@@ -173,3 +191,55 @@ func (t *HTTPTransport) RequestVote(uri url.URL, term, candidateID, lastLogIndex
 
 	return peerTerm, nil
 }
+
+// TimeoutNow tells a follower to start an election immediately.
+func (t *HTTPTransport) TimeoutNow(uri url.URL, term, leaderID uint64) error {
+	// Construct URL.
+	u := uri
+	u.Path = path.Join(u.Path, "raft/timeout")
+
+	// Set URL parameters.
+	v := &url.Values{}
+	v.Set("term", strconv.FormatUint(term, 10))
+	v.Set("leaderID", strconv.FormatUint(leaderID, 10))
+	u.RawQuery = v.Encode()
+
+	// Send HTTP request.
+	resp, err := t.client().Get(u.String())
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+
+	// Parse returned error.
+	if s := resp.Header.Get("X-Raft-Error"); s != "" {
+		return errors.New(s)
+	}
+
+	return nil
+}
+
+// TransferLeadership requests that the leader at uri hands leadership to the
+// node with the given id. An id of zero lets the leader choose the node.
+func (t *HTTPTransport) TransferLeadership(uri url.URL, id uint64) error {
+	// Construct URL.
+	u := uri
+	u.Path = path.Join(u.Path, "raft/transfer")
+	if id != 0 {
+		u.RawQuery = (&url.Values{"id": {strconv.FormatUint(id, 10)}}).Encode()
+	}
+
+	// Send HTTP request.
+	resp, err := t.client().Get(u.String())
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+
+	// Parse returned error.
+	if s := resp.Header.Get("X-Raft-Error"); s != "" {
+		return errors.New(s)
+	}
+
+	return nil
+}
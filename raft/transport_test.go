@@ -363,6 +363,91 @@ func TestHTTPTransport_RequestVote_ErrConnectionRefused(t *testing.T) {
 	}
 }
 
+// Ensure that a pre-vote can be requested over HTTP.
+func TestHTTPTransport_RequestPreVote(t *testing.T) {
+	// Start mock HTTP server.
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if path := r.URL.Path; path != `/raft/prevote` {
+			t.Fatalf("unexpected path: %s", path)
+		}
+		if term := r.FormValue("term"); term != `1` {
+			t.Fatalf("unexpected term: %v", term)
+		}
+		if candidateID := r.FormValue("candidateID"); candidateID != `2` {
+			t.Fatalf("unexpected candidate id: %v", candidateID)
+		}
+		w.Header().Set("X-Raft-Term", `100`)
+		w.Header().Set("X-Raft-Error", `leader active`)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer s.Close()
+
+	u, _ := url.Parse(s.URL)
+	if peerTerm, err := (&raft.HTTPTransport{}).RequestPreVote(*u, 1, 2, 3, 4); err == nil || err.Error() != `leader active` {
+		t.Fatalf("unexpected error: %v", err)
+	} else if peerTerm != 100 {
+		t.Fatalf("unexpected peer term: %d", peerTerm)
+	}
+}
+
+// Ensure that a timeout now request can be sent over HTTP.
+func TestHTTPTransport_TimeoutNow(t *testing.T) {
+	// Start mock HTTP server.
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if path := r.URL.Path; path != `/raft/timeout` {
+			t.Fatalf("unexpected path: %s", path)
+		}
+		if term := r.FormValue("term"); term != `1` {
+			t.Fatalf("unexpected term: %v", term)
+		}
+		if leaderID := r.FormValue("leaderID"); leaderID != `2` {
+			t.Fatalf("unexpected leader id: %v", leaderID)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer s.Close()
+
+	u, _ := url.Parse(s.URL)
+	if err := (&raft.HTTPTransport{}).TimeoutNow(*u, 1, 2); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+// Ensure that a timeout now request returns the remote error.
+func TestHTTPTransport_TimeoutNow_Error(t *testing.T) {
+	// Start mock HTTP server.
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Raft-Error", `not follower`)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer s.Close()
+
+	u, _ := url.Parse(s.URL)
+	if err := (&raft.HTTPTransport{}).TimeoutNow(*u, 1, 2); err == nil || err.Error() != `not follower` {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure that a leadership transfer request can be sent over HTTP.
+func TestHTTPTransport_TransferLeadership(t *testing.T) {
+	// Start mock HTTP server.
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if path := r.URL.Path; path != `/raft/transfer` {
+			t.Fatalf("unexpected path: %s", path)
+		}
+		if id := r.FormValue("id"); id != `3` {
+			t.Fatalf("unexpected id: %v", id)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer s.Close()
+
+	u, _ := url.Parse(s.URL)
+	if err := (&raft.HTTPTransport{}).TransferLeadership(*u, 3); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
 // Transport represents a test transport that directly calls another log.
 // Logs are looked up by hostname only.
 type Transport struct {
@@ -441,6 +526,24 @@ func (t *Transport) RequestVote(u url.URL, term, candidateID, lastLogIndex, last
 	return l.RequestVote(term, candidateID, lastLogIndex, lastLogTerm)
 }
 
+// RequestPreVote calls RequestPreVote() on the target log.
+func (t *Transport) RequestPreVote(u url.URL, term, candidateID, lastLogIndex, lastLogTerm uint64) (uint64, error) {
+	l, err := t.log(u)
+	if err != nil {
+		return 0, err
+	}
+	return l.RequestPreVote(term, candidateID, lastLogIndex, lastLogTerm)
+}
+
+// TimeoutNow calls TimeoutNow() on the target log.
+func (t *Transport) TimeoutNow(u url.URL, term, leaderID uint64) error {
+	l, err := t.log(u)
+	if err != nil {
+		return err
+	}
+	return l.TimeoutNow(term, leaderID)
+}
+
 // streamingBuffer implements a streaming bytes buffer.
 // This will hang during reads until there is data available or the streamer is closed.
 type streamingBuffer struct {
@@ -2,26 +2,53 @@ package influxdb
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"time"
 
 	"github.com/influxdb/influxdb/influxql"
 )
 
 const (
 	MAX_MAP_RESPONSE_SIZE = 1024 * 1024
+
+	// MapperContentType is the content type of mapper requests and responses sent
+	// using the binary mapper protocol.
+	MapperContentType = "application/x-influxdb-mapper"
+
+	// maxMapFrameSize is the largest frame accepted by the binary mapper protocol.
+	maxMapFrameSize = 1 << 30
+)
+
+// Frame types of the binary mapper protocol. Each frame is written as a one byte
+// type, a four byte big-endian payload length, and the payload.
+const (
+	mapFrameRequest byte = iota + 1
+	mapFrameData
+	mapFrameError
+	mapFrameComplete
 )
 
 // RemoteMapper implements the influxql.Mapper interface. The engine uses the remote mapper
 // to pull map results from shards that only exist on other servers in the cluster.
 type RemoteMapper struct {
 	dataNodes []*DataNode
+	transport http.RoundTripper
 	resp      *http.Response
 	results   chan interface{}
 	unmarshal influxql.UnmarshalFunc
 	complete  bool
 
+	// set when the remote server only supports the JSON protocol.
+	jsonProtocol bool
+
+	// the points read by the query's local mappers and its deadline.
+	scanned *scanCounter
+
 	Call            string   `json:",omitempty"`
 	Database        string   `json:",omitempty"`
 	MeasurementName string   `json:",omitempty"`
@@ -36,7 +63,14 @@ type RemoteMapper struct {
 	Limit           int      `json:",omitempty"`
 	Offset          int      `json:",omitempty"`
 	Interval        int64    `json:",omitempty"`
+	IntervalOffset  int64    `json:",omitempty"`
+	TimeZone        string   `json:",omitempty"`
 	ChunkSize       int      `json:",omitempty"`
+
+	// What's left of the query's limits when the mapper begins. Zero means no limit.
+	MaxPointsScanned int64         `json:",omitempty"`
+	Timeout          time.Duration `json:",omitempty"`
+	TimeRemaining    time.Duration `json:",omitempty"`
 }
 
 // Responses get streamed back to the remote mapper from the remote machine that runs a local mapper
@@ -58,35 +92,65 @@ func (m *RemoteMapper) Close() {
 
 // Begin sends a request to the remote server to start streaming map results
 func (m *RemoteMapper) Begin(c *influxql.Call, startingTime int64, chunkSize int) error {
-	// get the function for unmarshaling results
-	f, err := influxql.InitializeUnmarshaller(c)
-	if err != nil {
-		return err
-	}
-	m.unmarshal = f
-
 	if c != nil {
 		m.Call = c.String()
 	}
 	m.ChunkSize = chunkSize
 	m.TMin = startingTime
 
-	// send the request to map to the remote server
-	b, err := json.Marshal(m)
-	if err != nil {
+	// the remote server reads no more points, and runs for no longer, than what's left for the query
+	var err error
+	if m.MaxPointsScanned, m.TimeRemaining, err = m.scanned.remaining(time.Now()); err != nil {
 		return err
 	}
 
-	// request to start streaming results
-	resp, err := http.Post(m.dataNodes[0].URL.String()+"/data/run_mapper", "application/json", bytes.NewReader(b))
+	// request to start streaming results using the binary protocol. Servers that
+	// don't support it respond with JSON so resend the request as JSON.
+	resp, err := m.post(false)
 	if err != nil {
 		return err
 	}
+	if resp.Header.Get("Content-Type") != MapperContentType {
+		resp.Body.Close()
+		if resp, err = m.post(true); err != nil {
+			return err
+		}
+	}
 	m.resp = resp
 
+	// get the function for unmarshaling results
+	var f influxql.UnmarshalFunc
+	if m.jsonProtocol {
+		f, err = influxql.InitializeUnmarshaller(c)
+	} else {
+		f, err = influxql.InitializeBinaryUnmarshaller(c)
+	}
+	if err != nil {
+		return err
+	}
+	m.unmarshal = f
+
 	return nil
 }
 
+// post sends the mapper request to the remote server.
+func (m *RemoteMapper) post(useJSON bool) (*http.Response, error) {
+	var buf bytes.Buffer
+	contentType := MapperContentType
+	if useJSON {
+		contentType = "application/json"
+		if err := json.NewEncoder(&buf).Encode(m); err != nil {
+			return nil, err
+		}
+	} else if err := WriteMapRequest(&buf, m); err != nil {
+		return nil, err
+	}
+	m.jsonProtocol = useJSON
+
+	client := &http.Client{Transport: m.transport}
+	return client.Post(m.dataNodes[0].URL.String()+"/data/run_mapper", contentType, &buf)
+}
+
 // NextInterval is part of the mapper interface. In this case we read the next chunk from the remote mapper
 func (m *RemoteMapper) NextInterval() (interface{}, error) {
 	// just return nil if the mapper has completed its run
@@ -94,21 +158,18 @@ func (m *RemoteMapper) NextInterval() (interface{}, error) {
 		return nil, nil
 	}
 
-	// read the chunk
-	chunk := make([]byte, MAX_MAP_RESPONSE_SIZE, MAX_MAP_RESPONSE_SIZE)
-	n, err := m.resp.Body.Read(chunk)
-	if err != nil {
-		return nil, err
-	}
-	if n == 0 {
-		return nil, nil
+	// read the next response
+	var mr *MapResponse
+	var err error
+	if m.jsonProtocol {
+		mr, err = m.readJSONResponse()
+	} else {
+		mr, err = ReadMapResponse(m.resp.Body)
 	}
-
-	// marshal the response
-	mr := &MapResponse{}
-	err = json.Unmarshal(chunk[:n], mr)
 	if err != nil {
 		return nil, err
+	} else if mr == nil {
+		return nil, nil
 	}
 	if mr.Err != "" {
 		return nil, errors.New(mr.Err)
@@ -129,6 +190,27 @@ func (m *RemoteMapper) NextInterval() (interface{}, error) {
 	return v, nil
 }
 
+// readJSONResponse reads the next chunk from a remote server using the JSON protocol.
+func (m *RemoteMapper) readJSONResponse() (*MapResponse, error) {
+	// read the chunk
+	chunk := make([]byte, MAX_MAP_RESPONSE_SIZE, MAX_MAP_RESPONSE_SIZE)
+	n, err := m.resp.Body.Read(chunk)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, nil
+	}
+
+	// marshal the response
+	mr := &MapResponse{}
+	err = json.Unmarshal(chunk[:n], mr)
+	if err != nil {
+		return nil, err
+	}
+	return mr, nil
+}
+
 // CallExpr will parse the Call string into an expression or return nil
 func (m *RemoteMapper) CallExpr() (*influxql.Call, error) {
 	if m.Call == "" {
@@ -194,3 +276,230 @@ func (m *RemoteMapper) SetFilters(filters []influxql.Expr) {
 		m.Filters[i] = f.String()
 	}
 }
+
+// WriteMapRequest writes a mapper request to w using the binary mapper protocol.
+func WriteMapRequest(w io.Writer, m *RemoteMapper) error {
+	var e mapRequestEncoder
+	e.writeString(m.Call)
+	e.writeString(m.Database)
+	e.writeString(m.MeasurementName)
+	e.writeInt(m.TMin)
+	e.writeInt(m.TMax)
+	e.writeInt(int64(len(m.SeriesIDs)))
+	for _, id := range m.SeriesIDs {
+		e.writeInt(int64(id))
+	}
+	e.writeInt(int64(m.ShardID))
+	e.writeStrings(m.Filters)
+	e.writeFields(m.WhereFields)
+	e.writeFields(m.SelectFields)
+	e.writeStrings(m.SelectTags)
+	e.writeInt(int64(m.Limit))
+	e.writeInt(int64(m.Offset))
+	e.writeInt(m.Interval)
+	e.writeInt(int64(m.ChunkSize))
+	e.writeInt(m.IntervalOffset)
+	e.writeString(m.TimeZone)
+	e.writeInt(m.MaxPointsScanned)
+	e.writeInt(int64(m.Timeout))
+	e.writeInt(int64(m.TimeRemaining))
+	return writeMapFrame(w, mapFrameRequest, e.Bytes())
+}
+
+// ReadMapRequest reads a mapper request written by WriteMapRequest.
+func ReadMapRequest(r io.Reader) (*RemoteMapper, error) {
+	typ, b, err := readMapFrame(r)
+	if err != nil {
+		return nil, err
+	} else if typ != mapFrameRequest {
+		return nil, fmt.Errorf("unexpected map frame type: %d", typ)
+	}
+
+	d := &mapRequestDecoder{r: bytes.NewReader(b)}
+	m := &RemoteMapper{
+		Call:            d.readString(),
+		Database:        d.readString(),
+		MeasurementName: d.readString(),
+		TMin:            d.readInt(),
+		TMax:            d.readInt(),
+	}
+	if n := d.readLen(); n > 0 {
+		m.SeriesIDs = make([]uint64, n)
+		for i := range m.SeriesIDs {
+			m.SeriesIDs[i] = uint64(d.readInt())
+		}
+	}
+	m.ShardID = uint64(d.readInt())
+	m.Filters = d.readStrings()
+	m.WhereFields = d.readFields()
+	m.SelectFields = d.readFields()
+	m.SelectTags = d.readStrings()
+	m.Limit = int(d.readInt())
+	m.Offset = int(d.readInt())
+	m.Interval = d.readInt()
+	m.ChunkSize = int(d.readInt())
+	m.IntervalOffset = d.readInt()
+	m.TimeZone = d.readString()
+	m.MaxPointsScanned = d.readInt()
+	m.Timeout = time.Duration(d.readInt())
+	m.TimeRemaining = time.Duration(d.readInt())
+	if d.err != nil {
+		return nil, d.err
+	}
+	return m, nil
+}
+
+// WriteMapResponse writes a map response to w using the binary mapper protocol.
+func WriteMapResponse(w io.Writer, r *MapResponse) error {
+	if r.Err != "" {
+		return writeMapFrame(w, mapFrameError, []byte(r.Err))
+	} else if r.Completed {
+		return writeMapFrame(w, mapFrameComplete, nil)
+	}
+	return writeMapFrame(w, mapFrameData, r.Data)
+}
+
+// ReadMapResponse reads a map response written by WriteMapResponse.
+func ReadMapResponse(r io.Reader) (*MapResponse, error) {
+	typ, b, err := readMapFrame(r)
+	if err != nil {
+		return nil, err
+	}
+
+	switch typ {
+	case mapFrameData:
+		return &MapResponse{Data: b}, nil
+	case mapFrameError:
+		return &MapResponse{Err: string(b)}, nil
+	case mapFrameComplete:
+		return &MapResponse{Completed: true}, nil
+	default:
+		return nil, fmt.Errorf("unexpected map frame type: %d", typ)
+	}
+}
+
+// writeMapFrame writes a single length-prefixed frame to w.
+func writeMapFrame(w io.Writer, typ byte, payload []byte) error {
+	b := make([]byte, 5, 5+len(payload))
+	b[0] = typ
+	binary.BigEndian.PutUint32(b[1:5], uint32(len(payload)))
+	_, err := w.Write(append(b, payload...))
+	return err
+}
+
+// readMapFrame reads a single length-prefixed frame from r.
+func readMapFrame(r io.Reader) (byte, []byte, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+
+	n := binary.BigEndian.Uint32(hdr[1:5])
+	if n > maxMapFrameSize {
+		return 0, nil, fmt.Errorf("map frame too large: %d bytes", n)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return 0, nil, err
+	}
+	return hdr[0], b, nil
+}
+
+// mapRequestEncoder encodes the fields of a binary mapper request.
+type mapRequestEncoder struct {
+	bytes.Buffer
+}
+
+func (e *mapRequestEncoder) writeInt(v int64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(v))
+	e.Write(b[:])
+}
+
+func (e *mapRequestEncoder) writeString(s string) {
+	e.writeInt(int64(len(s)))
+	e.WriteString(s)
+}
+
+func (e *mapRequestEncoder) writeStrings(a []string) {
+	e.writeInt(int64(len(a)))
+	for _, s := range a {
+		e.writeString(s)
+	}
+}
+
+func (e *mapRequestEncoder) writeFields(a []*Field) {
+	e.writeInt(int64(len(a)))
+	for _, f := range a {
+		e.writeInt(int64(f.ID))
+		e.writeString(f.Name)
+		e.writeString(string(f.Type))
+	}
+}
+
+// mapRequestDecoder decodes the fields of a binary mapper request. The first
+// error encountered is saved and all subsequent reads return zero values.
+type mapRequestDecoder struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (d *mapRequestDecoder) readInt() int64 {
+	if d.err != nil {
+		return 0
+	}
+	var b [8]byte
+	if _, err := io.ReadFull(d.r, b[:]); err != nil {
+		d.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(b[:]))
+}
+
+// readLen reads a length and ensures it is no larger than the remaining request.
+func (d *mapRequestDecoder) readLen() int {
+	n := d.readInt()
+	if d.err == nil && (n < 0 || n > int64(d.r.Len())) {
+		d.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	return int(n)
+}
+
+func (d *mapRequestDecoder) readString() string {
+	n := d.readLen()
+	if d.err != nil || n == 0 {
+		return ""
+	}
+	b := make([]byte, n)
+	d.r.Read(b)
+	return string(b)
+}
+
+func (d *mapRequestDecoder) readStrings() []string {
+	n := d.readLen()
+	if n == 0 {
+		return nil
+	}
+	a := make([]string, n)
+	for i := range a {
+		a[i] = d.readString()
+	}
+	return a
+}
+
+func (d *mapRequestDecoder) readFields() []*Field {
+	n := d.readLen()
+	if n == 0 {
+		return nil
+	}
+	a := make([]*Field, n)
+	for i := range a {
+		a[i] = &Field{
+			ID:   uint8(d.readInt()),
+			Name: d.readString(),
+			Type: influxql.DataType(d.readString()),
+		}
+	}
+	return a
+}
@@ -0,0 +1,86 @@
+package influxdb_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/influxdb/influxdb"
+	"github.com/influxdb/influxdb/influxql"
+)
+
+// Ensure a mapper request can be written and read using the binary protocol.
+func TestMapRequest(t *testing.T) {
+	m := &influxdb.RemoteMapper{
+		Call:            `mean(value)`,
+		Database:        "db0",
+		MeasurementName: "cpu",
+		TMin:            -100,
+		TMax:            200,
+		SeriesIDs:       []uint64{1, 2, 3},
+		ShardID:         4,
+		Filters:         []string{`host = 'serverA'`},
+		WhereFields:     []*influxdb.Field{{ID: 1, Name: "value", Type: influxql.Float}},
+		SelectFields:    []*influxdb.Field{{ID: 1, Name: "value", Type: influxql.Float}, {ID: 2, Name: "name", Type: influxql.String}},
+		SelectTags:      []string{"host", "region"},
+		Limit:           10,
+		Offset:          5,
+		Interval:        60,
+		IntervalOffset:  15,
+		TimeZone:        "Europe/Berlin",
+		ChunkSize:       1000,
+
+		MaxPointsScanned: 500,
+		Timeout:          time.Minute,
+		TimeRemaining:    30 * time.Second,
+	}
+
+	var buf bytes.Buffer
+	if err := influxdb.WriteMapRequest(&buf, m); err != nil {
+		t.Fatal(err)
+	}
+	other, err := influxdb.ReadMapRequest(&buf)
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(m, other) {
+		t.Fatalf("mismatch:\n\nexp=%#v\n\ngot=%#v\n\n", m, other)
+	}
+}
+
+// Ensure a truncated mapper request returns an error.
+func TestMapRequest_ErrUnexpectedEOF(t *testing.T) {
+	var buf bytes.Buffer
+	if err := influxdb.WriteMapRequest(&buf, &influxdb.RemoteMapper{Database: "db0"}); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	if _, err := influxdb.ReadMapRequest(bytes.NewReader(b[:len(b)-1])); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+// Ensure map responses can be written and read using the binary protocol.
+func TestMapResponse(t *testing.T) {
+	responses := []*influxdb.MapResponse{
+		{Data: []byte{1, 2, 3}},
+		{Err: "marker"},
+		{Data: []byte{}},
+		{Completed: true},
+	}
+
+	var buf bytes.Buffer
+	for _, r := range responses {
+		if err := influxdb.WriteMapResponse(&buf, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, exp := range responses {
+		r, err := influxdb.ReadMapResponse(&buf)
+		if err != nil {
+			t.Fatalf("%d. unexpected error: %s", i, err)
+		} else if !reflect.DeepEqual(exp, r) {
+			t.Fatalf("%d. mismatch: %#v", i, r)
+		}
+	}
+}
@@ -2,16 +2,21 @@ package influxdb
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"math"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"runtime"
 	"sort"
@@ -19,6 +24,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/influxdb/influxdb/influxql"
 	"github.com/influxdb/influxdb/messaging"
@@ -73,13 +80,29 @@ type Server struct {
 	dataNodes map[uint64]*DataNode // data nodes by id
 	databases map[string]*database // databases by name
 	users     map[string]*User     // user by name
+	roles     map[string]*Role     // roles by name
+	tokens    map[string]*Token    // API tokens by name
+	hashes    map[string]*Token    // API tokens by hash of their secret
 
 	shards map[uint64]*Shard // shards by shard id
 
 	stats      *Stats
+	otherStats []*Stats // stats registered by other components, such as the HTTP handler
+	otherDiags []registeredDiagnostics
 	Logger     *log.Logger
 	WriteTrace bool // Detailed logging of write path
 
+	// Log of applied commands, administrative statements and failed authentications.
+	// Nil disables auditing.
+	AuditLog *AuditLog
+
+	// Cache of aggregate query results grouped by time. Nil disables caching.
+	QueryCache *QueryCache
+
+	// HTTP transport used for requests to other nodes in the cluster.
+	// Defaults to http.DefaultTransport if not set.
+	Transport http.RoundTripper
+
 	authenticationEnabled bool
 
 	// Retention policy settings
@@ -91,6 +114,34 @@ type Server struct {
 	ComputeRunsPerInterval int
 	ComputeNoMoreThan      time.Duration
 
+	// query limits. Zero means no limit.
+	MaxSeriesPerQuery int           // max series selected by a query
+	MaxPointsScanned  int           // max points read from the local shards by a query
+	MaxGroupByBuckets int           // max group by time() intervals per series
+	QueryTimeout      time.Duration // max time a select statement can run for
+
+	// Statements running for at least SlowQueryThreshold are logged, and written to the
+	// self-monitoring database if it's started. Zero disables the slow query log.
+	SlowQueryThreshold time.Duration
+
+	// The database and retention policy self-monitoring writes to, if started.
+	monitoringDatabase  string
+	monitoringRetention string
+
+	// Requirements for the passwords of new users and password changes. Passwords
+	// are checked by the server executing the statement, before they're broadcast.
+	PasswordPolicy PasswordPolicy
+
+	// Failed logins before a user or a remote host is locked out. Zero means no lockout.
+	// Failed logins are counted, and lockouts last, for LoginLockout.
+	MaxFailedLogins        int
+	MaxFailedLoginsPerHost int
+	LoginLockout           time.Duration
+
+	loginMu      sync.Mutex
+	loginsByUser map[string]*loginFailures // failed logins by user name
+	loginsByHost map[string]*loginFailures // failed logins by remote host
+
 	// This is the last time this data node has run continuous queries.
 	// Keep this state in memory so if a broker makes a request in another second
 	// to compute, it won't rerun CQs that have already been run. If this data node
@@ -111,10 +162,19 @@ func NewServer() *Server {
 		dataNodes: make(map[uint64]*DataNode),
 		databases: make(map[string]*database),
 		users:     make(map[string]*User),
+		roles:     make(map[string]*Role),
+		tokens:    make(map[string]*Token),
+		hashes:    make(map[string]*Token),
 
 		shards: make(map[uint64]*Shard),
 		stats:  NewStats("server"),
 		Logger: log.New(os.Stderr, "[server] ", log.LstdFlags),
+
+		MaxGroupByBuckets: influxql.MaxGroupByPoints,
+		PasswordPolicy:    PasswordPolicy{MinLength: 1},
+
+		loginsByUser: make(map[string]*loginFailures),
+		loginsByHost: make(map[string]*loginFailures),
 	}
 	// Server will always return with authentication enabled.
 	// This ensures that disabling authentication must be an explicit decision.
@@ -281,6 +341,9 @@ func (s *Server) close() error {
 	s.dataNodes = nil
 	s.databases = nil
 	s.users = nil
+	s.roles = nil
+	s.tokens = nil
+	s.hashes = nil
 
 	return nil
 }
@@ -328,6 +391,7 @@ func (s *Server) load() error {
 							continue
 						}
 
+						sh.cache = s.QueryCache
 						if err := sh.open(s.shardPath(sh.ID), s.client.Conn(sh.ID)); err != nil {
 							return fmt.Errorf("cannot open shard store: id=%d, err=%s", sh.ID, err)
 						}
@@ -343,6 +407,20 @@ func (s *Server) load() error {
 			s.users[u.Name] = u
 		}
 
+		// Load roles.
+		s.roles = make(map[string]*Role)
+		for _, r := range tx.roles() {
+			s.roles[r.Name] = r
+		}
+
+		// Load API tokens.
+		s.tokens = make(map[string]*Token)
+		s.hashes = make(map[string]*Token)
+		for _, t := range tx.tokens() {
+			s.tokens[t.Name] = t
+			s.hashes[t.Hash] = t
+		}
+
 		return nil
 	})
 }
@@ -354,6 +432,10 @@ func (s *Server) StartSelfMonitoring(database, retention string, interval time.D
 		return fmt.Errorf("statistics check interval must be non-zero")
 	}
 
+	s.mu.Lock()
+	s.monitoringDatabase, s.monitoringRetention = database, retention
+	s.mu.Unlock()
+
 	// Function for local use turns stats into a slice of points
 	pointsFromStats := func(st *Stats, tags map[string]string) []Point {
 
@@ -387,6 +469,9 @@ func (s *Server) StartSelfMonitoring(database, retention string, interval time.D
 				tags["host"] = h
 			}
 			batch := pointsFromStats(s.stats, tags)
+			for _, st := range s.registeredStats() {
+				batch = append(batch, pointsFromStats(st, tags)...)
+			}
 
 			// Shard-level stats.
 			tags["shardID"] = strconv.FormatUint(s.id, 10)
@@ -548,9 +633,10 @@ func (s *Server) Client() MessagingClient {
 }
 
 // broadcast encodes a message as JSON and send it to the broker's broadcast topic.
+// The origin, if any, is the user and address of the statement sending the message.
 // This function waits until the message has been processed by the server.
 // Returns the broker log index of the message or an error.
-func (s *Server) broadcast(typ messaging.MessageType, c interface{}) (uint64, error) {
+func (s *Server) broadcast(typ messaging.MessageType, c interface{}, o *commandOrigin) (uint64, error) {
 	s.stats.Inc("broadcastMessageTx")
 
 	// Encode the command.
@@ -558,6 +644,9 @@ func (s *Server) broadcast(typ messaging.MessageType, c interface{}) (uint64, er
 	if err != nil {
 		return 0, err
 	}
+	if data, err = o.encode(data); err != nil {
+		return 0, err
+	}
 
 	// Publish the message.
 	m := &messaging.Message{
@@ -672,6 +761,7 @@ func (s *Server) Join(u *url.URL, joinURL *url.URL) error {
 	var retries int
 	var resp *http.Response
 	var err error
+	client := &http.Client{Transport: s.Transport}
 
 	// When POSTing the to the join endpoint, we are manually following redirects
 	// and not relying on the Go http client redirect policy. The Go http client will convert
@@ -691,7 +781,7 @@ func (s *Server) Join(u *url.URL, joinURL *url.URL) error {
 			return err
 		}
 
-		resp, err = http.Post(joinURL.String(), "application/octet-stream", &buf)
+		resp, err = client.Post(joinURL.String(), "application/octet-stream", &buf)
 		if err != nil {
 			return err
 		}
@@ -746,7 +836,7 @@ func (s *Server) Join(u *url.URL, joinURL *url.URL) error {
 
 	// Download the metastore from joining server.
 	joinURL.Path = "/data/metastore"
-	resp, err = http.Get(joinURL.String())
+	resp, err = client.Get(joinURL.String())
 	if err != nil {
 		return err
 	}
@@ -856,7 +946,7 @@ func (s *Server) DataNodes() (a []*DataNode) {
 // CreateDataNode creates a new data node with a given URL.
 func (s *Server) CreateDataNode(u *url.URL) error {
 	c := &createDataNodeCommand{URL: u.String()}
-	_, err := s.broadcast(createDataNodeMessageType, c)
+	_, err := s.broadcast(createDataNodeMessageType, c, nil)
 	return err
 }
 
@@ -896,7 +986,7 @@ func (s *Server) applyCreateDataNode(m *messaging.Message) (err error) {
 // DeleteDataNode deletes an existing data node.
 func (s *Server) DeleteDataNode(id uint64) error {
 	c := &deleteDataNodeCommand{ID: id}
-	_, err := s.broadcast(deleteDataNodeMessageType, c)
+	_, err := s.broadcast(deleteDataNodeMessageType, c, nil)
 	return err
 }
 
@@ -938,11 +1028,15 @@ func (s *Server) Databases() (a []string) {
 
 // CreateDatabase creates a new database.
 func (s *Server) CreateDatabase(name string) error {
+	return s.createDatabase(name, nil)
+}
+
+func (s *Server) createDatabase(name string, o *commandOrigin) error {
 	if name == "" {
 		return ErrDatabaseNameRequired
 	}
 	c := &createDatabaseCommand{Name: name}
-	_, err := s.broadcast(createDatabaseMessageType, c)
+	_, err := s.broadcast(createDatabaseMessageType, c, o)
 	return err
 }
 
@@ -994,11 +1088,15 @@ func (s *Server) applyCreateDatabase(m *messaging.Message) (err error) {
 
 // DropDatabase deletes an existing database.
 func (s *Server) DropDatabase(name string) error {
+	return s.dropDatabase(name, nil)
+}
+
+func (s *Server) dropDatabase(name string, o *commandOrigin) error {
 	if name == "" {
 		return ErrDatabaseNameRequired
 	}
 	c := &dropDatabaseCommand{Name: name}
-	_, err := s.broadcast(dropDatabaseMessageType, c)
+	_, err := s.broadcast(dropDatabaseMessageType, c, o)
 	return err
 }
 
@@ -1059,7 +1157,7 @@ func (s *Server) ShardGroups(database string) ([]*ShardGroup, error) {
 // CreateShardGroupIfNotExists creates the shard group for a retention policy for the interval a timestamp falls into.
 func (s *Server) CreateShardGroupIfNotExists(database, policy string, timestamp time.Time) error {
 	c := &createShardGroupIfNotExistsCommand{Database: database, Policy: policy, Timestamp: timestamp}
-	_, err := s.broadcast(createShardGroupIfNotExistsMessageType, c)
+	_, err := s.broadcast(createShardGroupIfNotExistsMessageType, c, nil)
 	return err
 }
 
@@ -1154,6 +1252,7 @@ func (s *Server) applyCreateShardGroupIfNotExists(m *messaging.Message) (err err
 		}
 
 		// Open shard store. Panic if an error occurs and we can retry.
+		sh.cache = s.QueryCache
 		if err := sh.open(s.shardPath(sh.ID), s.client.Conn(sh.ID)); err != nil {
 			panic("unable to open shard: " + err.Error())
 		}
@@ -1170,7 +1269,7 @@ func (s *Server) applyCreateShardGroupIfNotExists(m *messaging.Message) (err err
 // DeleteShardGroup deletes the shard group identified by shardID.
 func (s *Server) DeleteShardGroup(database, policy string, shardID uint64) error {
 	c := &deleteShardGroupCommand{Database: database, Policy: policy, ID: shardID}
-	_, err := s.broadcast(deleteShardGroupMessageType, c)
+	_, err := s.broadcast(deleteShardGroupMessageType, c, nil)
 	return err
 }
 
@@ -1260,7 +1359,9 @@ func (s *Server) AdminUserExists() bool {
 
 // Authenticate returns an authenticated user by username. If any error occurs,
 // or the authentication credentials are invalid, an error is returned.
-func (s *Server) Authenticate(username, password string) (*User, error) {
+// Failed logins are counted for the user and for the host of addr, and the user or the
+// host is locked out for a while once there are too many of them.
+func (s *Server) Authenticate(username, password, addr string) (*User, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -1270,20 +1371,137 @@ func (s *Server) Authenticate(username, password string) (*User, error) {
 	if u == nil && !s.authenticationEnabled {
 		return nil, nil
 	}
+
+	// Reject logins from locked out users and hosts, even with a valid password.
+	host := hostOf(addr)
+	now := time.Now()
+	if s.loginLocked(username, host, now) {
+		return nil, ErrLoginLocked
+	}
+
 	if u == nil {
+		s.addLoginFailure("", host, now)
 		return nil, fmt.Errorf("invalid username or password")
 	}
 	err := u.Authenticate(password)
 	if err != nil {
+		s.addLoginFailure(username, host, now)
 		return nil, fmt.Errorf("invalid username or password")
 	}
+	s.resetLoginFailures(username, host)
 	return u, nil
 }
 
+// loginLocked returns true if a user or a host is locked out.
+func (s *Server) loginLocked(username, host string, now time.Time) bool {
+	s.loginMu.Lock()
+	defer s.loginMu.Unlock()
+	return s.loginsByUser[username].locked(now) || s.loginsByHost[host].locked(now)
+}
+
+// addLoginFailure counts a failed login of a user from a host. Failed logins of
+// unknown users are only counted for the host.
+func (s *Server) addLoginFailure(username, host string, now time.Time) {
+	s.loginMu.Lock()
+	defer s.loginMu.Unlock()
+
+	if username != "" {
+		f := s.loginsByUser[username]
+		if f == nil {
+			f = &loginFailures{}
+			s.loginsByUser[username] = f
+		}
+		f.add(now, s.MaxFailedLogins, s.LoginLockout)
+	}
+
+	if host != "" {
+		// Forget hosts whose failed logins have expired so the map doesn't grow unbounded.
+		if len(s.loginsByHost) >= maxLoginHosts {
+			for h, f := range s.loginsByHost {
+				if f.expired(now, s.LoginLockout) {
+					delete(s.loginsByHost, h)
+				}
+			}
+		}
+
+		f := s.loginsByHost[host]
+		if f == nil {
+			f = &loginFailures{}
+			s.loginsByHost[host] = f
+		}
+		f.add(now, s.MaxFailedLoginsPerHost, s.LoginLockout)
+	}
+}
+
+// resetLoginFailures forgets the failed logins of a user and a host after a successful login.
+func (s *Server) resetLoginFailures(username, host string) {
+	s.loginMu.Lock()
+	defer s.loginMu.Unlock()
+	delete(s.loginsByUser, username)
+	delete(s.loginsByHost, host)
+}
+
+// LoginFailures returns the number of recent failed logins of a user and whether the
+// user is locked out.
+func (s *Server) LoginFailures(username string) (n int, locked bool) {
+	s.loginMu.Lock()
+	defer s.loginMu.Unlock()
+
+	f := s.loginsByUser[username]
+	if f == nil {
+		return 0, false
+	}
+	now := time.Now()
+	if f.expired(now, s.LoginLockout) {
+		return 0, false
+	}
+	return f.n, f.locked(now)
+}
+
+// UnlockUser forgets the failed logins of a user on every server, ending any lockout.
+func (s *Server) UnlockUser(username string) error {
+	return s.unlockUser(username, nil)
+}
+
+func (s *Server) unlockUser(username string, o *commandOrigin) error {
+	c := &unlockUserCommand{Username: username}
+	_, err := s.broadcast(unlockUserMessageType, c, o)
+	return err
+}
+
+func (s *Server) applyUnlockUser(m *messaging.Message) error {
+	var c unlockUserCommand
+	mustUnmarshalJSON(m.Data, &c)
+
+	// Validate user.
+	if c.Username == "" {
+		return ErrUsernameRequired
+	} else if s.users[c.Username] == nil {
+		return ErrUserNotFound
+	}
+
+	s.loginMu.Lock()
+	delete(s.loginsByUser, c.Username)
+	s.loginMu.Unlock()
+	return nil
+}
+
 // CreateUser creates a user on the server.
 func (s *Server) CreateUser(username, password string, admin bool) error {
+	return s.createUser(username, password, admin, nil)
+}
+
+func (s *Server) createUser(username, password string, admin bool, o *commandOrigin) error {
+	// The password is validated before it's broadcast so every server, and every
+	// replay of the command, applies it regardless of its own password policy.
+	if username == "" {
+		return ErrUsernameRequired
+	} else if err := s.PasswordPolicy.Validate(password); err != nil {
+		return err
+	}
+
 	c := &createUserCommand{Username: username, Password: password, Admin: admin}
-	_, err := s.broadcast(createUserMessageType, c)
+	_, err := s.broadcast(createUserMessageType, c, o)
 	return err
 }
 
@@ -1323,8 +1541,16 @@ func (s *Server) applyCreateUser(m *messaging.Message) (err error) {
 
 // UpdateUser updates an existing user on the server.
 func (s *Server) UpdateUser(username, password string) error {
+	return s.updateUser(username, password, nil)
+}
+
+func (s *Server) updateUser(username, password string, o *commandOrigin) error {
+	if err := s.PasswordPolicy.Validate(password); err != nil {
+		return err
+	}
+
 	c := &updateUserCommand{Username: username, Password: password}
-	_, err := s.broadcast(updateUserMessageType, c)
+	_, err := s.broadcast(updateUserMessageType, c, o)
 	return err
 }
 
@@ -1355,8 +1581,12 @@ func (s *Server) applyUpdateUser(m *messaging.Message) (err error) {
 
 // DeleteUser removes a user from the server.
 func (s *Server) DeleteUser(username string) error {
+	return s.deleteUser(username, nil)
+}
+
+func (s *Server) deleteUser(username string, o *commandOrigin) error {
 	c := &deleteUserCommand{Username: username}
-	_, err := s.broadcast(deleteUserMessageType, c)
+	_, err := s.broadcast(deleteUserMessageType, c, o)
 	return err
 }
 
@@ -1371,20 +1601,160 @@ func (s *Server) applyDeleteUser(m *messaging.Message) error {
 		return ErrUserNotFound
 	}
 
-	// Remove from metastore.
+	// Remove the user and its API tokens from metastore.
 	s.meta.mustUpdate(m.Index, func(tx *metatx) error {
+		for _, t := range s.tokens {
+			if t.Username == c.Username {
+				if err := tx.deleteToken(t.Name); err != nil {
+					return err
+				}
+			}
+		}
 		return tx.deleteUser(c.Username)
 	})
 
-	// Delete the user.
+	// Delete the user and its API tokens.
+	for _, t := range s.tokens {
+		if t.Username == c.Username {
+			delete(s.tokens, t.Name)
+			delete(s.hashes, t.Hash)
+		}
+	}
 	delete(s.users, c.Username)
 	return nil
 }
 
+// AuthenticateToken returns the user an API token authenticates as. The user
+// returned is limited to the privileges of the token.
+func (s *Server) AuthenticateToken(secret string) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t := s.hashes[hashToken(secret)]
+	if t == nil || t.Expired(time.Now()) {
+		return nil, ErrInvalidToken
+	}
+	u := s.users[t.Username]
+	if u == nil {
+		return nil, ErrInvalidToken
+	}
+
+	// Tokens with all privileges on every database don't restrict the user.
+	if t.Privilege == influxql.AllPrivileges && t.Database == "" {
+		return u, nil
+	}
+	other := *u
+	other.token = t
+	return &other, nil
+}
+
+// Token returns an API token by name.
+// Returns nil if the token does not exist.
+func (s *Server) Token(name string) *Token {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tokens[name]
+}
+
+// Tokens returns a list of all API tokens, sorted by name.
+func (s *Server) Tokens() (a []*Token) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, t := range s.tokens {
+		a = append(a, t)
+	}
+	sort.Sort(tokens(a))
+	return a
+}
+
+// CreateToken creates an API token authenticating as a user and returns its secret.
+// The token is limited to a privilege on a database, or on every database if database
+// is blank. A zero expiry means the token never expires.
+func (s *Server) CreateToken(name, username string, p influxql.Privilege, database string, expires time.Time) (string, error) {
+	return s.createToken(name, username, p, database, expires, nil)
+}
+
+func (s *Server) createToken(name, username string, p influxql.Privilege, database string, expires time.Time, o *commandOrigin) (string, error) {
+	// Generate the secret. Only its hash is broadcast and stored.
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	secret := hex.EncodeToString(b)
+
+	c := &createTokenCommand{Name: name, Username: username, Hash: hashToken(secret), Privilege: p, Database: database, Expires: expires}
+	if _, err := s.broadcast(createTokenMessageType, c, o); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+func (s *Server) applyCreateToken(m *messaging.Message) error {
+	var c createTokenCommand
+	mustUnmarshalJSON(m.Data, &c)
+
+	// Validate token.
+	if c.Name == "" {
+		return ErrTokenNameRequired
+	} else if s.tokens[c.Name] != nil {
+		return ErrTokenExists
+	} else if s.users[c.Username] == nil {
+		return ErrUserNotFound
+	}
+
+	// Persist to metastore.
+	t := &Token{Name: c.Name, Username: c.Username, Hash: c.Hash, Privilege: c.Privilege, Database: c.Database, Expires: c.Expires}
+	err := s.meta.mustUpdate(m.Index, func(tx *metatx) error {
+		return tx.saveToken(t)
+	})
+
+	s.tokens[t.Name] = t
+	s.hashes[t.Hash] = t
+	return err
+}
+
+// DropToken revokes an API token.
+func (s *Server) DropToken(name string) error {
+	return s.dropToken(name, nil)
+}
+
+func (s *Server) dropToken(name string, o *commandOrigin) error {
+	c := &dropTokenCommand{Name: name}
+	_, err := s.broadcast(dropTokenMessageType, c, o)
+	return err
+}
+
+func (s *Server) applyDropToken(m *messaging.Message) error {
+	var c dropTokenCommand
+	mustUnmarshalJSON(m.Data, &c)
+
+	// Validate token.
+	if c.Name == "" {
+		return ErrTokenNameRequired
+	}
+	t := s.tokens[c.Name]
+	if t == nil {
+		return ErrTokenNotFound
+	}
+
+	// Remove from metastore.
+	err := s.meta.mustUpdate(m.Index, func(tx *metatx) error {
+		return tx.deleteToken(c.Name)
+	})
+
+	delete(s.tokens, t.Name)
+	delete(s.hashes, t.Hash)
+	return err
+}
+
 // SetPrivilege grants / revokes a privilege to a user.
 func (s *Server) SetPrivilege(p influxql.Privilege, username string, dbname string) error {
+	return s.setPrivilege(p, username, dbname, nil)
+}
+
+func (s *Server) setPrivilege(p influxql.Privilege, username string, dbname string, o *commandOrigin) error {
 	c := &setPrivilegeCommand{p, username, dbname}
-	_, err := s.broadcast(setPrivilegeMessageType, c)
+	_, err := s.broadcast(setPrivilegeMessageType, c, o)
 	return err
 }
 
@@ -1418,6 +1788,199 @@ func (s *Server) applySetPrivilege(m *messaging.Message) error {
 	})
 }
 
+// Role returns a role by name.
+// Returns nil if the role does not exist.
+func (s *Server) Role(name string) *Role {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.roles[name]
+}
+
+// Roles returns a list of all roles, sorted by name.
+func (s *Server) Roles() (a []*Role) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, r := range s.roles {
+		a = append(a, r)
+	}
+	sort.Sort(roles(a))
+	return a
+}
+
+// CreateRole creates a role on the server.
+func (s *Server) CreateRole(name string) error {
+	return s.createRole(name, nil)
+}
+
+func (s *Server) createRole(name string, o *commandOrigin) error {
+	c := &createRoleCommand{Name: name}
+	_, err := s.broadcast(createRoleMessageType, c, o)
+	return err
+}
+
+func (s *Server) applyCreateRole(m *messaging.Message) error {
+	var c createRoleCommand
+	mustUnmarshalJSON(m.Data, &c)
+
+	// Validate role.
+	if c.Name == "" {
+		return ErrRoleNameRequired
+	} else if s.roles[c.Name] != nil {
+		return ErrRoleExists
+	}
+
+	// Persist to metastore.
+	r := &Role{Name: c.Name}
+	err := s.meta.mustUpdate(m.Index, func(tx *metatx) error {
+		return tx.saveRole(r)
+	})
+
+	s.roles[r.Name] = r
+	return err
+}
+
+// DropRole removes a role from the server and from every user it was granted to.
+func (s *Server) DropRole(name string) error {
+	return s.dropRole(name, nil)
+}
+
+func (s *Server) dropRole(name string, o *commandOrigin) error {
+	c := &dropRoleCommand{Name: name}
+	_, err := s.broadcast(dropRoleMessageType, c, o)
+	return err
+}
+
+func (s *Server) applyDropRole(m *messaging.Message) error {
+	var c dropRoleCommand
+	mustUnmarshalJSON(m.Data, &c)
+
+	// Validate role.
+	if c.Name == "" {
+		return ErrRoleNameRequired
+	} else if s.roles[c.Name] == nil {
+		return ErrRoleNotFound
+	}
+
+	// Find the users the role was granted to.
+	var users []*User
+	for _, u := range s.users {
+		if u.hasRole(c.Name) {
+			users = append(users, u)
+		}
+	}
+
+	// Remove from metastore.
+	err := s.meta.mustUpdate(m.Index, func(tx *metatx) error {
+		for _, u := range users {
+			u.removeRole(c.Name)
+			if err := tx.saveUser(u); err != nil {
+				return err
+			}
+		}
+		return tx.deleteRole(c.Name)
+	})
+
+	// Delete the role.
+	delete(s.roles, c.Name)
+	return err
+}
+
+// SetRolePrivilege grants / revokes a privilege on a database to a role. The privilege
+// is limited to the measurements matching measurement, if set.
+func (s *Server) SetRolePrivilege(p influxql.Privilege, role, database string, measurement *Matcher) error {
+	return s.setRolePrivilege(p, role, database, measurement, nil)
+}
+
+func (s *Server) setRolePrivilege(p influxql.Privilege, role, database string, measurement *Matcher, o *commandOrigin) error {
+	c := &setRolePrivilegeCommand{Privilege: p, Role: role, Database: database, Measurement: measurement}
+	_, err := s.broadcast(setRolePrivilegeMessageType, c, o)
+	return err
+}
+
+func (s *Server) applySetRolePrivilege(m *messaging.Message) error {
+	var c setRolePrivilegeCommand
+	mustUnmarshalJSON(m.Data, &c)
+
+	// Validate role.
+	if c.Role == "" {
+		return ErrRoleNameRequired
+	}
+
+	r := s.roles[c.Role]
+	if r == nil {
+		return ErrRoleNotFound
+	}
+
+	// Roles can't be given cluster admin.
+	if c.Database == "" {
+		return ErrInvalidGrantRevoke
+	}
+
+	// Replace or remove an existing grant on the same measurements.
+	r.setGrant(&Grant{Privilege: c.Privilege, Database: c.Database, Measurement: c.Measurement})
+
+	// Persist to metastore.
+	return s.meta.mustUpdate(m.Index, func(tx *metatx) error {
+		return tx.saveRole(r)
+	})
+}
+
+// GrantRole gives a user the privileges of a role.
+func (s *Server) GrantRole(role, username string) error {
+	return s.grantRole(role, username, nil)
+}
+
+func (s *Server) grantRole(role, username string, o *commandOrigin) error {
+	c := &userRoleCommand{Role: role, Username: username}
+	_, err := s.broadcast(grantRoleMessageType, c, o)
+	return err
+}
+
+// RevokeRole removes a role from a user.
+func (s *Server) RevokeRole(role, username string) error {
+	return s.revokeRole(role, username, nil)
+}
+
+func (s *Server) revokeRole(role, username string, o *commandOrigin) error {
+	c := &userRoleCommand{Role: role, Username: username}
+	_, err := s.broadcast(revokeRoleMessageType, c, o)
+	return err
+}
+
+func (s *Server) applyUserRole(m *messaging.Message) error {
+	var c userRoleCommand
+	mustUnmarshalJSON(m.Data, &c)
+
+	// Validate user and role.
+	if c.Username == "" {
+		return ErrUsernameRequired
+	} else if c.Role == "" {
+		return ErrRoleNameRequired
+	}
+
+	u := s.users[c.Username]
+	if u == nil {
+		return ErrUserNotFound
+	} else if s.roles[c.Role] == nil {
+		return ErrRoleNotFound
+	}
+
+	// Update the user's roles.
+	if m.Type == grantRoleMessageType {
+		if !u.hasRole(c.Role) {
+			u.Roles = append(u.Roles, c.Role)
+			sort.Strings(u.Roles)
+		}
+	} else {
+		u.removeRole(c.Role)
+	}
+
+	// Persist to metastore.
+	return s.meta.mustUpdate(m.Index, func(tx *metatx) error {
+		return tx.saveUser(u)
+	})
+}
+
 // RetentionPolicy returns a retention policy by name.
 // Returns an error if the database doesn't exist.
 func (s *Server) RetentionPolicy(database, name string) (*RetentionPolicy, error) {
@@ -1478,6 +2041,10 @@ func (s *Server) RetentionPolicyExists(database, retention string) bool {
 
 // CreateRetentionPolicy creates a retention policy for a database.
 func (s *Server) CreateRetentionPolicy(database string, rp *RetentionPolicy) error {
+	return s.createRetentionPolicy(database, rp, nil)
+}
+
+func (s *Server) createRetentionPolicy(database string, rp *RetentionPolicy, o *commandOrigin) error {
 	// Enforce duration of at least retentionPolicyMinDuration
 	if rp.Duration < retentionPolicyMinDuration && rp.Duration != 0 {
 		return ErrRetentionPolicyMinDuration
@@ -1490,7 +2057,7 @@ func (s *Server) CreateRetentionPolicy(database string, rp *RetentionPolicy) err
 		ShardGroupDuration: calculateShardGroupDuration(rp.Duration),
 		ReplicaN:           rp.ReplicaN,
 	}
-	_, err := s.broadcast(createRetentionPolicyMessageType, c)
+	_, err := s.broadcast(createRetentionPolicyMessageType, c, o)
 	return err
 }
 
@@ -1562,13 +2129,17 @@ type RetentionPolicyUpdate struct {
 
 // UpdateRetentionPolicy updates an existing retention policy on a database.
 func (s *Server) UpdateRetentionPolicy(database, name string, rpu *RetentionPolicyUpdate) error {
+	return s.updateRetentionPolicy(database, name, rpu, nil)
+}
+
+func (s *Server) updateRetentionPolicy(database, name string, rpu *RetentionPolicyUpdate, o *commandOrigin) error {
 	// Enforce duration of at least retentionPolicyMinDuration
 	if rpu.Duration != nil && *rpu.Duration < retentionPolicyMinDuration && *rpu.Duration != 0 {
 		return ErrRetentionPolicyMinDuration
 	}
 
 	c := &updateRetentionPolicyCommand{Database: database, Name: name, Policy: rpu}
-	_, err := s.broadcast(updateRetentionPolicyMessageType, c)
+	_, err := s.broadcast(updateRetentionPolicyMessageType, c, o)
 	return err
 }
 
@@ -1617,8 +2188,12 @@ func (s *Server) applyUpdateRetentionPolicy(m *messaging.Message) (err error) {
 
 // DeleteRetentionPolicy removes a retention policy from a database.
 func (s *Server) DeleteRetentionPolicy(database, name string) error {
+	return s.deleteRetentionPolicy(database, name, nil)
+}
+
+func (s *Server) deleteRetentionPolicy(database, name string, o *commandOrigin) error {
 	c := &deleteRetentionPolicyCommand{Database: database, Name: name}
-	_, err := s.broadcast(deleteRetentionPolicyMessageType, c)
+	_, err := s.broadcast(deleteRetentionPolicyMessageType, c, o)
 	return err
 }
 
@@ -1649,8 +2224,12 @@ func (s *Server) applyDeleteRetentionPolicy(m *messaging.Message) (err error) {
 
 // SetDefaultRetentionPolicy sets the default policy to write data into and query from on a database.
 func (s *Server) SetDefaultRetentionPolicy(database, name string) error {
+	return s.setDefaultRetentionPolicy(database, name, nil)
+}
+
+func (s *Server) setDefaultRetentionPolicy(database, name string, o *commandOrigin) error {
 	c := &setDefaultRetentionPolicyCommand{Database: database, Name: name}
-	_, err := s.broadcast(setDefaultRetentionPolicyMessageType, c)
+	_, err := s.broadcast(setDefaultRetentionPolicyMessageType, c, o)
 	return err
 }
 
@@ -1707,8 +2286,12 @@ func (s *Server) applyDropSeries(m *messaging.Message) error {
 
 // DropSeries deletes from an existing series.
 func (s *Server) DropSeries(database string, seriesByMeasurement map[string][]uint64) error {
+	return s.dropSeries(database, seriesByMeasurement, nil)
+}
+
+func (s *Server) dropSeries(database string, seriesByMeasurement map[string][]uint64, o *commandOrigin) error {
 	c := dropSeriesCommand{Database: database, SeriesByMeasurement: seriesByMeasurement}
-	_, err := s.broadcast(dropSeriesMessageType, c)
+	_, err := s.broadcast(dropSeriesMessageType, c, o)
 	return err
 }
 
@@ -1905,7 +2488,7 @@ func (s *Server) createMeasurementsIfNotExists(database, retentionPolicy string,
 
 	// Any broadcast actually required?
 	if len(c.Measurements) > 0 {
-		_, err := s.broadcast(createMeasurementsIfNotExistsMessageType, c)
+		_, err := s.broadcast(createMeasurementsIfNotExistsMessageType, c, nil)
 		if err != nil {
 			return err
 		}
@@ -1979,8 +2562,12 @@ func (s *Server) applyCreateMeasurementsIfNotExists(m *messaging.Message) error
 
 // DropMeasurement drops a given measurement from a database.
 func (s *Server) DropMeasurement(database, name string) error {
+	return s.dropMeasurement(database, name, nil)
+}
+
+func (s *Server) dropMeasurement(database, name string, o *commandOrigin) error {
 	c := &dropMeasurementCommand{Database: database, Name: name}
-	_, err := s.broadcast(dropMeasurementMessageType, c)
+	_, err := s.broadcast(dropMeasurementMessageType, c, o)
 	return err
 }
 
@@ -2108,17 +2695,23 @@ func (s *Server) ReadSeries(database, retentionPolicy, name string, tags map[str
 // ExecuteQuery executes an InfluxQL query against the server.
 // If the user isn't authorized to access the database an error will be returned.
 // It sends results down the passed in chan and closes it when done. It will close the chan
-// on the first statement that throws an error.
-func (s *Server) ExecuteQuery(q *influxql.Query, database string, user *User, chunkSize int) (chan *Result, error) {
+// on the first statement that throws an error. Bound parameters in the statements are
+// replaced by their values in params. The address the query was sent from, if any, is
+// written to the audit log along with the user.
+func (s *Server) ExecuteQuery(q *influxql.Query, database string, params map[string]interface{}, user *User, addr string, chunkSize int) (chan *Result, error) {
 	// Authorize user to execute the query.
 	if s.authenticationEnabled {
 		if err := s.Authorize(user, q, database); err != nil {
+			s.auditAuthorization(q, database, user, addr, err)
 			return nil, err
 		}
 	}
 
 	s.stats.Add("queriesRx", int64(len(q.Statements)))
 
+	// Commands broadcast by the statements carry the user and address to the audit log.
+	origin := newCommandOrigin(user, addr)
+
 	// Execute each statement. Keep the iterator external so we can
 	// track how many of the statements were executed
 	results := make(chan *Result)
@@ -2136,6 +2729,12 @@ func (s *Server) ExecuteQuery(q *influxql.Query, database string, user *User, ch
 
 			}
 
+			// Replace bound parameters with their values before normalizing the statement.
+			if err := influxql.BindParams(stmt, params); err != nil {
+				results <- &Result{Err: err}
+				break
+			}
+
 			// If we have a default database, normalize the statement with it.
 			if defaultDB != "" {
 				if err := s.NormalizeStatement(stmt, defaultDB); err != nil {
@@ -2145,36 +2744,42 @@ func (s *Server) ExecuteQuery(q *influxql.Query, database string, user *User, ch
 			}
 
 			var res *Result
+			var plan selectPlanStats
+			start := time.Now()
 			switch stmt := stmt.(type) {
 			case *influxql.SelectStatement:
-				if err := s.executeSelectStatement(i, stmt, database, user, results, chunkSize); err != nil {
+				err := s.executeSelectStatement(i, stmt, database, user, results, chunkSize, &plan)
+				s.auditStatement(stmt, defaultDB, user, addr, err)
+				if err != nil {
 					results <- &Result{Err: err}
 					break
 				}
+			case *influxql.ExplainStatement:
+				res = s.executeExplainStatement(stmt, user, chunkSize)
 			case *influxql.CreateDatabaseStatement:
-				res = s.executeCreateDatabaseStatement(stmt, user)
+				res = s.executeCreateDatabaseStatement(stmt, user, origin)
 			case *influxql.DropDatabaseStatement:
-				res = s.executeDropDatabaseStatement(stmt, user)
+				res = s.executeDropDatabaseStatement(stmt, user, origin)
 			case *influxql.ShowDatabasesStatement:
 				res = s.executeShowDatabasesStatement(stmt, user)
 			case *influxql.ShowServersStatement:
 				res = s.executeShowServersStatement(stmt, user)
 			case *influxql.CreateUserStatement:
-				res = s.executeCreateUserStatement(stmt, user)
+				res = s.executeCreateUserStatement(stmt, user, origin)
 			case *influxql.SetPasswordUserStatement:
-				res = s.executeSetPasswordUserStatement(stmt, user)
+				res = s.executeSetPasswordUserStatement(stmt, user, origin)
 			case *influxql.DeleteStatement:
 				res = s.executeDeleteStatement()
 			case *influxql.DropUserStatement:
-				res = s.executeDropUserStatement(stmt, user)
+				res = s.executeDropUserStatement(stmt, user, origin)
 			case *influxql.ShowUsersStatement:
 				res = s.executeShowUsersStatement(stmt, user)
 			case *influxql.DropSeriesStatement:
-				res = s.executeDropSeriesStatement(stmt, database, user)
+				res = s.executeDropSeriesStatement(stmt, database, user, origin)
 			case *influxql.ShowSeriesStatement:
 				res = s.executeShowSeriesStatement(stmt, database, user)
 			case *influxql.DropMeasurementStatement:
-				res = s.executeDropMeasurementStatement(stmt, database, user)
+				res = s.executeDropMeasurementStatement(stmt, database, user, origin)
 			case *influxql.ShowMeasurementsStatement:
 				res = s.executeShowMeasurementsStatement(stmt, database, user)
 			case *influxql.ShowTagKeysStatement:
@@ -2188,19 +2793,39 @@ func (s *Server) ExecuteQuery(q *influxql.Query, database string, user *User, ch
 			case *influxql.ShowDiagnosticsStatement:
 				res = s.executeShowDiagnosticsStatement(stmt, user)
 			case *influxql.GrantStatement:
-				res = s.executeGrantStatement(stmt, user)
+				res = s.executeGrantStatement(stmt, user, origin)
 			case *influxql.RevokeStatement:
-				res = s.executeRevokeStatement(stmt, user)
+				res = s.executeRevokeStatement(stmt, user, origin)
+			case *influxql.CreateRoleStatement:
+				res = s.executeCreateRoleStatement(stmt, user, origin)
+			case *influxql.DropRoleStatement:
+				res = s.executeDropRoleStatement(stmt, user, origin)
+			case *influxql.GrantRoleStatement:
+				res = s.executeGrantRoleStatement(stmt, user, origin)
+			case *influxql.RevokeRoleStatement:
+				res = s.executeRevokeRoleStatement(stmt, user, origin)
+			case *influxql.ShowRolesStatement:
+				res = s.executeShowRolesStatement(stmt, user)
+			case *influxql.ShowGrantsForUserStatement:
+				res = s.executeShowGrantsForUserStatement(stmt, user)
+			case *influxql.UnlockUserStatement:
+				res = s.executeUnlockUserStatement(stmt, user, origin)
+			case *influxql.CreateTokenStatement:
+				res = s.executeCreateTokenStatement(stmt, user, origin)
+			case *influxql.DropTokenStatement:
+				res = s.executeDropTokenStatement(stmt, user, origin)
+			case *influxql.ShowTokensStatement:
+				res = s.executeShowTokensStatement(stmt, user)
 			case *influxql.CreateRetentionPolicyStatement:
-				res = s.executeCreateRetentionPolicyStatement(stmt, user)
+				res = s.executeCreateRetentionPolicyStatement(stmt, user, origin)
 			case *influxql.AlterRetentionPolicyStatement:
-				res = s.executeAlterRetentionPolicyStatement(stmt, user)
+				res = s.executeAlterRetentionPolicyStatement(stmt, user, origin)
 			case *influxql.DropRetentionPolicyStatement:
-				res = s.executeDropRetentionPolicyStatement(stmt, user)
+				res = s.executeDropRetentionPolicyStatement(stmt, user, origin)
 			case *influxql.ShowRetentionPoliciesStatement:
 				res = s.executeShowRetentionPoliciesStatement(stmt, user)
 			case *influxql.CreateContinuousQueryStatement:
-				res = s.executeCreateContinuousQueryStatement(stmt, user)
+				res = s.executeCreateContinuousQueryStatement(stmt, user, origin)
 			case *influxql.DropContinuousQueryStatement:
 				continue
 			case *influxql.ShowContinuousQueriesStatement:
@@ -2209,7 +2834,13 @@ func (s *Server) ExecuteQuery(q *influxql.Query, database string, user *User, ch
 				panic(fmt.Sprintf("unsupported statement type: %T", stmt))
 			}
 
+			if d := time.Since(start); s.SlowQueryThreshold > 0 && d >= s.SlowQueryThreshold {
+				s.logSlowQuery(stmt, defaultDB, user, d, &plan)
+			}
+
 			if res != nil {
+				s.auditStatement(stmt, defaultDB, user, addr, res.Err)
+
 				// set the StatementID for the handler on the other side to combine results
 				res.StatementID = i
 
@@ -2234,13 +2865,34 @@ func (s *Server) ExecuteQuery(q *influxql.Query, database string, user *User, ch
 }
 
 // executeSelectStatement plans and executes a select statement against a database.
-func (s *Server) executeSelectStatement(statementID int, stmt *influxql.SelectStatement, database string, user *User, results chan *Result, chunkSize int) error {
+func (s *Server) executeSelectStatement(statementID int, stmt *influxql.SelectStatement, database string, user *User, results chan *Result, chunkSize int, plan *selectPlanStats) error {
 	// Perform any necessary query re-writing.
 	stmt, err := s.rewriteSelectStatement(stmt)
 	if err != nil {
 		return err
 	}
 
+	// Ensure the user can read each measurement.
+	if err := s.authorizeSources(user, stmt); err != nil {
+		return err
+	}
+
+	// Aggregates grouped by time can reuse the intervals of earlier executions.
+	if s.QueryCache != nil {
+		rows, ok, err := s.executeCachedSelectStatement(stmt, chunkSize, plan)
+		if err != nil {
+			return err
+		} else if ok {
+			for _, row := range rows {
+				results <- &Result{StatementID: statementID, Series: []*influxql.Row{row}}
+			}
+			if len(rows) == 0 {
+				results <- &Result{StatementID: statementID, Series: make([]*influxql.Row, 0)}
+			}
+			return nil
+		}
+	}
+
 	// Plan statement execution.
 	e, err := s.planSelectStatement(stmt, chunkSize)
 	if err != nil {
@@ -2251,31 +2903,254 @@ func (s *Server) executeSelectStatement(statementID int, stmt *influxql.SelectSt
 	ch := e.Execute()
 
 	// Stream results from the channel. We should send an empty result if nothing comes through.
+	// After an error the rest of the rows are drained, so the plan has finished when it's described.
 	resultSent := false
 	for row := range ch {
-		if row.Err != nil {
-			return row.Err
+		if err != nil {
+			continue
+		} else if row.Err != nil {
+			err = row.Err
 		} else {
 			resultSent = true
 			results <- &Result{StatementID: statementID, Series: []*influxql.Row{row}}
 		}
 	}
+	plan.add(e)
 
-	if !resultSent {
+	if err != nil {
+		return err
+	} else if !resultSent {
 		results <- &Result{StatementID: statementID, Series: make([]*influxql.Row, 0)}
 	}
 
 	return nil
 }
 
+// selectPlanStats describes the plans executed for a select statement.
+type selectPlanStats struct {
+	series        int
+	shards        int
+	pointsScanned int
+	remoteMappers int
+}
+
+// add adds the series, shards and mappers of an executed plan.
+func (p *selectPlanStats) add(e *influxql.Executor) {
+	shards := make(map[uint64]struct{})
+	for _, j := range e.Jobs() {
+		p.series += len(j.TagSet.SeriesIDs)
+		for _, m := range j.Mappers {
+			switch m := m.(type) {
+			case *LocalMapper:
+				shards[m.shardID] = struct{}{}
+				p.pointsScanned += m.pointsScanned
+			case *RemoteMapper:
+				shards[m.ShardID] = struct{}{}
+				p.remoteMappers++
+			}
+		}
+	}
+	p.shards += len(shards)
+}
+
+// logSlowQuery logs a statement that ran for at least the slow query threshold
+// and writes it to the self-monitoring database, if self-monitoring is started.
+func (s *Server) logSlowQuery(stmt influxql.Statement, database string, user *User, d time.Duration, plan *selectPlanStats) {
+	stmt = redactStatement(stmt)
+
+	var username string
+	if user != nil {
+		username = user.Name
+	}
+	s.Logger.Printf("slow query: %s (user=%q database=%q duration=%s series=%d shards=%d points-scanned=%d remote-mappers=%d)",
+		stmt.String(), username, database, d, plan.series, plan.shards, plan.pointsScanned, plan.remoteMappers)
+
+	s.mu.RLock()
+	monitoringDatabase, monitoringRetention := s.monitoringDatabase, s.monitoringRetention
+	s.mu.RUnlock()
+	if monitoringDatabase == "" {
+		return
+	}
+
+	p := Point{
+		Name: "slow_queries",
+		Tags: map[string]string{
+			"serverID": strconv.FormatUint(s.ID(), 10),
+			"database": database,
+			"user":     username,
+		},
+		Timestamp: time.Now(),
+		Fields: map[string]interface{}{
+			"statement":     stmt.String(),
+			"duration":      int64(d),
+			"seriesCount":   int64(plan.series),
+			"shardCount":    int64(plan.shards),
+			"pointsScanned": int64(plan.pointsScanned),
+			"remoteMappers": int64(plan.remoteMappers),
+		},
+	}
+	if _, err := s.WriteSeries(monitoringDatabase, monitoringRetention, []Point{p}); err != nil {
+		s.Logger.Printf("failed to write slow query: %s", err)
+	}
+}
+
+// executeExplainStatement plans a select statement and describes the plan. If the statement is
+// analyzed then each MapReduceJob of the plan is also run and timed.
+func (s *Server) executeExplainStatement(stmt *influxql.ExplainStatement, user *User, chunkSize int) *Result {
+	start := time.Now()
+
+	// Perform any necessary query re-writing.
+	sel, err := s.rewriteSelectStatement(stmt.Statement)
+	if err != nil {
+		return &Result{Err: err}
+	}
+	if err := s.authorizeSources(user, sel); err != nil {
+		return &Result{Err: err}
+	}
+
+	// Plan statement execution.
+	e, err := s.planSelectStatement(sel, chunkSize)
+	if err != nil {
+		return &Result{Err: err}
+	}
+	planningTime := time.Since(start)
+
+	row := &influxql.Row{Columns: []string{"QUERY PLAN"}}
+	add := func(format string, args ...interface{}) {
+		row.Values = append(row.Values, []interface{}{fmt.Sprintf(format, args...)})
+	}
+
+	add("STATEMENT: %s", sel.String())
+
+	// Describe the map and reduce functions of each aggregate.
+	if calls := sel.FunctionCalls(); len(calls) == 0 {
+		add("MAP: %s", funcName(influxql.MapRawQuery))
+	} else {
+		for _, c := range calls {
+			mapFunc, err := influxql.InitializeMapFunc(c)
+			if err != nil {
+				return &Result{Err: err}
+			}
+			reduceFunc, err := influxql.InitializeReduceFunc(c)
+			if err != nil {
+				return &Result{Err: err}
+			}
+			add("CALL: %s MAP: %s REDUCE: %s", c.String(), funcName(mapFunc), funcName(reduceFunc))
+		}
+	}
+
+	jobs := e.Jobs()
+	var executionTime time.Duration
+	var pointsScanned, pointsReturned int
+	for _, j := range jobs {
+		add("TAG SET: %s", tagSetString(j.TagSet))
+		add("  MEASUREMENT: %s", j.MeasurementName)
+		add("  TIME RANGE: %s - %s", time.Unix(0, j.TMin).UTC().Format(time.RFC3339Nano), time.Unix(0, j.TMax).UTC().Format(time.RFC3339Nano))
+		add("  SERIES: %d", len(j.TagSet.SeriesIDs))
+		for _, m := range j.Mappers {
+			switch m := m.(type) {
+			case *LocalMapper:
+				add("  SHARD %d: local, %d series", m.shardID, len(m.seriesIDs))
+			case *RemoteMapper:
+				add("  SHARD %d: remote %s, %d series", m.ShardID, m.dataNodes[0].URL.String(), len(m.SeriesIDs))
+			default:
+				add("  MAPPER: in-memory")
+			}
+		}
+
+		if !stmt.Analyze {
+			continue
+		}
+
+		// Run the job and count the points it returns.
+		jobStart := time.Now()
+		ch := make(chan *influxql.Row)
+		go func(j *influxql.MapReduceJob) {
+			j.Execute(ch, len(jobs) > 1)
+			close(ch)
+		}(j)
+
+		var returned int
+		for r := range ch {
+			if r.Err != nil && err == nil {
+				err = r.Err
+			}
+			returned += len(r.Values)
+		}
+		if err != nil {
+			return &Result{Err: err}
+		}
+		jobTime := time.Since(jobStart)
+
+		// Only local mappers know how many points they read.
+		var scanned int
+		for _, m := range j.Mappers {
+			if m, ok := m.(*LocalMapper); ok {
+				scanned += m.pointsScanned
+			}
+		}
+
+		add("  EXECUTION TIME: %s", jobTime)
+		add("  POINTS SCANNED: %d", scanned)
+		add("  POINTS RETURNED: %d", returned)
+
+		executionTime += jobTime
+		pointsScanned += scanned
+		pointsReturned += returned
+	}
+
+	add("PLANNING TIME: %s", planningTime)
+	if stmt.Analyze {
+		add("EXECUTION TIME: %s", executionTime)
+		add("POINTS SCANNED: %d", pointsScanned)
+		add("POINTS RETURNED: %d", pointsReturned)
+	}
+
+	return &Result{Series: []*influxql.Row{row}}
+}
+
+// tagSetString returns the tag values of a tag set in key order, e.g. host=serverA,region=west.
+func tagSetString(t *influxql.TagSet) string {
+	if len(t.Tags) == 0 {
+		return "*"
+	}
+
+	keys := make([]string, 0, len(t.Tags))
+	for k := range t.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + t.Tags[k]
+	}
+	return strings.Join(pairs, ",")
+}
+
+// funcName returns the name of a map or reduce function without its package, e.g. MapMean.
+func funcName(fn interface{}) string {
+	name := runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name()
+	name = name[strings.LastIndex(name, "/")+1:]
+	name = strings.TrimPrefix(name, "influxql.")
+
+	// functions returned by closures are named after the function that created them
+	if i := strings.Index(name, ".func"); i != -1 {
+		name = name[:i]
+	}
+	return name
+}
+
 // rewriteSelectStatement performs any necessary query re-writing.
 func (s *Server) rewriteSelectStatement(stmt *influxql.SelectStatement) (*influxql.SelectStatement, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	return s.expandSelectStatement(stmt)
+}
 
-	var err error
-
-	// Expand regex expressions in the FROM clause.
+// expandSelectStatement expands the regexes, subqueries and wildcards of a select statement.
+func (s *Server) expandSelectStatement(stmt *influxql.SelectStatement) (*influxql.SelectStatement, error) {
+	// Expand regex expressions and subqueries in the FROM clause.
 	sources, err := s.expandSources(stmt.Sources)
 	if err != nil {
 		return nil, err
@@ -2310,6 +3185,26 @@ func (s *Server) expandWildcards(stmt *influxql.SelectStatement) (*influxql.Sele
 
 	// Iterate measurements in the FROM clause getting the fields & dimensions for each.
 	for _, src := range stmt.Sources {
+		// A subquery's fields and dimensions are the columns and tags of the rows it returns.
+		if sq, ok := src.(*influxql.SubQuery); ok {
+			_, tags, err := sq.Statement.Dimensions.Normalize()
+			if err != nil {
+				return nil, err
+			}
+			for _, f := range sq.Statement.Fields {
+				if _, ok := fieldSet[f.Name()]; !ok {
+					fieldSet[f.Name()] = struct{}{}
+					fields = append(fields, &influxql.Field{Expr: &influxql.VarRef{Val: f.Name()}})
+				}
+			}
+			for _, t := range tags {
+				if _, ok := dimensionSet[t]; !ok {
+					dimensionSet[t] = struct{}{}
+					dimensions = append(dimensions, &influxql.Dimension{Expr: &influxql.VarRef{Val: t}})
+				}
+			}
+		}
+
 		if m, ok := src.(*influxql.Measurement); ok {
 			// Lookup the database.
 			db, ok := s.databases[m.Database]
@@ -2390,6 +3285,18 @@ func (s *Server) expandSources(sources influxql.Sources) (influxql.Sources, erro
 				}
 			}
 
+		case *influxql.SubQuery:
+			// Expand the subquery's own sources and wildcards.
+			stmt, err := s.expandSelectStatement(src.Statement)
+			if err != nil {
+				return nil, err
+			}
+			src.Statement = stmt
+
+			name := src.String()
+			set[name] = src
+			names = append(names, name)
+
 		default:
 			return nil, fmt.Errorf("expandSources: unsuported source type: %T", source)
 		}
@@ -2414,16 +3321,19 @@ func (s *Server) planSelectStatement(stmt *influxql.SelectStatement, chunkSize i
 
 	// Plan query.
 	p := influxql.NewPlanner(s)
+	p.MaxSeries = s.MaxSeriesPerQuery
+	p.MaxBuckets = s.MaxGroupByBuckets
+	p.Timeout = s.QueryTimeout
 
 	return p.Plan(stmt, chunkSize)
 }
 
-func (s *Server) executeCreateDatabaseStatement(q *influxql.CreateDatabaseStatement, user *User) *Result {
-	return &Result{Err: s.CreateDatabase(q.Name)}
+func (s *Server) executeCreateDatabaseStatement(q *influxql.CreateDatabaseStatement, user *User, o *commandOrigin) *Result {
+	return &Result{Err: s.createDatabase(q.Name, o)}
 }
 
-func (s *Server) executeDropDatabaseStatement(q *influxql.DropDatabaseStatement, user *User) *Result {
-	return &Result{Err: s.DropDatabase(q.Name)}
+func (s *Server) executeDropDatabaseStatement(q *influxql.DropDatabaseStatement, user *User, o *commandOrigin) *Result {
+	return &Result{Err: s.dropDatabase(q.Name, o)}
 }
 
 func (s *Server) executeShowDatabasesStatement(q *influxql.ShowDatabasesStatement, user *User) *Result {
@@ -2442,27 +3352,27 @@ func (s *Server) executeShowServersStatement(q *influxql.ShowServersStatement, u
 	return &Result{Series: []*influxql.Row{row}}
 }
 
-func (s *Server) executeCreateUserStatement(q *influxql.CreateUserStatement, user *User) *Result {
+func (s *Server) executeCreateUserStatement(q *influxql.CreateUserStatement, user *User, o *commandOrigin) *Result {
 	isAdmin := false
 	if q.Privilege != nil {
 		isAdmin = *q.Privilege == influxql.AllPrivileges
 	}
-	return &Result{Err: s.CreateUser(q.Name, q.Password, isAdmin)}
+	return &Result{Err: s.createUser(q.Name, q.Password, isAdmin, o)}
 }
 
-func (s *Server) executeSetPasswordUserStatement(q *influxql.SetPasswordUserStatement, user *User) *Result {
-	return &Result{Err: s.UpdateUser(q.Name, q.Password)}
+func (s *Server) executeSetPasswordUserStatement(q *influxql.SetPasswordUserStatement, user *User, o *commandOrigin) *Result {
+	return &Result{Err: s.updateUser(q.Name, q.Password, o)}
 }
 
-func (s *Server) executeDropUserStatement(q *influxql.DropUserStatement, user *User) *Result {
-	return &Result{Err: s.DeleteUser(q.Name)}
+func (s *Server) executeDropUserStatement(q *influxql.DropUserStatement, user *User, o *commandOrigin) *Result {
+	return &Result{Err: s.deleteUser(q.Name, o)}
 }
 
-func (s *Server) executeDropMeasurementStatement(stmt *influxql.DropMeasurementStatement, database string, user *User) *Result {
-	return &Result{Err: s.DropMeasurement(database, stmt.Name)}
+func (s *Server) executeDropMeasurementStatement(stmt *influxql.DropMeasurementStatement, database string, user *User, o *commandOrigin) *Result {
+	return &Result{Err: s.dropMeasurement(database, stmt.Name, o)}
 }
 
-func (s *Server) executeDropSeriesStatement(stmt *influxql.DropSeriesStatement, database string, user *User) *Result {
+func (s *Server) executeDropSeriesStatement(stmt *influxql.DropSeriesStatement, database string, user *User, o *commandOrigin) *Result {
 	s.mu.RLock()
 
 	seriesByMeasurement := make(map[string][]uint64)
@@ -2477,7 +3387,7 @@ func (s *Server) executeDropSeriesStatement(stmt *influxql.DropSeriesStatement,
 		}
 
 		s.mu.RUnlock()
-		return &Result{Err: s.DropSeries(database, seriesByMeasurement)}
+		return &Result{Err: s.dropSeries(database, seriesByMeasurement, o)}
 	}
 
 	// Handle the more complicated `DROP SERIES` with sources and/or conditions...
@@ -2513,7 +3423,7 @@ func (s *Server) executeDropSeriesStatement(stmt *influxql.DropSeriesStatement,
 	}
 	s.mu.RUnlock()
 
-	return &Result{Err: s.DropSeries(database, seriesByMeasurement)}
+	return &Result{Err: s.dropSeries(database, seriesByMeasurement, o)}
 }
 
 func (s *Server) executeShowSeriesStatement(stmt *influxql.ShowSeriesStatement, database string, user *User) *Result {
@@ -2814,6 +3724,36 @@ func (s *Server) executeShowContinuousQueriesStatement(stmt *influxql.ShowContin
 	return &Result{Series: rows}
 }
 
+// RegisterStats adds the stats of another component, such as the HTTP handler, to
+// the stats returned by SHOW STATS and written by self-monitoring.
+func (s *Server) RegisterStats(st *Stats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.otherStats = append(s.otherStats, st)
+}
+
+// registeredStats returns the stats registered by other components.
+func (s *Server) registeredStats() []*Stats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.otherStats
+}
+
+// RegisterDiagnostics adds the diagnostics of another component, such as a broker
+// running in the same process, to the rows returned by SHOW DIAGNOSTICS and written
+// by self-monitoring.
+func (s *Server) RegisterDiagnostics(measurement string, d Diagnostics) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.otherDiags = append(s.otherDiags, registeredDiagnostics{measurement: measurement, diags: d})
+}
+
+// registeredDiagnostics is the diagnostics of another component and the measurement they're reported as.
+type registeredDiagnostics struct {
+	measurement string
+	diags       Diagnostics
+}
+
 func (s *Server) executeShowStatsStatement(stmt *influxql.ShowStatsStatement, user *User) *Result {
 	var rows []*influxql.Row
 	// Server stats.
@@ -2825,6 +3765,26 @@ func (s *Server) executeShowStatsStatement(stmt *influxql.ShowStatsStatement, us
 	})
 	rows = append(rows, serverRow)
 
+	// Query cache stats.
+	if s.QueryCache != nil {
+		row := &influxql.Row{Name: s.QueryCache.stats.Name(), Columns: []string{}}
+		s.QueryCache.stats.Walk(func(k string, v int64) {
+			row.Columns = append(row.Columns, k)
+			row.Values = append(row.Values, []interface{}{v})
+		})
+		rows = append(rows, row)
+	}
+
+	// Stats registered by other components.
+	for _, st := range s.registeredStats() {
+		row := &influxql.Row{Name: st.Name(), Columns: []string{}}
+		st.Walk(func(k string, v int64) {
+			row.Columns = append(row.Columns, k)
+			row.Values = append(row.Values, []interface{}{v})
+		})
+		rows = append(rows, row)
+	}
+
 	// Shard-level stats.
 	for _, sh := range s.shards {
 		row := &influxql.Row{Columns: []string{}}
@@ -2916,12 +3876,136 @@ func (s *Server) executeShowFieldKeysStatement(stmt *influxql.ShowFieldKeysState
 	return result
 }
 
-func (s *Server) executeGrantStatement(stmt *influxql.GrantStatement, user *User) *Result {
-	return &Result{Err: s.SetPrivilege(stmt.Privilege, stmt.User, stmt.On)}
+func (s *Server) executeGrantStatement(stmt *influxql.GrantStatement, user *User, o *commandOrigin) *Result {
+	if stmt.Role != "" {
+		return &Result{Err: s.setRolePrivilege(stmt.Privilege, stmt.Role, stmt.On, newMeasurementMatcher(stmt.Measurement), o)}
+	} else if stmt.Measurement != nil {
+		// Privileges on measurements can only be granted through roles.
+		return &Result{Err: ErrInvalidGrantRevoke}
+	}
+	return &Result{Err: s.setPrivilege(stmt.Privilege, stmt.User, stmt.On, o)}
+}
+
+func (s *Server) executeRevokeStatement(stmt *influxql.RevokeStatement, user *User, o *commandOrigin) *Result {
+	if stmt.Role != "" {
+		return &Result{Err: s.setRolePrivilege(influxql.NoPrivileges, stmt.Role, stmt.On, newMeasurementMatcher(stmt.Measurement), o)}
+	} else if stmt.Measurement != nil {
+		return &Result{Err: ErrInvalidGrantRevoke}
+	}
+	return &Result{Err: s.setPrivilege(influxql.NoPrivileges, stmt.User, stmt.On, o)}
+}
+
+// newMeasurementMatcher returns a Matcher for the name or regex of a measurement.
+// Returns nil if the measurement is nil.
+func newMeasurementMatcher(m *influxql.Measurement) *Matcher {
+	if m == nil {
+		return nil
+	} else if m.Regex != nil {
+		return &Matcher{IsRegex: true, Name: m.Regex.Val.String()}
+	}
+	return &Matcher{Name: m.Name}
+}
+
+func (s *Server) executeCreateRoleStatement(stmt *influxql.CreateRoleStatement, user *User, o *commandOrigin) *Result {
+	return &Result{Err: s.createRole(stmt.Name, o)}
+}
+
+func (s *Server) executeDropRoleStatement(stmt *influxql.DropRoleStatement, user *User, o *commandOrigin) *Result {
+	return &Result{Err: s.dropRole(stmt.Name, o)}
+}
+
+func (s *Server) executeGrantRoleStatement(stmt *influxql.GrantRoleStatement, user *User, o *commandOrigin) *Result {
+	return &Result{Err: s.grantRole(stmt.Role, stmt.User, o)}
+}
+
+func (s *Server) executeRevokeRoleStatement(stmt *influxql.RevokeRoleStatement, user *User, o *commandOrigin) *Result {
+	return &Result{Err: s.revokeRole(stmt.Role, stmt.User, o)}
+}
+
+func (s *Server) executeShowRolesStatement(stmt *influxql.ShowRolesStatement, user *User) *Result {
+	row := &influxql.Row{Columns: []string{"role"}}
+	for _, r := range s.Roles() {
+		row.Values = append(row.Values, []interface{}{r.Name})
+	}
+	return &Result{Series: []*influxql.Row{row}}
+}
+
+// executeCreateTokenStatement creates an API token and returns its secret. The secret
+// can't be retrieved later on.
+func (s *Server) executeCreateTokenStatement(stmt *influxql.CreateTokenStatement, user *User, o *commandOrigin) *Result {
+	var expires time.Time
+	if stmt.Duration > 0 {
+		expires = time.Now().UTC().Add(stmt.Duration)
+	}
+
+	secret, err := s.createToken(stmt.Name, stmt.User, stmt.Privilege, stmt.Database, expires, o)
+	if err != nil {
+		return &Result{Err: err}
+	}
+	row := &influxql.Row{Columns: []string{"name", "token"}, Values: [][]interface{}{{stmt.Name, secret}}}
+	return &Result{Series: []*influxql.Row{row}}
 }
 
-func (s *Server) executeRevokeStatement(stmt *influxql.RevokeStatement, user *User) *Result {
-	return &Result{Err: s.SetPrivilege(influxql.NoPrivileges, stmt.User, stmt.On)}
+func (s *Server) executeDropTokenStatement(stmt *influxql.DropTokenStatement, user *User, o *commandOrigin) *Result {
+	return &Result{Err: s.dropToken(stmt.Name, o)}
+}
+
+func (s *Server) executeShowTokensStatement(stmt *influxql.ShowTokensStatement, user *User) *Result {
+	row := &influxql.Row{Columns: []string{"name", "user", "privilege", "database", "expires"}}
+	for _, t := range s.Tokens() {
+		var expires interface{}
+		if !t.Expires.IsZero() {
+			expires = t.Expires
+		}
+		row.Values = append(row.Values, []interface{}{t.Name, t.Username, t.Privilege.String(), t.Database, expires})
+	}
+	return &Result{Series: []*influxql.Row{row}}
+}
+
+// executeShowGrantsForUserStatement lists the privileges of a user on each database, followed
+// by the privileges of each of its roles.
+func (s *Server) executeShowGrantsForUserStatement(stmt *influxql.ShowGrantsForUserStatement, user *User) *Result {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u := s.users[stmt.Name]
+	if u == nil {
+		return &Result{Err: ErrUserNotFound}
+	}
+
+	row := &influxql.Row{Columns: []string{"database", "measurement", "privilege", "role"}}
+	if u.Admin {
+		row.Values = append(row.Values, []interface{}{"", "", influxql.AllPrivileges.String(), ""})
+	}
+
+	// Add the privileges granted to the user directly.
+	var names []string
+	for name, p := range u.Privileges {
+		if p != influxql.NoPrivileges {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		row.Values = append(row.Values, []interface{}{name, "", u.Privileges[name].String(), ""})
+	}
+
+	// Add the privileges of the user's roles.
+	for _, name := range u.Roles {
+		r := s.roles[name]
+		if r == nil {
+			continue
+		}
+		for _, g := range r.Grants {
+			var measurement string
+			if g.Measurement != nil {
+				measurement = g.Measurement.String()
+			}
+			row.Values = append(row.Values, []interface{}{g.Database, measurement, g.Privilege.String(), r.Name})
+		}
+	}
+
+	return &Result{Series: []*influxql.Row{row}}
 }
 
 // measurementsFromSourceOrDB returns a list of measurements from the
@@ -2955,33 +4039,38 @@ func measurementsFromSourceOrDB(stmt influxql.Source, db *database) (Measurement
 }
 
 func (s *Server) executeShowUsersStatement(q *influxql.ShowUsersStatement, user *User) *Result {
-	row := &influxql.Row{Columns: []string{"user", "admin"}}
+	row := &influxql.Row{Columns: []string{"user", "admin", "locked", "failed_logins"}}
 	for _, user := range s.Users() {
-		row.Values = append(row.Values, []interface{}{user.Name, user.Admin})
+		n, locked := s.LoginFailures(user.Name)
+		row.Values = append(row.Values, []interface{}{user.Name, user.Admin, locked, n})
 	}
 	return &Result{Series: []*influxql.Row{row}}
 }
 
-func (s *Server) executeCreateRetentionPolicyStatement(stmt *influxql.CreateRetentionPolicyStatement, user *User) *Result {
+func (s *Server) executeUnlockUserStatement(q *influxql.UnlockUserStatement, user *User, o *commandOrigin) *Result {
+	return &Result{Err: s.unlockUser(q.Name, o)}
+}
+
+func (s *Server) executeCreateRetentionPolicyStatement(stmt *influxql.CreateRetentionPolicyStatement, user *User, o *commandOrigin) *Result {
 	rp := NewRetentionPolicy(stmt.Name)
 	rp.Duration = stmt.Duration
 	rp.ReplicaN = uint32(stmt.Replication)
 
 	// Create new retention policy.
-	err := s.CreateRetentionPolicy(stmt.Database, rp)
+	err := s.createRetentionPolicy(stmt.Database, rp, o)
 	if err != nil {
 		return &Result{Err: err}
 	}
 
 	// If requested, set new policy as the default.
 	if stmt.Default {
-		err = s.SetDefaultRetentionPolicy(stmt.Database, stmt.Name)
+		err = s.setDefaultRetentionPolicy(stmt.Database, stmt.Name, o)
 	}
 
 	return &Result{Err: err}
 }
 
-func (s *Server) executeAlterRetentionPolicyStatement(stmt *influxql.AlterRetentionPolicyStatement, user *User) *Result {
+func (s *Server) executeAlterRetentionPolicyStatement(stmt *influxql.AlterRetentionPolicyStatement, user *User, o *commandOrigin) *Result {
 	rpu := &RetentionPolicyUpdate{
 		Duration: stmt.Duration,
 		ReplicaN: func() *uint32 {
@@ -2994,14 +4083,14 @@ func (s *Server) executeAlterRetentionPolicyStatement(stmt *influxql.AlterRetent
 	}
 
 	// Update the retention policy.
-	err := s.UpdateRetentionPolicy(stmt.Database, stmt.Name, rpu)
+	err := s.updateRetentionPolicy(stmt.Database, stmt.Name, rpu, o)
 	if err != nil {
 		return &Result{Err: err}
 	}
 
 	// If requested, set as default retention policy.
 	if stmt.Default {
-		err = s.SetDefaultRetentionPolicy(stmt.Database, stmt.Name)
+		err = s.setDefaultRetentionPolicy(stmt.Database, stmt.Name, o)
 	}
 
 	return &Result{Err: err}
@@ -3011,8 +4100,8 @@ func (s *Server) executeDeleteStatement() *Result {
 	return &Result{Err: ErrInvalidQuery}
 }
 
-func (s *Server) executeDropRetentionPolicyStatement(q *influxql.DropRetentionPolicyStatement, user *User) *Result {
-	return &Result{Err: s.DeleteRetentionPolicy(q.Database, q.Name)}
+func (s *Server) executeDropRetentionPolicyStatement(q *influxql.DropRetentionPolicyStatement, user *User, o *commandOrigin) *Result {
+	return &Result{Err: s.deleteRetentionPolicy(q.Database, q.Name, o)}
 }
 
 func (s *Server) executeShowRetentionPoliciesStatement(q *influxql.ShowRetentionPoliciesStatement, user *User) *Result {
@@ -3030,14 +4119,18 @@ func (s *Server) executeShowRetentionPoliciesStatement(q *influxql.ShowRetention
 	return &Result{Series: []*influxql.Row{row}}
 }
 
-func (s *Server) executeCreateContinuousQueryStatement(q *influxql.CreateContinuousQueryStatement, user *User) *Result {
-	return &Result{Err: s.CreateContinuousQuery(q)}
+func (s *Server) executeCreateContinuousQueryStatement(q *influxql.CreateContinuousQueryStatement, user *User, o *commandOrigin) *Result {
+	return &Result{Err: s.createContinuousQuery(q, o)}
 }
 
 // CreateContinuousQuery creates a continuous query.
 func (s *Server) CreateContinuousQuery(q *influxql.CreateContinuousQueryStatement) error {
+	return s.createContinuousQuery(q, nil)
+}
+
+func (s *Server) createContinuousQuery(q *influxql.CreateContinuousQueryStatement, o *commandOrigin) error {
 	c := &createContinuousQueryCommand{Query: q.String()}
-	_, err := s.broadcast(createContinuousQueryMessageType, c)
+	_, err := s.broadcast(createContinuousQueryMessageType, c, o)
 	return err
 }
 
@@ -3048,7 +4141,7 @@ func (s *Server) executeDropContinuousQueryStatement(q *influxql.DropContinuousQ
 // DropContinuousQuery dropsoa continuous query.
 func (s *Server) DropContinuousQuery(q *influxql.DropContinuousQueryStatement) error {
 	c := &dropContinuousQueryCommand{Name: q.Name, Database: q.Database}
-	_, err := s.broadcast(dropContinuousQueryMessageType, c)
+	_, err := s.broadcast(dropContinuousQueryMessageType, c, nil)
 	return err
 }
 
@@ -3117,6 +4210,16 @@ func (s *Server) StartLocalMapper(rm *RemoteMapper) (*LocalMapper, error) {
 		return nil, ErrMeasurementNotFound(rm.MeasurementName)
 	}
 
+	// align intervals to the same time zone as the server running the query
+	window := influxql.Window{Interval: rm.Interval, Offset: rm.IntervalOffset}
+	if rm.TimeZone != "" {
+		loc, err := time.LoadLocation(rm.TimeZone)
+		if err != nil {
+			return nil, err
+		}
+		window.Location = loc
+	}
+
 	// create a job, it's only used as a container for a few variables
 	job := &influxql.MapReduceJob{
 		MeasurementName: rm.MeasurementName,
@@ -3132,8 +4235,18 @@ func (s *Server) StartLocalMapper(rm *RemoteMapper) (*LocalMapper, error) {
 		limit = math.MaxUint64
 	}
 
+	// limit the mapper to what's left of the query's points and time, or to this server's limits
+	max, timeout, remaining := rm.MaxPointsScanned, rm.Timeout, rm.TimeRemaining
+	if max == 0 {
+		max = int64(s.MaxPointsScanned)
+	}
+	if timeout == 0 {
+		timeout, remaining = s.QueryTimeout, s.QueryTimeout
+	}
+
 	// now create and start the local mapper
 	lm := &LocalMapper{
+		shardID:      rm.ShardID,
 		seriesIDs:    rm.SeriesIDs,
 		job:          job,
 		db:           shard.store,
@@ -3142,9 +4255,11 @@ func (s *Server) StartLocalMapper(rm *RemoteMapper) (*LocalMapper, error) {
 		whereFields:  rm.WhereFields,
 		selectFields: rm.SelectFields,
 		selectTags:   rm.SelectTags,
-		interval:     rm.Interval,
+		seriesTags:   m.seriesTags(rm.SeriesIDs, rm.SelectTags),
+		window:       window,
 		tmax:         rm.TMax,
 		limit:        limit,
+		scanned:      newScanCounter(max, timeout, remaining),
 	}
 
 	return lm, nil
@@ -3292,7 +4407,7 @@ func (s *Server) DiagnosticsAsRows() []*influxql.Row {
 		}
 	}
 
-	return []*influxql.Row{
+	rows := []*influxql.Row{
 		gd.AsRow("server_go", tags),
 		sd.AsRow("server_system", tags),
 		md.AsRow("server_memory", tags),
@@ -3301,6 +4416,12 @@ func (s *Server) DiagnosticsAsRows() []*influxql.Row {
 		shardGroupsRow,
 		shardsRow,
 	}
+
+	// Diagnostics registered by other components.
+	for _, d := range s.otherDiags {
+		rows = append(rows, d.diags.AsRow(d.measurement, tags))
+	}
+	return rows
 }
 
 // processor runs in a separate goroutine and processes all incoming broker messages.
@@ -3318,7 +4439,9 @@ func (s *Server) processor(conn MessagingConn, done chan struct{}) {
 			}
 		}
 
-		// All messages must be processed under lock.
+		// All messages must be processed under lock. The audit event of the
+		// message is written once the lock is released.
+		var e *AuditEvent
 		func() {
 			s.stats.Inc("broadcastMessageRx")
 			s.mu.Lock()
@@ -3366,6 +4489,20 @@ func (s *Server) processor(conn MessagingConn, done chan struct{}) {
 				err = s.applyDropMeasurement(m)
 			case setPrivilegeMessageType:
 				err = s.applySetPrivilege(m)
+			case createRoleMessageType:
+				err = s.applyCreateRole(m)
+			case dropRoleMessageType:
+				err = s.applyDropRole(m)
+			case setRolePrivilegeMessageType:
+				err = s.applySetRolePrivilege(m)
+			case grantRoleMessageType, revokeRoleMessageType:
+				err = s.applyUserRole(m)
+			case unlockUserMessageType:
+				err = s.applyUnlockUser(m)
+			case createTokenMessageType:
+				err = s.applyCreateToken(m)
+			case dropTokenMessageType:
+				err = s.applyDropToken(m)
 			case createContinuousQueryMessageType:
 				err = s.applyCreateContinuousQueryCommand(m)
 			case dropContinuousQueryMessageType:
@@ -3375,6 +4512,14 @@ func (s *Server) processor(conn MessagingConn, done chan struct{}) {
 			case writeRawSeriesMessageType:
 				panic("write series not allowed in broadcast topic")
 			}
+			e = s.commandAuditEvent(m, err)
+
+			// Cached query results may include dropped data or miss new shard groups.
+			switch m.Type {
+			case dropDatabaseMessageType, deleteRetentionPolicyMessageType, createShardGroupIfNotExistsMessageType,
+				deleteShardGroupMessageType, dropMeasurementMessageType, dropSeriesMessageType:
+				s.QueryCache.reset()
+			}
 
 			// Sync high water mark and errors.
 			s.index = m.Index
@@ -3382,6 +4527,10 @@ func (s *Server) processor(conn MessagingConn, done chan struct{}) {
 				s.errors[m.Index] = err
 			}
 		}()
+
+		if e != nil {
+			s.Audit(e)
+		}
 	}
 }
 
@@ -3509,6 +4658,14 @@ func NewMessagingClient(dataURL url.URL) MessagingClient {
 	return &messagingClient{messaging.NewClient(dataURL)}
 }
 
+// NewMessagingClientWithTransport returns an instance of MessagingClient that
+// connects to brokers using the given HTTP transport.
+func NewMessagingClientWithTransport(dataURL url.URL, t *http.Transport) MessagingClient {
+	c := messaging.NewClient(dataURL)
+	c.Transport = t
+	return &messagingClient{c}
+}
+
 func (c *messagingClient) Conn(topicID uint64) MessagingConn { return c.Client.Conn(topicID) }
 
 // MessagingConn represents a streaming connection to a single broker topic.
@@ -3543,16 +4700,27 @@ func (s *Server) Authorize(u *User, q *influxql.Query, database string) error {
 		return ErrAuthorize{text: "no user provided"}
 	}
 
-	// Cluster admins can do anything.
-	if u.Admin {
+	// Cluster admins can do anything, unless they authenticated with a restricted token.
+	if u.Admin && u.token == nil {
 		return nil
 	}
 
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	// Check each statement in the query.
 	for _, stmt := range q.Statements {
 		// Get the privileges required to execute the statement.
 		privs := stmt.RequiredPrivileges()
 
+		// Select statements are also authorized for each measurement they read once the
+		// measurements are known, so privileges on some measurements of a database are enough.
+		var measurements bool
+		switch stmt.(type) {
+		case *influxql.SelectStatement, *influxql.ExplainStatement:
+			measurements = true
+		}
+
 		// Make sure the user has each privilege required to execute
 		// the statement.
 		for _, p := range privs {
@@ -3565,7 +4733,7 @@ func (s *Server) Authorize(u *User, q *influxql.Query, database string) error {
 			}
 
 			// Check if user has required privilege.
-			if !u.Authorize(p.Privilege, dbname) {
+			if !s.authorized(u, p.Privilege, dbname, "") && !(measurements && s.authorizedOnMeasurements(u, p.Privilege, dbname)) {
 				var msg string
 				if dbname == "" {
 					msg = "requires cluster admin"
@@ -3582,6 +4750,176 @@ func (s *Server) Authorize(u *User, q *influxql.Query, database string) error {
 	return nil
 }
 
+// authorized returns true if a user has a privilege on a database, either directly or through
+// one of its roles. If a measurement is given then the privileges roles have on the
+// measurements of the database matching it are also included.
+func (s *Server) authorized(u *User, p influxql.Privilege, database, measurement string) bool {
+	if u.token != nil && !u.token.Allows(p, database) {
+		return false
+	} else if u.Authorize(p, database) {
+		return true
+	}
+	for _, name := range u.Roles {
+		if r := s.roles[name]; r != nil && r.Authorize(p, database, measurement) {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizedOnMeasurements returns true if one of a user's roles has a privilege on some of
+// the measurements of a database.
+func (s *Server) authorizedOnMeasurements(u *User, p influxql.Privilege, database string) bool {
+	if u.token != nil && !u.token.Allows(p, database) {
+		return false
+	}
+	for _, name := range u.Roles {
+		r := s.roles[name]
+		if r == nil {
+			continue
+		}
+		for _, g := range r.Grants {
+			if g.Database == database && g.Privilege >= p {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// authorizeSources returns an error if a user isn't authorized to read each measurement
+// selected by a statement. The statement must have been rewritten so that its sources only
+// refer to measurements by name.
+func (s *Server) authorizeSources(u *User, stmt *influxql.SelectStatement) error {
+	if !s.authenticationEnabled || u == nil || (u.Admin && u.token == nil) {
+		return nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var err error
+	influxql.WalkFunc(stmt.Sources, func(n influxql.Node) {
+		m, ok := n.(*influxql.Measurement)
+		if !ok || err != nil || s.authorized(u, influxql.ReadPrivilege, m.Database, m.Name) {
+			return
+		}
+		err = ErrAuthorize{
+			text: fmt.Sprintf("%s not authorized to read from measurement %s.  requires READ privilege on %s.%s", u.Name, m.Name, m.Database, m.Name),
+		}
+	})
+	return err
+}
+
+// AuthorizeWrite returns an error if user u isn't authorized to write each of the points
+// to the database. Callers check whether authentication is enabled; a nil user is never
+// authorized.
+func (s *Server) AuthorizeWrite(u *User, database string, points []Point) error {
+	if u == nil {
+		return ErrAuthorize{text: "no user provided"}
+	} else if u.Admin && u.token == nil {
+		return nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, p := range points {
+		if !s.authorized(u, influxql.WritePrivilege, database, p.Name) {
+			return ErrAuthorize{
+				text: fmt.Sprintf("%s not authorized to write to measurement %s.  requires WRITE privilege on %s.%s", u.Name, p.Name, database, p.Name),
+			}
+		}
+	}
+	return nil
+}
+
+// maxLoginHosts is the number of hosts with failed logins after which expired ones are forgotten.
+const maxLoginHosts = 10000
+
+// loginFailures represents the recent failed logins of a user or of a host.
+type loginFailures struct {
+	n           int       // failed logins since the count last expired
+	last        time.Time // time of the last failed login
+	lockedUntil time.Time
+}
+
+// add counts a failed login. The count restarts if the last failed login is older than
+// the lockout duration, and a lockout starts once it reaches max. Zero max never locks out.
+func (f *loginFailures) add(now time.Time, max int, lockout time.Duration) {
+	if f.expired(now, lockout) {
+		f.n = 0
+	}
+	f.n++
+	f.last = now
+	if max > 0 && f.n >= max {
+		f.lockedUntil = now.Add(lockout)
+	}
+}
+
+// expired returns true if the failed logins are too old to be counted and no lockout is in progress.
+func (f *loginFailures) expired(now time.Time, lockout time.Duration) bool {
+	return now.Sub(f.last) > lockout && !f.locked(now)
+}
+
+// locked returns true if a lockout is in progress.
+func (f *loginFailures) locked(now time.Time) bool {
+	return f != nil && now.Before(f.lockedUntil)
+}
+
+// hostOf returns the host of a "host:port" address.
+func hostOf(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// PasswordPolicy represents the requirements passwords must meet.
+type PasswordPolicy struct {
+	MinLength      int  // minimum number of characters
+	RequireUpper   bool // requires an upper case letter
+	RequireLower   bool // requires a lower case letter
+	RequireDigit   bool // requires a digit
+	RequireSpecial bool // requires a character that isn't a letter or a digit
+}
+
+// Validate returns an error if a password doesn't meet the policy.
+func (p *PasswordPolicy) Validate(password string) error {
+	if p.MinLength > 0 && utf8.RuneCountInString(password) < p.MinLength {
+		if password == "" {
+			return ErrPasswordRequired
+		}
+		return fmt.Errorf("password must be at least %d characters", p.MinLength)
+	}
+
+	var upper, lower, digit, special bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case !unicode.IsLetter(r):
+			special = true
+		}
+	}
+
+	switch {
+	case p.RequireUpper && !upper:
+		return fmt.Errorf("password must contain an upper case letter")
+	case p.RequireLower && !lower:
+		return fmt.Errorf("password must contain a lower case letter")
+	case p.RequireDigit && !digit:
+		return fmt.Errorf("password must contain a digit")
+	case p.RequireSpecial && !special:
+		return fmt.Errorf("password must contain a character other than a letter or a digit")
+	}
+	return nil
+}
+
 // BcryptCost is the cost associated with generating password with Bcrypt.
 // This setting is lowered during testing to improve test suite performance.
 var BcryptCost = 10
@@ -3593,6 +4931,9 @@ type User struct {
 	Hash       string                        `json:"hash"`
 	Privileges map[string]influxql.Privilege `json:"privileges"` // db name to privilege
 	Admin      bool                          `json:"admin,omitempty"`
+	Roles      []string                      `json:"roles,omitempty"` // names of the roles granted to the user
+
+	token *Token // API token the user authenticated with, limiting its privileges
 }
 
 // Authenticate returns nil if the password matches the user's password.
@@ -3603,10 +4944,33 @@ func (u *User) Authenticate(password string) error {
 
 // Authorize returns true if the user is authorized and false if not.
 func (u *User) Authorize(privilege influxql.Privilege, database string) bool {
+	if u.token != nil && !u.token.Allows(privilege, database) {
+		return false
+	}
 	p, ok := u.Privileges[database]
 	return (ok && p >= privilege) || (u.Admin)
 }
 
+// hasRole returns true if the role has been granted to the user.
+func (u *User) hasRole(name string) bool {
+	for _, r := range u.Roles {
+		if r == name {
+			return true
+		}
+	}
+	return false
+}
+
+// removeRole removes a role from the roles granted to the user.
+func (u *User) removeRole(name string) {
+	for i, r := range u.Roles {
+		if r == name {
+			u.Roles = append(u.Roles[:i], u.Roles[i+1:]...)
+			return
+		}
+	}
+}
+
 // users represents a list of users, sortable by name.
 type users []*User
 
@@ -3614,15 +4978,144 @@ func (p users) Len() int           { return len(p) }
 func (p users) Less(i, j int) bool { return p[i].Name < p[j].Name }
 func (p users) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
 
+// Role represents a named set of privileges that can be granted to users.
+type Role struct {
+	Name   string   `json:"name"`
+	Grants []*Grant `json:"grants,omitempty"`
+}
+
+// Authorize returns true if the role has a privilege on a measurement of a database.
+// If measurement is blank then only privileges on the whole database are checked.
+func (r *Role) Authorize(privilege influxql.Privilege, database, measurement string) bool {
+	for _, g := range r.Grants {
+		if g.Authorize(privilege, database, measurement) {
+			return true
+		}
+	}
+	return false
+}
+
+// setGrant replaces the role's grant on the same database and measurements as g.
+// The grant is removed if g has no privileges.
+func (r *Role) setGrant(g *Grant) {
+	for i, other := range r.Grants {
+		if other.Database == g.Database && other.Measurement.equals(g.Measurement) {
+			r.Grants = append(r.Grants[:i], r.Grants[i+1:]...)
+			break
+		}
+	}
+	if g.Privilege != influxql.NoPrivileges {
+		r.Grants = append(r.Grants, g)
+	}
+}
+
+// Token represents a named API token authenticating as a user.
+// Only a hash of the token's secret is stored.
+type Token struct {
+	Name      string             `json:"name"`
+	Username  string             `json:"username"`
+	Hash      string             `json:"hash"`
+	Privilege influxql.Privilege `json:"privilege"`          // highest privilege allowed by the token
+	Database  string             `json:"database,omitempty"` // database the token is limited to
+	Expires   time.Time          `json:"expires"`            // zero if the token doesn't expire
+}
+
+// Allows returns true if the token allows a privilege on a database.
+func (t *Token) Allows(privilege influxql.Privilege, database string) bool {
+	return t.Privilege >= privilege && (t.Database == "" || t.Database == database)
+}
+
+// Expired returns true if the token has expired at the given time.
+func (t *Token) Expired(now time.Time) bool {
+	return !t.Expires.IsZero() && !now.Before(t.Expires)
+}
+
+// hashToken returns the hex encoded SHA-256 hash of a token's secret. Secrets are
+// random so unlike passwords they don't need a slow hash.
+func hashToken(secret string) string {
+	h := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(h[:])
+}
+
+// tokens represents a list of API tokens, sortable by name.
+type tokens []*Token
+
+func (p tokens) Len() int           { return len(p) }
+func (p tokens) Less(i, j int) bool { return p[i].Name < p[j].Name }
+func (p tokens) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+// roles represents a list of roles, sortable by name.
+type roles []*Role
+
+func (p roles) Len() int           { return len(p) }
+func (p roles) Less(i, j int) bool { return p[i].Name < p[j].Name }
+func (p roles) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+// Grant represents a privilege on a database, or on the measurements of
+// a database matching a name or regex.
+type Grant struct {
+	Privilege   influxql.Privilege `json:"privilege"`
+	Database    string             `json:"database"`
+	Measurement *Matcher           `json:"measurement,omitempty"`
+}
+
+// Authorize returns true if the grant gives a privilege on a measurement of a database.
+// If measurement is blank then only grants on the whole database match.
+func (g *Grant) Authorize(privilege influxql.Privilege, database, measurement string) bool {
+	if g.Database != database || g.Privilege < privilege {
+		return false
+	}
+	return g.Measurement == nil || (measurement != "" && g.Measurement.Matches(measurement))
+}
+
 // Matcher can match either a Regex or plain string.
 type Matcher struct {
-	IsRegex bool
-	Name    string
+	IsRegex bool   `json:"regex,omitempty"`
+	Name    string `json:"name"`
+
+	re *regexp.Regexp // the compiled regex, set when the matcher is decoded
+}
+
+// UnmarshalJSON decodes a matcher and compiles its regex, so grants loaded from
+// the meta store or from commands don't compile it on every match.
+func (m *Matcher) UnmarshalJSON(b []byte) error {
+	var o struct {
+		IsRegex bool   `json:"regex,omitempty"`
+		Name    string `json:"name"`
+	}
+	if err := json.Unmarshal(b, &o); err != nil {
+		return err
+	}
+	m.IsRegex, m.Name, m.re = o.IsRegex, o.Name, nil
+	if m.IsRegex {
+		// An invalid regex matches nothing rather than failing to load the grant.
+		m.re, _ = regexp.Compile(m.Name)
+	}
+	return nil
+}
+
+// String returns the name, or the regex surrounded by slashes.
+func (m *Matcher) String() string {
+	if m.IsRegex {
+		return "/" + m.Name + "/"
+	}
+	return m.Name
+}
+
+// equals returns true if both matchers match the same name or regex. Nil matchers are equal.
+func (m *Matcher) equals(other *Matcher) bool {
+	if m == nil || other == nil {
+		return m == other
+	}
+	return m.IsRegex == other.IsRegex && m.Name == other.Name
 }
 
 // Matches returns true of the name passed in matches this Matcher.
 func (m *Matcher) Matches(name string) bool {
 	if m.IsRegex {
+		if m.re != nil {
+			return m.re.MatchString(name)
+		}
 		matches, _ := regexp.MatchString(m.Name, name)
 		return matches
 	}
@@ -3813,17 +5306,16 @@ func (s *Server) runContinuousQuery(cq *ContinuousQuery) {
 	now := time.Now()
 	cq.lastRun = now
 
-	interval, err := cq.cq.Source.GroupByInterval()
-	if err != nil || interval == 0 {
+	// the window aligns the intervals to the offset and time zone of the query
+	window, err := cq.cq.Source.GroupByWindow()
+	if err != nil || window.Interval == 0 {
 		return
 	}
 
-	startTime := now.Round(interval)
-	if startTime.UnixNano() > now.UnixNano() {
-		startTime = startTime.Add(-interval)
-	}
+	startTime := time.Unix(0, window.Truncate(now.UnixNano()))
+	endTime := time.Unix(0, window.Next(startTime.UnixNano()))
 
-	if err := cq.cq.Source.SetTimeRange(startTime, startTime.Add(interval)); err != nil {
+	if err := cq.cq.Source.SetTimeRange(startTime, endTime); err != nil {
 		log.Printf("cq error setting time range: %s\n", err.Error())
 	}
 
@@ -3836,7 +5328,7 @@ func (s *Server) runContinuousQuery(cq *ContinuousQuery) {
 		if now.Sub(startTime) > s.RecomputeNoOlderThan {
 			return
 		}
-		newStartTime := startTime.Add(-interval)
+		newStartTime := time.Unix(0, window.Truncate(startTime.UnixNano()-1))
 
 		if err := cq.cq.Source.SetTimeRange(newStartTime, startTime); err != nil {
 			log.Printf("cq error setting time range: %s\n", err.Error())
@@ -16,6 +16,7 @@ import (
 
 	"github.com/influxdb/influxdb"
 	"github.com/influxdb/influxdb/influxql"
+	"github.com/influxdb/influxdb/raft"
 	"github.com/influxdb/influxdb/test"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -293,6 +294,144 @@ func TestServer_MultiStatementQueryAuthorization(t *testing.T) {
 	}
 }
 
+// Ensure roles grant their privileges on databases and measurements to users.
+func TestServer_Roles(t *testing.T) {
+	c := test.NewDefaultMessagingClient()
+	defer c.Close()
+	s := OpenDefaultServer(c)
+	defer s.Close()
+	s.MustWriteSeries("db", "raw", []influxdb.Point{{Name: "cpu", Timestamp: mustParseTime("2000-01-01T00:00:00Z"), Fields: map[string]interface{}{"value": float64(10)}}})
+	s.MustWriteSeries("db", "raw", []influxdb.Point{{Name: "mem", Timestamp: mustParseTime("2000-01-01T00:00:00Z"), Fields: map[string]interface{}{"value": float64(20)}}})
+
+	// Create a user and a role reading the cpu measurements.
+	s.CreateUser("jdoe", "jdoe", false)
+	results := s.executeQuery(MustParseQuery(`CREATE ROLE readers; GRANT READ ON db./^cpu/ TO ROLE readers; GRANT ROLE readers TO jdoe`), "", nil)
+	if results.Error() != nil {
+		t.Fatalf("unexpected error: %s", results.Error())
+	} else if r := s.Role("readers"); r == nil || len(r.Grants) != 1 || r.Grants[0].Measurement.String() != "/^cpu/" {
+		t.Fatalf("unexpected role: %#v", r)
+	}
+
+	s.Restart()
+	s.SetAuthenticationEnabled(true)
+	user := s.User("jdoe")
+	if !reflect.DeepEqual(user.Roles, []string{"readers"}) {
+		t.Fatalf("unexpected roles: %v", user.Roles)
+	}
+
+	// The user can read cpu but not mem.
+	if results := s.executeQuery(MustParseQuery(`SELECT value FROM cpu`), "db", user); results.Error() != nil {
+		t.Fatalf("unexpected error: %s", results.Error())
+	} else if s := mustMarshalJSON(results); s != `{"results":[{"series":[{"name":"cpu","columns":["time","value"],"values":[["2000-01-01T00:00:00Z",10]]}]}]}` {
+		t.Fatalf("unexpected results: %s", s)
+	}
+	if results := s.executeQuery(MustParseQuery(`SELECT value FROM mem`), "db", user); results.Error() == nil {
+		t.Fatal("expected error reading mem")
+	}
+	if results := s.executeQuery(MustParseQuery(`SELECT value FROM /.*/`), "db", user); results.Error() == nil {
+		t.Fatal("expected error reading all measurements")
+	}
+	if err := s.Authorize(user, MustParseQuery(`SHOW MEASUREMENTS`), "db"); err == nil {
+		t.Fatal("expected error showing measurements")
+	}
+
+	// Writes require a write privilege.
+	points := []influxdb.Point{{Name: "cpu", Fields: map[string]interface{}{"value": float64(10)}}}
+	if err := s.AuthorizeWrite(user, "db", points); err == nil {
+		t.Fatal("expected error writing cpu")
+	}
+	s.SetRolePrivilege(influxql.AllPrivileges, "readers", "db", &influxdb.Matcher{Name: "cpu"})
+	if err := s.AuthorizeWrite(user, "db", points); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if err := s.AuthorizeWrite(user, "db", append(points, influxdb.Point{Name: "mem"})); err == nil {
+		t.Fatal("expected error writing mem")
+	}
+
+	// The grants of the user include the ones of its roles.
+	s.SetAuthenticationEnabled(false)
+	if results := s.executeQuery(MustParseQuery(`SHOW GRANTS FOR jdoe`), "", nil); results.Error() != nil {
+		t.Fatalf("unexpected error: %s", results.Error())
+	} else if s := mustMarshalJSON(results); s != `{"results":[{"series":[{"columns":["database","measurement","privilege","role"],"values":[["db","/^cpu/","READ","readers"],["db","cpu","ALL PRIVILEGES","readers"]]}]}]}` {
+		t.Fatalf("unexpected results: %s", s)
+	}
+
+	// Dropping the role removes it from its users.
+	if err := s.DropRole("readers"); err != nil {
+		t.Fatal(err)
+	} else if s.Role("readers") != nil {
+		t.Fatal("expected role to be dropped")
+	} else if user = s.User("jdoe"); len(user.Roles) != 0 {
+		t.Fatalf("unexpected roles: %v", user.Roles)
+	} else if err := s.DropRole("readers"); err != influxdb.ErrRoleNotFound {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+// Ensure API tokens authenticate as their user, limited to their privileges.
+func TestServer_Tokens(t *testing.T) {
+	c := test.NewDefaultMessagingClient()
+	defer c.Close()
+	s := OpenDefaultServer(c)
+	defer s.Close()
+	s.CreateUser("jdoe", "jdoe", true)
+
+	// Create a token reading from db.
+	results := s.executeQuery(MustParseQuery(`CREATE TOKEN reader FOR jdoe WITH READ ON db DURATION 1h`), "", nil)
+	if results.Error() != nil {
+		t.Fatalf("unexpected error: %s", results.Error())
+	}
+	secret, _ := results.Results[0].Series[0].Values[0][1].(string)
+	if len(secret) != 64 {
+		t.Fatalf("unexpected secret: %q", secret)
+	} else if tok := s.Token("reader"); tok == nil || tok.Hash == secret || tok.Expires.IsZero() {
+		t.Fatalf("unexpected token: %#v", tok)
+	}
+
+	s.Restart()
+
+	// The token authenticates as the user, restricted to reads on db.
+	u, err := s.AuthenticateToken(secret)
+	if err != nil {
+		t.Fatal(err)
+	} else if u.Name != "jdoe" {
+		t.Fatalf("unexpected user: %s", u.Name)
+	} else if err := s.Authorize(u, MustParseQuery(`SELECT value FROM cpu`), "db"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if err := s.Authorize(u, MustParseQuery(`SELECT value FROM cpu`), "other"); err == nil {
+		t.Fatal("expected error reading from other database")
+	} else if err := s.Authorize(u, MustParseQuery(`DROP DATABASE db`), ""); err == nil {
+		t.Fatal("expected error dropping database")
+	} else if err := s.AuthorizeWrite(u, "db", []influxdb.Point{{Name: "cpu"}}); err == nil {
+		t.Fatal("expected error writing")
+	} else if !s.User("jdoe").Authorize(influxql.AllPrivileges, "") {
+		t.Fatal("expected user to remain admin")
+	}
+
+	// Unknown and expired tokens are rejected.
+	if _, err := s.AuthenticateToken("bad"); err != influxdb.ErrInvalidToken {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expired, err := s.CreateToken("expired", "jdoe", influxql.AllPrivileges, "", time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	} else if _, err := s.AuthenticateToken(expired); err != influxdb.ErrInvalidToken {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Tokens can be revoked, and are removed with their user.
+	if err := s.DropToken("expired"); err != nil {
+		t.Fatal(err)
+	} else if err := s.DropToken("expired"); err != influxdb.ErrTokenNotFound {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.DeleteUser("jdoe"); err != nil {
+		t.Fatal(err)
+	} else if tokens := s.Tokens(); len(tokens) != 0 {
+		t.Fatalf("unexpected tokens: %v", tokens)
+	} else if _, err := s.AuthenticateToken(secret); err != influxdb.ErrInvalidToken {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
 // Ensure the server can create a database.
 func TestServer_CreateDatabase(t *testing.T) {
 	c := test.NewDefaultMessagingClient()
@@ -408,7 +547,7 @@ func TestServer_CreateUser(t *testing.T) {
 	}
 
 	// Verify that the authenticated user exists.
-	u, err := s.Authenticate("susy", "pass")
+	u, err := s.Authenticate("susy", "pass", "")
 	if err != nil {
 		t.Fatalf("error fetching authenticated user")
 	} else if u.Name != "susy" {
@@ -543,12 +682,85 @@ func TestServer_NonExistingUsers(t *testing.T) {
 	if u != nil {
 		t.Fatalf("unexpected user found")
 	}
-	u, err := s.Authenticate("susy", "wrong_password")
+	u, err := s.Authenticate("susy", "wrong_password", "")
 	if err == nil {
 		t.Fatalf("unexpected authenticated user found")
 	}
 }
 
+// Ensure the server enforces its password policy.
+func TestServer_PasswordPolicy(t *testing.T) {
+	c := test.NewDefaultMessagingClient()
+	defer c.Close()
+	s := OpenServer(c)
+	defer s.Close()
+
+	// Empty passwords are rejected by default.
+	if err := s.CreateUser("susy", "", false); err != influxdb.ErrPasswordRequired {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	s.PasswordPolicy = influxdb.PasswordPolicy{MinLength: 8, RequireDigit: true}
+	if err := s.CreateUser("susy", "pass", false); err == nil || err.Error() != "password must be at least 8 characters" {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.CreateUser("susy", "password", false); err == nil || err.Error() != "password must contain a digit" {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.CreateUser("susy", "passw0rd", false); err != nil {
+		t.Fatal(err)
+	} else if err := s.UpdateUser("susy", "short1"); err == nil {
+		t.Fatal("expected error updating password")
+	} else if err := s.UpdateUser("susy", "passw0rd2"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Ensure users and hosts are locked out after too many failed logins.
+func TestServer_LoginLockout(t *testing.T) {
+	c := test.NewDefaultMessagingClient()
+	defer c.Close()
+	s := OpenServer(c)
+	defer s.Close()
+	s.MaxFailedLogins = 2
+	s.MaxFailedLoginsPerHost = 3
+	s.LoginLockout = time.Minute
+	s.SetAuthenticationEnabled(true)
+	s.CreateUser("susy", "pass", false)
+	s.CreateUser("bob", "pass", false)
+
+	// A successful login resets the failed logins.
+	s.Authenticate("susy", "wrong", "10.0.0.1:1000")
+	if _, err := s.Authenticate("susy", "pass", "10.0.0.1:1001"); err != nil {
+		t.Fatal(err)
+	} else if n, locked := s.LoginFailures("susy"); n != 0 || locked {
+		t.Fatalf("unexpected failed logins: %d, %v", n, locked)
+	}
+
+	// The user is locked out after two failed logins, even with the right password.
+	s.Authenticate("susy", "wrong", "10.0.0.1:1000")
+	s.Authenticate("susy", "wrong", "10.0.0.2:1000")
+	if _, err := s.Authenticate("susy", "pass", "10.0.0.3:1000"); err != influxdb.ErrLoginLocked {
+		t.Fatalf("unexpected error: %v", err)
+	} else if n, locked := s.LoginFailures("susy"); n != 2 || !locked {
+		t.Fatalf("unexpected failed logins: %d, %v", n, locked)
+	}
+
+	// The host is locked out after three failed logins, whatever the user.
+	s.Authenticate("nobody", "wrong", "10.0.0.1:1002")
+	s.Authenticate("bob", "wrong", "10.0.0.1:1003")
+	if _, err := s.Authenticate("bob", "pass", "10.0.0.1:1004"); err != influxdb.ErrLoginLocked {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, err := s.Authenticate("bob", "pass", "10.0.0.4:1000"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Unlocking the user ends its lockout.
+	if err := s.UnlockUser("susy"); err != nil {
+		t.Fatal(err)
+	} else if _, err := s.Authenticate("susy", "pass", "10.0.0.3:1000"); err != nil {
+		t.Fatal(err)
+	}
+}
+
 // Ensure the database can create a new retention policy.
 func TestServer_CreateRetentionPolicy(t *testing.T) {
 	c := test.NewDefaultMessagingClient()
@@ -1010,6 +1222,237 @@ func TestServer_WriteAllDataTypes(t *testing.T) {
 	f(t, "foo", "SELECT * from series4", `{"series":[{"name":"series4","columns":["time","value"],"values":[["2000-01-01T00:00:00Z",true]]}]}`)
 }
 
+// Ensure the server can explain the plan of a select statement and analyze its execution.
+func TestServer_ExplainSelectStatement(t *testing.T) {
+	c := test.NewDefaultMessagingClient()
+	defer c.Close()
+	s := OpenServer(c)
+	defer s.Close()
+	s.CreateDatabase("foo")
+	s.CreateRetentionPolicy("foo", &influxdb.RetentionPolicy{Name: "raw", Duration: 1 * time.Hour})
+	s.SetDefaultRetentionPolicy("foo", "raw")
+
+	s.MustWriteSeries("foo", "raw", []influxdb.Point{{Name: "cpu", Tags: map[string]string{"host": "serverA"}, Timestamp: mustParseTime("2000-01-01T00:00:00Z"), Fields: map[string]interface{}{"value": float64(10)}}})
+	s.MustWriteSeries("foo", "raw", []influxdb.Point{{Name: "cpu", Tags: map[string]string{"host": "serverA"}, Timestamp: mustParseTime("2000-01-01T00:00:10Z"), Fields: map[string]interface{}{"value": float64(20)}}})
+	s.MustWriteSeries("foo", "raw", []influxdb.Point{{Name: "cpu", Tags: map[string]string{"host": "serverB"}, Timestamp: mustParseTime("2000-01-01T00:00:00Z"), Fields: map[string]interface{}{"value": float64(30)}}})
+	s.MustWriteSeries("foo", "raw", []influxdb.Point{{Name: "mem", Tags: map[string]string{"host": "serverA"}, Timestamp: mustParseTime("2000-01-01T00:00:00Z"), Fields: map[string]interface{}{"value": float64(40)}}})
+
+	f := func(t *testing.T, query string, expected []string) {
+		results := s.executeQuery(MustParseQuery(query), "foo", nil)
+		if res := results.Results[0]; res.Err != nil {
+			t.Fatalf("unexpected error: %s", res.Err)
+		} else if len(res.Series) != 1 {
+			t.Fatalf("unexpected row count: %d", len(res.Series))
+		} else if s := mustMarshalJSON(res); !strings.Contains(s, `"columns":["QUERY PLAN"]`) {
+			t.Fatalf("unexpected columns: %s", s)
+		} else {
+			for _, exp := range expected {
+				if !strings.Contains(s, exp) {
+					t.Errorf("%s: expected plan to contain %q: %s", query, exp, s)
+				}
+			}
+		}
+	}
+
+	f(t, `EXPLAIN SELECT sum(value) FROM cpu WHERE time >= '2000-01-01T00:00:00Z' AND time < '2000-01-01T00:01:00Z' GROUP BY host`, []string{
+		`"TAG SET: host=serverA"`,
+		`"TAG SET: host=serverB"`,
+		`"  SERIES: 1"`,
+		`"  TIME RANGE: 2000-01-01T00:00:00Z - 2000-01-01T00:00:59.999999Z"`,
+		`: local, 1 series"`,
+		`MAP: MapSum REDUCE: ReduceSum"`,
+	})
+	f(t, `EXPLAIN ANALYZE SELECT value FROM cpu WHERE host = 'serverA' AND time >= '2000-01-01T00:00:00Z' AND time < '2000-01-01T00:01:00Z'`, []string{
+		`"MAP: MapRawQuery"`,
+		`"  POINTS SCANNED: 2"`,
+		`"  POINTS RETURNED: 2"`,
+		`"POINTS SCANNED: 2"`,
+	})
+
+	// Joins explain the plans of the statements for each measurement.
+	f(t, `EXPLAIN ANALYZE SELECT cpu.value, mem.value FROM cpu, mem WHERE host = 'serverA' AND time >= '2000-01-01T00:00:00Z' AND time < '2000-01-01T00:01:00Z'`, []string{
+		`"  MEASUREMENT: cpu"`,
+		`"  MEASUREMENT: mem"`,
+		`"POINTS SCANNED: 3"`,
+	})
+}
+
+// Ensure the server returns an error when a query exceeds a limit.
+func TestServer_QueryLimits(t *testing.T) {
+	c := test.NewDefaultMessagingClient()
+	defer c.Close()
+	s := OpenServer(c)
+	defer s.Close()
+	s.CreateDatabase("foo")
+	s.CreateRetentionPolicy("foo", &influxdb.RetentionPolicy{Name: "raw", Duration: 1 * time.Hour})
+	s.SetDefaultRetentionPolicy("foo", "raw")
+
+	s.MustWriteSeries("foo", "raw", []influxdb.Point{{Name: "cpu", Tags: map[string]string{"host": "serverA"}, Timestamp: mustParseTime("2000-01-01T00:00:00Z"), Fields: map[string]interface{}{"value": float64(10)}}})
+	s.MustWriteSeries("foo", "raw", []influxdb.Point{{Name: "cpu", Tags: map[string]string{"host": "serverA"}, Timestamp: mustParseTime("2000-01-01T00:00:10Z"), Fields: map[string]interface{}{"value": float64(20)}}})
+	s.MustWriteSeries("foo", "raw", []influxdb.Point{{Name: "cpu", Tags: map[string]string{"host": "serverB"}, Timestamp: mustParseTime("2000-01-01T00:00:00Z"), Fields: map[string]interface{}{"value": float64(30)}}})
+
+	f := func(t *testing.T, query, expected string) {
+		results := s.executeQuery(MustParseQuery(query), "foo", nil)
+		if res := results.Results[0]; expected == "" && res.Err != nil {
+			t.Errorf("%s: unexpected error: %s", query, res.Err)
+		} else if expected != "" && (res.Err == nil || res.Err.Error() != expected) {
+			t.Errorf("%s: unexpected error: exp %q, got %v", query, expected, res.Err)
+		}
+	}
+
+	s.MaxSeriesPerQuery = 1
+	f(t, `SELECT value FROM cpu`, `max series exceeded: query selects 2 series, the limit is 1. maybe you forgot a where or slimit clause?`)
+	f(t, `SELECT value FROM cpu WHERE host = 'serverA'`, ``)
+	s.MaxSeriesPerQuery = 0
+
+	s.MaxPointsScanned = 2
+	f(t, `SELECT value FROM cpu`, `max points scanned exceeded: query read more than 2 points. maybe you forgot to specify a where time clause?`)
+	f(t, `SELECT sum(value) FROM cpu WHERE host = 'serverA'`, ``)
+	s.MaxPointsScanned = 0
+
+	s.MaxGroupByBuckets = 10
+	f(t, `SELECT sum(value) FROM cpu WHERE time >= '2000-01-01T00:00:00Z' AND time < '2000-01-01T01:00:00Z' GROUP BY time(1m)`, `too many points in the group by interval. maybe you forgot to specify a where time clause?`)
+	f(t, `SELECT sum(value) FROM cpu WHERE time >= '2000-01-01T00:00:00Z' AND time < '2000-01-01T00:05:00Z' GROUP BY time(1m)`, ``)
+	s.MaxGroupByBuckets = influxql.MaxGroupByPoints
+
+	s.QueryTimeout = time.Nanosecond
+	f(t, `SELECT value FROM cpu`, `query timeout exceeded: query ran for longer than 1ns`)
+}
+
+// Ensure statements exceeding the slow query threshold are logged and written to the monitoring database.
+func TestServer_SlowQueryLog(t *testing.T) {
+	c := test.NewDefaultMessagingClient()
+	defer c.Close()
+	s := OpenServer(c)
+	defer s.Close()
+	s.CreateDatabase("foo")
+	s.CreateRetentionPolicy("foo", &influxdb.RetentionPolicy{Name: "raw", Duration: 1 * time.Hour})
+	s.SetDefaultRetentionPolicy("foo", "raw")
+	s.CreateDatabase("_internal")
+	s.CreateRetentionPolicy("_internal", &influxdb.RetentionPolicy{Name: "raw", Duration: 1 * time.Hour})
+	s.SetDefaultRetentionPolicy("_internal", "raw")
+
+	s.MustWriteSeries("foo", "raw", []influxdb.Point{{Name: "cpu", Tags: map[string]string{"host": "serverA"}, Timestamp: mustParseTime("2000-01-01T00:00:00Z"), Fields: map[string]interface{}{"value": float64(10)}}})
+	s.MustWriteSeries("foo", "raw", []influxdb.Point{{Name: "cpu", Tags: map[string]string{"host": "serverB"}, Timestamp: mustParseTime("2000-01-01T00:00:10Z"), Fields: map[string]interface{}{"value": float64(20)}}})
+
+	var buf bytes.Buffer
+	s.Logger = log.New(&buf, "", 0)
+	if err := s.StartSelfMonitoring("_internal", "raw", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	// Statements are only logged once they reach the threshold.
+	s.SlowQueryThreshold = time.Hour
+	if res := s.executeQuery(MustParseQuery(`SELECT value FROM cpu`), "foo", nil); res.Err != nil || res.Results[0].Err != nil {
+		t.Fatalf("unexpected error: %s", res.Error())
+	} else if buf.Len() != 0 {
+		t.Fatalf("unexpected log: %s", buf.String())
+	}
+
+	s.SlowQueryThreshold = time.Nanosecond
+	if res := s.executeQuery(MustParseQuery(`SELECT value FROM cpu`), "foo", nil); res.Err != nil || res.Results[0].Err != nil {
+		t.Fatalf("unexpected error: %s", res.Error())
+	} else if !strings.Contains(buf.String(), `slow query: SELECT value FROM "foo"."raw".cpu (user="" database="foo" duration=`) ||
+		!strings.Contains(buf.String(), `series=2 shards=1 points-scanned=2 remote-mappers=0)`) {
+		t.Fatalf("unexpected log: %s", buf.String())
+	}
+	s.SlowQueryThreshold = 0
+
+	// Writes are applied in order, so the slow query is written once this one is.
+	s.MustWriteSeries("_internal", "raw", []influxdb.Point{{Name: "sync", Timestamp: time.Now(), Fields: map[string]interface{}{"value": float64(1)}}})
+	res := s.executeQuery(MustParseQuery(`SELECT statement, seriesCount, shardCount, pointsScanned, remoteMappers FROM slow_queries WHERE "database" = 'foo'`), "_internal", nil)
+	if res.Err != nil || res.Results[0].Err != nil {
+		t.Fatalf("unexpected error: %s", res.Error())
+	} else if rows := res.Results[0].Series; len(rows) != 1 || len(rows[0].Values) != 1 {
+		t.Fatalf("unexpected rows: %s", mustMarshalJSON(res))
+	} else if v := rows[0].Values[0][1:]; mustMarshalJSON(v) != `["SELECT value FROM \"foo\".\"raw\".cpu",2,1,2,0]` {
+		t.Fatalf("unexpected values: %s", mustMarshalJSON(v))
+	}
+
+	// Statements failing on a limit are logged with the plan they executed.
+	buf.Reset()
+	s.SlowQueryThreshold = time.Nanosecond
+	s.MaxPointsScanned = 1
+	if res := s.executeQuery(MustParseQuery(`SELECT value FROM cpu`), "foo", nil); res.Results[0].Err == nil {
+		t.Fatal("expected error")
+	} else if !strings.Contains(buf.String(), `series=2 shards=1 points-scanned=`) || strings.Contains(buf.String(), `points-scanned=0`) {
+		t.Fatalf("unexpected log: %s", buf.String())
+	}
+	s.MaxPointsScanned = 0
+
+	// Passwords aren't logged.
+	buf.Reset()
+	if res := s.executeQuery(MustParseQuery(`CREATE USER susy WITH PASSWORD 'pass'`), "", nil); res.Err != nil || res.Results[0].Err != nil {
+		t.Fatalf("unexpected error: %s", res.Error())
+	} else if !strings.Contains(buf.String(), `slow query: CREATE USER susy`) || strings.Contains(buf.String(), `pass'`) {
+		t.Fatalf("unexpected log: %s", buf.String())
+	}
+}
+
+// Ensure stats registered by other components are returned by SHOW STATS.
+func TestServer_RegisterStats(t *testing.T) {
+	c := test.NewDefaultMessagingClient()
+	defer c.Close()
+	s := OpenServer(c)
+	defer s.Close()
+
+	st := influxdb.NewStats("httpd")
+	st.Set("rateLimited", 3)
+	s.RegisterStats(st)
+
+	results := s.executeQuery(MustParseQuery(`SHOW STATS`), "", nil)
+	if results.Error() != nil {
+		t.Fatalf("unexpected error: %s", results.Error())
+	}
+	var row *influxql.Row
+	for _, r := range results.Results[0].Series {
+		if r.Name == "httpd" {
+			row = r
+		}
+	}
+	if row == nil {
+		t.Fatal("expected httpd stats")
+	} else if s := mustMarshalJSON(row); s != `{"name":"httpd","columns":["rateLimited"],"values":[[3]]}` {
+		t.Fatalf("unexpected row: %s", s)
+	}
+}
+
+// Ensure the server reports the snapshots of a local broker with its diagnostics.
+func TestServer_RegisterDiagnostics(t *testing.T) {
+	c := test.NewDefaultMessagingClient()
+	defer c.Close()
+	s := OpenServer(c)
+	defer s.Close()
+
+	stats := raft.SnapshotStats{Index: 100, Count: 2, Size: 4096, Duration: 5 * time.Millisecond}
+	s.RegisterDiagnostics("broker_snapshot", &influxdb.SnapshotDiagnostics{Log: &SnapshotLog{stats}})
+
+	results := s.executeQuery(MustParseQuery(`SHOW DIAGNOSTICS`), "", nil)
+	if results.Error() != nil {
+		t.Fatalf("unexpected error: %s", results.Error())
+	}
+	var row *influxql.Row
+	for _, r := range results.Results[0].Series {
+		if r.Name == "broker_snapshot" {
+			row = r
+		}
+	}
+	if row == nil {
+		t.Fatal("expected broker snapshot diagnostics")
+	} else if !reflect.DeepEqual(row.Columns, []string{"time", "index", "count", "size", "duration", "installed"}) {
+		t.Fatalf("unexpected columns: %v", row.Columns)
+	} else if !reflect.DeepEqual(row.Values[0][1:], []interface{}{int64(100), 2, int64(4096), "5ms", 0}) {
+		t.Fatalf("unexpected values: %v", row.Values[0][1:])
+	}
+}
+
+// SnapshotLog is a raft log with fixed snapshot stats.
+type SnapshotLog struct {
+	stats raft.SnapshotStats
+}
+
+func (l *SnapshotLog) SnapshotStats() raft.SnapshotStats { return l.stats }
+
 func TestServer_EnforceRetentionPolices(t *testing.T) {
 	c := test.NewDefaultMessagingClient()
 	s := OpenServer(c)
@@ -1929,7 +2372,7 @@ func (s *Server) MustWriteSeries(database, retentionPolicy string, points []infl
 }
 
 func (s *Server) executeQuery(q *influxql.Query, db string, user *influxdb.User) influxdb.Response {
-	results, err := s.ExecuteQuery(q, db, user, 10000)
+	results, err := s.ExecuteQuery(q, db, nil, user, "", 10000)
 	if err != nil {
 		return influxdb.Response{Err: err}
 	}
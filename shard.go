@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"math"
 	"sync"
 	"time"
 
@@ -67,7 +68,8 @@ type Shard struct {
 	store *bolt.DB      // underlying data store
 	conn  MessagingConn // streaming connection to broker
 
-	stats *Stats // In-memory stats
+	stats *Stats      // In-memory stats
+	cache *QueryCache // query results invalidated by writes
 
 	wg      sync.WaitGroup // pending goroutines
 	closing chan struct{}  // close notification
@@ -193,13 +195,18 @@ func (s *Shard) readSeries(seriesID uint64, timestamp int64) (values []byte, err
 
 // writeSeries writes series batch to a shard.
 func (s *Shard) writeSeries(index uint64, batch []byte) error {
-	return s.store.Update(func(tx *bolt.Tx) error {
+	// Track the oldest point to invalidate cached query results after it.
+	min := int64(math.MaxInt64)
+	err := s.store.Update(func(tx *bolt.Tx) error {
 		for {
 			if pointHeaderSize > len(batch) {
 				return ErrInvalidPointBuffer
 			}
 			seriesID, payloadLength, timestamp := unmarshalPointHeader(batch[:pointHeaderSize])
 			batch = batch[pointHeaderSize:]
+			if timestamp < min {
+				min = timestamp
+			}
 
 			if payloadLength > uint32(len(batch)) {
 				return ErrInvalidPointBuffer
@@ -233,6 +240,10 @@ func (s *Shard) writeSeries(index uint64, batch []byte) error {
 
 		return nil
 	})
+	if err == nil {
+		s.cache.invalidate(s.ID, min)
+	}
+	return err
 }
 
 func (s *Shard) dropSeries(seriesIDs ...uint64) error {
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math"
 	"sort"
+	"sync/atomic"
 	"time"
 
 	"github.com/boltdb/bolt"
@@ -19,13 +20,17 @@ type tx struct {
 	// used by DecodeFields and FieldIDs. Only used in a raw query, which won't let you select from more than one measurement
 	measurement *Measurement
 	decoder     fieldDecoder
+
+	// the points read by the local mappers of the query and its deadline
+	scanned *scanCounter
 }
 
 // newTx return a new initialized Tx.
 func newTx(server *Server) *tx {
 	return &tx{
-		server: server,
-		now:    time.Now(),
+		server:  server,
+		now:     time.Now(),
+		scanned: newScanCounter(int64(server.MaxPointsScanned), server.QueryTimeout, server.QueryTimeout),
 	}
 }
 
@@ -113,12 +118,16 @@ func (tx *tx) CreateMapReduceJobs(stmt *influxql.SelectStatement, tagKeys []stri
 			return nil, nil
 		}
 
-		// get the group by interval, if there is one
-		var interval int64
-		if d, err := stmt.GroupByInterval(); err != nil {
+		// get the group by intervals, if there are any
+		window, err := stmt.GroupByWindow()
+		if err != nil {
 			return nil, err
-		} else {
-			interval = d.Nanoseconds()
+		}
+
+		// remote mappers align intervals to the same time zone by name
+		var timeZone string
+		if window.Location != nil {
+			timeZone = window.Location.String()
 		}
 
 		// get the sorted unique tag sets for this query.
@@ -157,6 +166,7 @@ func (tx *tx) CreateMapReduceJobs(stmt *influxql.SelectStatement, tagKeys []stri
 
 					mapper = &RemoteMapper{
 						dataNodes:       nodes,
+						transport:       tx.server.Transport,
 						Database:        mm.Database,
 						MeasurementName: m.Name,
 						TMin:            tmin.UnixNano(),
@@ -168,11 +178,16 @@ func (tx *tx) CreateMapReduceJobs(stmt *influxql.SelectStatement, tagKeys []stri
 						SelectTags:      selectTags,
 						Limit:           stmt.Limit,
 						Offset:          stmt.Offset,
-						Interval:        interval,
+						Interval:        window.Interval,
+						IntervalOffset:  window.Offset,
+						TimeZone:        timeZone,
+						Timeout:         tx.server.QueryTimeout,
+						scanned:         tx.scanned,
 					}
 					mapper.(*RemoteMapper).SetFilters(t.Filters)
 				} else {
 					mapper = &LocalMapper{
+						shardID:      shard.ID,
 						seriesIDs:    t.SeriesIDs,
 						db:           shard.store,
 						job:          job,
@@ -181,8 +196,10 @@ func (tx *tx) CreateMapReduceJobs(stmt *influxql.SelectStatement, tagKeys []stri
 						whereFields:  whereFields,
 						selectFields: selectFields,
 						selectTags:   selectTags,
+						seriesTags:   m.seriesTags(t.SeriesIDs, selectTags),
 						tmax:         tmax.UnixNano(),
-						interval:     interval,
+						window:       window,
+						scanned:      tx.scanned,
 						// multiple mappers may need to be merged together to get the results
 						// for a raw query. So each mapper will have to read at least the
 						// limit plus the offset in data points to ensure we've hit our mark
@@ -244,30 +261,40 @@ func (tx *tx) fieldNames(fields []*influxql.Field) []string {
 
 // LocalMapper implements the influxql.Mapper interface for running map tasks over a shard that is local to this server
 type LocalMapper struct {
-	cursorsEmpty     bool                   // boolean that lets us know if the cursors are empty
-	decoder          fieldDecoder           // decoder for the raw data bytes
-	filters          []influxql.Expr        // filters for each series
-	cursors          []*bolt.Cursor         // bolt cursors for each series id
-	seriesIDs        []uint64               // seriesIDs to be read from this shard
-	db               *bolt.DB               // bolt store for the shard accessed by this mapper
-	txn              *bolt.Tx               // read transactions by shard id
-	job              *influxql.MapReduceJob // the MRJob this mapper belongs to
-	mapFunc          influxql.MapFunc       // the map func
-	fieldID          uint8                  // the field ID associated with the mapFunc curently being run
-	fieldName        string                 // the field name associated with the mapFunc currently being run
-	keyBuffer        []int64                // the current timestamp key for each cursor
-	valueBuffer      [][]byte               // the current value for each cursor
-	tmin             int64                  // the min of the current group by interval being iterated over
-	tmax             int64                  // the max of the current group by interval being iterated over
-	additionalNames  []string               // additional field or tag names that might be requested from the map function
-	whereFields      []*Field               // field names that occur in the where clause
-	selectFields     []*Field               // field names that occur in the select clause
-	selectTags       []string               // tag keys that occur in the select clause
-	isRaw            bool                   // if the query is a non-aggregate query
-	interval         int64                  // the group by interval of the query, if any
-	limit            uint64                 // used for raw queries for LIMIT
-	perIntervalLimit int                    // used for raw queries to determine how far into a chunk we are
-	chunkSize        int                    // used for raw queries to determine how much data to read before flushing to client
+	cursorsEmpty     bool                         // boolean that lets us know if the cursors are empty
+	decoder          fieldDecoder                 // decoder for the raw data bytes
+	filters          []influxql.Expr              // filters for each series
+	cursors          []*bolt.Cursor               // bolt cursors for each series id
+	seriesIDs        []uint64                     // seriesIDs to be read from this shard
+	db               *bolt.DB                     // bolt store for the shard accessed by this mapper
+	txn              *bolt.Tx                     // read transactions by shard id
+	job              *influxql.MapReduceJob       // the MRJob this mapper belongs to
+	mapFunc          influxql.MapFunc             // the map func
+	fieldID          uint8                        // the field ID associated with the mapFunc curently being run
+	fieldName        string                       // the field name associated with the mapFunc currently being run
+	keyBuffer        []int64                      // the current timestamp key for each cursor
+	valueBuffer      [][]byte                     // the current value for each cursor
+	tmin             int64                        // the min of the current group by interval being iterated over
+	tmax             int64                        // the max of the current group by interval being iterated over
+	additionalNames  []string                     // additional field or tag names that might be requested from the map function
+	whereFields      []*Field                     // field names that occur in the where clause
+	selectFields     []*Field                     // field names that occur in the select clause
+	selectTags       []string                     // tag keys that occur in the select clause
+	seriesTags       map[uint64]map[string]string // values of the select clause tag keys for each series
+	isRaw            bool                         // if the query is a non-aggregate query
+	window           influxql.Window              // the group by intervals of the query, if any
+	limit            uint64                       // used for raw queries for LIMIT
+	perIntervalLimit int                          // used for raw queries to determine how far into a chunk we are
+	chunkSize        int                          // used for raw queries to determine how much data to read before flushing to client
+	shardID          uint64                       // the shard read by this mapper
+	pointsScanned    int                          // the number of points read from the shard, including those filtered out
+	scanned          *scanCounter                 // the points read by all mappers of the query
+	err              error                        // the error that stopped the mapper, if any
+}
+
+// Tags returns the values of the select clause tag keys for a series.
+func (l *LocalMapper) Tags(seriesID uint64) map[string]string {
+	return l.seriesTags[seriesID]
 }
 
 // Open opens the LocalMapper.
@@ -325,7 +352,12 @@ func (l *LocalMapper) Begin(c *influxql.Call, startingTime int64, chunkSize int)
 			l.limit = math.MaxUint64
 		}
 	} else {
-		lit, ok := c.Args[0].(*influxql.VarRef)
+		// count(distinct(field)) reads the field of the inner call
+		arg := c.Args[0]
+		if inner, ok := arg.(*influxql.Call); ok && len(inner.Args) > 0 {
+			arg = inner.Args[0]
+		}
+		lit, ok := arg.(*influxql.VarRef)
 		if !ok {
 			return fmt.Errorf("aggregate call didn't contain a field %s", c.String())
 		}
@@ -360,6 +392,11 @@ func (l *LocalMapper) Begin(c *influxql.Call, startingTime int64, chunkSize int)
 		t := int64(btou64(k))
 		l.keyBuffer[i] = t
 		l.valueBuffer[i] = v
+
+		l.pointsScanned++
+		if err := l.scanned.add(1); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -368,29 +405,32 @@ func (l *LocalMapper) Begin(c *influxql.Call, startingTime int64, chunkSize int)
 // forward only operation from the start time passed into Begin. Will return nil when there is no more data to be read.
 // If this is a raw query, interval should be the max time to hit in the query
 func (l *LocalMapper) NextInterval() (interface{}, error) {
-	if l.cursorsEmpty || l.tmin > l.job.TMax {
+	if l.err != nil {
+		return nil, l.err
+	} else if l.cursorsEmpty || l.tmin > l.job.TMax {
 		return nil, nil
 	}
 
 	// after we call to the mapper, this will be the tmin for the next interval.
-	nextMin := l.tmin + l.interval
+	nextMin := l.tmin + l.window.Interval
 
 	// Set the upper bound of the interval.
 	if l.isRaw {
 		l.perIntervalLimit = l.chunkSize
-	} else if l.interval > 0 {
-		// Set tmax to ensure that the interval lands on the boundary of the interval
-		if l.tmin%l.interval != 0 {
-			// the first interval in a query with a group by may be smaller than the others. This happens when they have a
-			// where time > clause that is in the middle of the bucket that the group by time creates. That will be the
-			// case on the first interval when the tmin % the interval isn't equal to zero
-			nextMin = l.tmin/l.interval*l.interval + l.interval
-		}
+	} else if l.window.Interval > 0 {
+		// Set tmax to ensure that the interval lands on the boundary of the interval.
+		// the first interval in a query with a group by may be smaller than the others. This happens when they have a
+		// where time > clause that is in the middle of the bucket that the group by time creates. Intervals may also
+		// differ in length when they're aligned to a time zone with daylight savings.
+		nextMin = l.window.Next(l.tmin)
 		l.tmax = nextMin - 1
 	}
 
 	// Execute the map function. This local mapper acts as the iterator
 	val := l.mapFunc(l)
+	if l.err != nil {
+		return nil, l.err
+	}
 
 	// see if all the cursors are empty
 	l.cursorsEmpty = true
@@ -476,6 +516,13 @@ func (l *LocalMapper) Next() (seriesID uint64, timestamp int64, value interface{
 			l.keyBuffer[min] = 0
 		} else {
 			l.keyBuffer[min] = int64(btou64(nextKey))
+
+			// points are counted as they're read from the shard, the end of a cursor isn't a point
+			l.pointsScanned++
+			if err := l.scanned.add(1); err != nil {
+				l.err = err
+				return 0, 0, nil
+			}
 		}
 		l.valueBuffer[min] = nextVal
 
@@ -511,6 +558,77 @@ func (l *LocalMapper) IsEmpty(tmax int64) bool {
 	return true
 }
 
+// deadlineCheckInterval is the number of points read by a query between checks of its deadline.
+const deadlineCheckInterval = 1000
+
+// scanCounter counts the points read by the mappers of a query so a server can limit them.
+// It also ends the query once its deadline has passed.
+//
+// The points read by remote mappers aren't added to the counter of the server running the
+// query. Instead, each remote mapper is sent the points and time left when it begins.
+type scanCounter struct {
+	n        int64         // the number of points read
+	max      int64         // the max number of points that can be read, zero for no limit
+	timeout  time.Duration // the max time the query can run for, zero for no limit
+	deadline time.Time     // the time the query times out
+}
+
+// newScanCounter returns a counter of up to max points for a query with a timeout, of which
+// remaining is left. Zero means no limit.
+func newScanCounter(max int64, timeout, remaining time.Duration) *scanCounter {
+	c := &scanCounter{max: max, timeout: timeout}
+	if remaining > 0 {
+		c.deadline = time.Now().Add(remaining)
+	}
+	return c
+}
+
+// add increments the number of points read and returns an error if the max is exceeded
+// or if the deadline has passed.
+func (c *scanCounter) add(n int) error {
+	if c == nil {
+		return nil
+	}
+	total := atomic.AddInt64(&c.n, int64(n))
+	if c.max > 0 && total > c.max {
+		return c.errMaxExceeded()
+	} else if !c.deadline.IsZero() && total%deadlineCheckInterval < int64(n) && time.Now().After(c.deadline) {
+		return c.errTimeout()
+	}
+	return nil
+}
+
+// remaining returns the points that can still be read and the time left before the deadline.
+// Zero means no limit. Returns an error if neither is left.
+func (c *scanCounter) remaining(now time.Time) (int64, time.Duration, error) {
+	if c == nil {
+		return 0, 0, nil
+	}
+
+	var points int64
+	if c.max > 0 {
+		if points = c.max - atomic.LoadInt64(&c.n); points <= 0 {
+			return 0, 0, c.errMaxExceeded()
+		}
+	}
+
+	var d time.Duration
+	if !c.deadline.IsZero() {
+		if d = c.deadline.Sub(now); d <= 0 {
+			return 0, 0, c.errTimeout()
+		}
+	}
+	return points, d, nil
+}
+
+func (c *scanCounter) errMaxExceeded() error {
+	return fmt.Errorf("max points scanned exceeded: query read more than %d points. maybe you forgot to specify a where time clause?", c.max)
+}
+
+func (c *scanCounter) errTimeout() error {
+	return fmt.Errorf("query timeout exceeded: query ran for longer than %s", c.timeout)
+}
+
 // matchesFilter returns true if the value matches the where clause
 func matchesWhere(f influxql.Expr, fields map[string]interface{}) bool {
 	if ok, _ := influxql.Eval(f, fields).(bool); !ok {